@@ -8,7 +8,6 @@ require (
 	github.com/gen2brain/malgo v0.11.23
 	github.com/go-ole/go-ole v1.2.6
 	github.com/gorilla/websocket v1.5.0
-	github.com/hegedustibor/htgo-tts v0.0.0-20230402053941-cd8d1a158135
 	github.com/moutend/go-wca v0.3.0
 	github.com/sashabaranov/go-openai v1.15.3
 	github.com/shirou/gopsutil/v3 v3.23.7
@@ -16,6 +15,8 @@ require (
 	github.com/syndtr/goleveldb v1.0.0
 	github.com/zserge/lorca v0.1.10
 	github.com/ztrue/tracerr v0.4.0
+	golang.org/x/crypto v0.7.0
+	golang.org/x/sys v0.10.0
 )
 
 require (
@@ -43,13 +44,11 @@ require (
 	github.com/tklauser/numcpus v0.6.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.3 // indirect
 	go.opencensus.io v0.24.0 // indirect
-	golang.org/x/crypto v0.7.0 // indirect
 	golang.org/x/exp v0.0.0-20190306152737-a1d7652674e8 // indirect
 	golang.org/x/image v0.0.0-20190227222117-0694c2d4d067 // indirect
 	golang.org/x/mobile v0.0.0-20190415191353-3e0bab5405d6 // indirect
 	golang.org/x/net v0.9.0 // indirect
 	golang.org/x/oauth2 v0.7.0 // indirect
-	golang.org/x/sys v0.10.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/api v0.118.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
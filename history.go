@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"kot.ai/internal/config"
+	"kot.ai/internal/history"
+)
+
+// historyUsage описывает команду kot history
+const historyUsage = `Использование:
+  kot history export [--format jsonl|csv|md|enc] [--since ВРЕМЯ] [--until ВРЕМЯ]
+                     [--query СЛОВА] [--source ИСТОЧНИК] [--type ТИП] [--output ФАЙЛ]
+  kot history import [--format jsonl|csv|enc] ФАЙЛ...
+
+Время — 2006-01-02, 2006-01-02T15:04 или RFC 3339. Без --output выгрузка
+идет в стандартный вывод, формат по умолчанию определяется по расширению
+файла или jsonl. Загрузка пропускает записи, которые уже есть в истории.
+База истории открывается только при остановленном ассистенте: из работающего
+выгружайте историю в веб-интерфейсе.
+`
+
+// runHistory выполняет kot history и возвращает код завершения
+func runHistory(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, historyUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = exportHistory(args[1:], stdout, stderr)
+	case "import":
+		err = importHistory(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, historyUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "Неизвестная команда: %s\n\n%s", args[0], historyUsage)
+		return 2
+	}
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Ошибка: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// openHistory открывает базу истории из настроек
+func openHistory() (*history.Store, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AssistantConfig.HistoryFilePath == "" {
+		return nil, fmt.Errorf("в настройках не указан history_file_path")
+	}
+	options, err := historyOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	store, err := history.Open(cfg.AssistantConfig.HistoryFilePath, options)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть историю %s (возможно, ассистент запущен): %v", cfg.AssistantConfig.HistoryFilePath, err)
+	}
+	return store, nil
+}
+
+// exportHistory выполняет kot history export
+func exportHistory(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("kot history export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "", "Формат: jsonl, csv, md или enc (зашифрованный jsonl)")
+	since := flags.String("since", "", "Записи не раньше этого времени")
+	until := flags.String("until", "", "Записи раньше этого времени")
+	query := flags.String("query", "", "Слова, которые должны встречаться в команде или ответе")
+	source := flags.String("source", "", "Источник: local, web, mobile, voice")
+	kind := flags.String("type", "", "Тип записи: имя команды или chat")
+	output := flags.String("output", "", "Файл для выгрузки; по умолчанию стандартный вывод")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	q := history.Query{Text: *query, Source: *source, Type: *kind}
+	var err error
+	if *since != "" {
+		if q.Since, err = history.ParseTime(*since); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if q.Until, err = history.ParseTime(*until); err != nil {
+			return err
+		}
+	}
+	if *format == "" {
+		*format = history.FormatFromPath(*output)
+	}
+	if *format == "" {
+		*format = history.FormatJSONL
+	}
+
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	w := stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+	count, err := store.Export(buffered, *format, q)
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "Выгружено записей: %d\n", count)
+	return nil
+}
+
+// importHistory выполняет kot history import
+func importHistory(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("kot history import", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "", "Формат: jsonl, csv или enc; по умолчанию по расширению файла")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("не указан файл для загрузки")
+	}
+
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, path := range flags.Args() {
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = history.FormatFromPath(path)
+		}
+		if fileFormat == "" {
+			return fmt.Errorf("%s: не удалось определить формат, укажите --format", path)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		result, err := store.Import(bufio.NewReader(file), fileFormat)
+		file.Close()
+		fmt.Fprintf(stdout, "%s: добавлено %d, уже были %d\n", path, result.Added, result.Skipped)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
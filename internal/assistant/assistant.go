@@ -2,8 +2,9 @@ package assistant
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,53 +12,75 @@ import (
 	"sync"
 	"time"
 
-	"github.com/sashabaranov/go-openai"
-	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/ztrue/tracerr"
 
-	"kot.ai/internal/drawing"
-	"kot.ai/internal/bank"
-	"kot.ai/internal/steam"
-	"kot.ai/internal/swift"
+	"kot.ai/internal/config"
+	"kot.ai/internal/history"
+	"kot.ai/internal/intent"
 	"kot.ai/internal/system"
+	"kot.ai/internal/tts"
 	"kot.ai/internal/voice"
+	"kot.ai/internal/weather"
 )
 
 // Assistant представляет основную логику ассистента
 type Assistant struct {
-	config       AssistantConfig
-	system       *system.SystemManager
-	voice        *voice.VoiceManager
-	openAIClient *openai.Client
-	db           *leveldb.DB
-	isRunning    bool
-	mutex        sync.Mutex
-}
-
-// AssistantConfig содержит настройки ассистента
-type AssistantConfig struct {
-	Name            string `json:"name"`
-	OpenAIAPIKey    string `json:"openai_api_key"`
-	GoogleAPIKey    string `json:"google_api_key"`
-	UseLocalModels  bool   `json:"use_local_models"`
-	LocalModelPath  string `json:"local_model_path"`
-	HistoryEnabled  bool   `json:"history_enabled"`
-	HistoryFilePath string `json:"history_file_path"`
+	config    AssistantConfig // читается через currentConfig
+	system    *system.SystemManager
+	voice     *voice.VoiceManager
+	provider  Provider
+	intents   *intent.Parser
+	weather   weather.Provider
+	sessions  *sessionStore
+	policy    *Policy
+	audit     *AuditLog
+	history   *history.Store
+	cipher    history.Cipher // шифрует историю; nil — история открытая
+	isRunning bool
+	mutex     sync.Mutex // защищает компоненты; берется раньше configMutex
+
+	configMutex sync.Mutex // защищает config при смене настроек
+
+	settingsCallback func() error
+	stateCallback    func(string) // показывает, слушает ли голосовой модуль
+	devices          DeviceManager
+	voiceCancel      context.CancelFunc // прерывает текущий голосовой ответ
 }
 
-// HistoryEntry представляет запись в истории команд
-type HistoryEntry struct {
-	Timestamp int64  `json:"timestamp"`
-	Command   string `json:"command"`
-	Response  string `json:"response"`
+// DeviceManager управляет устройствами, которым открыт доступ
+// к веб-интерфейсу. Его реализует пользовательский интерфейс.
+type DeviceManager interface {
+	// PairingCode выдает одноразовый код для подключения нового устройства
+	PairingCode() (string, time.Time, error)
+	// DeviceNames возвращает имена устройств с доступом
+	DeviceNames() []string
+	// RevokeDevice отзывает доступ устройств с этим именем и возвращает их число
+	RevokeDevice(name string) (int, error)
 }
 
+// AssistantConfig содержит настройки ассистента, см. config.AssistantConfig
+type AssistantConfig = config.AssistantConfig
+
+// HistoryEntry представляет запись в истории команд
+type HistoryEntry = history.Entry
+
+// Типы записей истории, кроме имен команд реестра
+const (
+	HistoryTypeChat         = "chat"         // ответ языковой модели
+	HistoryTypeConfirmation = "confirmation" // ответ на вопрос о подтверждении
+	HistoryTypeAppChoice    = "app_choice"   // выбор приложения из вариантов
+)
+
 // NewAssistant создает новый экземпляр Assistant
 func NewAssistant(config AssistantConfig, system *system.SystemManager, voice *voice.VoiceManager) *Assistant {
 	return &Assistant{
-		config: config,
-		system: system,
-		voice:  voice,
+		config:   config,
+		system:   system,
+		voice:    voice,
+		intents:  intent.NewParser(commandIntents()),
+		sessions: newSessionStore(),
+		policy:   NewPolicy(config.PolicyRules, config.ConfirmRisk),
+		audit:    NewAuditLog(config.AuditLogPath),
 	}
 }
 
@@ -69,45 +92,156 @@ func (a *Assistant) Start() error {
 	if a.isRunning {
 		return nil
 	}
+	config := a.currentConfig()
+
+	// Инициализация языковой модели
+	provider, err := newProvider(config)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	a.provider = provider
 
-	// Инициализация OpenAI клиента
-	if a.config.OpenAIAPIKey != "" {
-		a.openAIClient = openai.NewClient(a.config.OpenAIAPIKey)
+	// Инициализация источника погоды
+	weatherProvider, err := weather.NewProvider(config.WeatherProvider, config.WeatherURL, config.WeatherLocation)
+	if err != nil {
+		return tracerr.Wrap(err)
 	}
+	a.weather = weatherProvider
 
 	// Инициализация базы данных истории
-	if a.config.HistoryEnabled && a.config.HistoryFilePath != "" {
-		// Создаем директорию, если она не существует
-		dir := filepath.Dir(a.config.HistoryFilePath)
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return tracerr.Wrap(err)
-			}
+	store, err := a.openHistory(config)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	a.history = store
+	if store != nil {
+		// Продолжаем последние разговоры из истории
+		if err := a.restoreSessions(store); err != nil {
+			log.Printf("Ошибка восстановления разговоров: %v", err)
 		}
+	}
 
-		// Открываем базу данных
-		db, err := leveldb.OpenFile(a.config.HistoryFilePath, nil)
-		if err != nil {
-			return tracerr.Wrap(err)
-		}
-		a.db = db
+	// Каталог приложений загружается из кэша и обновляется в фоне
+	if a.system != nil {
+		a.system.SetCatalog(startCatalog(config))
 	}
 
 	// Устанавливаем обработчик голосовых команд
-	a.voice.SetCommandCallback(func(command string) {
-		response, err := a.ProcessCommand(command)
+	if a.voice != nil {
+		a.voice.SetCommandCallback(a.handleVoiceCommand)
+		a.voice.SetWakeCallback(a.cancelVoiceResponse)
+		a.voice.SetStateCallback(a.notifyVoiceState)
+	}
+
+	a.isRunning = true
+	return nil
+}
+
+// openHistory открывает базу истории или возвращает nil, если история
+// отключена. Вызывается под a.mutex.
+func (a *Assistant) openHistory(config AssistantConfig) (*history.Store, error) {
+	if !config.HistoryEnabled || config.HistoryFilePath == "" {
+		return nil, nil
+	}
+
+	// Создаем директорию, если она не существует
+	dir := filepath.Dir(config.HistoryFilePath)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+	}
+
+	// Открываем базу данных; старые записи удаляются в фоне
+	store, err := history.Open(config.HistoryFilePath, history.Options{Retention: historyRetention(config), Cipher: a.cipher})
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	return store, nil
+}
+
+// startCatalog загружает каталог приложений из кэша и запускает его
+// обновление в фоне
+func startCatalog(config AssistantConfig) *system.Catalog {
+	catalog := system.NewCatalog(config.AppCatalogPath, config.AppAliases)
+	if err := catalog.Load(); err != nil {
+		log.Printf("Ошибка загрузки каталога приложений: %v", err)
+	}
+	catalog.StartRefresh(time.Duration(config.AppCatalogRefresh) * time.Minute)
+	return catalog
+}
+
+// handleVoiceCommand обрабатывает распознанную голосовую команду. Ответ
+// произносится по предложениям, пока модель генерирует остальное.
+func (a *Assistant) handleVoiceCommand(command string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Новая команда прерывает ответ на предыдущую
+	a.mutex.Lock()
+	if a.voiceCancel != nil {
+		a.voiceCancel()
+	}
+	a.voiceCancel = cancel
+	a.mutex.Unlock()
+
+	if _, err := a.processSpoken(ctx, OriginVoice, command, nil, a.voice.Speak); err != nil && ctx.Err() == nil {
+		log.Printf("Ошибка обработки голосовой команды: %v", err)
+	}
+}
+
+// ProcessCommandSpoken обрабатывает команду, как ProcessCommandStream, и
+// синтезирует ответ по предложениям, пока модель генерирует остальное.
+// play получает звук каждого предложения, например чтобы отправить его на
+// телефон.
+func (a *Assistant) ProcessCommandSpoken(ctx context.Context, origin, command string, onDelta func(string), play func(tts.Audio) error) (string, error) {
+	if a.voice == nil {
+		return "", tracerr.New("Голосовой модуль отключен")
+	}
+	return a.processSpoken(ctx, origin, command, onDelta, func(sentence string) error {
+		audio, err := a.voice.Synthesize(ctx, sentence)
 		if err != nil {
-			log.Printf("Ошибка обработки голосовой команды: %v", err)
-			a.voice.Speak("Извините, произошла ошибка при обработке команды")
-			return
+			return err
 		}
+		return play(audio)
+	})
+}
 
-		// Произносим ответ
-		a.voice.Speak(response)
+// processSpoken выполняет команду и передает ответ по предложениям
+// функции speak. После ошибки говорит, что команда не выполнена; после
+// отмены ctx остаток ответа не произносится.
+func (a *Assistant) processSpoken(ctx context.Context, origin, command string, onDelta func(string), speak func(string) error) (string, error) {
+	speech := newSpeechQueue(ctx, speak)
+	splitter := &sentenceSplitter{}
+	response, err := a.ProcessCommandStream(ctx, origin, command, func(delta string) {
+		if onDelta != nil {
+			onDelta(delta)
+		}
+		for _, sentence := range splitter.Add(delta) {
+			speech.Say(sentence)
+		}
 	})
+	switch {
+	case ctx.Err() != nil:
+		// Ответ прерван, договаривать его не нужно
+	case err != nil:
+		speech.Say("Извините, произошла ошибка при обработке команды")
+	default:
+		speech.Say(splitter.Flush())
+	}
+	speech.Close()
+	return response, err
+}
 
-	a.isRunning = true
-	return nil
+// cancelVoiceResponse прерывает генерацию и произнесение текущего
+// голосового ответа. Вызывается, когда пользователь снова произносит
+// ключевое слово.
+func (a *Assistant) cancelVoiceResponse() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.voiceCancel != nil {
+		a.voiceCancel()
+	}
 }
 
 // Stop останавливает ассистента
@@ -120,168 +254,628 @@ func (a *Assistant) Stop() {
 	}
 
 	// Закрываем базу данных
-	if a.db != nil {
-		a.db.Close()
-		a.db = nil
+	if a.history != nil {
+		a.history.Close()
+		a.history = nil
+	}
+
+	// Останавливаем обновление каталога приложений
+	if a.system != nil {
+		if catalog := a.system.Catalog(); catalog != nil {
+			catalog.Stop()
+		}
 	}
 
 	a.isRunning = false
 }
 
-// ProcessCommand обрабатывает команду пользователя
+// Restart перезапускает ассистента: заново создает провайдер модели,
+// источник погоды и открывает базу истории
+func (a *Assistant) Restart() error {
+	a.Stop()
+	return a.Start()
+}
+
+// Настройки, от которых зависят компоненты ассистента. При их изменении
+// компонент создается заново; остальные настройки читаются при каждой
+// команде.
+var (
+	providerFields = []string{"openai_api_key", "use_local_models", "llm_provider", "llm_base_url"}
+	weatherFields  = []string{"weather_provider", "weather_url", "weather_location"}
+	historyFields  = []string{"history_enabled", "history_file_path", "history_max_age_days", "history_max_entries"}
+	catalogFields  = []string{"app_catalog_path", "app_aliases", "app_catalog_refresh"}
+)
+
+// Reconfigure применяет новые настройки без остановки ассистента. Заново
+// создаются только компоненты, настройки которых изменились: провайдер
+// модели, источник погоды, база истории и каталог приложений. Команды,
+// которые уже выполняются, заканчиваются со старыми компонентами, а
+// разговоры, ограничения источников и голосовые обработчики сохраняются.
+func (a *Assistant) Reconfigure(updated AssistantConfig) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	changed := changedFields(a.currentConfig(), updated)
+	a.configMutex.Lock()
+	a.config = updated
+	a.configMutex.Unlock()
+	a.policy.SetRules(updated.PolicyRules, updated.ConfirmRisk)
+	a.audit.SetPath(updated.AuditLogPath)
+
+	// Остановленный ассистент создаст компоненты при запуске
+	if !a.isRunning {
+		return nil
+	}
+
+	var errs []error
+	if anyChanged(changed, providerFields) {
+		if provider, err := newProvider(updated); err != nil {
+			errs = append(errs, err)
+		} else {
+			a.provider = provider
+		}
+	}
+	if anyChanged(changed, weatherFields) {
+		if source, err := weather.NewProvider(updated.WeatherProvider, updated.WeatherURL, updated.WeatherLocation); err != nil {
+			errs = append(errs, err)
+		} else {
+			a.weather = source
+		}
+	}
+	if anyChanged(changed, historyFields) {
+		// Базу нужно закрыть до открытия: LevelDB не открывается дважды
+		if a.history != nil {
+			a.history.Close()
+			a.history = nil
+		}
+		store, err := a.openHistory(updated)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		a.history = store
+	}
+	if a.system != nil && anyChanged(changed, catalogFields) {
+		if catalog := a.system.Catalog(); catalog != nil {
+			catalog.Stop()
+		}
+		a.system.SetCatalog(startCatalog(updated))
+	}
+	return tracerr.Wrap(errors.Join(errs...))
+}
+
+// changedFields возвращает имена изменившихся настроек ассистента
+func changedFields(old, updated AssistantConfig) map[string]bool {
+	changed := make(map[string]bool)
+	for _, change := range config.Diff(&config.Config{AssistantConfig: old}, &config.Config{AssistantConfig: updated}) {
+		changed[strings.TrimPrefix(change.Field, "assistant.")] = true
+	}
+	return changed
+}
+
+// anyChanged сообщает, что изменилась хотя бы одна из настроек fields
+func anyChanged(changed map[string]bool, fields []string) bool {
+	for _, field := range fields {
+		if changed[field] {
+			return true
+		}
+	}
+	return false
+}
+
+// currentConfig возвращает действующие настройки ассистента
+func (a *Assistant) currentConfig() AssistantConfig {
+	a.configMutex.Lock()
+	defer a.configMutex.Unlock()
+	return a.config
+}
+
+// currentProvider возвращает провайдер языковой модели или nil
+func (a *Assistant) currentProvider() Provider {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.provider
+}
+
+// currentWeather возвращает источник погоды или nil
+func (a *Assistant) currentWeather() weather.Provider {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.weather
+}
+
+// SetSettingsCallback устанавливает функцию, которая показывает настройки
+// пользователю. Ее вызывает команда "настройки".
+func (a *Assistant) SetSettingsCallback(callback func() error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.settingsCallback = callback
+}
+
+// SetHistoryCipher включает шифрование истории. Вызывайте до Start:
+// открытая история шифруется при открытии.
+func (a *Assistant) SetHistoryCipher(cipher history.Cipher) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.cipher = cipher
+}
+
+// SetVoiceStateCallback устанавливает функцию, которая показывает, слушает
+// ли голосовой модуль команду: voice.StateIdle, voice.StateCommand или
+// voice.StateFollowUp
+func (a *Assistant) SetVoiceStateCallback(callback func(string)) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stateCallback = callback
+}
+
+// notifyVoiceState передает состояние голосового модуля интерфейсу
+func (a *Assistant) notifyVoiceState(state string) {
+	a.mutex.Lock()
+	callback := a.stateCallback
+	a.mutex.Unlock()
+
+	if callback != nil {
+		callback(state)
+	}
+}
+
+// SetDeviceManager подключает управление устройствами веб-интерфейса
+// для команд подключения и отзыва доступа
+func (a *Assistant) SetDeviceManager(devices DeviceManager) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.devices = devices
+}
+
+// System возвращает управление компьютером или nil, если его нет
+func (a *Assistant) System() *system.SystemManager {
+	return a.system
+}
+
+// AudioDevices возвращает микрофоны и динамики голосового модуля
+func (a *Assistant) AudioDevices() (voice.AudioDevices, error) {
+	if a.voice == nil {
+		return voice.AudioDevices{}, tracerr.New("Голосовой модуль отключен")
+	}
+	return a.voice.AudioDevices()
+}
+
+// SetAudioDevice выбирает микрофон (voice.DeviceInput) или динамик
+// (voice.DeviceOutput) по имени или идентификатору
+func (a *Assistant) SetAudioDevice(kind, device string) error {
+	if a.voice == nil {
+		return tracerr.New("Голосовой модуль отключен")
+	}
+	return a.voice.SetAudioDevice(kind, device)
+}
+
+// NewVoiceStream создает поток распознавания для записи с другого
+// устройства, см. voice.VoiceManager.NewRemoteStream
+func (a *Assistant) NewVoiceStream(format string, sampleRate, channels int, onCommand, onState func(string)) (*voice.RemoteStream, error) {
+	if a.voice == nil {
+		return nil, tracerr.New("Голосовой модуль отключен")
+	}
+	return a.voice.NewRemoteStream(format, sampleRate, channels, onCommand, onState)
+}
+
+// Transcribe распознает запись из браузера тем же способом, что и речь
+// с микрофона: 16 кГц, моно, 16 бит
+func (a *Assistant) Transcribe(audio []byte) (string, error) {
+	if a.voice == nil {
+		return "", tracerr.New("Голосовой модуль отключен")
+	}
+	return a.voice.Transcribe(audio)
+}
+
+// SetRiskLimit запрещает источнику команды с риском выше limit.
+// Так ограничиваются устройства, которым разрешен только разговор.
+func (a *Assistant) SetRiskLimit(origin string, limit RiskLevel) {
+	a.policy.SetLimit(origin, limit)
+}
+
+// ClearRiskLimit снимает ограничение риска для источника
+func (a *Assistant) ClearRiskLimit(origin string) {
+	a.policy.ClearLimit(origin)
+}
+
+// ReleaseOrigin забывает источник, который больше не будет присылать
+// команды, например отключившегося клиента: снимает его ограничение риска
+// и убирает его разговор из памяти
+func (a *Assistant) ReleaseOrigin(origin string) {
+	a.policy.ClearLimit(origin)
+	a.sessions.release(origin)
+}
+
+// ProcessCommand обрабатывает команду пользователя без указания источника
 func (a *Assistant) ProcessCommand(command string) (string, error) {
+	return a.ProcessCommandFrom(OriginDefault, command)
+}
+
+// ProcessCommandFrom обрабатывает команду в рамках текущего разговора источника.
+// Источник — "voice", "web:<id>", "mobile:<id>" и т.п.
+func (a *Assistant) ProcessCommandFrom(origin, command string) (string, error) {
+	return a.ProcessCommandStream(context.Background(), origin, command, nil)
+}
+
+// ProcessCommandStream обрабатывает команду, как ProcessCommandFrom, и
+// передает ответ в onDelta по частям по мере генерации. Ответы встроенных
+// команд и моделей без потоковой генерации приходят одной частью.
+// Отмена ctx прерывает генерацию: возвращается полученная часть ответа
+// и ошибка контекста, а в историю сохраняется то, что успели сказать.
+func (a *Assistant) ProcessCommandStream(ctx context.Context, origin, command string, onDelta func(string)) (string, error) {
+	reply := func(text string) string {
+		if onDelta != nil && text != "" {
+			onDelta(text)
+		}
+		return text
+	}
+
 	command = strings.TrimSpace(command)
 	if command == "" {
-		return "Пожалуйста, укажите команду", nil
+		return reply("Пожалуйста, укажите команду"), nil
 	}
 
-	// Проверяем специальные команды
-	response, handled := a.handleSpecialCommands(command)
+	session := a.sessions.get(origin)
+
+	// Проверяем ответ на вопрос о подтверждении или уточняющий вопрос,
+	// затем специальные команды
+	kind := HistoryTypeConfirmation
+	response, handled := a.resolveConfirmation(session, command)
+	if !handled {
+		kind = HistoryTypeAppChoice
+		response, handled = a.resolveAppChoice(session, command)
+	}
+	if !handled {
+		response, kind, handled = a.handleSpecialCommands(session, command)
+	}
 	if handled {
 		// Сохраняем в историю
-		a.saveToHistory(command, response)
-		return response, nil
+		a.recordTurn(session, kind, command, response)
+		return reply(response), nil
 	}
 
 	// Обрабатываем команду с помощью AI
-	response, err := a.processWithAI(command)
+	response, streamed, err := a.processWithAI(ctx, session, command, onDelta)
 	if err != nil {
-		return "", tracerr.Wrap(err)
+		if ctx.Err() != nil && response != "" {
+			a.recordTurn(session, HistoryTypeChat, command, response)
+		}
+		return response, tracerr.Wrap(err)
 	}
 
 	// Сохраняем в историю
-	a.saveToHistory(command, response)
+	a.recordTurn(session, HistoryTypeChat, command, response)
 
+	if !streamed {
+		reply(response)
+	}
 	return response, nil
 }
 
-// handleSpecialCommands обрабатывает специальные команды
-func (a *Assistant) handleSpecialCommands(command string) (string, bool) {
-	lowerCmd := strings.ToLower(command)
+// ExecuteShell выполняет строку в командной оболочке по правилам политики.
+// Если нужно подтверждение, возвращается вопрос, а команда выполнится,
+// когда пользователь ответит "да" из того же источника.
+func (a *Assistant) ExecuteShell(origin, line string) (string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", tracerr.New("Не указана команда")
+	}
+	if a.system == nil {
+		return "", tracerr.New("Системные команды недоступны")
+	}
 
-	for _, cmd := range commandRegistry {
-		for _, keyword := range cmd.Keywords {
-			if strings.HasPrefix(lowerCmd, keyword) {
-				// Извлекаем аргументы, удаляя ключевое слово и лишние пробелы
-				argsStr := strings.TrimSpace(strings.TrimPrefix(lowerCmd, keyword))
-				var args []string
-				if argsStr != "" {
-					args = strings.Split(argsStr, " ")
-				}
-				return cmd.Handler(a, args)
-			}
+	response, _ := a.runCommand(a.sessions.get(origin), shellCommand, []string{line})
+	return response, nil
+}
+
+// NewConversation начинает новый разговор для источника
+func (a *Assistant) NewConversation(origin string) string {
+	return a.sessions.reset(origin).ID
+}
+
+// ListConversations возвращает разговоры, начиная с самого свежего
+func (a *Assistant) ListConversations() ([]ConversationSummary, error) {
+	index := newConversationIndex()
+	if store := a.historyStore(); store != nil {
+		// Записи читаются по одной, в памяти остаются только итоги разговоров
+		err := store.Each(history.Query{}, func(entry HistoryEntry) bool {
+			index.add(entry)
+			return true
+		})
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		return index.list(), nil
+	}
+
+	// История отключена — доступны только разговоры текущего запуска
+	for _, session := range a.sessions.all() {
+		for _, entry := range session.turns {
+			index.add(entry)
 		}
 	}
+	return index.list(), nil
+}
+
+// handleSpecialCommands выполняет специальную команду, если она распознана,
+// и возвращает ее имя
+func (a *Assistant) handleSpecialCommands(session *Session, command string) (string, string, bool) {
+	cmd, args, ok := a.matchCommand(command)
+	if !ok {
+		return "", "", false
+	}
+	response, handled := a.runCommand(session, cmd, args)
+	return response, cmd.Name, handled
+}
 
-	// Команда не распознана как специальная
-	return "", false
+// matchCommand распознает в фразе команду реестра и ее аргументы.
+// Совпадения с низкой уверенностью не считаются командами и
+// передаются языковой модели.
+func (a *Assistant) matchCommand(command string) (Command, []string, bool) {
+	match, ok := a.intents.Parse(command)
+	if !ok || match.Confidence < a.intentThreshold() {
+		return Command{}, nil, false
+	}
+
+	cmd, ok := findCommand(match.Intent)
+	if !ok {
+		return Command{}, nil, false
+	}
+	return cmd, cmd.slotArgs(match.Slots), true
 }
 
-// processWithAI обрабатывает команду с помощью AI
-func (a *Assistant) processWithAI(command string) (string, error) {
-	if a.openAIClient == nil {
-		return "Для обработки команд необходим API ключ OpenAI", nil
+// intentThreshold возвращает минимальную уверенность распознавания команды
+func (a *Assistant) intentThreshold() float64 {
+	threshold := a.currentConfig().IntentThreshold
+	if threshold <= 0 {
+		return intent.DefaultThreshold
 	}
+	return threshold
+}
+
+// processWithAI обрабатывает команду с помощью AI. Если задан onDelta и
+// модель умеет потоковую генерацию, текст ответа передается в onDelta по
+// частям, а streamed сообщает, что ответ уже передан.
+func (a *Assistant) processWithAI(parent context.Context, session *Session, command string, onDelta func(string)) (response string, streamed bool, err error) {
+	provider := a.currentProvider()
+	if provider == nil {
+		return "Для обработки команд необходимо настроить языковую модель или указать API ключ OpenAI", false, nil
+	}
+	config := a.currentConfig()
 
 	// Создаем контекст с таймаутом
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	ctx, cancel := context.WithTimeout(parent, llmTimeout(config))
 	defer cancel()
 
+	streamer, canStream := provider.(StreamingProvider)
+	canStream = canStream && onDelta != nil
+
 	// Формируем системное сообщение
 	systemMessage := fmt.Sprintf(
 		"Ты - %s, персональный голосовой ассистент для Windows. "+
-		"Ты можешь выполнять команды для управления компьютером, "+
-		"отвечать на вопросы и помогать пользователю. "+
-		"Отвечай кратко и по существу. "+
-		"Текущее время: %s.",
-		a.config.Name,
+			"Ты можешь выполнять команды для управления компьютером, "+
+			"отвечать на вопросы и помогать пользователю. "+
+			"Отвечай кратко и по существу. "+
+			"Текущее время: %s.",
+		config.Name,
 		time.Now().Format("15:04 02.01.2006"),
 	)
 
-	// Отправляем запрос в OpenAI API
-	resp, err := a.openAIClient.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: systemMessage,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: command,
-				},
-			},
-			Temperature: 0.7,
-		},
-	)
-	if err != nil {
-		return "", tracerr.Wrap(err)
+	messages := session.contextMessages(systemMessage, command, a.contextTurns(), a.contextTokenBudget())
+	tools := commandTools()
+
+	// Модель может вызвать команды ассистента как инструменты: выполняем
+	// вызов и возвращаем ей результат, пока она не сформулирует ответ
+	var lastResult string
+	for round := 0; round <= maxToolRounds; round++ {
+		req := CompletionRequest{
+			Model:       llmModel(config),
+			Messages:    messages,
+			Temperature: llmTemperature(config),
+		}
+		if round < maxToolRounds {
+			req.Tools = tools
+		}
+
+		var resp CompletionResponse
+		if canStream {
+			resp, err = streamer.Stream(ctx, req, func(delta string) {
+				streamed = true
+				onDelta(delta)
+			})
+		} else {
+			resp, err = provider.Complete(ctx, req)
+		}
+		if err != nil {
+			return resp.Content, streamed, tracerr.Wrap(err)
+		}
+
+		if resp.ToolCall == nil {
+			if resp.Content == "" {
+				break
+			}
+			return resp.Content, streamed, nil
+		}
+
+		// Пока выполнялась генерация, пользователь мог отменить запрос
+		if err := parent.Err(); err != nil {
+			return "", streamed, tracerr.Wrap(err)
+		}
+
+		log.Printf("Модель вызвала инструмент %s(%s)", resp.ToolCall.Name, resp.ToolCall.Arguments)
+		lastResult = a.runToolCall(session, *resp.ToolCall)
+		messages = append(messages,
+			Message{Role: RoleAssistant, ToolCall: resp.ToolCall},
+			Message{Role: RoleFunction, Name: resp.ToolCall.Name, Content: lastResult},
+		)
 	}
 
-	if len(resp.Choices) == 0 {
-		return "Извините, я не смог обработать ваш запрос", nil
+	// Модель не дала текстового ответа — сообщаем результат последней команды
+	if lastResult != "" {
+		return lastResult, streamed, nil
 	}
+	return "Извините, я не смог обработать ваш запрос", streamed, nil
+}
 
-	return resp.Choices[0].Message.Content, nil
+// contextTurns возвращает число реплик, передаваемых модели
+func (a *Assistant) contextTurns() int {
+	turns := a.currentConfig().ContextTurns
+	if turns <= 0 {
+		return defaultContextTurns
+	}
+	return turns
 }
 
-// saveToHistory сохраняет команду и ответ в историю
-func (a *Assistant) saveToHistory(command, response string) {
-	if a.db == nil || !a.config.HistoryEnabled {
-		return
+// contextTokenBudget возвращает предел размера контекста в токенах
+func (a *Assistant) contextTokenBudget() int {
+	budget := a.currentConfig().ContextTokenBudget
+	if budget <= 0 {
+		return defaultContextTokenBudget
 	}
+	return budget
+}
 
-	// Создаем запись
-	entry := HistoryEntry{
+// recordTurn добавляет реплику в разговор и сохраняет ее в историю.
+// kind — имя команды или HistoryTypeChat и другие типы записей.
+func (a *Assistant) recordTurn(session *Session, kind, command, response string) {
+	entry := a.saveToHistory(HistoryEntry{
 		Timestamp: time.Now().Unix(),
 		Command:   command,
 		Response:  response,
+		SessionID: session.ID,
+		Source:    session.Origin,
+		Type:      kind,
+	})
+
+	a.sessions.mutex.Lock()
+	session.addTurn(entry, a.contextTurns())
+	a.sessions.mutex.Unlock()
+}
+
+// historyStore возвращает открытую историю или nil, если история не
+// ведется. Stop закрывает историю под a.mutex, поэтому ее читают только
+// через эту функцию.
+func (a *Assistant) historyStore() *history.Store {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !a.currentConfig().HistoryEnabled {
+		return nil
 	}
+	return a.history
+}
 
-	// Сериализуем запись
-	data, err := json.Marshal(entry)
-	if err != nil {
-		log.Printf("Ошибка сериализации записи истории: %v", err)
-		return
+// historyRetention возвращает правила хранения истории из настроек
+func historyRetention(config AssistantConfig) history.Retention {
+	return history.Retention{
+		MaxAge:     time.Duration(max(config.HistoryMaxAgeDays, 0)) * 24 * time.Hour,
+		MaxEntries: max(config.HistoryMaxEntries, 0),
 	}
+}
 
-	// Создаем ключ на основе временной метки
-	key := fmt.Sprintf("%d", entry.Timestamp)
+// historyBackupPath возвращает каталог копий истории; по умолчанию —
+// рядом с базой истории
+func (a *Assistant) historyBackupPath() string {
+	config := a.currentConfig()
+	if config.HistoryBackupPath != "" {
+		return config.HistoryBackupPath
+	}
+	return filepath.Join(filepath.Dir(config.HistoryFilePath), "history-backups")
+}
 
-	// Сохраняем запись
-	err = a.db.Put([]byte(key), data, nil)
+// restoreSessions продолжает последний разговор каждого источника из истории
+// store. Читаются только последние записи каждого источника.
+func (a *Assistant) restoreSessions(store *history.Store) error {
+	sources, err := store.Sources()
 	if err != nil {
-		log.Printf("Ошибка сохранения записи истории: %v", err)
+		return tracerr.Wrap(err)
 	}
-}
 
-// GetHistory возвращает историю команд
-func (a *Assistant) GetHistory() ([]HistoryEntry, error) {
-	if a.db == nil || !a.config.HistoryEnabled {
-		return nil, nil
+	for _, origin := range sources {
+		// Разговоры клиентов ("web:3") живут, пока клиент подключен, а
+		// номера клиентов в новом запуске принадлежат другим соединениям
+		if strings.Contains(origin, ":") {
+			continue
+		}
+		var session *Session
+		var turns []HistoryEntry
+		err := store.Each(history.Query{Source: origin, Descending: true}, func(entry HistoryEntry) bool {
+			if session == nil {
+				if entry.SessionID == "" {
+					return false
+				}
+				session = &Session{ID: entry.SessionID, Origin: origin}
+			}
+			if entry.SessionID != session.ID {
+				return false
+			}
+			session.Started = entry.Time()
+			if len(turns) < a.contextTurns() {
+				turns = append(turns, entry)
+			}
+			return true
+		})
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		if session == nil {
+			continue
+		}
+
+		for i := len(turns) - 1; i >= 0; i-- {
+			session.addTurn(turns[i], a.contextTurns())
+		}
+		a.sessions.restore(session)
 	}
 
-	var history []HistoryEntry
+	return nil
+}
+
+// saveToHistory сохраняет запись в историю и возвращает ее с идентификатором
+func (a *Assistant) saveToHistory(entry HistoryEntry) HistoryEntry {
+	store := a.historyStore()
+	if store == nil {
+		return entry
+	}
 
-	// Итерируемся по всем записям
-	iter := a.db.NewIterator(nil, nil)
-	defer iter.Release()
+	saved, err := store.Add(entry)
+	if err != nil {
+		log.Printf("Ошибка сохранения записи истории: %v", err)
+		return entry
+	}
+	return saved
+}
 
-	for iter.Next() {
-		// Десериализуем запись
-		var entry HistoryEntry
-		if err := json.Unmarshal(iter.Value(), &entry); err != nil {
-			continue
-		}
+// ExportHistory записывает в w историю в формате format (history.FormatJSONL,
+// FormatCSV или FormatMarkdown) и возвращает число записей
+func (a *Assistant) ExportHistory(w io.Writer, format string, query history.Query) (int, error) {
+	store := a.historyStore()
+	if store == nil {
+		return 0, tracerr.New("История отключена в настройках")
+	}
+	return store.Export(w, format, query)
+}
 
-		history = append(history, entry)
+// ImportHistory добавляет в историю записи из выгрузки, пропуская те,
+// что уже есть
+func (a *Assistant) ImportHistory(r io.Reader, format string) (history.ImportResult, error) {
+	store := a.historyStore()
+	if store == nil {
+		return history.ImportResult{}, tracerr.New("История отключена в настройках")
 	}
+	return store.Import(r, format)
+}
 
-	if err := iter.Error(); err != nil {
-		return nil, tracerr.Wrap(err)
+// QueryHistory возвращает страницу истории команд. Если история
+// отключена, страница пустая.
+func (a *Assistant) QueryHistory(query history.Query) (history.Page, error) {
+	store := a.historyStore()
+	if store == nil {
+		return history.Page{}, nil
 	}
 
-	return history, nil
-}
\ No newline at end of file
+	page, err := store.Query(query)
+	if err != nil {
+		return history.Page{}, tracerr.Wrap(err)
+	}
+	return page, nil
+}
@@ -1,146 +1,519 @@
 package assistant
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"kot.ai/internal/history"
+	"kot.ai/internal/system"
+	"kot.ai/internal/voice"
+	"kot.ai/internal/weather"
 )
 
 func TestNewAssistant(t *testing.T) {
 	// Создаем конфигурацию для тестирования
 	config := AssistantConfig{
-		Name:           "TestAssistant",
-		OpenAIAPIKey:   "test-key",
-		UseLocalModels: false,
-		HistoryEnabled: true,
-		HistoryPath:    "test-history.db",
+		Name:            "TestAssistant",
+		OpenAIAPIKey:    "test-key",
+		UseLocalModels:  false,
+		HistoryEnabled:  true,
+		HistoryFilePath: filepath.Join(t.TempDir(), "history.db"),
 	}
 
 	// Создаем новый экземпляр ассистента
-	assistant, err := NewAssistant(config)
-
-	// Проверяем, что ассистент создан без ошибок
-	assert.NoError(t, err)
+	assistant := NewAssistant(config, nil, nil)
 	assert.NotNil(t, assistant)
 
 	// Проверяем, что поля ассистента инициализированы правильно
-	assert.Equal(t, config.Name, assistant.Config.Name)
-	assert.Equal(t, config.OpenAIAPIKey, assistant.Config.OpenAIAPIKey)
-	assert.Equal(t, config.UseLocalModels, assistant.Config.UseLocalModels)
-	assert.Equal(t, config.HistoryEnabled, assistant.Config.HistoryEnabled)
-	assert.Equal(t, config.HistoryPath, assistant.Config.HistoryPath)
+	assert.Equal(t, config.Name, assistant.config.Name)
+	assert.Equal(t, config.OpenAIAPIKey, assistant.config.OpenAIAPIKey)
+	assert.Equal(t, config.HistoryFilePath, assistant.config.HistoryFilePath)
 
-	// Проверяем, что канал команд создан
-	assert.NotNil(t, assistant.CommandChan)
+	// Запуск открывает историю и создает источник погоды
+	assert.NoError(t, assistant.Start())
+	assert.NotNil(t, assistant.history)
+	assert.NotNil(t, assistant.weather)
+
+	// Перезапуск заново открывает базу истории
+	assert.NoError(t, assistant.Restart())
+	assert.NotNil(t, assistant.history)
 
 	// Закрываем ассистента после теста
 	assistant.Stop()
+	assert.Nil(t, assistant.history)
 }
 
 func TestProcessCommand(t *testing.T) {
 	// Создаем конфигурацию для тестирования
 	config := AssistantConfig{
 		Name:           "TestAssistant",
-		OpenAIAPIKey:   "test-key",
-		UseLocalModels: false,
 		HistoryEnabled: false, // Отключаем историю для упрощения теста
 	}
 
-	// Создаем новый экземпляр ассистента
-	assistant, err := NewAssistant(config)
-	assert.NoError(t, err)
-	assert.NotNil(t, assistant)
+	assistant := NewAssistant(config, nil, nil)
+	provider := &FakeProvider{}
+	assistant.provider = provider
 
 	// Тестируем обработку специальной команды
-	response, isSpecial := assistant.ProcessCommand("помощь")
-	assert.True(t, isSpecial)
+	response, err := assistant.ProcessCommand("помощь")
+	assert.NoError(t, err)
 	assert.Contains(t, response, "доступные команды")
+	for _, cmd := range commandRegistry {
+		assert.Contains(t, response, strings.ToLower(cmd.Description), cmd.Name)
+	}
+	assert.Empty(t, provider.Requests)
 
-	// Тестируем обработку обычной команды
-	// Для этого теста мы не можем проверить фактический ответ от AI,
-	// поэтому просто проверяем, что команда не распознана как специальная
-	response, isSpecial = assistant.ProcessCommand("расскажи о погоде")
-	assert.False(t, isSpecial)
-
-	// Закрываем ассистента после теста
-	assistant.Stop()
+	// Обычная команда передается языковой модели
+	response, err = assistant.ProcessCommand("расскажи о погоде на Марсе")
+	assert.NoError(t, err)
+	assert.Equal(t, "эхо: расскажи о погоде на Марсе", response)
+	assert.Len(t, provider.Requests, 1)
 }
 
 func TestAddToHistory(t *testing.T) {
-	// Создаем временный файл для истории
-	tempHistoryPath := "test-history-" + time.Now().Format("20060102150405") + ".db"
-
 	// Создаем конфигурацию для тестирования
 	config := AssistantConfig{
-		Name:           "TestAssistant",
-		OpenAIAPIKey:   "test-key",
-		UseLocalModels: false,
-		HistoryEnabled: true,
-		HistoryPath:    tempHistoryPath,
+		Name:            "TestAssistant",
+		HistoryEnabled:  true,
+		HistoryFilePath: filepath.Join(t.TempDir(), "history.db"),
 	}
 
-	// Создаем новый экземпляр ассистента
-	assistant, err := NewAssistant(config)
-	assert.NoError(t, err)
-	assert.NotNil(t, assistant)
+	assistant := NewAssistant(config, nil, nil)
+	assert.NoError(t, assistant.Start())
+	defer assistant.Stop()
 
 	// Добавляем команду в историю
-	err = assistant.AddToHistory("тестовая команда", "тестовый ответ")
-	assert.NoError(t, err)
+	assistant.saveToHistory(HistoryEntry{
+		Timestamp: time.Now().Unix(),
+		Command:   "тестовая команда",
+		Response:  "тестовый ответ",
+	})
 
 	// Получаем историю
-	history, err := assistant.GetHistory(10)
+	page, err := assistant.QueryHistory(history.Query{})
 	assert.NoError(t, err)
-	assert.Len(t, history, 1)
-	assert.Equal(t, "тестовая команда", history[0].Command)
-	assert.Equal(t, "тестовый ответ", history[0].Response)
+	assert.Len(t, page.Entries, 1)
+	assert.Equal(t, "тестовая команда", page.Entries[0].Command)
+	assert.Equal(t, "тестовый ответ", page.Entries[0].Response)
 
-	// Закрываем ассистента после теста
-	assistant.Stop()
+	// Команды в одну секунду не затирают друг друга и помечены типом
+	_, err = assistant.ProcessCommand("помощь")
+	assert.NoError(t, err)
+	_, err = assistant.ProcessCommand("помощь")
+	assert.NoError(t, err)
+	page, err = assistant.QueryHistory(history.Query{Type: "help"})
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 2)
+
+	page, err = assistant.QueryHistory(history.Query{Text: "тестовый"})
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+
+	// Очистка после подтверждения удаляет все записи
+	_, err = assistant.ProcessCommand("очисти историю")
+	assert.NoError(t, err)
+	response, err := assistant.ProcessCommand("да")
+	assert.NoError(t, err)
+	page, err = assistant.QueryHistory(history.Query{Text: "тестовый"})
+	assert.NoError(t, err)
+	assert.Empty(t, page.Entries)
 
-	// Удаляем временный файл истории
-	// В реальном тесте мы бы использовали os.Remove(tempHistoryPath),
-	// но для упрощения этого теста мы пропустим этот шаг
+	// Перед очисткой сохранена копия, из которой историю можно вернуть
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(config.HistoryFilePath), "history-backups", "*.jsonl"))
+	if assert.Len(t, backups, 1) {
+		assert.Contains(t, response, backups[0])
+		file, err := os.Open(backups[0])
+		assert.NoError(t, err)
+		defer file.Close()
+		result, err := assistant.ImportHistory(file, history.FormatJSONL)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, result.Added)
+	}
+	page, err = assistant.QueryHistory(history.Query{Text: "тестовый"})
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
 }
 
-func TestIsSpecialCommand(t *testing.T) {
-	// Создаем конфигурацию для тестирования
+func TestHistoryDuringRestart(t *testing.T) {
 	config := AssistantConfig{
-		Name:           "TestAssistant",
-		OpenAIAPIKey:   "test-key",
-		UseLocalModels: false,
-		HistoryEnabled: false,
+		Name:            "TestAssistant",
+		OpenAIAPIKey:    "test-key",
+		HistoryEnabled:  true,
+		HistoryFilePath: filepath.Join(t.TempDir(), "history.db"),
 	}
+	assistant := NewAssistant(config, nil, nil)
+	assert.NoError(t, assistant.Start())
+	defer assistant.Stop()
 
-	// Создаем новый экземпляр ассистента
-	assistant, err := NewAssistant(config)
+	// Запись и чтение истории во время перезапуска не обращаются
+	// к закрытой базе
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			assistant.saveToHistory(HistoryEntry{Timestamp: time.Now().Unix(), Command: "команда"})
+			assistant.QueryHistory(history.Query{})
+			assistant.ListConversations()
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, assistant.Restart())
+	}
+	<-done
+}
+
+func TestReconfigure(t *testing.T) {
+	config := AssistantConfig{
+		Name:            "TestAssistant",
+		LLMProvider:     ProviderFake,
+		HistoryEnabled:  true,
+		HistoryFilePath: filepath.Join(t.TempDir(), "history.db"),
+		WeatherProvider: weather.ProviderNone,
+	}
+	assistant := NewAssistant(config, nil, nil)
+	assert.NoError(t, assistant.Start())
+	defer assistant.Stop()
+	_, err := assistant.ProcessCommand("помощь")
 	assert.NoError(t, err)
-	assert.NotNil(t, assistant)
+
+	// Настройки, которые читаются при каждой команде, компоненты не трогают
+	provider, store := assistant.provider, assistant.history
+	config.Name = "Кот"
+	config.LLMModel = "другая"
+	assert.NoError(t, assistant.Reconfigure(config))
+	assert.Same(t, provider, assistant.provider)
+	assert.Same(t, store, assistant.history)
+	assert.Equal(t, "Кот", assistant.currentConfig().Name)
+
+	// Новый провайдер модели — история остается открытой
+	config.LLMBaseURL = "http://localhost:9000/v1"
+	assert.NoError(t, assistant.Reconfigure(config))
+	assert.NotSame(t, provider, assistant.provider)
+	assert.Same(t, store, assistant.history)
+
+	// Новые правила хранения открывают историю заново, записи сохраняются
+	config.HistoryMaxEntries = 100
+	assert.NoError(t, assistant.Reconfigure(config))
+	assert.NotSame(t, store, assistant.history)
+	page, err := assistant.QueryHistory(history.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 1)
+
+	// Команды во время смены настроек не обращаются к закрытым компонентам
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			assistant.ProcessCommand("расскажи анекдот про кота")
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		config.HistoryMaxAgeDays = i + 1
+		assert.NoError(t, assistant.Reconfigure(config))
+	}
+	<-done
+
+	// Отключенная история закрывается
+	config.HistoryEnabled = false
+	assert.NoError(t, assistant.Reconfigure(config))
+	assert.Nil(t, assistant.history)
+}
+
+func TestIsSpecialCommand(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
 
 	// Тестируем различные специальные команды
 	tests := []struct {
 		command  string
-		expected bool
+		expected string // имя команды, пусто — не команда
 	}{
-		{"помощь", true},
-		{"Помощь", true}, // Проверка регистра
-		{"ПОМОЩЬ", true}, // Проверка регистра
-		{"настройки", true},
-		{"выключись", true},
-		{"перезапустись", true},
-		{"который час", true},
-		{"какая сегодня дата", true},
-		{"расскажи анекдот", true},
-		{"случайная команда", false},
-		{"", false},
+		{"помощь", "help"},
+		{"Помощь", "help"}, // Проверка регистра
+		{"ПОМОЩЬ", "help"}, // Проверка регистра
+		{"настройки", "settings"},
+		{"выключись", "exit"},
+		{"перезапустись", "restart"},
+		{"который час", "current_time"},
+		{"Который час?", "current_time"},
+		{"какая сегодня дата", "current_date"},
+		{"какая погода", "weather"},
+		{"какая погода в Казани", "weather"},
+		{"расскажи анекдот", "joke"},
+		{"установи громкость 50", "set_volume"},
+		{"включи звук", "unmute_volume"},
+		{"выключи звук", "mute_volume"},
+		{"случайная команда", ""},
+		{"", ""},
 	}
 
 	for _, test := range tests {
-		result := assistant.isSpecialCommand(test.command)
-		assert.Equal(t, test.expected, result, "Команда: %s", test.command)
+		cmd, _, ok := assistant.matchCommand(test.command)
+		assert.Equal(t, test.expected != "", ok, "Команда: %s", test.command)
+		assert.Equal(t, test.expected, cmd.Name, "Команда: %s", test.command)
 	}
 
-	// Закрываем ассистента после теста
-	assistant.Stop()
-}
\ No newline at end of file
+	// Аргументы извлекаются из слотов
+	_, args, _ := assistant.matchCommand("установи громкость 50")
+	assert.Equal(t, []string{"50"}, args)
+	_, args, _ = assistant.matchCommand("какая погода в Казани")
+	assert.Equal(t, []string{"Казани"}, args)
+}
+
+func TestTimeAndDate(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+
+	// Подменяем текущее время
+	now = func() time.Time { return time.Date(2024, time.March, 8, 9, 5, 0, 0, time.Local) }
+	defer func() { now = time.Now }()
+
+	response, err := assistant.ProcessCommand("который час")
+	assert.NoError(t, err)
+	assert.Equal(t, "Сейчас 09:05", response)
+
+	response, err = assistant.ProcessCommand("какое сегодня число")
+	assert.NoError(t, err)
+	assert.Equal(t, "Сегодня пятница, 8 марта 2024 года", response)
+}
+
+// fakeWeather возвращает заготовленную погоду
+type fakeWeather struct {
+	locations []string
+	err       error
+}
+
+func (w *fakeWeather) Current(ctx context.Context, location string) (weather.Report, error) {
+	w.locations = append(w.locations, location)
+	if w.err != nil {
+		return weather.Report{}, w.err
+	}
+	return weather.Report{
+		Location:    "Москва",
+		TempC:       -3,
+		FeelsLikeC:  -8,
+		Humidity:    75,
+		WindKmph:    12,
+		Description: "Небольшой снег",
+	}, nil
+}
+
+func TestWeatherCommand(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+
+	// Без источника погоды команда сообщает об отключении
+	response, err := assistant.ProcessCommand("какая погода")
+	assert.NoError(t, err)
+	assert.Equal(t, "Погода отключена в настройках", response)
+
+	source := &fakeWeather{}
+	assistant.weather = source
+
+	response, err = assistant.ProcessCommand("какая погода")
+	assert.NoError(t, err)
+	assert.Equal(t, "Москва: сейчас -3°C, небольшой снег. Ощущается как -8°C, ветер 12 км/ч, влажность 75%", response)
+
+	// Место передается, как его назвали, а не нормализованным словом
+	_, err = assistant.ProcessCommand("погода в Казани")
+	assert.NoError(t, err)
+	_, err = assistant.ProcessCommand("Какая погода в Нижнем Новгороде?")
+	assert.NoError(t, err)
+	_, err = assistant.ProcessCommand("погода в Щёлково")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "Казани", "Нижнем Новгороде", "Щёлково"}, source.locations)
+
+	source.err = errors.New("сервис недоступен")
+	response, err = assistant.ProcessCommand("какая погода")
+	assert.NoError(t, err)
+	assert.Contains(t, response, "Не удалось узнать погоду")
+}
+
+func TestSettingsAndJoke(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+
+	// Без интерфейса настроек команда подсказывает файл конфигурации
+	response, _ := assistant.ProcessCommand("настройки")
+	assert.Contains(t, response, "config.json")
+
+	opened := 0
+	assistant.SetSettingsCallback(func() error {
+		opened++
+		return nil
+	})
+	response, _ = assistant.ProcessCommand("открой настройки")
+	assert.Equal(t, "Открываю настройки", response)
+	assert.Equal(t, 1, opened)
+
+	response, _ = assistant.ProcessCommand("расскажи анекдот")
+	assert.Contains(t, jokes, response)
+}
+
+// launchBackend запоминает запущенные приложения
+type launchBackend struct {
+	launched []string
+}
+
+func (b *launchBackend) OpenApplication(name string) error {
+	return errors.New("приложение не найдено")
+}
+
+func (b *launchBackend) Launch(command []string) error {
+	b.launched = append(b.launched, strings.Join(command, " "))
+	return nil
+}
+
+func (b *launchBackend) OpenURL(url string) error             { return nil }
+func (b *launchBackend) GetVolume() (int, error)              { return 0, nil }
+func (b *launchBackend) SetVolume(level int) error            { return nil }
+func (b *launchBackend) IsMuted() (bool, error)               { return false, nil }
+func (b *launchBackend) SetMute(muted bool) error             { return nil }
+func (b *launchBackend) TakeScreenshot(filePath string) error { return nil }
+func (b *launchBackend) Close()                               {}
+
+func TestOpenApplicationClarification(t *testing.T) {
+	// Свежий кэш каталога, чтобы ассистент не сканировал систему
+	cachePath := filepath.Join(t.TempDir(), "apps.json")
+	cache := `{"updated": "` + time.Now().Format(time.RFC3339Nano) + `", "entries": [
+		{"id": "firefox", "name": "Firefox", "keywords": ["веб-браузер"], "command": ["firefox"], "source": "desktop"},
+		{"id": "google-chrome", "name": "Google Chrome", "keywords": ["веб-браузер"], "command": ["google-chrome"], "source": "desktop"},
+		{"id": "gedit", "name": "gedit", "command": ["/usr/bin/gedit"], "source": "path"}
+	]}`
+	assert.NoError(t, os.WriteFile(cachePath, []byte(cache), 0644))
+
+	backend := &launchBackend{}
+	assistant := NewAssistant(AssistantConfig{
+		Name:              "TestAssistant",
+		AppAliases:        map[string][]string{"блокнот": {"notepad", "gedit"}},
+		AppCatalogPath:    cachePath,
+		AppCatalogRefresh: 60,
+	}, system.NewSystemManagerWithBackend(backend), nil)
+	assert.NoError(t, assistant.Start())
+	defer assistant.Stop()
+
+	// Псевдоним выбирает установленное приложение
+	response, _ := assistant.ProcessCommand("открой блокнот")
+	assert.Equal(t, "Открываю блокнот", response)
+	assert.Equal(t, []string{"/usr/bin/gedit"}, backend.launched)
+
+	// Несколько вариантов: ассистент переспрашивает и принимает номер
+	response, _ = assistant.ProcessCommand("открой браузер")
+	assert.Equal(t, "Нашлось несколько приложений: Firefox, Google Chrome. Какое открыть?", response)
+	response, _ = assistant.ProcessCommand("второй")
+	assert.Equal(t, "Открываю Google Chrome", response)
+	assert.Equal(t, "google-chrome", backend.launched[1])
+
+	// Ответ названием приложения
+	assistant.ProcessCommand("открой браузер")
+	response, _ = assistant.ProcessCommand("файрфокс")
+	assert.Equal(t, "Открываю Firefox", response)
+
+	// Отказ от выбора
+	assistant.ProcessCommand("открой браузер")
+	response, _ = assistant.ProcessCommand("отмена")
+	assert.Equal(t, "Хорошо, ничего не открываю", response)
+	assert.Len(t, backend.launched, 3)
+}
+
+// volumeBackend хранит громкость и возвращает заданные ошибки чтения и записи
+type volumeBackend struct {
+	launchBackend
+	volume   int
+	getErr   error
+	setErr   error
+	setCalls int
+}
+
+func (b *volumeBackend) GetVolume() (int, error) { return b.volume, b.getErr }
+
+func (b *volumeBackend) SetVolume(level int) error {
+	b.setCalls++
+	if b.setErr != nil {
+		return b.setErr
+	}
+	b.volume = level
+	return nil
+}
+
+func TestRelativeVolume(t *testing.T) {
+	backend := &volumeBackend{volume: 50}
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, system.NewSystemManagerWithBackend(backend), nil)
+
+	response, _ := assistant.ProcessCommand("громче")
+	assert.Equal(t, "Громкость увеличена", response)
+	assert.Equal(t, 60, backend.volume)
+	response, _ = assistant.ProcessCommand("уменьши громкость на 30 процентов")
+	assert.Equal(t, "Громкость уменьшена", response)
+	assert.Equal(t, 30, backend.volume)
+
+	// Без управления звуком громкость не меняется и ассистент сообщает об ошибке
+	backend.getErr = system.ErrNotSupported
+	backend.setCalls = 0
+	response, _ = assistant.ProcessCommand("громче")
+	assert.Equal(t, "Не удалось увеличить громкость: "+system.ErrNotSupported.Error(), response)
+	response, _ = assistant.ProcessCommand("тише")
+	assert.Equal(t, "Не удалось уменьшить громкость: "+system.ErrNotSupported.Error(), response)
+	assert.Zero(t, backend.setCalls)
+	assert.Equal(t, 30, backend.volume)
+
+	// Ошибка записи тоже не выдается за успех
+	backend.getErr = nil
+	backend.setErr = system.ErrNotSupported
+	response, _ = assistant.ProcessCommand("громче")
+	assert.Equal(t, "Не удалось увеличить громкость: "+system.ErrNotSupported.Error(), response)
+}
+
+func TestAudioDeviceCommands(t *testing.T) {
+	devices := []voice.AudioDevice{
+		{ID: "01", Name: "Встроенный микрофон", Default: true},
+		{ID: "02", Name: "USB Headset"},
+		{ID: "03", Name: "USB Camera"},
+	}
+
+	// По умолчанию отмечено системное устройство, иначе — выбранное
+	assert.Equal(t, "1. Встроенный микрофон (выбран); 2. USB Headset; 3. USB Camera", formatAudioDevices(devices, ""))
+	assert.Equal(t, "1. Встроенный микрофон; 2. USB Headset; 3. USB Camera (выбран)", formatAudioDevices(devices, "03"))
+
+	// Выбор номером, порядковым числительным или частью названия
+	for choice, expected := range map[string]string{
+		"2":          "USB Headset",
+		"третий":     "USB Camera",
+		"headset":    "USB Headset",
+		"встроенный": "Встроенный микрофон",
+	} {
+		device, ok := chooseAudioDevice(devices, choice)
+		assert.True(t, ok, choice)
+		assert.Equal(t, expected, device.Name, choice)
+	}
+	for _, choice := range []string{"usb", "пятый", "колонка"} {
+		_, ok := chooseAudioDevice(devices, choice)
+		assert.False(t, ok, choice)
+	}
+
+	// Без голосового модуля команды сообщают об ошибке
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	response, _ := assistant.ProcessCommand("список микрофонов")
+	assert.Contains(t, response, "Голосовой модуль отключен")
+	_, err := assistant.Transcribe([]byte{0, 0})
+	assert.ErrorContains(t, err, "Голосовой модуль отключен")
+}
+
+func TestVoiceStateCallback(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+
+	// Без интерфейса состояние никуда не передается
+	assistant.notifyVoiceState(voice.StateCommand)
+
+	var states []string
+	assistant.SetVoiceStateCallback(func(state string) {
+		states = append(states, state)
+	})
+	assistant.notifyVoiceState(voice.StateCommand)
+	assistant.notifyVoiceState(voice.StateFollowUp)
+	assistant.notifyVoiceState(voice.StateIdle)
+	assert.Equal(t, []string{"command", "follow_up", "idle"}, states)
+}
@@ -0,0 +1,88 @@
+package assistant
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Исходы команды в журнале аудита
+const (
+	AuditAllowed   = "allowed"   // выполнена без подтверждения
+	AuditDenied    = "denied"    // запрещена правилами
+	AuditAsked     = "asked"     // ожидает подтверждения
+	AuditConfirmed = "confirmed" // пользователь подтвердил
+	AuditDeclined  = "declined"  // пользователь отказался
+	AuditExpired   = "expired"   // подтверждение не пришло вовремя
+)
+
+// AuditEntry — запись журнала аудита о решении по команде
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Origin  string    `json:"origin"`
+	Command string    `json:"command"`
+	Args    string    `json:"args,omitempty"`
+	Risk    string    `json:"risk"`
+	Outcome string    `json:"outcome"`
+}
+
+// AuditLog дописывает решения политики в файл в формате JSON Lines
+type AuditLog struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewAuditLog создает журнал аудита. Пустой путь отключает запись в файл.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// SetPath меняет файл журнала. Пустой путь отключает запись в файл.
+func (l *AuditLog) SetPath(path string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.path = path
+}
+
+// Record записывает решение по команде. Ошибки записи только логируются,
+// чтобы сбой журнала не мешал работе ассистента.
+func (l *AuditLog) Record(origin string, cmd Command, args []string, outcome string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(AuditEntry{
+		Time:    now(),
+		Origin:  origin,
+		Command: cmd.Name,
+		Args:    strings.Join(args, " "),
+		Risk:    cmd.Risk.String(),
+		Outcome: outcome,
+	})
+	if err != nil {
+		log.Printf("Ошибка записи в журнал аудита: %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		log.Printf("Ошибка записи в журнал аудита: %v", err)
+		return
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Ошибка записи в журнал аудита: %v", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("Ошибка записи в журнал аудита: %v", err)
+	}
+}
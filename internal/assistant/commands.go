@@ -1,118 +1,478 @@
 package assistant
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"kot.ai/internal/bank"
 	"kot.ai/internal/drawing"
+	"kot.ai/internal/intent"
 	"kot.ai/internal/steam"
+	"kot.ai/internal/system"
+	"kot.ai/internal/voice"
 )
 
 // CommandHandler определяет функцию-обработчик для команды
-type CommandHandler func(a *Assistant, args []string) (string, bool)
+type CommandHandler func(a *Assistant, session *Session, args []string) (string, bool)
 
-// Command представляет специальную команду
+// ConfirmFunc формирует вопрос, которым ассистент просит подтвердить
+// опасную команду. Пустая строка означает, что подтверждать нечего.
+type ConfirmFunc func(a *Assistant, session *Session, args []string) string
+
+// Command представляет специальную команду. Name, Description и Args
+// описывают команду как инструмент, который может вызвать языковая модель.
+// Keywords — образцы фраз для распознавания команды в речи пользователя.
+// Risk определяет, нужно ли подтверждение; Confirm задает вопрос для него.
 type Command struct {
-	Keywords []string
-	Handler  CommandHandler
+	Name        string
+	Description string
+	Args        []ToolArg
+	Keywords    []string
+	Risk        RiskLevel
+	Confirm     ConfirmFunc
+	Handler     CommandHandler
 }
 
 // commandRegistry содержит все зарегистрированные специальные команды
 var commandRegistry = []Command{
 	{
+		Name:        "open_application",
+		Description: "Открыть приложение на компьютере пользователя",
+		Args: []ToolArg{
+			{Name: "name", Type: "string", Description: "Название приложения, например \"браузер\" или \"калькулятор\"", Required: true, Slot: intent.SlotApp},
+		},
 		Keywords: []string{"открой", "запусти"},
 		Handler:  handleOpenApplication,
 	},
 	{
+		Name:        "increase_volume",
+		Description: "Увеличить громкость системы",
+		Args: []ToolArg{
+			{Name: "amount", Type: "integer", Description: "На сколько процентов увеличить громкость, по умолчанию 10", Slot: intent.SlotPercent},
+		},
 		Keywords: []string{"увеличь громкость", "громче"},
 		Handler:  handleIncreaseVolume,
 	},
 	{
+		Name:        "decrease_volume",
+		Description: "Уменьшить громкость системы",
+		Args: []ToolArg{
+			{Name: "amount", Type: "integer", Description: "На сколько процентов уменьшить громкость, по умолчанию 10", Slot: intent.SlotPercent},
+		},
 		Keywords: []string{"уменьши громкость", "тише"},
 		Handler:  handleDecreaseVolume,
 	},
 	{
-		Keywords: []string{"выключи звук", "без звука"},
-		Handler:  handleMuteVolume,
+		Name:        "set_volume",
+		Description: "Установить громкость системы на заданный уровень",
+		Args: []ToolArg{
+			{Name: "level", Type: "integer", Description: "Уровень громкости в процентах от 0 до 100", Required: true, Slot: intent.SlotPercent},
+		},
+		Keywords: []string{"установи громкость", "громкость"},
+		Handler:  handleSetVolume,
+	},
+	{
+		Name:        "mute_volume",
+		Description: "Выключить звук",
+		Keywords:    []string{"выключи звук", "без звука"},
+		Handler:     handleMuteVolume,
 	},
 	{
-		Keywords: []string{"скриншот", "снимок экрана"},
-		Handler:  handleScreenshot,
+		Name:        "unmute_volume",
+		Description: "Включить звук",
+		Keywords:    []string{"включи звук"},
+		Handler:     handleUnmuteVolume,
 	},
 	{
-		Keywords: []string{"информация о системе", "системная информация"},
-		Handler:  handleSystemInfo,
+		Name:        "take_screenshot",
+		Description: "Сделать снимок экрана и сохранить его в папку с изображениями",
+		Keywords:    []string{"скриншот", "снимок экрана"},
+		Handler:     handleScreenshot,
 	},
 	{
-		Keywords: []string{"список процессов", "запущенные программы"},
-		Handler:  handleProcessList,
+		Name:        "system_info",
+		Description: "Получить информацию о системе: ОС, процессор, память",
+		Keywords:    []string{"информация о системе", "системная информация"},
+		Handler:     handleSystemInfo,
 	},
 	{
+		Name:        "process_list",
+		Description: "Получить список процессов, занимающих больше всего памяти",
+		Keywords:    []string{"список процессов", "запущенные программы"},
+		Handler:     handleProcessList,
+	},
+	{
+		Name:        "kill_process",
+		Description: "Завершить процесс по имени",
+		Args: []ToolArg{
+			{Name: "name", Type: "string", Description: "Имя процесса, например \"chrome\"", Required: true, Slot: intent.SlotText},
+		},
 		Keywords: []string{"завершить процесс", "убить процесс"},
+		Risk:     RiskHigh,
+		Confirm:  confirmKillProcess,
 		Handler:  handleKillProcess,
 	},
 	{
-		Keywords: []string{"открой сайт", "открой страницу"},
+		Name:        "open_url",
+		Description: "Открыть сайт в браузере по умолчанию",
+		Args: []ToolArg{
+			{Name: "url", Type: "string", Description: "Адрес сайта, например \"google.com\"", Required: true, Slot: intent.SlotURL},
+		},
+		Keywords: []string{"открой сайт", "открой страницу", "открой", "перейди"},
 		Handler:  handleOpenURL,
 	},
 	{
-		Keywords: []string{"очистить историю", "удалить историю"},
-		Handler:  handleClearHistory,
+		Name:        "clear_history",
+		Description: "Удалить всю историю команд",
+		Keywords:    []string{"очистить историю", "удалить историю"},
+		Risk:        RiskHigh,
+		Handler:     handleClearHistory,
+	},
+	{
+		Name:        "new_conversation",
+		Description: "Начать новый разговор, забыв предыдущие реплики",
+		Keywords:    []string{"новый разговор", "новая беседа", "начнем сначала"},
+		Handler:     handleNewConversation,
+	},
+	{
+		Name:        "list_conversations",
+		Description: "Получить список прошлых разговоров",
+		Keywords:    []string{"список разговоров", "прошлые разговоры"},
+		Handler:     handleListConversations,
+	},
+	{
+		Name:        "current_time",
+		Description: "Узнать текущее время",
+		Keywords:    []string{"который час", "сколько времени"},
+		Handler:     handleTime,
+	},
+	{
+		Name:        "current_date",
+		Description: "Узнать сегодняшнюю дату и день недели",
+		Keywords:    []string{"какая сегодня дата", "какое сегодня число"},
+		Handler:     handleDate,
+	},
+	{
+		Name:        "weather",
+		Description: "Узнать текущую погоду",
+		Args: []ToolArg{
+			{Name: "location", Type: "string", Description: "Город, например \"Москва\"; по умолчанию место из настроек", Slot: intent.SlotPlace},
+		},
+		Keywords: []string{"какая погода", "погода"},
+		Handler:  handleWeather,
+	},
+	{
+		Name:        "joke",
+		Description: "Рассказать анекдот",
+		Keywords:    []string{"расскажи анекдот", "расскажи шутку", "пошути"},
+		Handler:     handleJoke,
+	},
+	{
+		Name:        "draw",
+		Description: "Нарисовать картинку и сохранить ее в папку с изображениями",
+		Keywords:    []string{"нарисуй"},
+		Handler:     handleDraw,
+	},
+	{
+		Name:        "steam_games",
+		Description: "Получить список игр пользователя в Steam",
+		Keywords:    []string{"мои игры"},
+		Handler:     handleSteamGames,
+	},
+	{
+		Name:        "bank_balance",
+		Description: "Узнать баланс банковского счета",
+		Keywords:    []string{"мой баланс"},
+		Handler:     handleBankBalance,
+	},
+	{
+		Name:        "send_money",
+		Description: "Отправить деньги",
+		Keywords:    []string{"отправь деньги"},
+		Risk:        RiskHigh,
+		Handler:     handleSendMoney,
+	},
+	{
+		Name:        "settings",
+		Description: "Открыть настройки ассистента",
+		Keywords:    []string{"настройки", "открой настройки"},
+		Handler:     handleSettings,
 	},
 	{
-		Keywords: []string{"нарисуй"},
-		Handler:  handleDraw,
+		Name:        "pair_device",
+		Description: "Выдать код для подключения нового устройства к веб-интерфейсу",
+		Keywords:    []string{"подключи устройство", "код подключения"},
+		Risk:        RiskMedium,
+		Handler:     handlePairDevice,
 	},
 	{
-		Keywords: []string{"мои игры"},
-		Handler:  handleSteamGames,
+		Name:        "list_devices",
+		Description: "Показать устройства с доступом к веб-интерфейсу",
+		Keywords:    []string{"подключенные устройства", "список устройств"},
+		Handler:     handleListDevices,
 	},
 	{
-		Keywords: []string{"мой баланс"},
-		Handler:  handleBankBalance,
+		Name:        "revoke_device",
+		Description: "Отозвать доступ устройства к веб-интерфейсу",
+		Args: []ToolArg{
+			{Name: "name", Type: "string", Description: "Имя устройства из списка устройств", Required: true, Slot: intent.SlotText},
+		},
+		Keywords: []string{"отзови доступ", "отключи устройство"},
+		Risk:     RiskHigh,
+		Handler:  handleRevokeDevice,
 	},
 	{
-		Keywords: []string{"отправь деньги"},
-		Handler:  handleSendMoney,
+		Name:        "list_microphones",
+		Description: "Показать микрофоны компьютера",
+		Keywords:    []string{"список микрофонов", "какие микрофоны"},
+		Handler:     handleListMicrophones,
 	},
 	{
-		Keywords: []string{"выход", "закрыть", "завершить работу"},
-		Handler:  handleExit,
+		Name:        "select_microphone",
+		Description: "Переключиться на другой микрофон",
+		Args: []ToolArg{
+			{Name: "name", Type: "string", Description: "Номер или название микрофона из списка микрофонов", Required: true, Slot: intent.SlotText},
+		},
+		Keywords: []string{"выбери микрофон", "переключи микрофон"},
+		Risk:     RiskMedium,
+		Handler:  handleSelectMicrophone,
 	},
+	{
+		Name:        "exit",
+		Description: "Завершить работу ассистента",
+		Keywords:    []string{"выход", "закрыть", "завершить работу", "выключись"},
+		Risk:        RiskHigh,
+		Handler:     handleExit,
+	},
+}
+
+func init() {
+	// Эти обработчики сами обращаются к реестру: справка перечисляет его
+	// команды, а перезапуск заново подключает обработку голосовых команд.
+	// Поэтому они добавляются после инициализации реестра.
+	commandRegistry = append(commandRegistry,
+		Command{
+			Name:        "restart",
+			Description: "Перезапустить ассистента",
+			Keywords:    []string{"перезапустись", "перезагрузись"},
+			Risk:        RiskMedium,
+			Handler:     handleRestart,
+		},
+		Command{
+			Name:        "help",
+			Description: "Показать список доступных команд",
+			Keywords:    []string{"помощь", "справка", "что ты умеешь", "список команд"},
+			Handler:     handleHelp,
+		},
+	)
+}
+
+// shellCommand выполняет строку в командной оболочке. Ее нет в реестре,
+// поэтому ни голосом, ни языковой моделью ее не вызвать: она доступна
+// только через ExecuteShell, например из веб-интерфейса.
+var shellCommand = Command{
+	Name:        "execute",
+	Description: "Выполнить команду в оболочке",
+	Risk:        RiskHigh,
+	Confirm:     confirmShell,
+	Handler:     handleShell,
+}
+
+// now возвращает текущее время; подменяется в тестах
+var now = time.Now
+
+// Названия месяцев в родительном падеже и дней недели для ответов
+var (
+	monthNames = [...]string{"января", "февраля", "марта", "апреля", "мая", "июня",
+		"июля", "августа", "сентября", "октября", "ноября", "декабря"}
+	weekdayNames = [...]string{"воскресенье", "понедельник", "вторник", "среда",
+		"четверг", "пятница", "суббота"}
+)
+
+// jokes содержит анекдоты для команды "расскажи анекдот"
+var jokes = []string{
+	"Программист ставит на тумбочку два стакана: один с водой — если захочет пить, другой пустой — если не захочет.",
+	"— Сколько программистов нужно, чтобы вкрутить лампочку? — Ни одного, это аппаратная проблема.",
+	"Кот — единственное существо, которое может разбудить вас в пять утра и при этом считать, что делает одолжение.",
+	"Оптимист верит, что мы живем в лучшем из миров. Пессимист боится, что так оно и есть.",
+	"— Доктор, я себя чувствую собакой. — Давно? — С тех пор, как был щенком.",
 }
 
-func handleOpenApplication(a *Assistant, args []string) (string, bool) {
+func handleOpenApplication(a *Assistant, session *Session, args []string) (string, bool) {
 	if len(args) == 0 {
 		return "Пожалуйста, укажите, что открыть", true
 	}
 	appName := strings.Join(args, " ")
 	err := a.system.OpenApplication(appName)
+	var ambiguous *system.AmbiguousAppError
+	if errors.As(err, &ambiguous) {
+		return a.askAppChoice(session, ambiguous.Candidates), true
+	}
 	if err != nil {
 		return fmt.Sprintf("Не удалось открыть %s: %v", appName, err), true
 	}
 	return fmt.Sprintf("Открываю %s", appName), true
 }
 
-func handleIncreaseVolume(a *Assistant, args []string) (string, bool) {
-	a.system.SetVolume(a.system.GetVolume() + 10)
+// askAppChoice запоминает варианты приложений и спрашивает, какое открыть
+func (a *Assistant) askAppChoice(session *Session, candidates []system.AppEntry) string {
+	a.sessions.mutex.Lock()
+	session.appChoices = candidates
+	a.sessions.mutex.Unlock()
+
+	names := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		names[i] = candidate.Name
+	}
+	return fmt.Sprintf("Нашлось несколько приложений: %s. Какое открыть?", strings.Join(names, ", "))
+}
+
+// ordinalStems сопоставляет основы порядковых числительных номерам вариантов
+var ordinalStems = map[string]int{
+	"перв":    1,
+	"втор":    2,
+	"трет":    3,
+	"четверт": 4,
+	"пят":     5,
+}
+
+// cancelStems — основы слов, которыми пользователь отказывается от выбора
+var cancelStems = map[string]bool{"отм": true, "никак": true, "нич": true}
+
+// resolveAppChoice обрабатывает ответ на вопрос, какое приложение открыть:
+// номер варианта ("второе"), название или отказ. Если ответ не похож на
+// выбор, варианты забываются, а фраза обрабатывается как обычная команда.
+func (a *Assistant) resolveAppChoice(session *Session, command string) (string, bool) {
+	a.sessions.mutex.Lock()
+	choices := session.appChoices
+	session.appChoices = nil
+	a.sessions.mutex.Unlock()
+
+	if len(choices) == 0 {
+		return "", false
+	}
+
+	var chosen []system.AppEntry
+	for _, word := range strings.Fields(intent.Normalize(command)) {
+		stem := intent.Stem(word)
+		if cancelStems[stem] {
+			return "Хорошо, ничего не открываю", true
+		}
+
+		index := ordinalStems[stem]
+		if n, err := strconv.Atoi(word); err == nil {
+			index = n
+		} else if stem == "последн" {
+			index = len(choices)
+		}
+		if index >= 1 && index <= len(choices) {
+			chosen = choices[index-1 : index]
+			break
+		}
+	}
+	if chosen == nil {
+		chosen = system.MatchApplications(choices, command)
+	}
+
+	switch {
+	case len(chosen) == 1:
+		if err := a.system.LaunchApplication(chosen[0]); err != nil {
+			return fmt.Sprintf("Не удалось открыть %s: %v", chosen[0].Name, err), true
+		}
+		return fmt.Sprintf("Открываю %s", chosen[0].Name), true
+	case len(chosen) > 1:
+		return a.askAppChoice(session, chosen), true
+	}
+	return "", false
+}
+
+func handleIncreaseVolume(a *Assistant, session *Session, args []string) (string, bool) {
+	if err := changeVolume(a, volumeStep(args)); err != nil {
+		return fmt.Sprintf("Не удалось увеличить громкость: %v", err), true
+	}
 	return "Громкость увеличена", true
 }
 
-func handleDecreaseVolume(a *Assistant, args []string) (string, bool) {
-	a.system.SetVolume(a.system.GetVolume() - 10)
+func handleDecreaseVolume(a *Assistant, session *Session, args []string) (string, bool) {
+	if err := changeVolume(a, -volumeStep(args)); err != nil {
+		return fmt.Sprintf("Не удалось уменьшить громкость: %v", err), true
+	}
 	return "Громкость уменьшена", true
 }
 
-func handleMuteVolume(a *Assistant, args []string) (string, bool) {
-	a.system.SetVolume(0)
+// changeVolume изменяет громкость относительно текущей
+func changeVolume(a *Assistant, delta int) error {
+	volume, err := a.system.GetVolume()
+	if err != nil {
+		return err
+	}
+	return a.system.SetVolume(volume + delta)
+}
+
+// volumeStep возвращает шаг изменения громкости из аргументов, по умолчанию 10%
+func volumeStep(args []string) int {
+	for _, arg := range args {
+		if step, err := strconv.Atoi(strings.TrimSuffix(arg, "%")); err == nil && step > 0 {
+			return step
+		}
+	}
+	return 10
+}
+
+func handleSetVolume(a *Assistant, session *Session, args []string) (string, bool) {
+	if len(args) == 0 {
+		return "Пожалуйста, укажите уровень громкости от 0 до 100", true
+	}
+	level, err := strconv.Atoi(strings.TrimSuffix(args[0], "%"))
+	if err != nil {
+		return fmt.Sprintf("Не понимаю уровень громкости %s", args[0]), true
+	}
+	if level < 0 {
+		level = 0
+	} else if level > 100 {
+		level = 100
+	}
+	if err := a.system.SetVolume(level); err != nil {
+		return fmt.Sprintf("Не удалось установить громкость: %v", err), true
+	}
+	return fmt.Sprintf("Громкость установлена на %d%%", level), true
+}
+
+func handleMuteVolume(a *Assistant, session *Session, args []string) (string, bool) {
+	if err := setMute(a, true); err != nil {
+		return fmt.Sprintf("Не удалось выключить звук: %v", err), true
+	}
 	return "Выключаю звук", true
 }
 
-func handleScreenshot(a *Assistant, args []string) (string, bool) {
+func handleUnmuteVolume(a *Assistant, session *Session, args []string) (string, bool) {
+	if err := setMute(a, false); err != nil {
+		return fmt.Sprintf("Не удалось включить звук: %v", err), true
+	}
+	return "Включаю звук", true
+}
+
+// setMute переключает звук, только если он еще не в нужном состоянии
+func setMute(a *Assistant, mute bool) error {
+	muted, err := a.system.IsMuted()
+	if err != nil {
+		return err
+	}
+	if muted == mute {
+		return nil
+	}
+	return a.system.ToggleMute()
+}
+
+func handleScreenshot(a *Assistant, session *Session, args []string) (string, bool) {
 	homeDir, _ := os.UserHomeDir()
 	screenshotPath := filepath.Join(homeDir, "Pictures", fmt.Sprintf("screenshot_%d.png", time.Now().Unix()))
 	err := a.system.TakeScreenshot(screenshotPath)
@@ -122,7 +482,7 @@ func handleScreenshot(a *Assistant, args []string) (string, bool) {
 	return fmt.Sprintf("Скриншот сохранен в %s", screenshotPath), true
 }
 
-func handleSystemInfo(a *Assistant, args []string) (string, bool) {
+func handleSystemInfo(a *Assistant, session *Session, args []string) (string, bool) {
 	info, err := a.system.GetSystemInfo()
 	if err != nil {
 		return fmt.Sprintf("Не удалось получить информацию о системе: %v", err), true
@@ -138,7 +498,7 @@ func handleSystemInfo(a *Assistant, args []string) (string, bool) {
 	return response, true
 }
 
-func handleProcessList(a *Assistant, args []string) (string, bool) {
+func handleProcessList(a *Assistant, session *Session, args []string) (string, bool) {
 	processes, err := a.system.GetRunningProcesses()
 	if err != nil {
 		return fmt.Sprintf("Не удалось получить список процессов: %v", err), true
@@ -157,35 +517,67 @@ func handleProcessList(a *Assistant, args []string) (string, bool) {
 	return response, true
 }
 
-func handleKillProcess(a *Assistant, args []string) (string, bool) {
+// findProcesses возвращает PID процессов с точно таким именем. Регистр и
+// расширение .exe не учитываются, чтобы "chrome" нашел и chrome.exe.
+func findProcesses(a *Assistant, name string) ([]int32, error) {
+	processes, err := a.system.GetRunningProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int32
+	for _, p := range processes {
+		processName := strings.TrimSuffix(strings.ToLower(p["name"].(string)), ".exe")
+		if processName == strings.ToLower(name) {
+			pids = append(pids, p["pid"].(int32))
+		}
+	}
+	return pids, nil
+}
+
+// confirmKillProcess спрашивает, завершать ли найденные процессы. Если
+// процессов нет, подтверждение не нужно: обработчик сообщит об этом сам.
+func confirmKillProcess(a *Assistant, session *Session, args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	processName := strings.Join(args, " ")
+	pids, err := findProcesses(a, processName)
+	if err != nil || len(pids) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Завершить процессы %s (%d шт.)? Скажите \"да\", чтобы подтвердить", processName, len(pids))
+}
+
+func handleKillProcess(a *Assistant, session *Session, args []string) (string, bool) {
 	if len(args) == 0 {
 		return "Пожалуйста, укажите имя процесса для завершения", true
 	}
 	processName := strings.Join(args, " ")
-	processes, err := a.system.GetRunningProcesses()
+	pids, err := findProcesses(a, processName)
 	if err != nil {
 		return fmt.Sprintf("Не удалось получить список процессов: %v", err), true
 	}
-	var foundPID int32
-	found := false
-	for _, p := range processes {
-		if strings.Contains(strings.ToLower(p["name"].(string)), strings.ToLower(processName)) {
-			foundPID = p["pid"].(int32)
-			found = true
-			break
-		}
-	}
-	if !found {
+	if len(pids) == 0 {
 		return fmt.Sprintf("Процесс %s не найден", processName), true
 	}
-	err = a.system.KillProcess(foundPID)
-	if err != nil {
+
+	killed := 0
+	for _, pid := range pids {
+		if err = a.system.KillProcess(pid); err == nil {
+			killed++
+		}
+	}
+	if killed == 0 {
 		return fmt.Sprintf("Не удалось завершить процесс %s: %v", processName, err), true
 	}
+	if killed < len(pids) {
+		return fmt.Sprintf("Завершено процессов %s: %d из %d", processName, killed, len(pids)), true
+	}
 	return fmt.Sprintf("Процесс %s успешно завершен", processName), true
 }
 
-func handleOpenURL(a *Assistant, args []string) (string, bool) {
+func handleOpenURL(a *Assistant, session *Session, args []string) (string, bool) {
 	if len(args) == 0 {
 		return "Пожалуйста, укажите URL для открытия", true
 	}
@@ -200,21 +592,49 @@ func handleOpenURL(a *Assistant, args []string) (string, bool) {
 	return fmt.Sprintf("Открываю %s", url), true
 }
 
-func handleClearHistory(a *Assistant, args []string) (string, bool) {
-	if a.db != nil {
-		a.db.Close()
-		os.RemoveAll(a.config.HistoryFilePath)
-		db, err := leveldb.OpenFile(a.config.HistoryFilePath, nil)
+func handleClearHistory(a *Assistant, session *Session, args []string) (string, bool) {
+	if store := a.historyStore(); store != nil {
+		// Перед очисткой история сохраняется, чтобы ее можно было вернуть
+		path, err := store.Snapshot(a.historyBackupPath())
 		if err != nil {
+			return fmt.Sprintf("Не удалось сохранить копию истории, история не очищена: %v", err), true
+		}
+		if err := store.Clear(); err != nil {
 			return fmt.Sprintf("Не удалось очистить историю: %v", err), true
 		}
-		a.db = db
+		if path != "" {
+			return fmt.Sprintf("История успешно очищена, копия сохранена в %s", path), true
+		}
 		return "История успешно очищена", true
 	}
 	return "История отключена в настройках", true
 }
 
-func handleDraw(a *Assistant, args []string) (string, bool) {
+func handleNewConversation(a *Assistant, session *Session, args []string) (string, bool) {
+	a.NewConversation(session.Origin)
+	return "Начинаю новый разговор", true
+}
+
+func handleListConversations(a *Assistant, session *Session, args []string) (string, bool) {
+	conversations, err := a.ListConversations()
+	if err != nil {
+		return fmt.Sprintf("Не удалось получить список разговоров: %v", err), true
+	}
+	if len(conversations) == 0 {
+		return "Прошлых разговоров нет", true
+	}
+	response := "Последние разговоры:\n"
+	for i, c := range conversations {
+		if i >= 10 {
+			break
+		}
+		response += fmt.Sprintf("%s (%s) - %s, реплик: %d\n",
+			c.Updated.Format("02.01.2006 15:04"), c.Origin, c.Title, c.Turns)
+	}
+	return response, true
+}
+
+func handleDraw(a *Assistant, session *Session, args []string) (string, bool) {
 	homeDir, _ := os.UserHomeDir()
 	drawingPath := filepath.Join(homeDir, "Pictures", fmt.Sprintf("drawing_%d.png", time.Now().Unix()))
 	err := drawing.Draw(drawingPath)
@@ -224,7 +644,7 @@ func handleDraw(a *Assistant, args []string) (string, bool) {
 	return fmt.Sprintf("Рисунок сохранен в %s", drawingPath), true
 }
 
-func handleSteamGames(a *Assistant, args []string) (string, bool) {
+func handleSteamGames(a *Assistant, session *Session, args []string) (string, bool) {
 	games, err := steam.GetGames()
 	if err != nil {
 		return fmt.Sprintf("Не удалось получить список игр: %v", err), true
@@ -236,7 +656,7 @@ func handleSteamGames(a *Assistant, args []string) (string, bool) {
 	return response, true
 }
 
-func handleBankBalance(a *Assistant, args []string) (string, bool) {
+func handleBankBalance(a *Assistant, session *Session, args []string) (string, bool) {
 	balance, err := bank.GetBalance()
 	if err != nil {
 		return fmt.Sprintf("Не удалось получить баланс: %v", err), true
@@ -244,14 +664,235 @@ func handleBankBalance(a *Assistant, args []string) (string, bool) {
 	return fmt.Sprintf("Ваш баланс: %.2f", balance), true
 }
 
-func handleSendMoney(a *Assistant, args []string) (string, bool) {
+func handleSendMoney(a *Assistant, session *Session, args []string) (string, bool) {
 	return "Функция отправки денег еще не реализована", true
 }
 
-func handleExit(a *Assistant, args []string) (string, bool) {
+func handleTime(a *Assistant, session *Session, args []string) (string, bool) {
+	return fmt.Sprintf("Сейчас %s", now().Format("15:04")), true
+}
+
+func handleDate(a *Assistant, session *Session, args []string) (string, bool) {
+	t := now()
+	return fmt.Sprintf("Сегодня %s, %d %s %d года",
+		weekdayNames[t.Weekday()], t.Day(), monthNames[t.Month()-1], t.Year()), true
+}
+
+func handleWeather(a *Assistant, session *Session, args []string) (string, bool) {
+	source := a.currentWeather()
+	if source == nil {
+		return "Погода отключена в настройках", true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	report, err := source.Current(ctx, strings.Join(args, " "))
+	if err != nil {
+		return fmt.Sprintf("Не удалось узнать погоду: %v", err), true
+	}
+
+	response := fmt.Sprintf("Сейчас %+.0f°C", report.TempC)
+	if report.Location != "" {
+		response = fmt.Sprintf("%s: сейчас %+.0f°C", report.Location, report.TempC)
+	}
+	if report.Description != "" {
+		response += ", " + strings.ToLower(report.Description)
+	}
+	response += fmt.Sprintf(". Ощущается как %+.0f°C, ветер %.0f км/ч, влажность %d%%",
+		report.FeelsLikeC, report.WindKmph, report.Humidity)
+	return response, true
+}
+
+func handleJoke(a *Assistant, session *Session, args []string) (string, bool) {
+	return jokes[rand.Intn(len(jokes))], true
+}
+
+func handleHelp(a *Assistant, session *Session, args []string) (string, bool) {
+	response := "Вот доступные команды:\n"
+	for _, cmd := range commandRegistry {
+		if len(cmd.Keywords) == 0 {
+			continue
+		}
+		example := []rune(cmd.Keywords[0])
+		response += fmt.Sprintf("- %s%s — %s\n",
+			strings.ToUpper(string(example[:1])), string(example[1:]), strings.ToLower(cmd.Description))
+	}
+	return response, true
+}
+
+func handleSettings(a *Assistant, session *Session, args []string) (string, bool) {
+	a.mutex.Lock()
+	callback := a.settingsCallback
+	a.mutex.Unlock()
+
+	if callback == nil {
+		return "Интерфейс настроек недоступен. Измените файл config.json и перезапустите ассистента", true
+	}
+	if err := callback(); err != nil {
+		return fmt.Sprintf("Не удалось открыть настройки: %v", err), true
+	}
+	return "Открываю настройки", true
+}
+
+// deviceManager возвращает управление устройствами или nil
+func (a *Assistant) deviceManager() DeviceManager {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.devices
+}
+
+func handlePairDevice(a *Assistant, session *Session, args []string) (string, bool) {
+	devices := a.deviceManager()
+	if devices == nil {
+		return "Веб-интерфейс не запущен", true
+	}
+	code, expires, err := devices.PairingCode()
+	if err != nil {
+		return fmt.Sprintf("Не удалось выдать код подключения: %v", err), true
+	}
+	return fmt.Sprintf("Код подключения: %s. Он действует до %s", code, expires.Format("15:04")), true
+}
+
+func handleListDevices(a *Assistant, session *Session, args []string) (string, bool) {
+	devices := a.deviceManager()
+	if devices == nil {
+		return "Веб-интерфейс не запущен", true
+	}
+	names := devices.DeviceNames()
+	if len(names) == 0 {
+		return "Подключенных устройств нет", true
+	}
+	return "Устройства с доступом: " + strings.Join(names, ", "), true
+}
+
+func handleRevokeDevice(a *Assistant, session *Session, args []string) (string, bool) {
+	devices := a.deviceManager()
+	if devices == nil {
+		return "Веб-интерфейс не запущен", true
+	}
+	if len(args) == 0 {
+		return "Пожалуйста, укажите имя устройства", true
+	}
+	name := strings.Join(args, " ")
+	revoked, err := devices.RevokeDevice(name)
+	if err != nil {
+		return fmt.Sprintf("Не удалось отозвать доступ: %v", err), true
+	}
+	if revoked == 0 {
+		return fmt.Sprintf("Устройство %s не найдено", name), true
+	}
+	return fmt.Sprintf("Доступ устройства %s отозван", name), true
+}
+
+func handleListMicrophones(a *Assistant, session *Session, args []string) (string, bool) {
+	devices, err := a.AudioDevices()
+	if err != nil {
+		return fmt.Sprintf("Не удалось получить список микрофонов: %v", err), true
+	}
+	if len(devices.Inputs) == 0 {
+		return "Микрофоны не найдены", true
+	}
+	return "Микрофоны: " + formatAudioDevices(devices.Inputs, devices.Input), true
+}
+
+func handleSelectMicrophone(a *Assistant, session *Session, args []string) (string, bool) {
+	if len(args) == 0 {
+		return "Пожалуйста, укажите номер или название микрофона", true
+	}
+	devices, err := a.AudioDevices()
+	if err != nil {
+		return fmt.Sprintf("Не удалось получить список микрофонов: %v", err), true
+	}
+	choice := strings.Join(args, " ")
+	device, ok := chooseAudioDevice(devices.Inputs, choice)
+	if !ok {
+		return fmt.Sprintf("Микрофон %s не найден", choice), true
+	}
+	if err := a.SetAudioDevice(voice.DeviceInput, device.Name); err != nil {
+		return fmt.Sprintf("Не удалось переключить микрофон: %v", err), true
+	}
+	return fmt.Sprintf("Слушаю через %s", device.Name), true
+}
+
+// formatAudioDevices перечисляет устройства с номерами и отмечает выбранное
+// в настройках или, если ничего не выбрано, устройство по умолчанию
+func formatAudioDevices(devices []voice.AudioDevice, selected string) string {
+	items := make([]string, len(devices))
+	for i, device := range devices {
+		items[i] = fmt.Sprintf("%d. %s", i+1, device.Name)
+		if isSelectedDevice(device, selected) {
+			items[i] += " (выбран)"
+		}
+	}
+	return strings.Join(items, "; ")
+}
+
+// isSelectedDevice сообщает, выбрано ли устройство в настройках
+func isSelectedDevice(device voice.AudioDevice, selected string) bool {
+	if selected == "" || strings.EqualFold(selected, "default") {
+		return device.Default
+	}
+	return strings.EqualFold(device.Name, selected) || device.ID == selected
+}
+
+// chooseAudioDevice находит устройство по номеру в списке ("2", "второй")
+// или по части названия
+func chooseAudioDevice(devices []voice.AudioDevice, choice string) (voice.AudioDevice, bool) {
+	for _, word := range strings.Fields(intent.Normalize(choice)) {
+		index := ordinalStems[intent.Stem(word)]
+		if n, err := strconv.Atoi(word); err == nil {
+			index = n
+		}
+		if index >= 1 && index <= len(devices) {
+			return devices[index-1], true
+		}
+	}
+
+	var found []voice.AudioDevice
+	needle := strings.ToLower(strings.TrimSpace(choice))
+	for _, device := range devices {
+		name := strings.ToLower(device.Name)
+		if name == needle {
+			return device, true
+		}
+		if strings.Contains(name, needle) {
+			found = append(found, device)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	return voice.AudioDevice{}, false
+}
+
+func handleRestart(a *Assistant, session *Session, args []string) (string, bool) {
+	go func() {
+		// Даем ответу сохраниться в истории до закрытия базы
+		time.Sleep(2 * time.Second)
+		if err := a.Restart(); err != nil {
+			log.Printf("Ошибка перезапуска ассистента: %v", err)
+		}
+	}()
+	return "Перезапускаюсь", true
+}
+
+func confirmShell(a *Assistant, session *Session, args []string) string {
+	return fmt.Sprintf("Выполнить в оболочке \"%s\"? Скажите \"да\", чтобы подтвердить", strings.Join(args, " "))
+}
+
+func handleShell(a *Assistant, session *Session, args []string) (string, bool) {
+	output, err := a.system.RunShell(strings.Join(args, " "))
+	if err != nil {
+		return fmt.Sprintf("Команда завершилась с ошибкой: %v\n%s", err, output), true
+	}
+	return output, true
+}
+
+func handleExit(a *Assistant, session *Session, args []string) (string, bool) {
 	go func() {
 		time.Sleep(2 * time.Second)
 		os.Exit(0)
 	}()
 	return "Завершаю работу. До свидания!", true
-}
\ No newline at end of file
+}
@@ -0,0 +1,231 @@
+package assistant
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"kot.ai/internal/config"
+	"kot.ai/internal/intent"
+)
+
+// RiskLevel определяет, насколько опасна команда
+type RiskLevel int
+
+// Уровни риска команд
+const (
+	RiskLow    RiskLevel = iota // справочные команды и безобидные действия
+	RiskMedium                  // действия, которые легко отменить: перезапуск
+	RiskHigh                    // необратимые действия: завершение процессов, оболочка, удаление истории
+)
+
+// String возвращает название уровня риска для настроек и журнала аудита
+func (r RiskLevel) String() string {
+	switch r {
+	case RiskMedium:
+		return "medium"
+	case RiskHigh:
+		return "high"
+	default:
+		return "low"
+	}
+}
+
+// parseRiskLevel разбирает уровень риска из настроек. Пустое или
+// неизвестное значение означает high.
+func parseRiskLevel(value string) RiskLevel {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "low":
+		return RiskLow
+	case "medium":
+		return RiskMedium
+	default:
+		return RiskHigh
+	}
+}
+
+// Решения политики
+const (
+	DecisionAllow   = "allow"   // выполнить сразу
+	DecisionDeny    = "deny"    // отказать
+	DecisionConfirm = "confirm" // спросить подтверждение
+)
+
+// confirmTimeout — сколько ждать подтверждения опасной команды
+const confirmTimeout = time.Minute
+
+// PolicyRule разрешает, запрещает или требует подтверждать команду.
+// Command — имя команды реестра или "*"; Origin — источник команды или
+// его начало ("web" подходит для "web:3"), пусто — любой источник.
+type PolicyRule = config.PolicyRule
+
+// ruleMatches проверяет, относится ли правило к команде из источника
+func ruleMatches(rule PolicyRule, origin, command string) bool {
+	if rule.Command != "*" && rule.Command != command {
+		return false
+	}
+	if rule.Origin == "" || rule.Origin == origin {
+		return true
+	}
+	return strings.HasPrefix(origin, rule.Origin+":")
+}
+
+// Policy решает, можно ли выполнить команду. Правила проверяются по
+// порядку, и первое подходящее определяет решение. Если правила нет,
+// подтверждения требуют команды с риском не ниже confirmRisk.
+// Для отдельных источников можно ограничить максимальный риск команд,
+// например для устройств, которым разрешен только разговор.
+type Policy struct {
+	rules       []PolicyRule
+	confirmRisk RiskLevel
+	limits      map[string]RiskLevel
+	mutex       sync.Mutex
+}
+
+// NewPolicy создает политику из правил и уровня риска, начиная с которого
+// нужно подтверждение ("low", "medium", "high")
+func NewPolicy(rules []PolicyRule, confirmRisk string) *Policy {
+	return &Policy{
+		rules:       rules,
+		confirmRisk: parseRiskLevel(confirmRisk),
+		limits:      make(map[string]RiskLevel),
+	}
+}
+
+// SetRules заменяет правила и уровень риска, начиная с которого нужно
+// подтверждение. Ограничения источников сохраняются.
+func (p *Policy) SetRules(rules []PolicyRule, confirmRisk string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.rules = rules
+	p.confirmRisk = parseRiskLevel(confirmRisk)
+}
+
+// SetLimit запрещает источнику команды с риском выше limit
+func (p *Policy) SetLimit(origin string, limit RiskLevel) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.limits[origin] = limit
+}
+
+// ClearLimit снимает ограничение риска для источника
+func (p *Policy) ClearLimit(origin string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.limits, origin)
+}
+
+// exceedsLimit проверяет, превышает ли команда ограничение источника
+func (p *Policy) exceedsLimit(origin string, risk RiskLevel) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	limit, ok := p.limits[origin]
+	return ok && risk > limit
+}
+
+// Decide возвращает решение для команды из источника
+func (p *Policy) Decide(origin, command string, risk RiskLevel) string {
+	p.mutex.Lock()
+	rules, confirmRisk := p.rules, p.confirmRisk
+	p.mutex.Unlock()
+
+	for _, rule := range rules {
+		if !ruleMatches(rule, origin, command) {
+			continue
+		}
+		switch rule.Action {
+		case DecisionAllow, DecisionDeny, DecisionConfirm:
+			return rule.Action
+		}
+	}
+
+	if risk >= confirmRisk && risk > RiskLow {
+		return DecisionConfirm
+	}
+	return DecisionAllow
+}
+
+// pendingCommand — опасная команда, ожидающая подтверждения пользователя
+type pendingCommand struct {
+	cmd     Command
+	args    []string
+	expires time.Time
+}
+
+// Слова, которыми пользователь подтверждает команду или отказывается от нее
+var (
+	confirmWords = map[string]bool{"да": true, "подтверждаю": true, "конечно": true, "давай": true, "yes": true}
+	declineWords = map[string]bool{"нет": true, "не": true, "отмена": true, "отмени": true, "стоп": true, "no": true}
+)
+
+// runCommand выполняет команду реестра с учетом политики. Запрещенная
+// команда не выполняется, а опасная откладывается до подтверждения.
+func (a *Assistant) runCommand(session *Session, cmd Command, args []string) (string, bool) {
+	if a.policy.exceedsLimit(session.Origin, cmd.Risk) {
+		a.audit.Record(session.Origin, cmd, args, AuditDenied)
+		return fmt.Sprintf("У этого устройства нет прав на команду \"%s\"", strings.ToLower(cmd.Description)), true
+	}
+
+	switch a.policy.Decide(session.Origin, cmd.Name, cmd.Risk) {
+	case DecisionDeny:
+		a.audit.Record(session.Origin, cmd, args, AuditDenied)
+		return fmt.Sprintf("Команда \"%s\" запрещена настройками", strings.ToLower(cmd.Description)), true
+
+	case DecisionConfirm:
+		question := confirmQuestion(a, session, cmd, args)
+		if question == "" {
+			break
+		}
+		a.sessions.mutex.Lock()
+		session.pending = &pendingCommand{cmd: cmd, args: args, expires: now().Add(confirmTimeout)}
+		a.sessions.mutex.Unlock()
+
+		a.audit.Record(session.Origin, cmd, args, AuditAsked)
+		return question, true
+	}
+
+	a.audit.Record(session.Origin, cmd, args, AuditAllowed)
+	return cmd.Handler(a, session, args)
+}
+
+// confirmQuestion формирует вопрос для подтверждения команды. Пустая
+// строка означает, что подтверждать нечего.
+func confirmQuestion(a *Assistant, session *Session, cmd Command, args []string) string {
+	if cmd.Confirm != nil {
+		return cmd.Confirm(a, session, args)
+	}
+	return fmt.Sprintf("%s? Скажите \"да\", чтобы подтвердить", cmd.Description)
+}
+
+// resolveConfirmation обрабатывает ответ на вопрос о подтверждении.
+// Если ответ не похож на согласие или отказ, команда отменяется, а фраза
+// обрабатывается как обычная.
+func (a *Assistant) resolveConfirmation(session *Session, command string) (string, bool) {
+	a.sessions.mutex.Lock()
+	pending := session.pending
+	session.pending = nil
+	a.sessions.mutex.Unlock()
+
+	if pending == nil {
+		return "", false
+	}
+	if now().After(pending.expires) {
+		a.audit.Record(session.Origin, pending.cmd, pending.args, AuditExpired)
+		return "", false
+	}
+
+	for _, word := range strings.Fields(intent.Normalize(command)) {
+		if declineWords[word] {
+			a.audit.Record(session.Origin, pending.cmd, pending.args, AuditDeclined)
+			return "Хорошо, отменяю", true
+		}
+		if confirmWords[word] {
+			a.audit.Record(session.Origin, pending.cmd, pending.args, AuditConfirmed)
+			return pending.cmd.Handler(a, session, pending.args)
+		}
+	}
+
+	a.audit.Record(session.Origin, pending.cmd, pending.args, AuditDeclined)
+	return "", false
+}
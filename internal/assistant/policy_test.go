@@ -0,0 +1,223 @@
+package assistant
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"kot.ai/internal/system"
+)
+
+func TestPolicyDecide(t *testing.T) {
+	policy := NewPolicy([]PolicyRule{
+		{Command: "exit", Origin: OriginVoice, Action: DecisionAllow},
+		{Command: "kill_process", Origin: OriginMobile, Action: DecisionDeny},
+		{Command: "*", Origin: "web", Action: DecisionConfirm},
+	}, "high")
+
+	tests := []struct {
+		origin  string
+		command string
+		risk    RiskLevel
+		want    string
+	}{
+		// Без правил подтверждение зависит от риска
+		{OriginDefault, "current_time", RiskLow, DecisionAllow},
+		{OriginDefault, "restart", RiskMedium, DecisionAllow},
+		{OriginDefault, "exit", RiskHigh, DecisionConfirm},
+		// Правило для источника
+		{OriginVoice, "exit", RiskHigh, DecisionAllow},
+		{"mobile:2", "kill_process", RiskHigh, DecisionDeny},
+		{OriginVoice, "kill_process", RiskHigh, DecisionConfirm},
+		// "web" подходит для всех веб-клиентов, но не для "website"
+		{"web:1", "current_time", RiskLow, DecisionConfirm},
+		{"website", "current_time", RiskLow, DecisionAllow},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.Decide(tt.origin, tt.command, tt.risk), "%s %s", tt.origin, tt.command)
+	}
+
+	// Подтверждение с уровня medium
+	policy = NewPolicy(nil, "medium")
+	assert.Equal(t, DecisionConfirm, policy.Decide(OriginDefault, "restart", RiskMedium))
+	assert.Equal(t, DecisionAllow, policy.Decide(OriginDefault, "current_time", RiskLow))
+
+	// Новые правила заменяют прежние, ограничения источников сохраняются
+	policy.SetLimit(OriginMobile, RiskLow)
+	policy.SetRules([]PolicyRule{{Command: "restart", Action: DecisionDeny}}, "high")
+	assert.Equal(t, DecisionDeny, policy.Decide(OriginDefault, "restart", RiskMedium))
+	assert.Equal(t, DecisionAllow, policy.Decide(OriginDefault, "shutdown", RiskMedium))
+	assert.True(t, policy.exceedsLimit(OriginMobile, RiskMedium))
+}
+
+func TestConfirmDangerousCommand(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	assistant := NewAssistant(AssistantConfig{
+		Name:         "TestAssistant",
+		AuditLogPath: auditPath,
+		PolicyRules: []PolicyRule{
+			{Command: "clear_history", Origin: OriginVoice, Action: DecisionDeny},
+			{Command: "clear_history", Origin: OriginMobile, Action: DecisionAllow},
+		},
+	}, nil, nil)
+	defer func() { now = time.Now }()
+
+	// Опасная команда выполняется только после подтверждения
+	response, _ := assistant.ProcessCommand("очистить историю")
+	assert.Equal(t, "Удалить всю историю команд? Скажите \"да\", чтобы подтвердить", response)
+	response, _ = assistant.ProcessCommand("да")
+	assert.Equal(t, "История отключена в настройках", response)
+
+	// Отказ
+	assistant.ProcessCommand("очистить историю")
+	response, _ = assistant.ProcessCommand("нет, не надо")
+	assert.Equal(t, "Хорошо, отменяю", response)
+
+	// Другая фраза отменяет команду и обрабатывается как обычно
+	assistant.ProcessCommand("очистить историю")
+	response, _ = assistant.ProcessCommand("расскажи анекдот")
+	assert.Contains(t, jokes, response)
+	response, _ = assistant.ProcessCommand("да")
+	assert.NotEqual(t, "История отключена в настройках", response)
+
+	// Подтверждение, пришедшее слишком поздно, не выполняет команду
+	assistant.ProcessCommand("очистить историю")
+	now = func() time.Time { return time.Now().Add(2 * confirmTimeout) }
+	response, _ = assistant.ProcessCommand("да")
+	assert.NotEqual(t, "История отключена в настройках", response)
+	now = time.Now
+
+	// Правила для источников
+	response, _ = assistant.ProcessCommandFrom(OriginVoice, "очистить историю")
+	assert.Equal(t, "Команда \"удалить всю историю команд\" запрещена настройками", response)
+	response, _ = assistant.ProcessCommandFrom("mobile:1", "очистить историю")
+	assert.Equal(t, "История отключена в настройках", response)
+
+	// Все решения записаны в журнал аудита
+	file, err := os.Open(auditPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+
+	var outcomes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		if entry.Command == "clear_history" {
+			assert.Equal(t, "high", entry.Risk)
+			outcomes = append(outcomes, entry.Origin+" "+entry.Outcome)
+		}
+	}
+	assert.Equal(t, []string{
+		"default asked", "default confirmed",
+		"default asked", "default declined",
+		"default asked", "default declined",
+		"default asked", "default expired",
+		"voice denied", "mobile:1 allowed",
+	}, outcomes)
+}
+
+func TestConfirmToolCall(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	provider := &FakeProvider{
+		ToolCalls: []ToolCall{{Name: "clear_history"}},
+		Responses: []string{"Точно удалить историю?"},
+	}
+	assistant.provider = provider
+
+	// Модель получает вопрос вместо результата и передает его пользователю
+	response, _ := assistant.ProcessCommand("удали все, что я говорил")
+	assert.Equal(t, "Точно удалить историю?", response)
+	messages := provider.Requests[1].Messages
+	assert.Contains(t, messages[len(messages)-1].Content, "Скажите \"да\"")
+
+	response, _ = assistant.ProcessCommand("да")
+	assert.Equal(t, "История отключена в настройках", response)
+}
+
+func TestExecuteShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("тест использует sh")
+	}
+
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, system.NewSystemManagerWithBackend(&launchBackend{}), nil)
+
+	response, err := assistant.ExecuteShell("web:1", "echo привет")
+	assert.NoError(t, err)
+	assert.Equal(t, "Выполнить в оболочке \"echo привет\"? Скажите \"да\", чтобы подтвердить", response)
+
+	// Подтверждение приходит обычной командой от того же клиента
+	response, _ = assistant.ProcessCommandFrom("web:2", "да")
+	assert.NotEqual(t, "привет\n", response)
+	assistant.ExecuteShell("web:1", "echo привет")
+	response, _ = assistant.ProcessCommandFrom("web:1", "да")
+	assert.Equal(t, "привет\n", response)
+
+	_, err = assistant.ExecuteShell("web:1", " ")
+	assert.Error(t, err)
+}
+
+// fakeDevices — управление устройствами для тестов
+type fakeDevices struct {
+	names []string
+}
+
+func (d *fakeDevices) PairingCode() (string, time.Time, error) {
+	return "123456", time.Date(2024, 1, 1, 12, 30, 0, 0, time.Local), nil
+}
+
+func (d *fakeDevices) DeviceNames() []string {
+	return d.names
+}
+
+func (d *fakeDevices) RevokeDevice(name string) (int, error) {
+	for i, n := range d.names {
+		if strings.EqualFold(n, name) {
+			d.names = append(d.names[:i], d.names[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestDeviceCommands(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{
+		Name:        "TestAssistant",
+		PolicyRules: []PolicyRule{{Command: "*", Action: DecisionAllow}},
+	}, nil, nil)
+
+	response, _ := assistant.ProcessCommand("список устройств")
+	assert.Equal(t, "Веб-интерфейс не запущен", response)
+
+	devices := &fakeDevices{names: []string{"Телефон", "Планшет"}}
+	assistant.SetDeviceManager(devices)
+
+	response, _ = assistant.ProcessCommand("код подключения")
+	assert.Equal(t, "Код подключения: 123456. Он действует до 12:30", response)
+	response, _ = assistant.ProcessCommand("список устройств")
+	assert.Equal(t, "Устройства с доступом: Телефон, Планшет", response)
+	response, _ = assistant.ProcessCommand("отзови доступ телефон")
+	assert.Equal(t, "Доступ устройства телефон отозван", response)
+	assert.Equal(t, []string{"Планшет"}, devices.names)
+
+	// Устройству без права system доступны только безопасные команды
+	assistant.SetRiskLimit("web:1", RiskLow)
+	response, _ = assistant.ProcessCommandFrom("web:1", "код подключения")
+	assert.Equal(t, "У этого устройства нет прав на команду \"выдать код для подключения нового устройства к веб-интерфейсу\"", response)
+	response, _ = assistant.ProcessCommandFrom("web:1", "список устройств")
+	assert.Equal(t, "Устройства с доступом: Планшет", response)
+
+	assistant.ClearRiskLimit("web:1")
+	response, _ = assistant.ProcessCommandFrom("web:1", "код подключения")
+	assert.Contains(t, response, "123456")
+}
@@ -0,0 +1,354 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/ztrue/tracerr"
+)
+
+// Поддерживаемые бэкенды языковой модели
+const (
+	ProviderOpenAI = "openai" // OpenAI API
+	ProviderLocal  = "local"  // OpenAI-совместимый сервер (llama.cpp server, Ollama, vLLM)
+	ProviderFake   = "fake"   // Детерминированная заглушка для тестов
+)
+
+// Значения по умолчанию для запросов к языковой модели
+const (
+	defaultLLMModel       = openai.GPT3Dot5Turbo
+	defaultLocalBaseURL   = "http://localhost:8080/v1"
+	defaultLLMTemperature = 0.7
+	defaultLLMTimeout     = 30 // секунд
+)
+
+// Роли сообщений в диалоге с моделью
+const (
+	RoleSystem    = openai.ChatMessageRoleSystem
+	RoleUser      = openai.ChatMessageRoleUser
+	RoleAssistant = openai.ChatMessageRoleAssistant
+	RoleFunction  = openai.ChatMessageRoleFunction
+)
+
+// Message представляет одно сообщение в запросе к модели
+type Message struct {
+	Role     string    `json:"role"`
+	Content  string    `json:"content"`
+	Name     string    `json:"name,omitempty"`          // имя инструмента для сообщений с его результатом
+	ToolCall *ToolCall `json:"function_call,omitempty"` // вызов инструмента в сообщении ассистента
+}
+
+// CompletionRequest содержит параметры запроса к модели
+type CompletionRequest struct {
+	Model       string
+	Messages    []Message
+	Temperature float32
+	Tools       []Tool
+}
+
+// CompletionResponse содержит ответ модели: текст или вызов инструмента
+type CompletionResponse struct {
+	Content  string
+	ToolCall *ToolCall
+}
+
+// Provider определяет бэкенд языковой модели
+type Provider interface {
+	// Name возвращает имя бэкенда для логов и сообщений об ошибках
+	Name() string
+	// Complete отправляет запрос и возвращает ответ модели
+	Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error)
+}
+
+// StreamingProvider — бэкенд, который умеет отдавать ответ по частям
+type StreamingProvider interface {
+	Provider
+	// Stream отправляет запрос и передает текст ответа в onDelta по мере
+	// генерации. Возвращает весь ответ, как Complete; при отмене ctx —
+	// полученную часть и ошибку контекста.
+	Stream(ctx context.Context, req CompletionRequest, onDelta func(string)) (CompletionResponse, error)
+}
+
+// newProvider создает провайдер в соответствии с настройками ассистента.
+// Возвращает nil без ошибки, если модель не настроена (например, нет API ключа).
+func newProvider(config AssistantConfig) (Provider, error) {
+	switch providerName(config) {
+	case ProviderOpenAI:
+		if config.OpenAIAPIKey == "" {
+			return nil, nil
+		}
+		clientConfig := openai.DefaultConfig(config.OpenAIAPIKey)
+		if config.LLMBaseURL != "" {
+			clientConfig.BaseURL = config.LLMBaseURL
+		}
+		return NewOpenAIProvider(ProviderOpenAI, clientConfig), nil
+	case ProviderLocal:
+		baseURL := config.LLMBaseURL
+		if baseURL == "" {
+			baseURL = defaultLocalBaseURL
+		}
+		// Локальным серверам ключ обычно не нужен, но если он указан — передаем его
+		clientConfig := openai.DefaultConfig(config.OpenAIAPIKey)
+		clientConfig.BaseURL = baseURL
+		return NewOpenAIProvider(ProviderLocal, clientConfig), nil
+	case ProviderFake:
+		return &FakeProvider{}, nil
+	default:
+		return nil, tracerr.New(fmt.Sprintf("Неизвестный провайдер языковой модели: %s", config.LLMProvider))
+	}
+}
+
+// providerName определяет бэкенд с учетом устаревшего флага use_local_models
+func providerName(config AssistantConfig) string {
+	if config.LLMProvider != "" {
+		return config.LLMProvider
+	}
+	if config.UseLocalModels {
+		return ProviderLocal
+	}
+	return ProviderOpenAI
+}
+
+// llmModel возвращает имя модели для запросов. Для локального бэкенда
+// без явно заданной модели используется local_model_path: llama.cpp server
+// игнорирует это поле, а Ollama и vLLM ожидают в нем имя загруженной модели.
+func llmModel(config AssistantConfig) string {
+	if config.LLMModel != "" {
+		return config.LLMModel
+	}
+	if providerName(config) == ProviderLocal && config.LocalModelPath != "" {
+		return config.LocalModelPath
+	}
+	return defaultLLMModel
+}
+
+// llmTemperature возвращает температуру генерации; без настройки —
+// значение по умолчанию
+func llmTemperature(config AssistantConfig) float32 {
+	if config.LLMTemperature == nil {
+		return defaultLLMTemperature
+	}
+	return *config.LLMTemperature
+}
+
+// llmTimeout возвращает таймаут одного запроса к модели
+func llmTimeout(config AssistantConfig) time.Duration {
+	if config.LLMTimeout <= 0 {
+		return defaultLLMTimeout * time.Second
+	}
+	return time.Duration(config.LLMTimeout) * time.Second
+}
+
+// OpenAIProvider обращается к OpenAI API или к любому OpenAI-совместимому серверу
+type OpenAIProvider struct {
+	name   string
+	client *openai.Client
+}
+
+// NewOpenAIProvider создает провайдер для указанной конфигурации клиента
+func NewOpenAIProvider(name string, clientConfig openai.ClientConfig) *OpenAIProvider {
+	return &OpenAIProvider{
+		name:   name,
+		client: openai.NewClientWithConfig(clientConfig),
+	}
+}
+
+// Name возвращает имя бэкенда
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+// chatRequest преобразует запрос в формат go-openai
+func (p *OpenAIProvider) chatRequest(req CompletionRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		message := openai.ChatCompletionMessage{
+			Role:    m.Role,
+			Content: m.Content,
+			Name:    m.Name,
+		}
+		if m.ToolCall != nil {
+			message.FunctionCall = &openai.FunctionCall{
+				Name:      m.ToolCall.Name,
+				Arguments: m.ToolCall.Arguments,
+			}
+		}
+		messages = append(messages, message)
+	}
+
+	// Инструменты передаются через function calling, который поддерживают
+	// и OpenAI, и большинство совместимых локальных серверов
+	functions := make([]openai.FunctionDefinition, 0, len(req.Tools))
+	for _, tool := range req.Tools {
+		functions = append(functions, openai.FunctionDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.Parameters,
+		})
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Temperature: requestTemperature(req.Temperature),
+		Functions:   functions,
+	}
+}
+
+// requestTemperature возвращает температуру для запроса. Нулевую
+// температуру go-openai не передает, и сервер подставил бы свою, поэтому
+// вместо нуля отправляется наименьшее положительное число.
+func requestTemperature(temperature float32) float32 {
+	if temperature == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return temperature
+}
+
+// Complete отправляет запрос к /chat/completions
+func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(req))
+	if err != nil {
+		return CompletionResponse{}, tracerr.Wrap(err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return CompletionResponse{}, nil
+	}
+
+	message := resp.Choices[0].Message
+	result := CompletionResponse{Content: message.Content}
+	if message.FunctionCall != nil && message.FunctionCall.Name != "" {
+		result.ToolCall = &ToolCall{
+			Name:      message.FunctionCall.Name,
+			Arguments: message.FunctionCall.Arguments,
+		}
+	}
+
+	return result, nil
+}
+
+// Stream отправляет запрос к /chat/completions с stream: true. Вызов
+// инструмента приходит по частям и собирается целиком.
+func (p *OpenAIProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string)) (CompletionResponse, error) {
+	chatReq := p.chatRequest(req)
+	chatReq.Stream = true
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, chatReq)
+	if err != nil {
+		return CompletionResponse{}, tracerr.Wrap(err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var call ToolCall
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return CompletionResponse{Content: content.String()}, tracerr.Wrap(err)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		delta := resp.Choices[0].Delta
+		if delta.FunctionCall != nil {
+			call.Name += delta.FunctionCall.Name
+			call.Arguments += delta.FunctionCall.Arguments
+		}
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+	}
+
+	result := CompletionResponse{Content: content.String()}
+	if call.Name != "" {
+		result.ToolCall = &call
+	}
+	return result, nil
+}
+
+// FakeProvider — детерминированный провайдер для тестов. Сначала по одному
+// на запрос возвращает вызовы инструментов из ToolCalls, затем ответы из
+// Responses, а когда они заканчиваются — повторяет последнее сообщение
+// пользователя с префиксом "эхо: ". Все запросы сохраняются в Requests.
+// В потоковом режиме ответ отдается по словам, а OnDelta вызывается после
+// каждого слова — тесты могут отменить генерацию посередине.
+type FakeProvider struct {
+	ToolCalls []ToolCall
+	Responses []string
+	Err       error
+	Requests  []CompletionRequest
+	OnDelta   func(string)
+	mutex     sync.Mutex
+}
+
+// Name возвращает имя бэкенда
+func (p *FakeProvider) Name() string {
+	return ProviderFake
+}
+
+// Complete возвращает следующий заготовленный ответ
+func (p *FakeProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.Requests = append(p.Requests, req)
+	if p.Err != nil {
+		return CompletionResponse{}, p.Err
+	}
+
+	if len(p.ToolCalls) > 0 {
+		call := p.ToolCalls[0]
+		p.ToolCalls = p.ToolCalls[1:]
+		return CompletionResponse{ToolCall: &call}, nil
+	}
+
+	if len(p.Responses) > 0 {
+		content := p.Responses[0]
+		p.Responses = p.Responses[1:]
+		return CompletionResponse{Content: content}, nil
+	}
+
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			return CompletionResponse{Content: "эхо: " + req.Messages[i].Content}, nil
+		}
+	}
+	return CompletionResponse{}, nil
+}
+
+// Stream возвращает следующий заготовленный ответ по словам
+func (p *FakeProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(string)) (CompletionResponse, error) {
+	resp, err := p.Complete(ctx, req)
+	if err != nil || resp.ToolCall != nil {
+		return resp, err
+	}
+
+	var sent strings.Builder
+	for _, word := range strings.SplitAfter(resp.Content, " ") {
+		if err := ctx.Err(); err != nil {
+			return CompletionResponse{Content: sent.String()}, tracerr.Wrap(err)
+		}
+		sent.WriteString(word)
+		onDelta(word)
+		if p.OnDelta != nil {
+			p.OnDelta(word)
+		}
+	}
+	return resp, nil
+}
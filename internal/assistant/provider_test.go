@@ -0,0 +1,187 @@
+package assistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   AssistantConfig
+		expected string // пусто — провайдер не создается
+		wantErr  bool
+	}{
+		{"openai без ключа", AssistantConfig{}, "", false},
+		{"openai с ключом", AssistantConfig{OpenAIAPIKey: "test-key"}, ProviderOpenAI, false},
+		{"use_local_models", AssistantConfig{UseLocalModels: true}, ProviderLocal, false},
+		{"явный local", AssistantConfig{LLMProvider: ProviderLocal, LLMBaseURL: "http://127.0.0.1:11434/v1"}, ProviderLocal, false},
+		{"fake", AssistantConfig{LLMProvider: ProviderFake}, ProviderFake, false},
+		{"неизвестный", AssistantConfig{LLMProvider: "unknown"}, "", true},
+	}
+
+	for _, test := range tests {
+		provider, err := newProvider(test.config)
+		if test.wantErr {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		assert.NoError(t, err, test.name)
+		if test.expected == "" {
+			assert.Nil(t, provider, test.name)
+			continue
+		}
+		if assert.NotNil(t, provider, test.name) {
+			assert.Equal(t, test.expected, provider.Name(), test.name)
+		}
+	}
+}
+
+func TestLLMSettings(t *testing.T) {
+	// Значения по умолчанию
+	config := AssistantConfig{}
+	assert.Equal(t, defaultLLMModel, llmModel(config))
+	assert.Equal(t, float32(defaultLLMTemperature), llmTemperature(config))
+	assert.Equal(t, float64(defaultLLMTimeout), llmTimeout(config).Seconds())
+
+	// Для локального бэкенда имя модели берется из local_model_path
+	config = AssistantConfig{UseLocalModels: true, LocalModelPath: "llama3"}
+	assert.Equal(t, "llama3", llmModel(config))
+
+	// Явно заданные значения имеют приоритет
+	temperature := float32(0.2)
+	config = AssistantConfig{UseLocalModels: true, LocalModelPath: "llama3", LLMModel: "mistral", LLMTemperature: &temperature, LLMTimeout: 5}
+	assert.Equal(t, "mistral", llmModel(config))
+	assert.Equal(t, float32(0.2), llmTemperature(config))
+	assert.Equal(t, float64(5), llmTimeout(config).Seconds())
+
+	// Нулевая температура — заданное значение, а не отсутствие настройки
+	temperature = 0
+	assert.Equal(t, float32(0), llmTemperature(config))
+	assert.Greater(t, requestTemperature(llmTemperature(config)), float32(0))
+	assert.Equal(t, float32(0.2), requestTemperature(0.2))
+}
+
+func TestProcessWithLocalProvider(t *testing.T) {
+	// Локальный HTTP-сервер, имитирующий OpenAI-совместимый API (llama.cpp server, Ollama)
+	var received struct {
+		Model       string    `json:"model"`
+		Messages    []Message `json:"messages"`
+		Temperature float32   `json:"temperature"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"created": 0,
+			"model":   received.Model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"message":       map[string]string{"role": "assistant", "content": "Все отлично!"},
+					"finish_reason": "stop",
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	temperature := float32(0.3)
+	config := AssistantConfig{
+		Name:           "TestAssistant",
+		HistoryEnabled: false,
+		LLMProvider:    ProviderLocal,
+		LLMBaseURL:     server.URL + "/v1",
+		LLMModel:       "test-model",
+		LLMTemperature: &temperature,
+	}
+
+	assistant := NewAssistant(config, nil, nil)
+	assert.NoError(t, assistant.Start())
+	defer assistant.Stop()
+
+	response, err := assistant.ProcessCommand("как дела?")
+	assert.NoError(t, err)
+	assert.Equal(t, "Все отлично!", response)
+
+	// Проверяем, что запрос сформирован по настройкам
+	assert.Equal(t, "test-model", received.Model)
+	assert.Equal(t, float32(0.3), received.Temperature)
+	if assert.Len(t, received.Messages, 2) {
+		assert.Equal(t, RoleSystem, received.Messages[0].Role)
+		assert.Equal(t, RoleUser, received.Messages[1].Role)
+		assert.Equal(t, "как дела?", received.Messages[1].Content)
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	provider := &FakeProvider{Responses: []string{"первый"}}
+	req := CompletionRequest{Messages: []Message{{Role: RoleUser, Content: "привет"}}}
+
+	// Сначала возвращаются заготовленные ответы
+	resp, err := provider.Complete(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "первый", resp.Content)
+
+	// Затем — эхо последнего сообщения пользователя
+	resp, err = provider.Complete(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "эхо: привет", resp.Content)
+	assert.Len(t, provider.Requests, 2)
+
+	// Ошибка пробрасывается в ProcessCommand
+	provider.Err = errors.New("модель недоступна")
+	assistant := NewAssistant(AssistantConfig{}, nil, nil)
+	assistant.provider = provider
+	_, err = assistant.ProcessCommand("как дела?")
+	assert.Error(t, err)
+}
+
+func TestStreamWithLocalProvider(t *testing.T) {
+	// Сервер отдает ответ частями в формате server-sent events
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, true, req["stream"])
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{"Все ", "отлично", "!"} {
+			chunk, _ := json.Marshal(map[string]interface{}{
+				"id":      "chatcmpl-test",
+				"object":  "chat.completion.chunk",
+				"choices": []map[string]interface{}{{"index": 0, "delta": map[string]string{"content": part}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	assistant := NewAssistant(AssistantConfig{
+		Name:        "TestAssistant",
+		LLMProvider: ProviderLocal,
+		LLMBaseURL:  server.URL + "/v1",
+		LLMModel:    "test-model",
+	}, nil, nil)
+	assert.NoError(t, assistant.Start())
+	defer assistant.Stop()
+
+	var deltas []string
+	response, err := assistant.ProcessCommandStream(context.Background(), OriginDefault, "как дела?", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Все отлично!", response)
+	assert.Equal(t, []string{"Все ", "отлично", "!"}, deltas)
+}
@@ -0,0 +1,218 @@
+package assistant
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"kot.ai/internal/system"
+)
+
+// Источники команд. Для WebSocket-клиентов к источнику добавляется
+// идентификатор соединения, например "web:3".
+const (
+	OriginDefault = "default"
+	OriginVoice   = "voice"
+	OriginWeb     = "web"
+	OriginMobile  = "mobile"
+)
+
+// Значения по умолчанию для контекста разговора
+const (
+	defaultContextTurns       = 10
+	defaultContextTokenBudget = 2000
+)
+
+// Session представляет разговор с пользователем из одного источника
+type Session struct {
+	ID      string
+	Origin  string
+	Started time.Time
+	turns   []HistoryEntry
+
+	appChoices []system.AppEntry // варианты приложений, ожидающие уточнения
+	pending    *pendingCommand   // опасная команда, ожидающая подтверждения
+}
+
+// ConversationSummary содержит краткие сведения о разговоре
+type ConversationSummary struct {
+	ID      string    `json:"id"`
+	Origin  string    `json:"origin"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+	Turns   int       `json:"turns"`
+	Title   string    `json:"title"`
+}
+
+// sessionStore хранит текущие разговоры по источникам
+type sessionStore struct {
+	sessions map[string]*Session
+	archived []*Session // завершенные разговоры текущего запуска
+	mutex    sync.Mutex
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*Session)}
+}
+
+// get возвращает текущий разговор источника, создавая его при необходимости
+func (s *sessionStore) get(origin string) *Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[origin]
+	if !ok {
+		session = newSession(origin)
+		s.sessions[origin] = session
+	}
+	return session
+}
+
+// reset начинает новый разговор для источника
+func (s *sessionStore) reset(origin string) *Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.sessions[origin]; ok && len(old.turns) > 0 {
+		s.archived = append(s.archived, old)
+	}
+	session := newSession(origin)
+	s.sessions[origin] = session
+	return session
+}
+
+// release забывает текущий разговор источника, например отключившегося
+// клиента. Реплики остаются в истории, если она ведется.
+func (s *sessionStore) release(origin string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.sessions, origin)
+}
+
+// restore делает разговор текущим для его источника
+func (s *sessionStore) restore(session *Session) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions[session.Origin] = session
+}
+
+// all возвращает копию списка текущих и завершенных разговоров
+func (s *sessionStore) all() []*Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sessions := make([]*Session, 0, len(s.sessions)+len(s.archived))
+	sessions = append(sessions, s.archived...)
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+func newSession(origin string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:      fmt.Sprintf("%s-%d", origin, now.UnixNano()),
+		Origin:  origin,
+		Started: now,
+	}
+}
+
+// addTurn добавляет реплику в разговор, оставляя в памяти не больше limit последних
+func (s *Session) addTurn(entry HistoryEntry, limit int) {
+	s.turns = append(s.turns, entry)
+	if len(s.turns) > limit {
+		s.turns = append([]HistoryEntry(nil), s.turns[len(s.turns)-limit:]...)
+	}
+}
+
+// contextMessages формирует сообщения с предыдущими репликами разговора.
+// Берется не больше maxTurns последних реплик, а самые старые отбрасываются,
+// пока оценка размера вместе с системным сообщением и текущей командой
+// не уложится в бюджет токенов.
+func (s *Session) contextMessages(systemMessage, command string, maxTurns, tokenBudget int) []Message {
+	turns := s.turns
+	if len(turns) > maxTurns {
+		turns = turns[len(turns)-maxTurns:]
+	}
+
+	used := estimateTokens(systemMessage) + estimateTokens(command)
+	start := len(turns)
+	for start > 0 {
+		turn := turns[start-1]
+		cost := estimateTokens(turn.Command) + estimateTokens(turn.Response)
+		if used+cost > tokenBudget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	messages := make([]Message, 0, 2*(len(turns)-start)+2)
+	messages = append(messages, Message{Role: RoleSystem, Content: systemMessage})
+	for _, turn := range turns[start:] {
+		messages = append(messages,
+			Message{Role: RoleUser, Content: turn.Command},
+			Message{Role: RoleAssistant, Content: turn.Response},
+		)
+	}
+	messages = append(messages, Message{Role: RoleUser, Content: command})
+
+	return messages
+}
+
+// estimateTokens грубо оценивает число токенов: около четырех символов
+// на токен плюс накладные расходы на служебную разметку сообщения
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/4 + 4
+}
+
+// conversationIndex группирует записи истории по разговорам
+type conversationIndex map[string]*ConversationSummary
+
+func newConversationIndex() conversationIndex {
+	return make(conversationIndex)
+}
+
+// add учитывает запись в итогах ее разговора
+func (index conversationIndex) add(entry HistoryEntry) {
+	if entry.SessionID == "" {
+		return
+	}
+	ts := entry.Time()
+	summary, ok := index[entry.SessionID]
+	if !ok {
+		summary = &ConversationSummary{
+			ID:      entry.SessionID,
+			Origin:  entry.Source,
+			Started: ts,
+			Updated: ts,
+			Title:   entry.Command,
+		}
+		index[entry.SessionID] = summary
+	}
+	if ts.Before(summary.Started) {
+		summary.Started = ts
+		summary.Title = entry.Command
+	}
+	if ts.After(summary.Updated) {
+		summary.Updated = ts
+	}
+	summary.Turns++
+}
+
+// list возвращает разговоры, начиная с самого свежего
+func (index conversationIndex) list() []ConversationSummary {
+	summaries := make([]ConversationSummary, 0, len(index))
+	for _, summary := range index {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Updated.After(summaries[j].Updated)
+	})
+	return summaries
+}
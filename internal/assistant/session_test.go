@@ -0,0 +1,150 @@
+package assistant
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextMessages(t *testing.T) {
+	session := newSession(OriginVoice)
+	for _, command := range []string{"первая", "вторая", "третья"} {
+		session.addTurn(HistoryEntry{Command: command, Response: "ответ на " + command}, 10)
+	}
+
+	// Без ограничений передаются все реплики
+	messages := session.contextMessages("система", "четвертая", 10, 10000)
+	assert.Len(t, messages, 8)
+	assert.Equal(t, RoleSystem, messages[0].Role)
+	assert.Equal(t, "первая", messages[1].Content)
+	assert.Equal(t, RoleAssistant, messages[2].Role)
+	assert.Equal(t, "четвертая", messages[7].Content)
+
+	// Ограничение по числу реплик
+	messages = session.contextMessages("система", "четвертая", 1, 10000)
+	assert.Len(t, messages, 4)
+	assert.Equal(t, "третья", messages[1].Content)
+
+	// Ограничение по бюджету токенов отбрасывает самые старые реплики
+	budget := estimateTokens("система") + estimateTokens("четвертая") +
+		estimateTokens("третья") + estimateTokens("ответ на третья")
+	messages = session.contextMessages("система", "четвертая", 10, budget)
+	assert.Len(t, messages, 4)
+	assert.Equal(t, "третья", messages[1].Content)
+
+	// Текущая команда передается, даже если бюджет исчерпан
+	messages = session.contextMessages("система", "четвертая", 10, 0)
+	assert.Len(t, messages, 2)
+
+	// В памяти хранится не больше заданного числа реплик
+	session.addTurn(HistoryEntry{Command: "четвертая"}, 2)
+	assert.Len(t, session.turns, 2)
+	assert.Equal(t, "третья", session.turns[0].Command)
+}
+
+func TestMultiTurnConversation(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	provider := &FakeProvider{}
+	assistant.provider = provider
+
+	// Вторая команда того же источника получает предыдущую реплику
+	_, err := assistant.ProcessCommandFrom(OriginVoice, "какая столица Франции")
+	assert.NoError(t, err)
+	_, err = assistant.ProcessCommandFrom(OriginVoice, "а Германии?")
+	assert.NoError(t, err)
+	assert.Len(t, provider.Requests[1].Messages, 4)
+	assert.Equal(t, "какая столица Франции", provider.Requests[1].Messages[1].Content)
+	assert.Equal(t, "эхо: какая столица Франции", provider.Requests[1].Messages[2].Content)
+
+	// Разговоры разных источников не смешиваются
+	_, err = assistant.ProcessCommandFrom("web:1", "привет")
+	assert.NoError(t, err)
+	assert.Len(t, provider.Requests[2].Messages, 2)
+
+	// Новый разговор начинается без контекста
+	response, err := assistant.ProcessCommandFrom(OriginVoice, "новый разговор")
+	assert.NoError(t, err)
+	assert.Equal(t, "Начинаю новый разговор", response)
+	_, err = assistant.ProcessCommandFrom(OriginVoice, "а Италии?")
+	assert.NoError(t, err)
+	assert.Len(t, provider.Requests[3].Messages, 2)
+
+	// Без истории список строится по разговорам текущего запуска
+	conversations, err := assistant.ListConversations()
+	assert.NoError(t, err)
+	assert.Len(t, conversations, 3)
+}
+
+func TestConversationRestore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "kot-ai-session-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	config := AssistantConfig{
+		Name:            "TestAssistant",
+		HistoryEnabled:  true,
+		HistoryFilePath: filepath.Join(tempDir, "history.db"),
+		LLMProvider:     ProviderFake,
+	}
+
+	// Первый запуск: одна реплика голосом
+	first := NewAssistant(config, nil, nil)
+	assert.NoError(t, first.Start())
+	_, err = first.ProcessCommandFrom(OriginVoice, "запомни число семь")
+	assert.NoError(t, err)
+	_, err = first.ProcessCommandFrom("web:1", "запомни число восемь")
+	assert.NoError(t, err)
+	sessionID := first.sessions.get(OriginVoice).ID
+	webSessionID := first.sessions.get("web:1").ID
+	first.Stop()
+
+	// Второй запуск продолжает тот же разговор
+	second := NewAssistant(config, nil, nil)
+	assert.NoError(t, second.Start())
+	defer second.Stop()
+
+	conversations, err := second.ListConversations()
+	assert.NoError(t, err)
+	if assert.Len(t, conversations, 2) {
+		assert.Equal(t, "web:1", conversations[0].Origin)
+		assert.Equal(t, OriginVoice, conversations[1].Origin)
+		assert.Equal(t, "запомни число семь", conversations[1].Title)
+	}
+
+	// Команда списка разговоров выводит их пользователю
+	response, err := second.ProcessCommandFrom("web:1", "список разговоров")
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(response, "запомни число семь"))
+
+	// Продолжение разговора передает модели восстановленную реплику
+	provider := &FakeProvider{}
+	second.provider = provider
+	_, err = second.ProcessCommandFrom(OriginVoice, "какое число?")
+	assert.NoError(t, err)
+	assert.Equal(t, sessionID, second.sessions.get(OriginVoice).ID)
+	assert.Len(t, provider.Requests[0].Messages, 4)
+
+	// Разговор клиента прошлого запуска не достается новому клиенту с тем же номером
+	assert.NotEqual(t, webSessionID, second.sessions.get("web:1").ID)
+}
+
+func TestReleaseOrigin(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	assistant.provider = &FakeProvider{}
+	assistant.SetRiskLimit("web:1", RiskLow)
+
+	_, err := assistant.ProcessCommandFrom("web:1", "запомни число семь")
+	assert.NoError(t, err)
+	sessionID := assistant.sessions.get("web:1").ID
+
+	// Отключившийся клиент не оставляет разговора и ограничений
+	assistant.ReleaseOrigin("web:1")
+	assistant.sessions.mutex.Lock()
+	assert.NotContains(t, assistant.sessions.sessions, "web:1")
+	assistant.sessions.mutex.Unlock()
+	assert.NotEqual(t, sessionID, assistant.sessions.get("web:1").ID)
+	assert.Empty(t, assistant.policy.limits)
+}
@@ -0,0 +1,113 @@
+package assistant
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sentenceSplitter собирает части ответа модели в законченные предложения,
+// чтобы голосовой ответ начинался до окончания генерации
+type sentenceSplitter struct {
+	buffer strings.Builder
+}
+
+// Add добавляет часть ответа и возвращает предложения, которые в ней
+// закончились
+func (s *sentenceSplitter) Add(delta string) []string {
+	s.buffer.WriteString(delta)
+	text := s.buffer.String()
+
+	var sentences []string
+	start := 0
+	for i, r := range text {
+		if !isSentenceEnd(r) {
+			continue
+		}
+		// Конец предложения — перевод строки или знак препинания, за
+		// которым идет пробел. Если после знака ничего нет, следующая часть
+		// может продолжить многоточие или число вроде "3.5".
+		end := i + utf8.RuneLen(r)
+		next, _ := utf8.DecodeRuneInString(text[end:])
+		if r != '\n' && (end >= len(text) || !unicode.IsSpace(next)) {
+			continue
+		}
+		if sentence := strings.TrimSpace(text[start:end]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+	}
+
+	s.buffer.Reset()
+	s.buffer.WriteString(text[start:])
+	return sentences
+}
+
+// Flush возвращает остаток ответа после окончания генерации
+func (s *sentenceSplitter) Flush() string {
+	rest := strings.TrimSpace(s.buffer.String())
+	s.buffer.Reset()
+	return rest
+}
+
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '.', '!', '?', '…', ';', '\n':
+		return true
+	}
+	return false
+}
+
+// speechQueue произносит предложения по очереди в отдельной горутине,
+// пока генерация ответа продолжается. После отмены ctx оставшиеся
+// предложения не произносятся.
+type speechQueue struct {
+	ctx       context.Context
+	speak     func(string) error
+	sentences chan string
+	done      sync.WaitGroup
+}
+
+// newSpeechQueue запускает очередь произнесения
+func newSpeechQueue(ctx context.Context, speak func(string) error) *speechQueue {
+	q := &speechQueue{
+		ctx:       ctx,
+		speak:     speak,
+		sentences: make(chan string, 32),
+	}
+	q.done.Add(1)
+	go q.run()
+	return q
+}
+
+func (q *speechQueue) run() {
+	defer q.done.Done()
+	for sentence := range q.sentences {
+		if q.ctx.Err() != nil {
+			continue
+		}
+		if err := q.speak(sentence); err != nil {
+			log.Printf("Ошибка синтеза речи: %v", err)
+		}
+	}
+}
+
+// Say ставит предложение в очередь
+func (q *speechQueue) Say(sentence string) {
+	if sentence == "" || q.ctx.Err() != nil {
+		return
+	}
+	select {
+	case q.sentences <- sentence:
+	case <-q.ctx.Done():
+	}
+}
+
+// Close дожидается, пока будут произнесены все предложения из очереди
+func (q *speechQueue) Close() {
+	close(q.sentences)
+	q.done.Wait()
+}
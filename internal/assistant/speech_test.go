@@ -0,0 +1,122 @@
+package assistant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentenceSplitter(t *testing.T) {
+	splitter := &sentenceSplitter{}
+
+	var sentences []string
+	for _, delta := range []string{"Сейчас ", "3.5 граду", "са. Ветер", " слабый! Зонт не", " нужен...", " Хорошего дня"} {
+		sentences = append(sentences, splitter.Add(delta)...)
+	}
+	assert.Equal(t, []string{"Сейчас 3.5 градуса.", "Ветер слабый!", "Зонт не нужен..."}, sentences)
+	assert.Equal(t, "Хорошего дня", splitter.Flush())
+	assert.Equal(t, "", splitter.Flush())
+
+	// Перевод строки тоже завершает предложение
+	assert.Equal(t, []string{"Первое", "Второе"}, splitter.Add("Первое\nВторое\n"))
+}
+
+func TestProcessCommandStream(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	assistant.provider = &FakeProvider{Responses: []string{"Сегодня солнечно. Зонт не нужен."}}
+
+	// Ответ модели приходит по частям
+	var deltas []string
+	response, err := assistant.ProcessCommandStream(context.Background(), OriginDefault, "что надеть?", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Сегодня солнечно. Зонт не нужен.", response)
+	assert.Equal(t, response, strings.Join(deltas, ""))
+	assert.Greater(t, len(deltas), 1)
+
+	// Ответ встроенной команды — одной частью
+	deltas = nil
+	response, _ = assistant.ProcessCommandStream(context.Background(), OriginDefault, "помощь", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	assert.Equal(t, []string{response}, deltas)
+}
+
+func TestCancelStream(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	provider := &FakeProvider{Responses: []string{"раз два три четыре пять"}}
+	assistant.provider = provider
+
+	// Пользователь прерывает ответ после второго слова
+	ctx, cancel := context.WithCancel(context.Background())
+	words := 0
+	provider.OnDelta = func(string) {
+		words++
+		if words == 2 {
+			cancel()
+		}
+	}
+
+	response, err := assistant.ProcessCommandStream(ctx, OriginDefault, "посчитай до пяти", func(string) {})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "раз два ", response)
+
+	// В разговоре остается то, что успели сказать
+	session := assistant.sessions.get(OriginDefault)
+	if assert.Len(t, session.turns, 1) {
+		assert.Equal(t, "раз два ", session.turns[0].Response)
+	}
+}
+
+func TestSpeechQueue(t *testing.T) {
+	var mutex sync.Mutex
+	var spoken []string
+	speak := func(text string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		spoken = append(spoken, text)
+		return nil
+	}
+
+	queue := newSpeechQueue(context.Background(), speak)
+	queue.Say("Первое.")
+	queue.Say("")
+	queue.Say("Второе.")
+	queue.Close()
+	assert.Equal(t, []string{"Первое.", "Второе."}, spoken)
+
+	// После отмены очередь замолкает
+	spoken = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	queue = newSpeechQueue(ctx, speak)
+	cancel()
+	queue.Say("Не будет сказано.")
+	queue.Close()
+	assert.Empty(t, spoken)
+}
+
+func TestProcessSpoken(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	assistant.provider = &FakeProvider{Responses: []string{"Сегодня солнечно. Зонт не нужен"}}
+
+	// Ответ произносится по предложениям, и части текста тоже приходят
+	var spoken, deltas []string
+	response, err := assistant.processSpoken(context.Background(), OriginDefault, "что надеть?", func(delta string) {
+		deltas = append(deltas, delta)
+	}, func(sentence string) error {
+		spoken = append(spoken, sentence)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Сегодня солнечно.", "Зонт не нужен"}, spoken)
+	assert.Equal(t, response, strings.Join(deltas, ""))
+
+	// Без голосового модуля звук ответа не получить
+	_, err = assistant.ProcessCommandSpoken(context.Background(), OriginDefault, "помощь", nil, nil)
+	assert.ErrorContains(t, err, "Голосовой модуль отключен")
+}
@@ -0,0 +1,168 @@
+package assistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"kot.ai/internal/intent"
+)
+
+// maxToolRounds ограничивает число последовательных вызовов инструментов
+// в ответ на одну команду, чтобы модель не зациклилась
+const maxToolRounds = 3
+
+// Tool описывает инструмент, который может вызвать языковая модель
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // JSON Schema аргументов
+}
+
+// ToolCall представляет вызов инструмента моделью
+type ToolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON-объект с аргументами
+}
+
+// ToolArg описывает аргумент команды, вызываемой как инструмент
+type ToolArg struct {
+	Name        string
+	Type        string // string, integer, number
+	Description string
+	Required    bool
+	Slot        intent.SlotKind // тип слота при распознавании фразы пользователя
+}
+
+// Tool возвращает описание команды в виде инструмента для языковой модели
+func (c Command) Tool() Tool {
+	type property struct {
+		Type        string `json:"type"`
+		Description string `json:"description,omitempty"`
+	}
+	schema := struct {
+		Type       string              `json:"type"`
+		Properties map[string]property `json:"properties"`
+		Required   []string            `json:"required,omitempty"`
+	}{
+		Type:       "object",
+		Properties: make(map[string]property, len(c.Args)),
+	}
+
+	for _, arg := range c.Args {
+		schema.Properties[arg.Name] = property{Type: arg.Type, Description: arg.Description}
+		if arg.Required {
+			schema.Required = append(schema.Required, arg.Name)
+		}
+	}
+
+	// Схема строится из фиксированных типов и не может не сериализоваться
+	parameters, _ := json.Marshal(schema)
+
+	return Tool{
+		Name:        c.Name,
+		Description: c.Description,
+		Parameters:  parameters,
+	}
+}
+
+// toolArgs преобразует JSON-аргументы вызова в аргументы обработчика
+// в порядке объявления ToolArg, как если бы пользователь произнес их после команды
+func (c Command) toolArgs(arguments string) ([]string, error) {
+	values := make(map[string]interface{})
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &values); err != nil {
+			return nil, fmt.Errorf("некорректные аргументы инструмента %s: %v", c.Name, err)
+		}
+	}
+
+	var args []string
+	for _, arg := range c.Args {
+		value, ok := values[arg.Name]
+		if !ok || value == nil {
+			if arg.Required {
+				return nil, fmt.Errorf("не указан аргумент %s инструмента %s", arg.Name, c.Name)
+			}
+			continue
+		}
+
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case float64:
+			text = fmt.Sprintf("%g", v)
+		default:
+			text = fmt.Sprint(v)
+		}
+		args = append(args, strings.Fields(text)...)
+	}
+
+	return args, nil
+}
+
+// slotArgs преобразует слоты распознанной фразы в аргументы обработчика
+// в порядке объявления ToolArg
+func (c Command) slotArgs(slots map[string]string) []string {
+	var args []string
+	for _, arg := range c.Args {
+		if value, ok := slots[arg.Name]; ok {
+			args = append(args, strings.Fields(value)...)
+		}
+	}
+	return args
+}
+
+// commandTools возвращает инструменты для всех команд реестра
+func commandTools() []Tool {
+	tools := make([]Tool, 0, len(commandRegistry))
+	for _, cmd := range commandRegistry {
+		if cmd.Name == "" {
+			continue
+		}
+		tools = append(tools, cmd.Tool())
+	}
+	return tools
+}
+
+// commandIntents возвращает намерения для всех команд реестра.
+// Ключевые слова команды служат образцами фраз, а аргументы со Slot — слотами.
+func commandIntents() []intent.Intent {
+	intents := make([]intent.Intent, 0, len(commandRegistry))
+	for _, cmd := range commandRegistry {
+		in := intent.Intent{Name: cmd.Name, Phrases: cmd.Keywords}
+		for _, arg := range cmd.Args {
+			if arg.Slot != "" {
+				in.Slots = append(in.Slots, intent.Slot{Name: arg.Name, Kind: arg.Slot, Required: arg.Required})
+			}
+		}
+		intents = append(intents, in)
+	}
+	return intents
+}
+
+// findCommand ищет команду реестра по имени инструмента
+func findCommand(name string) (Command, bool) {
+	for _, cmd := range commandRegistry {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return Command{}, false
+}
+
+// runToolCall выполняет вызов инструмента и возвращает результат для модели
+func (a *Assistant) runToolCall(session *Session, call ToolCall) string {
+	cmd, ok := findCommand(call.Name)
+	if !ok {
+		return fmt.Sprintf("Неизвестный инструмент: %s", call.Name)
+	}
+
+	args, err := cmd.toolArgs(call.Arguments)
+	if err != nil {
+		return err.Error()
+	}
+
+	result, _ := a.runCommand(session, cmd, args)
+	return result
+}
@@ -0,0 +1,195 @@
+package assistant
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandTools(t *testing.T) {
+	tools := commandTools()
+	assert.Len(t, tools, len(commandRegistry))
+
+	names := make(map[string]bool)
+	for _, tool := range tools {
+		// Имена инструментов уникальны и описаны
+		assert.False(t, names[tool.Name], "Повторяющееся имя инструмента: %s", tool.Name)
+		names[tool.Name] = true
+		assert.NotEmpty(t, tool.Description, tool.Name)
+
+		// Схема аргументов — корректный JSON-объект
+		var schema map[string]interface{}
+		assert.NoError(t, json.Unmarshal(tool.Parameters, &schema), tool.Name)
+		assert.Equal(t, "object", schema["type"], tool.Name)
+	}
+
+	// Обязательные аргументы попадают в схему
+	cmd, ok := findCommand("kill_process")
+	assert.True(t, ok)
+	assert.JSONEq(t,
+		`{"type":"object","properties":{"name":{"type":"string","description":"Имя процесса, например \"chrome\""}},"required":["name"]}`,
+		string(cmd.Tool().Parameters))
+}
+
+func TestToolArgs(t *testing.T) {
+	cmd, _ := findCommand("open_application")
+
+	args, err := cmd.toolArgs(`{"name": "google chrome"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"google", "chrome"}, args)
+
+	_, err = cmd.toolArgs(`{}`)
+	assert.Error(t, err)
+
+	_, err = cmd.toolArgs(`не json`)
+	assert.Error(t, err)
+
+	// Числовые аргументы и необязательные аргументы
+	cmd, _ = findCommand("decrease_volume")
+	args, err = cmd.toolArgs(`{"amount": 5}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"5"}, args)
+	assert.Equal(t, 5, volumeStep(args))
+
+	args, err = cmd.toolArgs("")
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Equal(t, 10, volumeStep(args))
+}
+
+func TestToolCallingFlow(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+	provider := &FakeProvider{
+		ToolCalls: []ToolCall{{Name: "list_conversations", Arguments: "{}"}},
+		Responses: []string{"Вы еще ни о чем не разговаривали"},
+	}
+	assistant.provider = provider
+
+	response, err := assistant.ProcessCommand("о чем мы говорили?")
+	assert.NoError(t, err)
+	assert.Equal(t, "Вы еще ни о чем не разговаривали", response)
+
+	// Модели передаются инструменты, а результат вызова возвращается ей
+	if assert.Len(t, provider.Requests, 2) {
+		assert.NotEmpty(t, provider.Requests[0].Tools)
+		messages := provider.Requests[1].Messages
+		last := messages[len(messages)-1]
+		assert.Equal(t, RoleFunction, last.Role)
+		assert.Equal(t, "list_conversations", last.Name)
+		assert.Equal(t, "Прошлых разговоров нет", last.Content)
+		assert.Equal(t, "list_conversations", messages[len(messages)-2].ToolCall.Name)
+	}
+
+	// Неизвестный инструмент не прерывает обработку
+	provider.ToolCalls = []ToolCall{{Name: "format_disk"}}
+	provider.Responses = []string{"Не могу"}
+	response, err = assistant.ProcessCommand("отформатируй диск")
+	assert.NoError(t, err)
+	assert.Equal(t, "Не могу", response)
+
+	// Модель, которая только вызывает инструменты, не зацикливается
+	provider.ToolCalls = make([]ToolCall, maxToolRounds+2)
+	for i := range provider.ToolCalls {
+		provider.ToolCalls[i] = ToolCall{Name: "new_conversation"}
+	}
+	response, err = assistant.ProcessCommand("начни заново много раз")
+	assert.NoError(t, err)
+	assert.Equal(t, "Начинаю новый разговор", response)
+}
+
+func TestToolCallingOverHTTP(t *testing.T) {
+	// OpenAI-совместимый сервер сначала вызывает функцию, затем отвечает текстом
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		message := map[string]interface{}{"role": "assistant", "content": "Разговоров пока не было"}
+		if len(requests) == 1 {
+			message = map[string]interface{}{
+				"role":          "assistant",
+				"content":       "",
+				"function_call": map[string]string{"name": "list_conversations", "arguments": "{}"},
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"choices": []map[string]interface{}{{"index": 0, "message": message}},
+		})
+	}))
+	defer server.Close()
+
+	assistant := NewAssistant(AssistantConfig{
+		LLMProvider: ProviderLocal,
+		LLMBaseURL:  server.URL + "/v1",
+	}, nil, nil)
+	assert.NoError(t, assistant.Start())
+	defer assistant.Stop()
+
+	response, err := assistant.ProcessCommand("о чем мы говорили?")
+	assert.NoError(t, err)
+	assert.Equal(t, "Разговоров пока не было", response)
+
+	if assert.Len(t, requests, 2) {
+		// Все команды переданы как функции
+		assert.Len(t, requests[0]["functions"], len(commandRegistry))
+
+		// Результат функции возвращен модели
+		messages := requests[1]["messages"].([]interface{})
+		last := messages[len(messages)-1].(map[string]interface{})
+		assert.Equal(t, "function", last["role"])
+		assert.Equal(t, "list_conversations", last["name"])
+		assert.Equal(t, "Прошлых разговоров нет", last["content"])
+	}
+}
+
+func TestCommandIntents(t *testing.T) {
+	assistant := NewAssistant(AssistantConfig{Name: "TestAssistant"}, nil, nil)
+
+	tests := []struct {
+		text string
+		name string
+		args []string
+	}{
+		{"сделай скриншот", "take_screenshot", nil},
+		{"открой сайт google.com", "open_url", []string{"google.com"}},
+		{"открой google.com", "open_url", []string{"google.com"}},
+		{"открой блокнот", "open_application", []string{"блокнот"}},
+		{"запусти калькулятор", "open_application", []string{"калькулятор"}},
+		{"убавь звук на 20 процентов", "decrease_volume", []string{"20"}},
+		{"завершить процесс chrome", "kill_process", []string{"chrome"}},
+		{"новый разговор, пожалуйста", "new_conversation", nil},
+	}
+	for _, tt := range tests {
+		match, ok := assistant.intents.Parse(tt.text)
+		if !assert.True(t, ok, tt.text) {
+			continue
+		}
+		assert.Equal(t, tt.name, match.Intent, tt.text)
+		assert.GreaterOrEqual(t, match.Confidence, assistant.intentThreshold(), tt.text)
+
+		cmd, _ := findCommand(match.Intent)
+		assert.Equal(t, tt.args, cmd.slotArgs(match.Slots), tt.text)
+	}
+
+	// Распознанная команда выполняется без обращения к модели
+	provider := &FakeProvider{}
+	assistant.provider = provider
+	response, err := assistant.ProcessCommand("Начнем сначала!")
+	assert.NoError(t, err)
+	assert.Equal(t, "Начинаю новый разговор", response)
+	assert.Empty(t, provider.Requests)
+
+	// Неуверенное совпадение уходит модели
+	response, err = assistant.ProcessCommand("расскажи, как открыть файл в питоне")
+	assert.NoError(t, err)
+	assert.Equal(t, "эхо: расскажи, как открыть файл в питоне", response)
+	assert.Len(t, provider.Requests, 1)
+}
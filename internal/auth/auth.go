@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Права доступа устройства
+const (
+	ScopeChat   = "chat"   // разговор с ассистентом и безопасные команды
+	ScopeSystem = "system" // управление компьютером: оболочка, скриншоты, опасные команды
+	ScopeMobile = "mobile" // управление телефоном, подключенным по USB
+)
+
+// AllScopes содержит все права доступа
+var AllScopes = []string{ScopeChat, ScopeSystem, ScopeMobile}
+
+// Параметры кодов подключения
+const (
+	codeDigits      = 6
+	codeTTL         = 5 * time.Minute
+	maxCodeAttempts = 5 // после стольких неверных попыток код перестает действовать
+)
+
+// Ошибки подключения устройства
+var (
+	ErrInvalidCode = errors.New("неверный код подключения")
+	ErrCodeExpired = errors.New("код подключения устарел, запросите новый")
+	ErrNoScopes    = errors.New("ни одно из запрошенных прав не разрешено")
+)
+
+// Device описывает устройство, которому разрешен доступ к веб-интерфейсу.
+// Сам токен не хранится, только его хэш.
+type Device struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	TokenHash string    `json:"token_hash"`
+	Scopes    []string  `json:"scopes"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
+	Temporary bool      `json:"-"` // выдан на время работы программы и не сохраняется
+}
+
+// HasScope проверяет, есть ли у устройства право доступа
+func (d Device) HasScope(scope string) bool {
+	for _, s := range d.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// pairingCode — одноразовый код для подключения нового устройства
+type pairingCode struct {
+	code     string
+	scopes   []string
+	expires  time.Time
+	attempts int
+}
+
+// Store хранит устройства и выдает коды подключения. Список устройств
+// сохраняется в JSON-файл.
+type Store struct {
+	path    string
+	devices []Device
+	code    *pairingCode
+	mutex   sync.Mutex
+}
+
+// NewStore создает хранилище устройств. Пустой путь — без сохранения на диск.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load загружает список устройств. Отсутствие файла не считается ошибкой.
+func (s *Store) Load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	var devices []Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.devices = devices
+	return nil
+}
+
+// save сохраняет постоянные устройства. Вызывается под мьютексом.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	devices := make([]Device, 0, len(s.devices))
+	for _, device := range s.devices {
+		if !device.Temporary {
+			devices = append(devices, device)
+		}
+	}
+
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return tracerr.Wrap(err)
+	}
+	return tracerr.Wrap(os.WriteFile(s.path, data, 0600))
+}
+
+// NewPairingCode выдает новый одноразовый код с указанными правами
+// (пусто — все права). Предыдущий код перестает действовать.
+func (s *Store) NewPairingCode(scopes []string) (string, time.Time, error) {
+	if len(scopes) == 0 {
+		scopes = AllScopes
+	}
+	scopes = normalizeScopes(scopes, AllScopes)
+	if len(scopes) == 0 {
+		return "", time.Time{}, tracerr.Wrap(ErrNoScopes)
+	}
+	max := big.NewInt(1)
+	for i := 0; i < codeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", time.Time{}, tracerr.Wrap(err)
+	}
+
+	code := &pairingCode{
+		code:    fmt.Sprintf("%0*d", codeDigits, n),
+		scopes:  scopes,
+		expires: time.Now().Add(codeTTL),
+	}
+
+	s.mutex.Lock()
+	s.code = code
+	s.mutex.Unlock()
+	return code.code, code.expires, nil
+}
+
+// Pair подключает устройство по коду и возвращает его токен. Устройство
+// получает запрошенные права, но не больше, чем разрешает код; пустой
+// список означает все права кода. Если ни одно право не подходит, код
+// остается действительным.
+func (s *Store) Pair(code, name string, scopes []string) (string, Device, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := s.code
+	if pending == nil {
+		return "", Device{}, tracerr.Wrap(ErrInvalidCode)
+	}
+	if time.Now().After(pending.expires) {
+		s.code = nil
+		return "", Device{}, tracerr.Wrap(ErrCodeExpired)
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(code)), []byte(pending.code)) != 1 {
+		pending.attempts++
+		if pending.attempts >= maxCodeAttempts {
+			s.code = nil
+		}
+		return "", Device{}, tracerr.Wrap(ErrInvalidCode)
+	}
+
+	if len(scopes) == 0 {
+		scopes = pending.scopes
+	}
+	scopes = normalizeScopes(scopes, pending.scopes)
+	if len(scopes) == 0 {
+		return "", Device{}, tracerr.Wrap(ErrNoScopes)
+	}
+	s.code = nil
+
+	token, device, err := s.issue(name, scopes, false)
+	if err != nil {
+		return "", Device{}, err
+	}
+	return token, device, tracerr.Wrap(s.save())
+}
+
+// IssueTemporary выдает токен, который действует до завершения программы.
+// Так подключается окно рабочего стола, открытое самим ассистентом.
+func (s *Store) IssueTemporary(name string, scopes []string) (string, Device, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.issue(name, normalizeScopes(scopes, AllScopes), true)
+}
+
+// issue создает устройство с новым токеном. Вызывается под мьютексом.
+func (s *Store) issue(name string, scopes []string, temporary bool) (string, Device, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", Device{}, tracerr.Wrap(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Устройство"
+	}
+	device := Device{
+		ID:        hashToken(token)[:8],
+		Name:      name,
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+		Created:   time.Now(),
+		Temporary: temporary,
+	}
+	s.devices = append(s.devices, device)
+	return token, device, nil
+}
+
+// Authenticate возвращает устройство по токену
+func (s *Store) Authenticate(token string) (Device, bool) {
+	if token == "" {
+		return Device{}, false
+	}
+	hash := hashToken(token)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.devices {
+		if subtle.ConstantTimeCompare([]byte(s.devices[i].TokenHash), []byte(hash)) == 1 {
+			s.devices[i].LastSeen = time.Now()
+			return s.devices[i], true
+		}
+	}
+	return Device{}, false
+}
+
+// Devices возвращает список устройств
+func (s *Store) Devices() []Device {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Device(nil), s.devices...)
+}
+
+// Revoke отзывает доступ устройств с указанным именем или идентификатором
+// (без учета регистра) и возвращает отозванные устройства
+func (s *Store) Revoke(name string) ([]Device, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var kept, revoked []Device
+	for _, device := range s.devices {
+		if name != "" && (strings.ToLower(device.Name) == name || device.ID == name) {
+			revoked = append(revoked, device)
+		} else {
+			kept = append(kept, device)
+		}
+	}
+	if len(revoked) == 0 {
+		return nil, nil
+	}
+
+	s.devices = kept
+	return revoked, tracerr.Wrap(s.save())
+}
+
+// TokenFromRequest извлекает токен из заголовка Authorization: Bearer
+// или, для WebSocket из браузера, из параметра token
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// CheckOrigin разрешает запросы без заголовка Origin (не из браузера),
+// со страниц того же адреса и из перечисленных источников
+func CheckOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeScopes оставляет только известные и разрешенные права
+// без повторов, в порядке AllScopes
+func normalizeScopes(scopes, permitted []string) []string {
+	var result []string
+	for _, scope := range AllScopes {
+		if contains(scopes, scope) && contains(permitted, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
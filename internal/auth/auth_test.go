@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	store := NewStore(path)
+
+	// Без кода подключиться нельзя
+	_, _, err := store.Pair("123456", "Телефон", nil)
+	assert.True(t, errors.Is(err, ErrInvalidCode))
+
+	code, _, err := store.NewPairingCode([]string{ScopeChat, ScopeMobile})
+	assert.NoError(t, err)
+	assert.Len(t, code, 6)
+
+	// Без подходящих прав устройство не подключается, а код не тратится
+	for _, scopes := range [][]string{{"admin"}, {ScopeSystem}} {
+		_, _, err = store.Pair(code, "Телефон", scopes)
+		assert.True(t, errors.Is(err, ErrNoScopes), scopes)
+	}
+	assert.Empty(t, store.Devices())
+
+	// Устройство не получает прав больше, чем разрешает код
+	token, device, err := store.Pair(code, "Телефон", []string{ScopeChat, ScopeSystem})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, []string{ScopeChat}, device.Scopes)
+	assert.NotContains(t, device.TokenHash, token)
+
+	// Код одноразовый
+	_, _, err = store.Pair(code, "Планшет", nil)
+	assert.True(t, errors.Is(err, ErrInvalidCode))
+
+	authenticated, ok := store.Authenticate(token)
+	assert.True(t, ok)
+	assert.Equal(t, "Телефон", authenticated.Name)
+	assert.True(t, authenticated.HasScope(ScopeChat))
+	assert.False(t, authenticated.HasScope(ScopeSystem))
+	_, ok = store.Authenticate("чужой токен")
+	assert.False(t, ok)
+
+	// Постоянные устройства сохраняются, временные — нет
+	desktopToken, _, err := store.IssueTemporary("Рабочий стол", nil)
+	assert.NoError(t, err)
+	_, ok = store.Authenticate(desktopToken)
+	assert.True(t, ok)
+
+	loaded := NewStore(path)
+	assert.NoError(t, loaded.Load())
+	if assert.Len(t, loaded.Devices(), 1) {
+		assert.Equal(t, "Телефон", loaded.Devices()[0].Name)
+	}
+	_, ok = loaded.Authenticate(token)
+	assert.True(t, ok)
+
+	// Отзыв по имени без учета регистра
+	revoked, err := loaded.Revoke("телефон")
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 1)
+	_, ok = loaded.Authenticate(token)
+	assert.False(t, ok)
+
+	reloaded := NewStore(path)
+	assert.NoError(t, reloaded.Load())
+	assert.Empty(t, reloaded.Devices())
+}
+
+func TestPairingAttempts(t *testing.T) {
+	store := NewStore("")
+	code, _, err := store.NewPairingCode(nil)
+	assert.NoError(t, err)
+
+	// После нескольких неверных попыток код перестает действовать
+	for i := 0; i < maxCodeAttempts; i++ {
+		_, _, err = store.Pair("wrong", "Устройство", nil)
+		assert.True(t, errors.Is(err, ErrInvalidCode))
+	}
+	_, _, err = store.Pair(code, "Устройство", nil)
+	assert.True(t, errors.Is(err, ErrInvalidCode))
+
+	// Код без единого известного права не выдается
+	_, _, err = store.NewPairingCode([]string{"admin"})
+	assert.True(t, errors.Is(err, ErrNoScopes))
+
+	// Новый код дает все права
+	code, _, _ = store.NewPairingCode(nil)
+	_, device, err := store.Pair(code, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, AllScopes, device.Scopes)
+	assert.Equal(t, "Устройство", device.Name)
+}
+
+func TestRequestHelpers(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://localhost:8080/ws?token=abc", nil)
+	assert.Equal(t, "abc", TokenFromRequest(r))
+	r.Header.Set("Authorization", "Bearer xyz")
+	assert.Equal(t, "xyz", TokenFromRequest(r))
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://localhost:8080", true},
+		{"http://evil.example", false},
+		{"https://kot.example", true},
+		{"http://localhost:9090", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://localhost:8080/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		assert.Equal(t, tt.want, CheckOrigin(r, []string{"https://kot.example/"}), tt.origin)
+	}
+}
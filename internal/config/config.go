@@ -1,76 +1,200 @@
+// Package config — единственное описание настроек приложения. Пакеты
+// ассистента, голоса, интерфейса и мобильного подключения используют
+// типы разделов отсюда, поэтому файл настроек и конструкторы не могут
+// разойтись.
 package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+
+	"github.com/ztrue/tracerr"
 )
 
+// PathEnv — переменная окружения с путем к файлу настроек
+const PathEnv = "KOT_CONFIG"
+
 // Config содержит все настройки приложения
 type Config struct {
+	Version         int             `json:"version"` // версия формата файла, см. CurrentVersion
 	AssistantConfig AssistantConfig `json:"assistant"`
 	VoiceConfig     VoiceConfig     `json:"voice"`
 	UIConfig        UIConfig        `json:"ui"`
 	MobileConfig    MobileConfig    `json:"mobile"`
+	SecurityConfig  SecurityConfig  `json:"security"`
 }
 
 // AssistantConfig содержит настройки ассистента
 type AssistantConfig struct {
-	Name            string `json:"name"`
-	OpenAIAPIKey    string `json:"openai_api_key"`
-	GoogleAPIKey    string `json:"google_api_key"`
-	UseLocalModels  bool   `json:"use_local_models"`
-	LocalModelPath  string `json:"local_model_path"`
-	HistoryEnabled  bool   `json:"history_enabled"`
-	HistoryFilePath string `json:"history_file_path"`
+	Name               string   `json:"name"`
+	OpenAIAPIKey       string   `json:"openai_api_key"`
+	GoogleAPIKey       string   `json:"google_api_key"`
+	UseLocalModels     bool     `json:"use_local_models"`
+	LocalModelPath     string   `json:"local_model_path"`
+	HistoryEnabled     bool     `json:"history_enabled"`
+	HistoryFilePath    string   `json:"history_file_path"`
+	HistoryMaxAgeDays  int      `json:"history_max_age_days"` // сколько дней хранить историю; 0 — без ограничения
+	HistoryMaxEntries  int      `json:"history_max_entries"`  // сколько записей хранить; 0 — без ограничения
+	HistoryBackupPath  string   `json:"history_backup_path"`  // куда сохранять историю перед очисткой
+	LLMProvider        string   `json:"llm_provider"`         // openai, local, fake; пусто — по use_local_models
+	LLMModel           string   `json:"llm_model"`
+	LLMBaseURL         string   `json:"llm_base_url"`
+	LLMTemperature     *float32 `json:"llm_temperature"`      // 0..2; не задано — 0.7
+	LLMTimeout         int      `json:"llm_timeout"`          // секунд
+	ContextTurns       int      `json:"context_turns"`        // сколько последних реплик разговора передавать модели
+	ContextTokenBudget int      `json:"context_token_budget"` // предел размера контекста в токенах
+	IntentThreshold    float64  `json:"intent_threshold"`     // минимальная уверенность распознавания команды
+	WeatherProvider    string   `json:"weather_provider"`     // wttr, none
+	WeatherURL         string   `json:"weather_url"`          // адрес wttr.in или совместимого сервера
+	WeatherLocation    string   `json:"weather_location"`     // место по умолчанию; пусто — по IP-адресу
+
+	AppAliases        map[string][]string `json:"app_aliases"`         // "браузер" → ["firefox", "chrome"]
+	AppCatalogPath    string              `json:"app_catalog_path"`    // кэш каталога приложений
+	AppCatalogRefresh int                 `json:"app_catalog_refresh"` // минут
+
+	PolicyRules  []PolicyRule `json:"policy_rules"`   // правила allow/deny/confirm для команд
+	ConfirmRisk  string       `json:"confirm_risk"`   // medium, high; с какого риска спрашивать подтверждение
+	AuditLogPath string       `json:"audit_log_path"` // журнал решений по командам; пусто — не вести
+}
+
+// PolicyRule разрешает, запрещает или требует подтверждать команду.
+// Command — имя команды или "*"; Origin — источник ("voice", "web", "mobile"), пусто — любой.
+type PolicyRule struct {
+	Command string `json:"command"`
+	Origin  string `json:"origin,omitempty"`
+	Action  string `json:"action"` // allow, deny, confirm
 }
 
 // VoiceConfig содержит настройки голосового модуля
 type VoiceConfig struct {
-	Enabled           bool    `json:"enabled"`
-	WakeWord          string  `json:"wake_word"`
-	Language          string  `json:"language"`
-	VoiceRecognition  string  `json:"voice_recognition"` // google, local, whisper
-	TTSProvider       string  `json:"tts_provider"`      // google, local
-	VoiceThreshold    float64 `json:"voice_threshold"`
-	SilenceThreshold  float64 `json:"silence_threshold"`
-	InputDevice       string  `json:"input_device"`
-	OutputDevice      string  `json:"output_device"`
+	Enabled          bool   `json:"enabled"`
+	WakeWord         string `json:"wake_word"`
+	Language         string `json:"language"`
+	VoiceRecognition string `json:"voice_recognition"` // google, local, whisper
+	TTSProvider      string `json:"tts_provider"`      // google, espeak-ng, rhvoice, piper; local — espeak-ng
+	InputDevice      string `json:"input_device"`
+	OutputDevice     string `json:"output_device"`
+	OpenAIAPIKey     string `json:"openai_api_key,omitempty"` // для whisper; пусто — ключ из раздела assistant
+	GoogleAPIKey     string `json:"google_api_key,omitempty"` // пусто — ключ из раздела assistant
+
+	STTEngine    string `json:"stt_engine"`     // whisper.cpp, vosk — движок для voice_recognition: local
+	STTModelPath string `json:"stt_model_path"` // модель whisper.cpp
+	STTThreads   int    `json:"stt_threads"`    // потоков процессора; 0 — по числу ядер
+	STTCommand   string `json:"stt_command"`    // программа whisper.cpp
+	STTServerURL string `json:"stt_server_url"` // адрес vosk-server
+
+	TTSVoice     string  `json:"tts_voice"`      // голос; для Piper — файл модели .onnx
+	TTSRate      float64 `json:"tts_rate"`       // скорость речи, 1 — обычная
+	TTSPitch     float64 `json:"tts_pitch"`      // высота голоса, 1 — обычная
+	TTSCommand   string  `json:"tts_command"`    // программа синтеза
+	TTSURL       string  `json:"tts_url"`        // адрес облачного синтеза
+	TTSCachePath string  `json:"tts_cache_path"` // каталог кэша фраз; пусто — без кэша
+
+	WakeWordEngine      string  `json:"wake_word_engine"`      // template — по образцам, stt — распознаванием каждой фразы
+	WakeWordTemplates   string  `json:"wake_word_templates"`   // каталог образцов ключевого слова (*.wav)
+	WakeWordSensitivity float64 `json:"wake_word_sensitivity"` // чувствительность от 0 до 1
+
+	VADAggressiveness int `json:"vad_aggressiveness"`   // 0..3: как строго шум отделяется от речи
+	VADPreRollMs      int `json:"vad_pre_roll_ms"`      // запись до начала речи, которая добавляется к фразе
+	VADHangoverMs     int `json:"vad_hangover_ms"`      // тишина, которая заканчивает фразу
+	VADMaxUtteranceMs int `json:"vad_max_utterance_ms"` // фраза длиннее обрывается
+
+	BargeIn      string  `json:"barge_in"`       // speech — ответ прерывает любая речь, wake_word — только ключевое слово
+	EchoMarginDb float64 `json:"echo_margin_db"` // насколько голос должен быть громче эха ответа, дБ
+
+	FollowUpSeconds int `json:"follow_up_seconds"` // сколько ждать продолжения без ключевого слова; 0 — не ждать
+
+	ActivationMode string `json:"activation_mode"` // wake_word, push_to_talk, toggle
+	Hotkey         string `json:"hotkey"`          // сочетание для push_to_talk и toggle, например ctrl+alt+space
+	HotkeyBackend  string `json:"hotkey_backend"`  // auto, x11, evdev
+	HotkeyDevice   string `json:"hotkey_device"`   // клавиатура evdev; пусто — все клавиатуры
 }
 
 // UIConfig содержит настройки пользовательского интерфейса
 type UIConfig struct {
-	Enabled      bool   `json:"enabled"`
-	UIType       string `json:"ui_type"` // web, tray, console
-	WebPort      int    `json:"web_port"`
-	Theme        string `json:"theme"`
+	Enabled        bool   `json:"enabled"`
+	UIType         string `json:"ui_type"` // web, tray, console
+	WebPort        int    `json:"web_port"`
+	Theme          string `json:"theme"`
 	StartMinimized bool   `json:"start_minimized"`
+
+	LocalOnly      bool     `json:"local_only"`      // принимать подключения только с этого компьютера
+	AllowedOrigins []string `json:"allowed_origins"` // другие страницы, которым разрешен доступ
+	DevicesPath    string   `json:"devices_path"`    // список подключенных устройств
 }
 
 // MobileConfig содержит настройки для мобильного подключения
 type MobileConfig struct {
-	Enabled       bool   `json:"enabled"`       // Включено ли мобильное подключение
-	USBEnabled    bool   `json:"usb_enabled"`    // Включено ли USB-подключение
-	ADBPath       string `json:"adb_path"`       // Путь к ADB (Android Debug Bridge)
-	WebUIEnabled  bool   `json:"webui_enabled"`  // Включен ли веб-интерфейс для мобильных устройств
-	WebUIPort     int    `json:"webui_port"`     // Порт для веб-интерфейса мобильных устройств
-	AutoConnect   bool   `json:"auto_connect"`   // Автоматически подключаться к устройству при запуске
+	Enabled      bool   `json:"enabled"`       // Включено ли мобильное подключение
+	USBEnabled   bool   `json:"usb_enabled"`   // Включено ли USB-подключение
+	ADBPath      string `json:"adb_path"`      // Путь к ADB (Android Debug Bridge)
+	WebUIEnabled bool   `json:"webui_enabled"` // Включен ли веб-интерфейс для мобильных устройств
+	WebUIPort    int    `json:"webui_port"`    // Порт для веб-интерфейса мобильных устройств
+	AutoConnect  bool   `json:"auto_connect"`  // Автоматически подключаться к устройству при запуске
+}
+
+// SecurityConfig содержит настройки шифрования и хранения секретов.
+// Строковые настройки любого раздела можно задать ссылкой "secret:имя"
+// на секрет, сохраненный командой kot secrets set.
+type SecurityConfig struct {
+	KeySource      string `json:"key_source"`      // keyring — связка ключей системы, passphrase — пароль из KOT_PASSPHRASE
+	KeysPath       string `json:"keys_path"`       // ключи шифрования, защищенные главным ключом
+	SecretsPath    string `json:"secrets_path"`    // зашифрованные секреты
+	EncryptHistory bool   `json:"encrypt_history"` // шифровать историю команд
 }
 
 // DefaultConfig возвращает конфигурацию по умолчанию
 func DefaultConfig() *Config {
 	homeDir, _ := os.UserHomeDir()
 	historyPath := filepath.Join(homeDir, ".kot.ai", "history.db")
+	historyBackupPath := filepath.Join(homeDir, ".kot.ai", "history-backups")
+	appCatalogPath := filepath.Join(homeDir, ".kot.ai", "apps.json")
+	auditLogPath := filepath.Join(homeDir, ".kot.ai", "audit.log")
+	devicesPath := filepath.Join(homeDir, ".kot.ai", "devices.json")
+	ttsCachePath := filepath.Join(homeDir, ".kot.ai", "tts-cache")
+	wakeWordTemplates := filepath.Join(homeDir, ".kot.ai", "wakeword")
+	llmTemperature := float32(0.7)
+	keysPath := filepath.Join(homeDir, ".kot.ai", "keys.json")
+	secretsPath := filepath.Join(homeDir, ".kot.ai", "secrets.json")
 
 	return &Config{
+		Version: CurrentVersion,
 		AssistantConfig: AssistantConfig{
-			Name:            "KOT.AI",
-			OpenAIAPIKey:    "",
-			GoogleAPIKey:    "",
-			UseLocalModels:  false,
-			LocalModelPath:  "",
-			HistoryEnabled:  true,
-			HistoryFilePath: historyPath,
+			Name:               "KOT.AI",
+			OpenAIAPIKey:       "",
+			GoogleAPIKey:       "",
+			UseLocalModels:     false,
+			LocalModelPath:     "",
+			HistoryEnabled:     true,
+			HistoryFilePath:    historyPath,
+			HistoryMaxAgeDays:  0,
+			HistoryMaxEntries:  0,
+			HistoryBackupPath:  historyBackupPath,
+			LLMProvider:        "",
+			LLMModel:           "",
+			LLMBaseURL:         "",
+			LLMTemperature:     &llmTemperature,
+			LLMTimeout:         30,
+			ContextTurns:       10,
+			ContextTokenBudget: 2000,
+			IntentThreshold:    0.7,
+			WeatherProvider:    "wttr",
+			WeatherURL:         "",
+			WeatherLocation:    "",
+			AppAliases: map[string][]string{
+				"браузер":     {"firefox", "google-chrome", "chromium", "chrome", "msedge"},
+				"блокнот":     {"gnome-text-editor", "gedit", "kate", "mousepad", "notepad"},
+				"калькулятор": {"gnome-calculator", "kcalc", "calc"},
+				"терминал":    {"gnome-terminal", "konsole", "xterm", "wt", "cmd"},
+				"проводник":   {"nautilus", "dolphin", "thunar", "explorer"},
+			},
+			AppCatalogPath:    appCatalogPath,
+			AppCatalogRefresh: 60,
+			ConfirmRisk:       "high",
+			AuditLogPath:      auditLogPath,
 		},
 		VoiceConfig: VoiceConfig{
 			Enabled:          true,
@@ -78,10 +202,37 @@ func DefaultConfig() *Config {
 			Language:         "ru-RU",
 			VoiceRecognition: "google",
 			TTSProvider:      "google",
-			VoiceThreshold:   0.5,
-			SilenceThreshold: 0.1,
 			InputDevice:      "",
 			OutputDevice:     "",
+			STTEngine:        "whisper.cpp",
+			STTModelPath:     "",
+			STTThreads:       0,
+			STTCommand:       "",
+			STTServerURL:     "",
+			TTSVoice:         "",
+			TTSRate:          1,
+			TTSPitch:         1,
+			TTSCommand:       "",
+			TTSURL:           "",
+			TTSCachePath:     ttsCachePath,
+
+			WakeWordEngine:      "template",
+			WakeWordTemplates:   wakeWordTemplates,
+			WakeWordSensitivity: 0.5,
+
+			VADAggressiveness: 2,
+			VADPreRollMs:      300,
+			VADHangoverMs:     800,
+			VADMaxUtteranceMs: 15000,
+
+			BargeIn:      "speech",
+			EchoMarginDb: 6,
+
+			FollowUpSeconds: 5,
+
+			ActivationMode: "wake_word",
+			Hotkey:         "ctrl+alt+space",
+			HotkeyBackend:  "auto",
 		},
 		UIConfig: UIConfig{
 			Enabled:        true,
@@ -89,89 +240,170 @@ func DefaultConfig() *Config {
 			WebPort:        8080,
 			Theme:          "dark",
 			StartMinimized: false,
+			LocalOnly:      true,
+			AllowedOrigins: []string{},
+			DevicesPath:    devicesPath,
 		},
 		MobileConfig: MobileConfig{
-			Enabled:       false,
-			USBEnabled:    true,
-			ADBPath:       "",
-			WebUIEnabled:  true,
-			WebUIPort:     8081,
-			AutoConnect:   false,
+			Enabled:      false,
+			USBEnabled:   true,
+			ADBPath:      "",
+			WebUIEnabled: true,
+			WebUIPort:    8081,
+			AutoConnect:  false,
+		},
+		SecurityConfig: SecurityConfig{
+			KeySource:      "keyring",
+			KeysPath:       keysPath,
+			SecretsPath:    secretsPath,
+			EncryptHistory: false,
 		},
 	}
 }
 
-// Load загружает конфигурацию из файла
+// DefaultPath возвращает путь к файлу настроек: из переменной KOT_CONFIG
+// или ~/.kot.ai/config.json
+func DefaultPath() string {
+	if path := os.Getenv(PathEnv); path != "" {
+		return path
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".kot.ai", "config.json")
+}
+
+// Load загружает настройки из DefaultPath, создавая файл при первом
+// запуске, и применяет переопределения из окружения
 func Load() (*Config, error) {
-	homeDir, err := os.UserHomeDir()
+	cfg, err := LoadOrCreate(DefaultPath())
 	if err != nil {
 		return nil, err
 	}
+	if _, err := cfg.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
-	configDir := filepath.Join(homeDir, ".kot.ai")
-	configPath := filepath.Join(configDir, "config.json")
-
-	// Создаем директорию, если она не существует
-	if _, err := os.Stat(configDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(configDir, 0755); err != nil {
+// LoadOrCreate загружает настройки из файла path, а если его нет,
+// сохраняет туда настройки по умолчанию
+func LoadOrCreate(path string) (*Config, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		cfg := DefaultConfig()
+		if err := cfg.SaveFile(path); err != nil {
 			return nil, err
 		}
+		return cfg, nil
+	}
+	return LoadFile(path)
+}
+
+// LoadFile загружает настройки из файла path. Файл прежней версии
+// переводится в текущий формат и перезаписывается, а его копия
+// сохраняется рядом. Настройки, которых в файле нет, берутся по умолчанию.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
 
-	// Проверяем существование файла конфигурации
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		// Создаем конфигурацию по умолчанию
-		defaultCfg := DefaultConfig()
+	// В настройках могут быть ключи API: файл должен читать только владелец
+	if err := restrictPermissions(path); err != nil {
+		return nil, err
+	}
+
+	cfg, version, err := parse(data)
+	if err != nil {
+		return nil, tracerr.New(fmt.Sprintf("Файл настроек %s: %v", path, err))
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, tracerr.New(fmt.Sprintf("Файл настроек %s: %v", path, err))
+	}
 
-		// Сохраняем конфигурацию по умолчанию
-		data, err := json.MarshalIndent(defaultCfg, "", "  ")
-		if err != nil {
+	if version < CurrentVersion {
+		backup := fmt.Sprintf("%s.v%d.bak", path, version)
+		if err := os.WriteFile(backup, data, 0600); err != nil {
 			return nil, err
 		}
-
-		if err := os.WriteFile(configPath, data, 0644); err != nil {
+		if err := cfg.SaveFile(path); err != nil {
 			return nil, err
 		}
+	}
+	return cfg, nil
+}
 
-		return defaultCfg, nil
+// Save проверяет настройки и сохраняет их в DefaultPath
+func (c *Config) Save() error {
+	return c.SaveFile(DefaultPath())
+}
+
+// SaveFile проверяет настройки и сохраняет их в файл path
+func (c *Config) SaveFile(path string) error {
+	if err := c.Validate(); err != nil {
+		return err
 	}
 
-	// Загружаем существующую конфигурацию
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, err
+	// Создаем директорию, если она не существует
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	saved := *c
+	saved.Version = CurrentVersion
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
 	}
+	return writeConfig(path, data)
+}
 
-	return &cfg, nil
+// Clone возвращает независимую копию настроек
+func (c *Config) Clone() *Config {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	var clone Config
+	if err := json.Unmarshal(data, &clone); err != nil {
+		panic(err)
+	}
+	return &clone
 }
 
-// Save сохраняет конфигурацию в файл
-func (c *Config) Save() error {
-	homeDir, err := os.UserHomeDir()
+// writeConfig записывает файл настроек, доступный только владельцу, так,
+// чтобы при сбое и при чтении из другого процесса файл был целым
+func writeConfig(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
-
-	configDir := filepath.Join(homeDir, ".kot.ai")
-	configPath := filepath.Join(configDir, "config.json")
-
-	// Создаем директорию, если она не существует
-	if _, err := os.Stat(configDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(configDir, 0755); err != nil {
+	defer os.Remove(temp.Name())
+	if runtime.GOOS != "windows" {
+		if err := temp.Chmod(0600); err != nil {
+			temp.Close()
 			return err
 		}
 	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
 
-	// Сохраняем конфигурацию
-	data, err := json.MarshalIndent(c, "", "  ")
+// restrictPermissions убирает доступ к файлу у группы и остальных
+func restrictPermissions(path string) error {
+	info, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(configPath, data, 0644)
-}
\ No newline at end of file
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return os.Chmod(path, info.Mode().Perm()&0700)
+	}
+	return nil
+}
@@ -1,238 +1,358 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// testConfig возвращает настройки, отличные от настроек по умолчанию
+func testConfig(dir string) *Config {
+	cfg := DefaultConfig()
+	cfg.AssistantConfig.Name = "TestAssistant"
+	cfg.AssistantConfig.OpenAIAPIKey = "test-key"
+	cfg.AssistantConfig.GoogleAPIKey = "test-google-key"
+	cfg.AssistantConfig.HistoryFilePath = filepath.Join(dir, "history.db")
+	cfg.VoiceConfig.WakeWord = "тест"
+	cfg.VoiceConfig.VADAggressiveness = 3
+	cfg.UIConfig.WebPort = 9090
+	return cfg
+}
+
 func TestLoadConfig(t *testing.T) {
-	// Создаем временный файл для конфигурации
-	tempDir, err := os.MkdirTemp("", "kot-ai-config-test")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tempDir)
-
-	configPath := filepath.Join(tempDir, "config.json")
-
-	// Создаем тестовую конфигурацию
-	testConfig := Config{
-		Assistant: AssistantConfig{
-			Name:           "TestAssistant",
-			OpenAIAPIKey:   "test-key",
-			GoogleAPIKey:   "test-google-key",
-			UseLocalModels: false,
-			LocalModelPath: "",
-			HistoryEnabled: true,
-			HistoryPath:    filepath.Join(tempDir, "history.db"),
-		},
-		Voice: VoiceConfig{
-			Enabled:          true,
-			WakeWord:         "тест",
-			Language:         "ru-RU",
-			VoiceRecognition: "google",
-			TTSProvider:      "google",
-			VoiceThreshold:   0.5,
-			SilenceThreshold: 0.1,
-			InputDevice:      "",
-			OutputDevice:     "",
-		},
-		UI: UIConfig{
-			Enabled:        true,
-			UIType:         "web",
-			WebPort:        8080,
-			Theme:          "dark",
-			StartMinimized: false,
-		},
-	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
 
-	// Сохраняем тестовую конфигурацию
-	err = SaveConfig(testConfig, configPath)
-	assert.NoError(t, err)
+	saved := testConfig(dir)
+	assert.NoError(t, saved.SaveFile(path))
 
-	// Загружаем конфигурацию
-	loadedConfig, err := LoadConfig(configPath)
-	assert.NoError(t, err)
+	loaded, err := LoadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, saved, loaded)
 
-	// Проверяем, что загруженная конфигурация соответствует сохраненной
-	assert.Equal(t, testConfig.Assistant.Name, loadedConfig.Assistant.Name)
-	assert.Equal(t, testConfig.Assistant.OpenAIAPIKey, loadedConfig.Assistant.OpenAIAPIKey)
-	assert.Equal(t, testConfig.Assistant.GoogleAPIKey, loadedConfig.Assistant.GoogleAPIKey)
-	assert.Equal(t, testConfig.Assistant.UseLocalModels, loadedConfig.Assistant.UseLocalModels)
-	assert.Equal(t, testConfig.Assistant.LocalModelPath, loadedConfig.Assistant.LocalModelPath)
-	assert.Equal(t, testConfig.Assistant.HistoryEnabled, loadedConfig.Assistant.HistoryEnabled)
-	assert.Equal(t, testConfig.Assistant.HistoryPath, loadedConfig.Assistant.HistoryPath)
-
-	assert.Equal(t, testConfig.Voice.Enabled, loadedConfig.Voice.Enabled)
-	assert.Equal(t, testConfig.Voice.WakeWord, loadedConfig.Voice.WakeWord)
-	assert.Equal(t, testConfig.Voice.Language, loadedConfig.Voice.Language)
-	assert.Equal(t, testConfig.Voice.VoiceRecognition, loadedConfig.Voice.VoiceRecognition)
-	assert.Equal(t, testConfig.Voice.TTSProvider, loadedConfig.Voice.TTSProvider)
-	assert.Equal(t, testConfig.Voice.VoiceThreshold, loadedConfig.Voice.VoiceThreshold)
-	assert.Equal(t, testConfig.Voice.SilenceThreshold, loadedConfig.Voice.SilenceThreshold)
-	assert.Equal(t, testConfig.Voice.InputDevice, loadedConfig.Voice.InputDevice)
-	assert.Equal(t, testConfig.Voice.OutputDevice, loadedConfig.Voice.OutputDevice)
-
-	assert.Equal(t, testConfig.UI.Enabled, loadedConfig.UI.Enabled)
-	assert.Equal(t, testConfig.UI.UIType, loadedConfig.UI.UIType)
-	assert.Equal(t, testConfig.UI.WebPort, loadedConfig.UI.WebPort)
-	assert.Equal(t, testConfig.UI.Theme, loadedConfig.UI.Theme)
-	assert.Equal(t, testConfig.UI.StartMinimized, loadedConfig.UI.StartMinimized)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
 }
 
 func TestLoadConfigNotExist(t *testing.T) {
-	// Создаем временный путь для несуществующего файла конфигурации
-	tempDir, err := os.MkdirTemp("", "kot-ai-config-test")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tempDir)
-
-	configPath := filepath.Join(tempDir, "non-existent-config.json")
+	path := filepath.Join(t.TempDir(), "kot", "config.json")
 
-	// Загружаем конфигурацию из несуществующего файла
-	config, err := LoadConfig(configPath)
-
-	// Проверяем, что возвращена ошибка
-	assert.Error(t, err)
-	// Проверяем, что возвращена пустая конфигурация
-	assert.Equal(t, Config{}, config)
-}
+	// LoadFile не создает файл
+	cfg, err := LoadFile(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, cfg)
 
-func TestSaveConfig(t *testing.T) {
-	// Создаем временный файл для конфигурации
-	tempDir, err := os.MkdirTemp("", "kot-ai-config-test")
+	// LoadOrCreate сохраняет настройки по умолчанию вместе с каталогом
+	cfg, err = LoadOrCreate(path)
 	assert.NoError(t, err)
-	defer os.RemoveAll(tempDir)
-
-	configPath := filepath.Join(tempDir, "config.json")
-
-	// Создаем тестовую конфигурацию
-	testConfig := Config{
-		Assistant: AssistantConfig{
-			Name:           "TestAssistant",
-			OpenAIAPIKey:   "test-key",
-			GoogleAPIKey:   "test-google-key",
-			UseLocalModels: false,
-			LocalModelPath: "",
-			HistoryEnabled: true,
-			HistoryPath:    filepath.Join(tempDir, "history.db"),
-		},
-		Voice: VoiceConfig{
-			Enabled:          true,
-			WakeWord:         "тест",
-			Language:         "ru-RU",
-			VoiceRecognition: "google",
-			TTSProvider:      "google",
-			VoiceThreshold:   0.5,
-			SilenceThreshold: 0.1,
-			InputDevice:      "",
-			OutputDevice:     "",
-		},
-		UI: UIConfig{
-			Enabled:        true,
-			UIType:         "web",
-			WebPort:        8080,
-			Theme:          "dark",
-			StartMinimized: false,
-		},
+	assert.Equal(t, DefaultConfig(), cfg)
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(filepath.Dir(path))
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
 	}
+}
 
-	// Сохраняем тестовую конфигурацию
-	err = SaveConfig(testConfig, configPath)
-	assert.NoError(t, err)
+func TestSaveConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
 
-	// Проверяем, что файл конфигурации создан
-	_, err = os.Stat(configPath)
+	// Файл с лишними правами исправляется при загрузке
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": 1}`), 0644))
+	_, err := LoadFile(path)
 	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(path)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
 
-	// Проверяем содержимое файла
-	content, err := os.ReadFile(configPath)
+	assert.NoError(t, testConfig(dir).SaveFile(path))
+	content, err := os.ReadFile(path)
 	assert.NoError(t, err)
 	assert.Contains(t, string(content), "TestAssistant")
 	assert.Contains(t, string(content), "test-key")
 	assert.Contains(t, string(content), "тест")
-	assert.Contains(t, string(content), "ru-RU")
-	assert.Contains(t, string(content), "web")
-	assert.Contains(t, string(content), "8080")
+	assert.Contains(t, string(content), "9090")
+
+	// Ошибочные настройки не сохраняются
+	invalid := testConfig(dir)
+	invalid.UIConfig.WebPort = 0
+	assert.Error(t, invalid.SaveFile(path))
+	loaded, err := LoadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 9090, loaded.UIConfig.WebPort)
 }
 
-func TestGetDefaultConfig(t *testing.T) {
-	// Получаем конфигурацию по умолчанию
-	config := GetDefaultConfig()
-
-	// Проверяем, что конфигурация содержит ожидаемые значения
-	assert.Equal(t, "KOT.AI", config.Assistant.Name)
-	assert.Equal(t, "", config.Assistant.OpenAIAPIKey) // Ключ API должен быть пустым по умолчанию
-	assert.Equal(t, false, config.Assistant.UseLocalModels)
-	assert.Equal(t, true, config.Assistant.HistoryEnabled)
-
-	assert.Equal(t, true, config.Voice.Enabled)
-	assert.Equal(t, "кот", config.Voice.WakeWord)
-	assert.Equal(t, "ru-RU", config.Voice.Language)
-
-	assert.Equal(t, true, config.UI.Enabled)
-	assert.Equal(t, "web", config.UI.UIType)
-	assert.Equal(t, 8080, config.UI.WebPort)
-	assert.Equal(t, "dark", config.UI.Theme)
-	assert.Equal(t, false, config.UI.StartMinimized)
+func TestDefaultConfig(t *testing.T) {
+	config := DefaultConfig()
+
+	assert.Equal(t, "KOT.AI", config.AssistantConfig.Name)
+	assert.Equal(t, "", config.AssistantConfig.OpenAIAPIKey) // Ключ API должен быть пустым по умолчанию
+	assert.Equal(t, false, config.AssistantConfig.UseLocalModels)
+	assert.Equal(t, true, config.AssistantConfig.HistoryEnabled)
+
+	assert.Equal(t, true, config.VoiceConfig.Enabled)
+	assert.Equal(t, "кот", config.VoiceConfig.WakeWord)
+	assert.Equal(t, "ru-RU", config.VoiceConfig.Language)
+
+	assert.Equal(t, true, config.UIConfig.Enabled)
+	assert.Equal(t, "web", config.UIConfig.UIType)
+	assert.Equal(t, 8080, config.UIConfig.WebPort)
+	assert.Equal(t, "dark", config.UIConfig.Theme)
+	assert.Equal(t, false, config.UIConfig.StartMinimized)
+
+	assert.Equal(t, CurrentVersion, config.Version)
+	assert.NoError(t, config.Validate())
 }
 
-func TestGetConfigPath(t *testing.T) {
-	// Получаем путь к конфигурации
-	configPath := GetConfigPath()
+func TestDefaultPath(t *testing.T) {
+	t.Setenv(PathEnv, "")
+	path := DefaultPath()
+	assert.Contains(t, path, ".kot.ai")
+	assert.Contains(t, path, "config.json")
 
-	// Проверяем, что путь не пустой
-	assert.NotEmpty(t, configPath)
+	t.Setenv(PathEnv, "/etc/kot/config.json")
+	assert.Equal(t, "/etc/kot/config.json", DefaultPath())
+}
 
-	// Проверяем, что путь содержит ожидаемые компоненты
-	assert.Contains(t, configPath, ".kot.ai")
-	assert.Contains(t, configPath, "config.json")
+func TestMigrateOldFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	old := `{
+  "assistant": {"name": "Кот", "history_path": "/tmp/h.db", "app_aliases": {"почта": ["thunderbird"]}},
+  "voice": {"enabled": false, "wake_word": "кот", "voice_recognition": "google", "tts_provider": "local"},
+  "ui": {"enabled": true, "ui_type": "web", "web_port": 8090, "theme": "light"}
+}`
+	assert.NoError(t, os.WriteFile(path, []byte(old), 0600))
+
+	cfg, err := LoadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Кот", cfg.AssistantConfig.Name)
+	assert.Equal(t, "/tmp/h.db", cfg.AssistantConfig.HistoryFilePath)
+	assert.Equal(t, map[string][]string{"почта": {"thunderbird"}}, cfg.AssistantConfig.AppAliases)
+	assert.Equal(t, "espeak-ng", cfg.VoiceConfig.TTSProvider)
+	assert.Equal(t, 8090, cfg.UIConfig.WebPort)
+
+	// Настройки, которых в старом файле не было, берутся по умолчанию
+	defaults := DefaultConfig()
+	assert.Equal(t, defaults.VoiceConfig.FollowUpSeconds, cfg.VoiceConfig.FollowUpSeconds)
+	assert.Equal(t, defaults.SecurityConfig, cfg.SecurityConfig)
+	assert.Equal(t, defaults.MobileConfig, cfg.MobileConfig)
+
+	// Файл переписан в новом формате, старый сохранен рядом
+	backup, err := os.ReadFile(path + ".v0.bak")
+	assert.NoError(t, err)
+	assert.Equal(t, old, string(backup))
+	content, _ := os.ReadFile(path)
+	assert.Contains(t, string(content), `"version": 1`)
+	assert.NotContains(t, string(content), "history_path\"")
+
+	// Файл более новой версии не загружается
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": 99}`), 0600))
+	_, err = LoadFile(path)
+	assert.ErrorContains(t, err, "более новой версией")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.UIConfig.WebPort = 70000
+	cfg.UIConfig.UIType = "desktop"
+	cfg.AssistantConfig.IntentThreshold = 1.5
+	cfg.VoiceConfig.VADAggressiveness = 4
+	cfg.AssistantConfig.PolicyRules = []PolicyRule{{Command: "kill_process", Action: "maybe"}}
+	cfg.MobileConfig.Enabled = true
+	cfg.MobileConfig.WebUIPort = 0
+	temperature := float32(2.5)
+	cfg.AssistantConfig.LLMTemperature = &temperature
+
+	err := cfg.Validate()
+	var validation *ValidationError
+	if !assert.True(t, errors.As(err, &validation)) {
+		return
+	}
+	var fields []string
+	for _, problem := range validation.Problems {
+		fields = append(fields, problem.Field)
+	}
+	assert.ElementsMatch(t, []string{
+		"assistant.intent_threshold", "assistant.policy_rules[0].action", "assistant.llm_temperature",
+		"voice.vad_aggressiveness", "ui.ui_type", "ui.web_port", "mobile.webui_port",
+	}, fields)
+	assert.Contains(t, err.Error(), "ui.ui_type: недопустимое значение \"desktop\", ожидается web, tray, console")
 }
 
-func TestEnsureConfigDir(t *testing.T) {
-	// Создаем временный путь для директории конфигурации
-	tempDir, err := os.MkdirTemp("", "kot-ai-config-test")
+func TestApplyEnv(t *testing.T) {
+	cfg := DefaultConfig()
+	overridden, err := cfg.ApplyEnv([]string{
+		"KOT_UI_WEB_PORT=9090",
+		"KOT_VOICE_ENABLED=false",
+		"KOT_ASSISTANT_OPENAI_API_KEY=sk-env",
+		"KOT_ASSISTANT_LLM_TEMPERATURE=0.2",
+		"KOT_UI_ALLOWED_ORIGINS=https://a.example, https://b.example",
+		`KOT_ASSISTANT_POLICY_RULES=[{"command": "*", "origin": "mobile", "action": "deny"}]`,
+		"KOT_PASSPHRASE=не настройка",
+		"HOME=/root",
+	})
 	assert.NoError(t, err)
-	defer os.RemoveAll(tempDir)
+	assert.Equal(t, []string{
+		"assistant.llm_temperature", "assistant.openai_api_key", "assistant.policy_rules",
+		"ui.allowed_origins", "ui.web_port", "voice.enabled",
+	}, overridden)
+	assert.Equal(t, 9090, cfg.UIConfig.WebPort)
+	assert.False(t, cfg.VoiceConfig.Enabled)
+	assert.Equal(t, "sk-env", cfg.AssistantConfig.OpenAIAPIKey)
+	if assert.NotNil(t, cfg.AssistantConfig.LLMTemperature) {
+		assert.InDelta(t, 0.2, *cfg.AssistantConfig.LLMTemperature, 1e-6)
+	}
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.UIConfig.AllowedOrigins)
+	assert.Equal(t, []PolicyRule{{Command: "*", Origin: "mobile", Action: "deny"}}, cfg.AssistantConfig.PolicyRules)
 
-	configDir := filepath.Join(tempDir, ".kot.ai")
+	_, err = cfg.ApplyEnv([]string{"KOT_UI_WEB_PORT=восемь"})
+	assert.ErrorContains(t, err, "KOT_UI_WEB_PORT")
+	assert.Equal(t, "KOT_SECURITY_ENCRYPT_HISTORY", EnvName("security.encrypt_history"))
+}
 
-	// Проверяем, что директория не существует
-	_, err = os.Stat(configDir)
-	assert.True(t, os.IsNotExist(err))
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	assert.NoError(t, testConfig(dir).SaveFile(path))
 
-	// Создаем директорию конфигурации
-	err = ensureConfigDir(configDir)
+	manager, err := NewManager(path, []string{"KOT_UI_THEME=light"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer manager.Close()
+
+	// Переопределения из окружения не попадают в файл
+	assert.Equal(t, "light", manager.Config().UIConfig.Theme)
+	assert.Equal(t, "dark", manager.File().UIConfig.Theme)
+	assert.Equal(t, []string{"ui.theme"}, manager.Overrides())
+	// Голосовой модуль получает ключ ассистента
+	assert.Equal(t, "test-key", manager.Config().VoiceConfig.OpenAIAPIKey)
+
+	// Секреты подставляются только в действующие настройки
+	file := manager.File()
+	file.AssistantConfig.OpenAIAPIKey = "secret:openai"
+	assert.NoError(t, manager.SetResolver(func(cfg *Config) (*Config, error) {
+		return cfg.ResolveSecrets(func(name string) (string, error) { return "sk-" + name, nil })
+	}))
+
+	applied := make(chan *Config, 10)
+	manager.OnChange(func(old, new *Config) error {
+		applied <- new
+		return nil
+	})
+
+	file.UIConfig.WebPort = 9191
+	file.VoiceConfig.WakeWord = "котик"
+	changes, err := manager.Update(file)
 	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Change{
+		{Field: "assistant.openai_api_key"},
+		{Field: "voice.openai_api_key"},
+		{Field: "voice.wake_word"},
+		{Field: "ui.web_port", Restart: true},
+	}, changes)
+	current := <-applied
+	assert.Equal(t, "sk-openai", current.AssistantConfig.OpenAIAPIKey)
+	content, _ := os.ReadFile(path)
+	assert.Contains(t, string(content), `"secret:openai"`)
+
+	// Ошибочные настройки не сохраняются и не применяются
+	file.UIConfig.Theme = "pink"
+	_, err = manager.Update(file)
+	assert.Error(t, err)
+	assert.Equal(t, 9191, manager.Config().UIConfig.WebPort)
+
+	// Правка файла применяется сама
+	manager.Watch(10 * time.Millisecond)
+	edited := manager.File()
+	edited.VoiceConfig.WakeWord = "кися"
+	assert.NoError(t, edited.SaveFile(path))
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	select {
+	case current = <-applied:
+		assert.Equal(t, "кися", current.VoiceConfig.WakeWord)
+	case <-time.After(5 * time.Second):
+		t.Fatal("изменение файла не применено")
+	}
 
-	// Проверяем, что директория создана
-	_, err = os.Stat(configDir)
-	assert.NoError(t, err)
+	// Файл с ошибкой не применяется
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": 1, "ui": {"web_port": -1}}`), 0600))
+	os.Chtimes(path, time.Now().Add(2*time.Second), time.Now().Add(2*time.Second))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "кися", manager.Config().VoiceConfig.WakeWord)
 }
 
-func TestInitConfig(t *testing.T) {
-	// Создаем временный путь для директории конфигурации
-	tempDir, err := os.MkdirTemp("", "kot-ai-config-test")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tempDir)
+func TestNeedsRestart(t *testing.T) {
+	assert.True(t, NeedsRestart("ui.web_port"))
+	assert.True(t, NeedsRestart("security.encrypt_history"))
+	assert.False(t, NeedsRestart("ui.theme"))
+	assert.False(t, NeedsRestart("voice.wake_word"))
+	assert.False(t, NeedsRestart("ui.web_port_extra"))
+}
 
-	// Устанавливаем временный путь для конфигурации
-	oldConfigDir := configDir
-	configDir = filepath.Join(tempDir, ".kot.ai")
-	defer func() { configDir = oldConfigDir }()
+func TestRedacted(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.AssistantConfig.GoogleAPIKey = "secret:google"
+	cfg.VoiceConfig.OpenAIAPIKey = ""
 
-	// Инициализируем конфигурацию
-	config, err := InitConfig()
+	redacted := cfg.Redacted()
+	assert.Equal(t, RedactedValue, redacted.AssistantConfig.OpenAIAPIKey)
+	assert.Equal(t, "secret:google", redacted.AssistantConfig.GoogleAPIKey)
+	assert.Equal(t, "", redacted.VoiceConfig.OpenAIAPIKey)
+	assert.Equal(t, "test-key", cfg.AssistantConfig.OpenAIAPIKey)
+
+	// Присланные обратно настройки сохраняют прежние ключи, новые ключи
+	// заменяют прежние
+	data, err := json.Marshal(redacted)
+	assert.NoError(t, err)
+	edited, err := Parse(data)
 	assert.NoError(t, err)
+	edited.VoiceConfig.GoogleAPIKey = "voice-key"
+	edited.UIConfig.Theme = "light"
+
+	restored := edited.Unredact(cfg)
+	assert.Equal(t, "test-key", restored.AssistantConfig.OpenAIAPIKey)
+	assert.Equal(t, "secret:google", restored.AssistantConfig.GoogleAPIKey)
+	assert.Equal(t, "voice-key", restored.VoiceConfig.GoogleAPIKey)
+	assert.Equal(t, "light", restored.UIConfig.Theme)
+	assert.Equal(t, RedactedValue, edited.AssistantConfig.OpenAIAPIKey)
+}
 
-	// Проверяем, что конфигурация инициализирована
-	assert.NotEmpty(t, config.Assistant.Name)
-	assert.NotEmpty(t, config.Voice.WakeWord)
-	assert.NotEmpty(t, config.UI.UIType)
+func TestParse(t *testing.T) {
+	// Словари из присланных настроек заменяют, а не дополняют значения
+	// по умолчанию
+	cfg, err := Parse([]byte(`{"version": 1, "assistant": {"app_aliases": {"почта": ["thunderbird"]}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"почта": {"thunderbird"}}, cfg.AssistantConfig.AppAliases)
+	assert.Equal(t, DefaultConfig().UIConfig, cfg.UIConfig)
 
-	// Проверяем, что файл конфигурации создан
-	configPath := filepath.Join(configDir, "config.json")
-	_, err = os.Stat(configPath)
+	// Нулевая температура сохраняется, null возвращает значение по умолчанию
+	cfg, err = Parse([]byte(`{"version": 1, "assistant": {"llm_temperature": 0}}`))
+	assert.NoError(t, err)
+	if assert.NotNil(t, cfg.AssistantConfig.LLMTemperature) {
+		assert.Equal(t, float32(0), *cfg.AssistantConfig.LLMTemperature)
+	}
+	assert.NoError(t, cfg.Validate())
+	cfg, err = Parse([]byte(`{"version": 1, "assistant": {"llm_temperature": null}}`))
 	assert.NoError(t, err)
-}
\ No newline at end of file
+	assert.Nil(t, cfg.AssistantConfig.LLMTemperature)
+
+	_, err = Parse([]byte(`{"ui": {"web_port": "восемь"}}`))
+	assert.Error(t, err)
+}
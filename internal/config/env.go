@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// EnvPrefix начинает переменные окружения, которые переопределяют
+// настройки: KOT_UI_WEB_PORT=9090, KOT_ASSISTANT_OPENAI_API_KEY=sk-...
+const EnvPrefix = "KOT_"
+
+// EnvName возвращает переменную окружения для настройки field
+// ("ui.web_port" → "KOT_UI_WEB_PORT")
+func EnvName(field string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(field, ".", "_"))
+}
+
+// ApplyEnv переопределяет настройки переменными окружения environ
+// в формате os.Environ и возвращает пути переопределенных настроек.
+// Списки строк задаются через запятую, словари и списки правил — в JSON.
+func (c *Config) ApplyEnv(environ []string) ([]string, error) {
+	values := make(map[string]string)
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if ok && strings.HasPrefix(name, EnvPrefix) {
+			values[name] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	var overridden []string
+	err := walkFields(reflect.ValueOf(c).Elem(), "", func(path string, field reflect.Value) error {
+		if !strings.Contains(path, ".") {
+			return nil // version
+		}
+		name := EnvName(path)
+		value, ok := values[name]
+		if !ok {
+			return nil
+		}
+		if err := setField(field, value); err != nil {
+			return tracerr.New(fmt.Sprintf("Переменная %s: %v", name, err))
+		}
+		overridden = append(overridden, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(overridden)
+	return overridden, nil
+}
+
+// setField записывает в поле значение из переменной окружения
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("ожидается true или false")
+		}
+		field.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("ожидается целое число")
+		}
+		field.SetInt(int64(parsed))
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("ожидается число")
+		}
+		field.SetFloat(parsed)
+	case reflect.Pointer:
+		// Необязательное значение: переменная задает его явно
+		target := reflect.New(field.Type().Elem())
+		if err := setField(target.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(target)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			items := []string{}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+			return nil
+		}
+		fallthrough
+	default:
+		target := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(value), target.Interface()); err != nil {
+			return tracerr.New(fmt.Sprintf("ожидается JSON: %v", err))
+		}
+		field.Set(target.Elem())
+	}
+	return nil
+}
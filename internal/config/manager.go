@@ -0,0 +1,339 @@
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchInterval — как часто Manager проверяет, не изменился ли файл
+const WatchInterval = 2 * time.Second
+
+// restartFields — настройки, которые работающая программа применить
+// не может: они вступают в силу после перезапуска. Запись с точкой
+// на конце означает весь раздел.
+var restartFields = []string{
+	"ui.enabled", "ui.ui_type", "ui.web_port", "ui.local_only", "ui.devices_path",
+	"security.",
+}
+
+// NeedsRestart сообщает, нужен ли перезапуск, чтобы применить настройку
+// field ("ui.web_port")
+func NeedsRestart(field string) bool {
+	for _, restart := range restartFields {
+		if field == restart || strings.HasSuffix(restart, ".") && strings.HasPrefix(field, restart) {
+			return true
+		}
+	}
+	return false
+}
+
+// Change — изменившаяся настройка
+type Change struct {
+	Field   string `json:"field"`
+	Restart bool   `json:"restart"` // применится после перезапуска
+}
+
+// Diff возвращает настройки, которые отличаются в old и new
+func Diff(old, new *Config) []Change {
+	values := make(map[string]any)
+	walkFields(reflect.ValueOf(old).Elem(), "", func(path string, value reflect.Value) error {
+		values[path] = value.Interface()
+		return nil
+	})
+
+	var changes []Change
+	walkFields(reflect.ValueOf(new).Elem(), "", func(path string, value reflect.Value) error {
+		if path != "version" && !reflect.DeepEqual(values[path], value.Interface()) {
+			changes = append(changes, Change{Field: path, Restart: NeedsRestart(path)})
+		}
+		return nil
+	})
+	return changes
+}
+
+// Listener применяет новые настройки подсистемы. Manager вызывает его,
+// только если настройки изменились.
+type Listener func(old, new *Config) error
+
+// Manager хранит действующие настройки: файл, переопределения из окружения
+// и подставленные секреты. Он следит за файлом и сообщает подсистемам об
+// изменениях, поэтому правка файла применяется без перезапуска.
+type Manager struct {
+	path    string
+	environ []string
+
+	mutex     sync.Mutex
+	resolve   func(*Config) (*Config, error)
+	file      *Config // как в файле, со ссылками на секреты
+	current   *Config // действующие
+	overrides []string
+	listeners []Listener
+	modTime   time.Time
+	data      []byte // последнее прочитанное содержимое файла
+
+	applyMutex sync.Mutex // упорядочивает применение настроек
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewManager загружает настройки из файла path, создавая его при первом
+// запуске, и применяет переопределения из environ (см. ApplyEnv)
+func NewManager(path string, environ []string) (*Manager, error) {
+	file, err := LoadOrCreate(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{path: path, environ: environ}
+	current, overrides, err := m.build(file, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.file, m.current, m.overrides = file, current, overrides
+	m.remember()
+	return m, nil
+}
+
+// Path возвращает путь к файлу настроек
+func (m *Manager) Path() string {
+	return m.path
+}
+
+// Config возвращает копию действующих настроек
+func (m *Manager) Config() *Config {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.current.Clone()
+}
+
+// File возвращает копию настроек как в файле: без переопределений из
+// окружения и со ссылками на секреты вместо их значений
+func (m *Manager) File() *Config {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.file.Clone()
+}
+
+// Overrides возвращает настройки, заданные переменными окружения
+func (m *Manager) Overrides() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]string(nil), m.overrides...)
+}
+
+// SetResolver задает подстановку секретов в действующие настройки
+func (m *Manager) SetResolver(resolve func(*Config) (*Config, error)) error {
+	m.applyMutex.Lock()
+	defer m.applyMutex.Unlock()
+
+	m.mutex.Lock()
+	file := m.file
+	m.mutex.Unlock()
+
+	current, overrides, err := m.build(file, resolve)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	m.resolve, m.current, m.overrides = resolve, current, overrides
+	m.mutex.Unlock()
+	return nil
+}
+
+// OnChange добавляет подсистему, которая применяет новые настройки
+func (m *Manager) OnChange(listener Listener) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// Update проверяет настройки, сохраняет их в файл и применяет. cfg —
+// настройки как в файле, см. File. Возвращает изменившиеся настройки.
+func (m *Manager) Update(cfg *Config) ([]Change, error) {
+	m.applyMutex.Lock()
+	defer m.applyMutex.Unlock()
+
+	file := cfg.Clone()
+	file.Version = CurrentVersion
+	current, overrides, err := m.build(file, m.resolver())
+	if err != nil {
+		return nil, err
+	}
+	if err := file.SaveFile(m.path); err != nil {
+		return nil, err
+	}
+	changes := m.apply(file, current, overrides)
+	m.remember()
+	return changes, nil
+}
+
+// Reload перечитывает файл и применяет изменения
+func (m *Manager) Reload() ([]Change, error) {
+	m.applyMutex.Lock()
+	defer m.applyMutex.Unlock()
+
+	file, err := LoadFile(m.path)
+	if err != nil {
+		return nil, err
+	}
+	current, overrides, err := m.build(file, m.resolver())
+	if err != nil {
+		return nil, err
+	}
+	changes := m.apply(file, current, overrides)
+	m.remember()
+	return changes, nil
+}
+
+// Watch начинает следить за файлом: изменения применяются сами
+func (m *Manager) Watch(interval time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop, m.done = make(chan struct{}), make(chan struct{})
+	go m.watch(interval, m.stop, m.done)
+}
+
+// Close прекращает следить за файлом
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+	m.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (m *Manager) watch(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !m.fileChanged() {
+				continue
+			}
+			changes, err := m.Reload()
+			if err != nil {
+				// Ошибочный файл не применяется, пока его не исправят
+				log.Printf("Настройки из %s не применены: %v", m.path, err)
+				m.remember()
+				continue
+			}
+			for _, change := range changes {
+				if change.Restart {
+					log.Printf("Настройка %s применится после перезапуска", change.Field)
+				}
+			}
+			if len(changes) > 0 {
+				log.Printf("Настройки перечитаны из %s, изменений: %d", m.path, len(changes))
+			}
+		}
+	}
+}
+
+// fileChanged сообщает, изменилось ли содержимое файла с последнего чтения
+func (m *Manager) fileChanged() bool {
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return false
+	}
+	m.mutex.Lock()
+	same := info.ModTime().Equal(m.modTime)
+	previous := m.data
+	m.mutex.Unlock()
+	if same {
+		return false
+	}
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return false
+	}
+	if bytes.Equal(data, previous) {
+		m.remember()
+		return false
+	}
+	return true
+}
+
+// remember запоминает состояние файла, чтобы не применять его повторно
+func (m *Manager) remember() {
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return
+	}
+	m.mutex.Lock()
+	m.modTime, m.data = info.ModTime(), data
+	m.mutex.Unlock()
+}
+
+func (m *Manager) resolver() func(*Config) (*Config, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.resolve
+}
+
+// build получает действующие настройки из настроек файла
+func (m *Manager) build(file *Config, resolve func(*Config) (*Config, error)) (*Config, []string, error) {
+	current := file.Clone()
+	overrides, err := current.ApplyEnv(m.environ)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resolve != nil {
+		if current, err = resolve(current); err != nil {
+			return nil, nil, err
+		}
+	}
+	current.inheritKeys()
+	if err := current.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return current, overrides, nil
+}
+
+// apply делает настройки действующими и сообщает о них подсистемам
+func (m *Manager) apply(file, current *Config, overrides []string) []Change {
+	m.mutex.Lock()
+	old := m.current
+	m.file, m.current, m.overrides = file, current, overrides
+	listeners := append([]Listener(nil), m.listeners...)
+	m.mutex.Unlock()
+
+	changes := Diff(old, current)
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, listener := range listeners {
+		if err := listener(old.Clone(), current.Clone()); err != nil {
+			log.Printf("Ошибка применения настроек: %v", err)
+		}
+	}
+	return changes
+}
+
+// inheritKeys передает голосовому модулю ключи API ассистента, если
+// для него не заданы свои
+func (c *Config) inheritKeys() {
+	if c.VoiceConfig.OpenAIAPIKey == "" {
+		c.VoiceConfig.OpenAIAPIKey = c.AssistantConfig.OpenAIAPIKey
+	}
+	if c.VoiceConfig.GoogleAPIKey == "" {
+		c.VoiceConfig.GoogleAPIKey = c.AssistantConfig.GoogleAPIKey
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ztrue/tracerr"
+)
+
+// CurrentVersion — версия формата файла настроек. Файлы без поля version
+// имеют версию 0.
+const CurrentVersion = 1
+
+// migrations[v] переводит разобранный файл версии v в версию v+1
+var migrations = []func(raw map[string]any){
+	migrateV0,
+}
+
+// migrateV0 переводит файлы, записанные до появления версий
+func migrateV0(raw map[string]any) {
+	// history_path переименован в history_file_path
+	if assistant, ok := raw["assistant"].(map[string]any); ok {
+		if path, ok := assistant["history_path"]; ok {
+			if _, exists := assistant["history_file_path"]; !exists {
+				assistant["history_file_path"] = path
+			}
+			delete(assistant, "history_path")
+		}
+	}
+
+	// Синтез "local" — прежнее название espeak-ng
+	if voice, ok := raw["voice"].(map[string]any); ok {
+		if voice["tts_provider"] == "local" {
+			voice["tts_provider"] = "espeak-ng"
+		}
+	}
+}
+
+// Parse разбирает настройки в формате файла любой версии, например
+// присланные из веб-интерфейса. Чего нет в data, берется из DefaultConfig.
+func Parse(data []byte) (*Config, error) {
+	cfg, _, err := parse(data)
+	return cfg, err
+}
+
+// parse разбирает файл настроек любой версии и возвращает настройки
+// в текущем формате и исходную версию файла. Чего нет в файле, берется
+// из DefaultConfig.
+func parse(data []byte) (*Config, int, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, err
+	}
+
+	version := 0
+	if value, ok := raw["version"].(float64); ok {
+		version = int(value)
+	}
+	if version > CurrentVersion {
+		return nil, version, tracerr.New(fmt.Sprintf("Файл записан более новой версией программы (формат %d, поддерживается до %d)", version, CurrentVersion))
+	}
+	for v := version; v < CurrentVersion; v++ {
+		migrations[v](raw)
+	}
+	raw["version"] = CurrentVersion
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, version, tracerr.Wrap(err)
+	}
+
+	// JSON дополняет словари, а не заменяет их: синонимы приложений
+	// из файла не должны смешиваться с синонимами по умолчанию
+	cfg := DefaultConfig()
+	if assistant, ok := raw["assistant"].(map[string]any); ok {
+		if _, ok := assistant["app_aliases"]; ok {
+			cfg.AssistantConfig.AppAliases = nil
+		}
+	}
+	if err := json.Unmarshal(migrated, cfg); err != nil {
+		return nil, version, err
+	}
+	return cfg, version, nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/secrets"
+)
+
+// SecretRefs возвращает имена секретов, на которые ссылаются настройки
+func (c *Config) SecretRefs() []string {
+	var names []string
+	walkStrings(reflect.ValueOf(c).Elem(), "", func(path string, value reflect.Value) error {
+		if secrets.IsReference(value.String()) {
+			names = append(names, strings.TrimPrefix(value.String(), secrets.ReferencePrefix))
+		}
+		return nil
+	})
+	return names
+}
+
+// ResolveSecrets возвращает копию настроек, в которой ссылки "secret:имя"
+// заменены значениями секретов из lookup. Сами настройки не меняются,
+// поэтому Save сохраняет в файл ссылки, а не секреты.
+func (c *Config) ResolveSecrets(lookup func(name string) (string, error)) (*Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	var resolved Config
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	err = walkStrings(reflect.ValueOf(&resolved).Elem(), "", func(path string, value reflect.Value) error {
+		secret, err := secrets.Resolve(value.String(), lookup)
+		if err != nil {
+			return tracerr.New(fmt.Sprintf("Настройка %s: %v", path, err))
+		}
+		value.SetString(secret)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// RedactedValue заменяет ключи API в настройках, которые показываются
+// пользователю, см. Redacted
+const RedactedValue = "********"
+
+// isSecretField сообщает, хранит ли настройка ключ доступа
+func isSecretField(path string) bool {
+	return strings.HasSuffix(path, "_api_key")
+}
+
+// Redacted возвращает копию настроек, в которой ключи API заменены на
+// RedactedValue. Пустые ключи и ссылки "secret:имя" остаются как есть:
+// они не раскрывают значения.
+func (c *Config) Redacted() *Config {
+	redacted := c.Clone()
+	walkStrings(reflect.ValueOf(redacted).Elem(), "", func(path string, value reflect.Value) error {
+		if isSecretField(path) && value.String() != "" && !secrets.IsReference(value.String()) {
+			value.SetString(RedactedValue)
+		}
+		return nil
+	})
+	return redacted
+}
+
+// Unredact возвращает копию настроек, в которой ключи со значением
+// RedactedValue взяты из previous. Так настройки, полученные через
+// Redacted и измененные пользователем, сохраняются без потери ключей.
+func (c *Config) Unredact(previous *Config) *Config {
+	keys := make(map[string]string)
+	walkStrings(reflect.ValueOf(previous).Elem(), "", func(path string, value reflect.Value) error {
+		if isSecretField(path) {
+			keys[path] = value.String()
+		}
+		return nil
+	})
+
+	restored := c.Clone()
+	walkStrings(reflect.ValueOf(restored).Elem(), "", func(path string, value reflect.Value) error {
+		if isSecretField(path) && value.String() == RedactedValue {
+			value.SetString(keys[path])
+		}
+		return nil
+	})
+	return restored
+}
+
+// walkStrings вызывает fn для каждого строкового поля настроек
+func walkStrings(v reflect.Value, path string, fn func(path string, value reflect.Value) error) error {
+	return walkFields(v, path, func(path string, value reflect.Value) error {
+		if value.Kind() != reflect.String {
+			return nil
+		}
+		return fn(path, value)
+	})
+}
+
+// walkFields вызывает fn для каждого поля структуры v и ее вложенных
+// структур, кроме самих структур. path — путь к полю по именам JSON:
+// assistant.openai_api_key.
+func walkFields(v reflect.Value, path string, fn func(path string, value reflect.Value) error) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = v.Type().Field(i).Name
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+
+		if field.Kind() == reflect.Struct {
+			if err := walkFields(field, name, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(name, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
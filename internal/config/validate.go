@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Problem — ошибка в одной настройке
+type Problem struct {
+	Field   string `json:"field"` // путь по именам JSON: ui.web_port
+	Message string `json:"message"`
+}
+
+// ValidationError перечисляет все ошибки в настройках
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		parts = append(parts, problem.Field+": "+problem.Message)
+	}
+	return "ошибки в настройках: " + strings.Join(parts, "; ")
+}
+
+// validator собирает ошибки в настройках
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) fail(field, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// oneOf проверяет, что значение — одно из допустимых
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, option := range allowed {
+		if value == option {
+			return
+		}
+	}
+	var options []string
+	for _, option := range allowed {
+		if option != "" {
+			options = append(options, option)
+		}
+	}
+	v.fail(field, "недопустимое значение %q, ожидается %s", value, strings.Join(options, ", "))
+}
+
+// between проверяет, что число в пределах [min, max]
+func (v *validator) between(field string, value, min, max float64) {
+	if value < min || value > max {
+		v.fail(field, "%g вне допустимых пределов от %g до %g", value, min, max)
+	}
+}
+
+// nonNegative проверяет, что число не отрицательное
+func (v *validator) nonNegative(field string, value float64) {
+	if value < 0 {
+		v.fail(field, "не может быть отрицательным")
+	}
+}
+
+// port проверяет номер порта
+func (v *validator) port(field string, value int) {
+	if value < 1 || value > 65535 {
+		v.fail(field, "порт %d вне пределов от 1 до 65535", value)
+	}
+}
+
+// Validate проверяет настройки и возвращает *ValidationError со всеми
+// найденными ошибками
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	a := c.AssistantConfig
+	v.oneOf("assistant.llm_provider", a.LLMProvider, "", "openai", "local", "fake")
+	if a.LLMTemperature != nil {
+		v.between("assistant.llm_temperature", float64(*a.LLMTemperature), 0, 2)
+	}
+	v.nonNegative("assistant.llm_timeout", float64(a.LLMTimeout))
+	v.nonNegative("assistant.context_turns", float64(a.ContextTurns))
+	v.nonNegative("assistant.context_token_budget", float64(a.ContextTokenBudget))
+	v.between("assistant.intent_threshold", a.IntentThreshold, 0, 1)
+	v.oneOf("assistant.weather_provider", a.WeatherProvider, "", "wttr", "none")
+	v.nonNegative("assistant.history_max_age_days", float64(a.HistoryMaxAgeDays))
+	v.nonNegative("assistant.history_max_entries", float64(a.HistoryMaxEntries))
+	v.nonNegative("assistant.app_catalog_refresh", float64(a.AppCatalogRefresh))
+	v.oneOf("assistant.confirm_risk", a.ConfirmRisk, "", "low", "medium", "high")
+	if a.HistoryEnabled && a.HistoryFilePath == "" {
+		v.fail("assistant.history_file_path", "не указан файл истории")
+	}
+	for i, rule := range a.PolicyRules {
+		field := fmt.Sprintf("assistant.policy_rules[%d]", i)
+		if rule.Command == "" {
+			v.fail(field+".command", "не указана команда или \"*\"")
+		}
+		v.oneOf(field+".action", rule.Action, "allow", "deny", "confirm")
+	}
+
+	voice := c.VoiceConfig
+	v.oneOf("voice.voice_recognition", voice.VoiceRecognition, "google", "local", "whisper")
+	v.oneOf("voice.tts_provider", voice.TTSProvider, "", "google", "espeak-ng", "rhvoice", "piper", "local")
+	v.oneOf("voice.stt_engine", voice.STTEngine, "", "whisper.cpp", "vosk")
+	v.nonNegative("voice.stt_threads", float64(voice.STTThreads))
+	v.between("voice.tts_rate", voice.TTSRate, 0, 10)
+	v.between("voice.tts_pitch", voice.TTSPitch, 0, 10)
+	v.oneOf("voice.wake_word_engine", voice.WakeWordEngine, "", "template", "stt")
+	v.between("voice.wake_word_sensitivity", voice.WakeWordSensitivity, 0, 1)
+	v.between("voice.vad_aggressiveness", float64(voice.VADAggressiveness), 0, 3)
+	v.nonNegative("voice.vad_pre_roll_ms", float64(voice.VADPreRollMs))
+	v.nonNegative("voice.vad_hangover_ms", float64(voice.VADHangoverMs))
+	v.nonNegative("voice.vad_max_utterance_ms", float64(voice.VADMaxUtteranceMs))
+	v.oneOf("voice.barge_in", voice.BargeIn, "", "speech", "wake_word")
+	v.nonNegative("voice.echo_margin_db", voice.EchoMarginDb)
+	v.nonNegative("voice.follow_up_seconds", float64(voice.FollowUpSeconds))
+	v.oneOf("voice.activation_mode", voice.ActivationMode, "", "wake_word", "push_to_talk", "toggle")
+	v.oneOf("voice.hotkey_backend", voice.HotkeyBackend, "", "auto", "x11", "evdev")
+	if voice.Enabled && voice.WakeWord == "" && (voice.ActivationMode == "" || voice.ActivationMode == "wake_word") {
+		v.fail("voice.wake_word", "не указано ключевое слово")
+	}
+	if voice.ActivationMode == "push_to_talk" || voice.ActivationMode == "toggle" {
+		if voice.Hotkey == "" {
+			v.fail("voice.hotkey", "не указано сочетание клавиш для %s", voice.ActivationMode)
+		}
+	}
+
+	ui := c.UIConfig
+	v.oneOf("ui.ui_type", ui.UIType, "web", "tray", "console")
+	v.port("ui.web_port", ui.WebPort)
+	v.oneOf("ui.theme", ui.Theme, "dark", "light")
+
+	mobile := c.MobileConfig
+	if mobile.Enabled && mobile.WebUIEnabled {
+		v.port("mobile.webui_port", mobile.WebUIPort)
+		if ui.Enabled && mobile.WebUIPort == ui.WebPort {
+			v.fail("mobile.webui_port", "совпадает с ui.web_port")
+		}
+	}
+
+	v.oneOf("security.key_source", c.SecurityConfig.KeySource, "keyring", "passphrase")
+	if c.SecurityConfig.KeysPath == "" {
+		v.fail("security.keys_path", "не указан файл ключей")
+	}
+	if c.SecurityConfig.SecretsPath == "" {
+		v.fail("security.secrets_path", "не указан файл секретов")
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Форматы выгрузки истории
+const (
+	FormatJSONL    = "jsonl" // по записи JSON в строке, без потерь
+	FormatCSV      = "csv"   // таблица для электронных таблиц
+	FormatMarkdown = "md"    // для чтения; обратно не загружается
+	// FormatEncrypted — JSON Lines, где каждая строка зашифрована ключом
+	// истории; так сохраняются копии зашифрованной истории
+	FormatEncrypted = "enc"
+)
+
+// exportAssociated привязывает строки зашифрованной выгрузки к ее назначению
+var exportAssociated = []byte("kot.ai history export")
+
+// csvHeader — столбцы выгрузки в CSV
+var csvHeader = []string{"id", "time", "command", "response", "session_id", "source", "type"}
+
+// maxLineSize ограничивает строку JSON Lines при загрузке
+const maxLineSize = 16 << 20
+
+// ImportResult — итог загрузки истории
+type ImportResult struct {
+	Added   int `json:"added"`
+	Skipped int `json:"skipped"` // уже были в истории
+}
+
+// FormatFromPath определяет формат выгрузки по расширению файла
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".md", ".markdown":
+		return FormatMarkdown
+	case ".jsonl", ".json", ".ndjson":
+		return FormatJSONL
+	case ".enc":
+		return FormatEncrypted
+	}
+	return ""
+}
+
+// ParseTime разбирает время из командной строки: RFC 3339 или дату
+// с необязательным временем в местном часовом поясе
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, tracerr.New(fmt.Sprintf("Некорректное время: %s, ожидается 2006-01-02 или 2006-01-02T15:04:05Z07:00", value))
+}
+
+// Export записывает в w записи, подходящие под q, от старых к новым,
+// и возвращает их число. Limit, After и Descending не учитываются.
+func (s *Store) Export(w io.Writer, format string, q Query) (int, error) {
+	q.After, q.Descending = "", false
+
+	var write func(Entry) error
+	var finish func() error
+	switch format {
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		write = func(entry Entry) error { return encoder.Encode(entry) }
+	case FormatEncrypted:
+		if s.cipher == nil {
+			return 0, tracerr.New("История не зашифрована, выгрузка в формате enc недоступна")
+		}
+		write = func(entry Entry) error {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if data, err = s.cipher.Encrypt(data, exportAssociated); err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, base64.StdEncoding.EncodeToString(data)+"\n")
+			return err
+		}
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return 0, tracerr.Wrap(err)
+		}
+		write = func(entry Entry) error {
+			return writer.Write([]string{
+				entry.ID, entry.Time().Format(time.RFC3339Nano), entry.Command, entry.Response,
+				entry.SessionID, entry.Source, entry.Type,
+			})
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case FormatMarkdown:
+		if _, err := io.WriteString(w, "# История команд\n"); err != nil {
+			return 0, tracerr.Wrap(err)
+		}
+		write = func(entry Entry) error {
+			_, err := io.WriteString(w, markdownEntry(entry))
+			return err
+		}
+	default:
+		return 0, tracerr.New(fmt.Sprintf("Неизвестный формат выгрузки: %s", format))
+	}
+
+	count := 0
+	var writeErr error
+	err := s.scan(q, func(entry Entry) bool {
+		if writeErr = write(entry); writeErr != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		return count, err
+	}
+	if writeErr != nil {
+		return count, tracerr.Wrap(writeErr)
+	}
+	if finish != nil {
+		if err := finish(); err != nil {
+			return count, tracerr.Wrap(err)
+		}
+	}
+	return count, nil
+}
+
+// markdownEntry оформляет запись для выгрузки в Markdown
+func markdownEntry(entry Entry) string {
+	var b strings.Builder
+	b.WriteString("\n## ")
+	b.WriteString(entry.Time().Local().Format("2006-01-02 15:04:05"))
+	for _, label := range []string{entry.Source, entry.Type} {
+		if label != "" {
+			b.WriteString(" · ")
+			b.WriteString(label)
+		}
+	}
+	b.WriteString("\n\n")
+	for _, part := range [][2]string{{"Команда", entry.Command}, {"Ответ", entry.Response}} {
+		b.WriteString("**")
+		b.WriteString(part[0])
+		b.WriteString(":**\n")
+		for _, line := range strings.Split(part[1], "\n") {
+			b.WriteString("> ")
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Import загружает записи из выгрузки в формате JSON Lines, CSV или enc.
+// Записи, которые уже есть в истории, пропускаются, поэтому одну выгрузку
+// можно загружать повторно или сводить истории нескольких компьютеров.
+func (s *Store) Import(r io.Reader, format string) (ImportResult, error) {
+	var result ImportResult
+	add := func(entry Entry) error {
+		added, err := s.merge(entry)
+		if err != nil {
+			return err
+		}
+		if added {
+			result.Added++
+		} else {
+			result.Skipped++
+		}
+		return nil
+	}
+
+	var err error
+	switch format {
+	case FormatJSONL:
+		err = readJSONL(r, nil, add)
+	case FormatEncrypted:
+		if s.cipher == nil {
+			return result, tracerr.New("Выгрузка зашифрована: включите encrypt_history в разделе security настроек")
+		}
+		err = readJSONL(r, func(line []byte) ([]byte, error) {
+			data, err := base64.StdEncoding.DecodeString(string(line))
+			if err != nil {
+				return nil, err
+			}
+			return s.cipher.Decrypt(data, exportAssociated)
+		}, add)
+	case FormatCSV:
+		err = readCSV(r, add)
+	case FormatMarkdown:
+		err = tracerr.New("Выгрузка в Markdown предназначена для чтения и не загружается, используйте jsonl или csv")
+	default:
+		err = tracerr.New(fmt.Sprintf("Неизвестный формат выгрузки: %s", format))
+	}
+	return result, err
+}
+
+// merge добавляет запись, если ее еще нет. Запись с идентификатором
+// считается той же, если он совпадает. У записи без идентификатора,
+// например из таблицы, заполненной вручную, сравниваются команда, ответ,
+// источник и разговор записей той же секунды.
+func (s *Store) merge(entry Entry) (bool, error) {
+	if _, ok := parseID(entry.ID); !ok {
+		entry.ID = ""
+	}
+	if entry.ID != "" {
+		if _, found, err := s.Get(entry.ID); err != nil || found {
+			return false, err
+		}
+		entry.Timestamp = entry.Time().Unix()
+		if _, err := s.Add(entry); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if entry.Timestamp <= 0 {
+		return false, tracerr.New(fmt.Sprintf("У записи \"%s\" нет времени", entry.Command))
+	}
+
+	second := time.Unix(entry.Timestamp, 0)
+	duplicate := false
+	err := s.scan(Query{Since: second, Until: second.Add(time.Second)}, func(existing Entry) bool {
+		duplicate = existing.Command == entry.Command && existing.Response == entry.Response &&
+			existing.Source == entry.Source && existing.SessionID == entry.SessionID
+		return !duplicate
+	})
+	if err != nil || duplicate {
+		return false, err
+	}
+
+	// Первый свободный идентификатор в этой секунде
+	id := uint64(second.UnixNano())
+	for {
+		if _, found, err := s.Get(formatID(id)); err != nil {
+			return false, err
+		} else if !found {
+			break
+		}
+		id++
+	}
+	entry.ID = formatID(id)
+	if _, err := s.Add(entry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readJSONL читает записи JSON Lines; decrypt, если задан, расшифровывает
+// каждую строку
+func readJSONL(r io.Reader, decrypt func([]byte) ([]byte, error), add func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		data := scanner.Bytes()
+		if decrypt != nil {
+			var err error
+			if data, err = decrypt(bytes.TrimSpace(data)); err != nil {
+				return tracerr.New(fmt.Sprintf("Строка %d: %v", line, err))
+			}
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return tracerr.New(fmt.Sprintf("Строка %d: %v", line, err))
+		}
+		if err := add(entry); err != nil {
+			return tracerr.New(fmt.Sprintf("Строка %d: %v", line, err))
+		}
+	}
+	return tracerr.Wrap(scanner.Err())
+}
+
+// readCSV читает записи CSV. Столбцы определяются по заголовку, лишние
+// столбцы не мешают.
+func readCSV(r io.Reader, add func(Entry) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	if _, ok := columns["command"]; !ok {
+		return tracerr.New("В CSV нет столбца command")
+	}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		entry := Entry{
+			ID:        field("id"),
+			Command:   field("command"),
+			Response:  field("response"),
+			SessionID: field("session_id"),
+			Source:    field("source"),
+			Type:      field("type"),
+		}
+		if value := field("time"); value != "" {
+			t, err := ParseTime(value)
+			if err != nil {
+				return tracerr.New(fmt.Sprintf("Строка %d: %v", row, err))
+			}
+			entry.Timestamp = t.Unix()
+		}
+		if err := add(entry); err != nil {
+			return tracerr.New(fmt.Sprintf("Строка %d: %v", row, err))
+		}
+	}
+}
+
+// Snapshot сохраняет всю историю в JSON Lines в каталог dir и возвращает
+// путь к файлу. Зашифрованная история сохраняется в формате enc. Пустая
+// история не сохраняется.
+func (s *Store) Snapshot(dir string) (string, error) {
+	if s.Count() == 0 {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	format, ext := FormatJSONL, ".jsonl"
+	if s.cipher != nil {
+		format, ext = FormatEncrypted, ".jsonl.enc"
+	}
+	path := filepath.Join(dir, "history-"+time.Now().Format("20060102-150405")+ext)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		path = filepath.Join(dir, fmt.Sprintf("history-%s%s", formatID(uint64(time.Now().UnixNano())), ext))
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	}
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	writer := bufio.NewWriter(file)
+	if _, err := s.Export(writer, format, Query{}); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", tracerr.Wrap(err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", tracerr.Wrap(err)
+	}
+	return path, nil
+}
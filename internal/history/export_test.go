@@ -0,0 +1,182 @@
+package history
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"kot.ai/internal/secrets"
+)
+
+// fillTest добавляет в историю записи с известным временем
+func fillTest(t *testing.T, s *Store, base time.Time) {
+	entries := []Entry{
+		{Command: "открой браузер", Response: "Открываю firefox", Source: "local", Type: "open_app", SessionID: "local-1"},
+		{Command: "расскажи стих", Response: "Строка первая,\nстрока \"вторая\"", Source: "web", Type: "chat", SessionID: "web-1"},
+		{Command: "какая погода", Response: "Солнечно", Source: "web", Type: "weather", SessionID: "web-1"},
+	}
+	for i, entry := range entries {
+		entry.ID = formatID(uint64(base.Add(time.Duration(i) * time.Hour).UnixNano()))
+		_, err := s.Add(entry)
+		assert.NoError(t, err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	for _, format := range []string{FormatJSONL, FormatCSV} {
+		source := openTest(t, Retention{})
+		fillTest(t, source, base)
+
+		var buffer bytes.Buffer
+		count, err := source.Export(&buffer, format, Query{})
+		assert.NoError(t, err, format)
+		assert.Equal(t, 3, count, format)
+
+		target := openTest(t, Retention{})
+		target.Add(Entry{Command: "своя запись"})
+		result, err := target.Import(bytes.NewReader(buffer.Bytes()), format)
+		assert.NoError(t, err, format)
+		assert.Equal(t, ImportResult{Added: 3}, result, format)
+
+		want, _ := source.Query(Query{})
+		got, _ := target.Query(Query{Until: base.Add(24 * time.Hour)})
+		assert.Equal(t, want.Entries, got.Entries, format)
+
+		// Повторная загрузка ничего не дублирует
+		result, err = target.Import(bytes.NewReader(buffer.Bytes()), format)
+		assert.NoError(t, err, format)
+		assert.Equal(t, ImportResult{Skipped: 3}, result, format)
+		assert.Equal(t, 4, target.Count(), format)
+	}
+}
+
+func TestExportRangeAndMarkdown(t *testing.T) {
+	s := openTest(t, Retention{})
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fillTest(t, s, base)
+
+	var buffer bytes.Buffer
+	count, err := s.Export(&buffer, FormatMarkdown, Query{Since: base.Add(time.Hour), Until: base.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	text := buffer.String()
+	assert.True(t, strings.HasPrefix(text, "# История команд\n"))
+	assert.Contains(t, text, " · web · chat\n")
+	assert.Contains(t, text, "**Команда:**\n> расскажи стих\n")
+	assert.Contains(t, text, "> Строка первая,\n> строка \"вторая\"\n")
+	assert.NotContains(t, text, "погода")
+
+	_, err = s.Import(strings.NewReader(text), FormatMarkdown)
+	assert.Error(t, err)
+	_, err = s.Export(&buffer, "xml", Query{})
+	assert.Error(t, err)
+}
+
+func TestImportCSVWithoutIDs(t *testing.T) {
+	s := openTest(t, Retention{})
+	data := "\ufefftime,command,response,extra\n" +
+		"2024-05-01 12:00:00,первая,ответ,x\n" +
+		"2024-05-01 12:00:00,вторая,ответ,x\n" +
+		"2024-05-01 12:00:00,первая,ответ,x\n"
+	result, err := s.Import(strings.NewReader(data), FormatCSV)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportResult{Added: 2, Skipped: 1}, result)
+
+	page, err := s.Query(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"первая", "вторая"}, commands(page))
+	want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	assert.Equal(t, want.Unix(), page.Entries[1].Timestamp)
+
+	_, err = s.Import(strings.NewReader("command\nбез времени\n"), FormatCSV)
+	assert.ErrorContains(t, err, "Строка 2")
+	_, err = s.Import(strings.NewReader("{\"command\": \"a\", \"timestamp\": 1}\nне json\n"), FormatJSONL)
+	assert.ErrorContains(t, err, "Строка 2")
+}
+
+func TestSnapshot(t *testing.T) {
+	s := openTest(t, Retention{})
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	// Пустую историю сохранять незачем
+	path, err := s.Snapshot(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+
+	fillTest(t, s, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	first, err := s.Snapshot(dir)
+	assert.NoError(t, err)
+	second, err := s.Snapshot(dir)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	file, err := os.Open(first)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	restored := openTest(t, Retention{})
+	result, err := restored.Import(file, FormatJSONL)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Added)
+}
+
+func TestEncryptedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := secrets.OpenKeyset(filepath.Join(dir, "keys.json"), secrets.Passphrase("пароль"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	s, err := OpenMemory(Options{Cipher: keys})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	fillTest(t, s, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	path, err := s.Snapshot(filepath.Join(dir, "backups"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(path, ".jsonl.enc"))
+	assert.Equal(t, FormatEncrypted, FormatFromPath(path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "браузер")
+
+	// Без ключа выгрузку не прочитать, с ключом она загружается целиком
+	_, err = openTest(t, Retention{}).Import(bytes.NewReader(data), FormatEncrypted)
+	assert.Error(t, err)
+	restored, err := OpenMemory(Options{Cipher: keys})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer restored.Close()
+	result, err := restored.Import(bytes.NewReader(data), FormatEncrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportResult{Added: 3}, result)
+}
+
+func TestParseTime(t *testing.T) {
+	value, err := ParseTime("2024-05-01T12:00:00+03:00")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), value.UTC())
+
+	value, err = ParseTime("2024-05-01")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), value)
+
+	_, err = ParseTime("вчера")
+	assert.Error(t, err)
+
+	assert.Equal(t, FormatCSV, FormatFromPath("history.CSV"))
+	assert.Equal(t, FormatJSONL, FormatFromPath("/tmp/h.jsonl"))
+	assert.Empty(t, FormatFromPath("history.txt"))
+}
@@ -0,0 +1,854 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/intent"
+)
+
+// Записи хранятся в LevelDB под ключами с общими префиксами:
+//
+//	e\x00<id>                   — запись в JSON
+//	s\x00<источник>\x00<id>     — индекс по источнику
+//	t\x00<тип>\x00<id>          — индекс по типу команды
+//	w\x00<основа слова>\x00<id> — полнотекстовый индекс
+//	m\x00<имя>                  — служебные значения
+//
+// Идентификатор — время добавления в наносекундах в шестнадцатеричном виде
+// фиксированной длины, поэтому записи во всех индексах упорядочены по времени.
+//
+// В зашифрованной истории запись хранится шифротекстом Cipher, привязанным
+// к ее идентификатору, а вместо основ слов в индексе лежат их метки
+// Cipher.Blind. Источник и тип команды остаются открытыми.
+const (
+	entryPrefix  = "e\x00"
+	sourcePrefix = "s\x00"
+	typePrefix   = "t\x00"
+	wordPrefix   = "w\x00"
+	metaPrefix   = "m\x00"
+
+	versionKey    = metaPrefix + "version"
+	countKey      = metaPrefix + "count"
+	encryptionKey = metaPrefix + "encryption"
+
+	// Значения encryptionKey: история зашифрована или шифруется
+	encrypted  = "aes-gcm"
+	encrypting = "aes-gcm-partial"
+
+	// version — версия формата хранилища
+	version = 1
+)
+
+const (
+	// DefaultLimit — сколько записей возвращается за один запрос по умолчанию
+	DefaultLimit = 50
+	// MaxLimit ограничивает размер страницы
+	MaxLimit = 1000
+
+	// pruneInterval — как часто применяются правила хранения
+	pruneInterval = time.Hour
+	// pruneBatch — сколько записей удаляется за одну запись в базу
+	pruneBatch = 1000
+)
+
+// Entry — запись в истории команд
+type Entry struct {
+	ID        string `json:"id,omitempty"`
+	Timestamp int64  `json:"timestamp"` // секунды Unix
+	Command   string `json:"command"`
+	Response  string `json:"response"`
+	SessionID string `json:"session_id,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Type      string `json:"type,omitempty"` // имя команды или "chat" для ответа модели
+}
+
+// Time возвращает время записи
+func (e Entry) Time() time.Time {
+	if nanos, err := strconv.ParseUint(e.ID, 16, 64); err == nil && len(e.ID) == idLength {
+		return time.Unix(0, int64(nanos))
+	}
+	return time.Unix(e.Timestamp, 0)
+}
+
+// Query описывает выборку из истории. Пустые поля не ограничивают выборку.
+type Query struct {
+	Text       string    // все слова должны встречаться в команде или ответе
+	Source     string    // источник: local, web, телефон
+	Type       string    // тип команды
+	Since      time.Time // не раньше
+	Until      time.Time // раньше
+	After      string    // продолжение: Next предыдущей страницы
+	Limit      int       // размер страницы; 0 — DefaultLimit
+	Descending bool      // сначала новые
+}
+
+// Page — страница выборки
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Next    string  `json:"next,omitempty"` // пусто — записей больше нет
+}
+
+// Retention — правила хранения истории. Нулевые значения не ограничивают.
+type Retention struct {
+	MaxAge     time.Duration // старые записи удаляются
+	MaxEntries int           // сверх этого числа удаляются самые старые
+}
+
+// Cipher шифрует записи истории. Его реализует secrets.Keyset.
+type Cipher interface {
+	// Encrypt шифрует plaintext, привязывая шифротекст к associated
+	Encrypt(plaintext, associated []byte) ([]byte, error)
+	// Decrypt расшифровывает данные Encrypt
+	Decrypt(ciphertext, associated []byte) ([]byte, error)
+	// Blind возвращает метку слова для поиска, не раскрывающую само слово
+	Blind(term string) string
+}
+
+// Options — параметры открытия истории
+type Options struct {
+	Retention Retention
+	// Cipher шифрует записи. Открытая история при этом шифруется целиком,
+	// а зашифрованная без Cipher не открывается.
+	Cipher Cipher
+}
+
+// Store — история команд с индексами и поиском
+type Store struct {
+	db        *leveldb.DB
+	retention Retention
+	cipher    Cipher
+
+	mutex  sync.Mutex // упорядочивает запись
+	lastID uint64
+	count  int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open открывает историю в каталоге path, при необходимости переводит ее
+// из старого формата, шифрует и запускает фоновое применение правил хранения
+func Open(path string, options Options) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	s, err := open(db, options)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenMemory открывает историю в памяти, например для тестов
+func OpenMemory(options Options) (*Store, error) {
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	s, err := open(db, options)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func open(db *leveldb.DB, options Options) (*Store, error) {
+	s := &Store{
+		db:        db,
+		retention: options.Retention,
+		cipher:    options.Cipher,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := s.checkEncryption(); err != nil {
+		return nil, err
+	}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	if err := s.encryptAll(); err != nil {
+		return nil, err
+	}
+
+	if s.retention.MaxAge > 0 || s.retention.MaxEntries > 0 {
+		if err := s.Prune(); err != nil {
+			log.Printf("Ошибка очистки истории: %v", err)
+		}
+		go s.pruneLoop()
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// Close останавливает фоновую очистку и закрывает базу
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+	return tracerr.Wrap(s.db.Close())
+}
+
+// Add сохраняет запись и возвращает ее с идентификатором. Идентификатор
+// строго возрастает, даже если записи добавляются в одну наносекунду или
+// часы перевели назад. Запись с заданным идентификатором, например при
+// переносе истории, сохраняется под ним, если он еще не занят.
+func (s *Store) Add(entry Entry) (Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry.ID != "" {
+		if _, ok := parseID(entry.ID); !ok {
+			return Entry{}, tracerr.New(fmt.Sprintf("Некорректный идентификатор записи: %s", entry.ID))
+		}
+		if ok, _ := s.db.Has([]byte(entryPrefix+entry.ID), nil); ok {
+			return Entry{}, tracerr.New(fmt.Sprintf("Запись %s уже есть", entry.ID))
+		}
+	} else {
+		id := uint64(time.Now().UnixNano())
+		if id <= s.lastID {
+			id = s.lastID + 1
+		}
+		entry.ID = formatID(id)
+	}
+	id, _ := parseID(entry.ID)
+	if entry.Timestamp == 0 {
+		entry.Timestamp = int64(id / uint64(time.Second))
+	}
+
+	batch := new(leveldb.Batch)
+	if err := s.putEntry(batch, entry); err != nil {
+		return Entry{}, err
+	}
+	batch.Put([]byte(countKey), encodeCount(s.count+1))
+	if err := s.db.Write(batch, nil); err != nil {
+		return Entry{}, tracerr.Wrap(err)
+	}
+	s.count++
+	s.lastID = max(s.lastID, id)
+	return entry, nil
+}
+
+// Get возвращает запись по идентификатору
+func (s *Store) Get(id string) (Entry, bool, error) {
+	data, err := s.db.Get([]byte(entryPrefix+id), nil)
+	if err == leveldb.ErrNotFound {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, tracerr.Wrap(err)
+	}
+	entry, err := s.decode(id, data)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// Delete удаляет запись вместе с ее индексами
+func (s *Store) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok, err := s.Get(id)
+	if err != nil || !ok {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	s.deleteEntry(batch, entry)
+	batch.Put([]byte(countKey), encodeCount(s.count-1))
+	if err := s.db.Write(batch, nil); err != nil {
+		return tracerr.Wrap(err)
+	}
+	s.count--
+	return nil
+}
+
+// Clear удаляет всю историю
+func (s *Store) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	iter := s.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		if bytes.HasPrefix(iter.Key(), []byte(metaPrefix)) {
+			continue
+		}
+		batch.Delete(append([]byte(nil), iter.Key()...))
+		if batch.Len() >= pruneBatch {
+			if err := s.db.Write(batch, nil); err != nil {
+				return tracerr.Wrap(err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return tracerr.Wrap(err)
+	}
+	batch.Put([]byte(countKey), encodeCount(0))
+	if err := s.db.Write(batch, nil); err != nil {
+		return tracerr.Wrap(err)
+	}
+	s.count = 0
+	return tracerr.Wrap(s.db.CompactRange(util.Range{}))
+}
+
+// Count возвращает число записей
+func (s *Store) Count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Query возвращает страницу записей. Чтобы получить следующую страницу,
+// передайте Page.Next в Query.After.
+func (s *Store) Query(q Query) (Page, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	var page Page
+	err := s.scan(q, func(entry Entry) bool {
+		if len(page.Entries) == limit {
+			page.Next = page.Entries[limit-1].ID
+			return false
+		}
+		page.Entries = append(page.Entries, entry)
+		return true
+	})
+	if err != nil {
+		return Page{}, err
+	}
+	return page, nil
+}
+
+// Each передает fn все подходящие записи по одной, не загружая выборку
+// в память целиком. Limit не учитывается. Обход прекращается, когда fn
+// возвращает false.
+func (s *Store) Each(q Query, fn func(Entry) bool) error {
+	return s.scan(q, fn)
+}
+
+// Sources возвращает источники, из которых есть записи
+func (s *Store) Sources() ([]string, error) {
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(sourcePrefix)), nil)
+	defer iter.Release()
+
+	var sources []string
+	for ok := iter.First(); ok; ok = iter.Seek([]byte(sourcePrefix + sources[len(sources)-1] + "\x01")) {
+		key := string(iter.Key()[len(sourcePrefix):])
+		source, _, found := strings.Cut(key, "\x00")
+		if !found {
+			break
+		}
+		sources = append(sources, source)
+	}
+	return sources, tracerr.Wrap(iter.Error())
+}
+
+// Prune применяет правила хранения
+func (s *Store) Prune() error {
+	if s.retention.MaxAge > 0 {
+		cutoff := formatID(uint64(time.Now().Add(-s.retention.MaxAge).UnixNano()))
+		if err := s.pruneWhile(func(id string, _ int) bool { return id < cutoff }); err != nil {
+			return err
+		}
+	}
+	if s.retention.MaxEntries > 0 {
+		if err := s.pruneWhile(func(_ string, count int) bool { return count > s.retention.MaxEntries }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneWhile удаляет самые старые записи, пока remove возвращает true
+func (s *Store) pruneWhile(remove func(id string, count int) bool) error {
+	for {
+		s.mutex.Lock()
+		removed, more, err := s.pruneBatch(remove)
+		s.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			log.Printf("Из истории удалено записей: %d", removed)
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// pruneBatch удаляет не больше pruneBatch записей. more сообщает, что
+// удалять, возможно, нужно еще.
+func (s *Store) pruneBatch(remove func(id string, count int) bool) (removed int, more bool, err error) {
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(entryPrefix)), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		id := string(iter.Key()[len(entryPrefix):])
+		if !remove(id, s.count-removed) {
+			break
+		}
+		if removed == pruneBatch {
+			more = true
+			break
+		}
+		if entry, err := s.decode(id, iter.Value()); err != nil {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		} else {
+			s.deleteEntry(batch, entry)
+		}
+		removed++
+	}
+	if err := iter.Error(); err != nil {
+		return 0, false, tracerr.Wrap(err)
+	}
+	if removed == 0 {
+		return 0, false, nil
+	}
+	batch.Put([]byte(countKey), encodeCount(s.count-removed))
+	if err := s.db.Write(batch, nil); err != nil {
+		return 0, false, tracerr.Wrap(err)
+	}
+	s.count -= removed
+	return removed, more, nil
+}
+
+// pruneLoop применяет правила хранения, пока хранилище открыто
+func (s *Store) pruneLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Prune(); err != nil {
+				log.Printf("Ошибка очистки истории: %v", err)
+			}
+		}
+	}
+}
+
+// scan обходит записи, подходящие под q, в нужном порядке. Кандидатов
+// дает самый избирательный из подходящих индексов, остальные условия
+// проверяются по самой записи.
+func (s *Store) scan(q Query, fn func(Entry) bool) error {
+	words := Terms(q.Text)
+	prefix := entryPrefix
+	switch {
+	case len(words) > 0:
+		// Длинные основы встречаются реже
+		longest := words[0]
+		for _, word := range words[1:] {
+			if utf8.RuneCountInString(word) > utf8.RuneCountInString(longest) {
+				longest = word
+			}
+		}
+		prefix = wordPrefix + s.term(longest) + "\x00"
+	case q.Type != "":
+		prefix = typePrefix + q.Type + "\x00"
+	case q.Source != "":
+		prefix = sourcePrefix + q.Source + "\x00"
+	}
+
+	// Диапазон идентификаторов [start, limit)
+	start, limit := prefix, prefix+"\xff"
+	if !q.Since.IsZero() {
+		start = prefix + formatID(uint64(max(q.Since.UnixNano(), 0)))
+	}
+	if !q.Until.IsZero() {
+		limit = prefix + formatID(uint64(max(q.Until.UnixNano(), 0)))
+	}
+	if q.After != "" {
+		if q.Descending {
+			limit = min(limit, prefix+q.After)
+		} else {
+			start = max(start, prefix+q.After+"\x00")
+		}
+	}
+	if start >= limit {
+		return nil
+	}
+
+	iter := s.db.NewIterator(&util.Range{Start: []byte(start), Limit: []byte(limit)}, nil)
+	defer iter.Release()
+
+	next, advance := iter.First, iter.Next
+	if q.Descending {
+		next, advance = iter.Last, iter.Prev
+	}
+	for ok := next(); ok; ok = advance() {
+		id := string(iter.Key()[len(prefix):])
+		entry := Entry{}
+		if prefix == entryPrefix {
+			found, err := s.decode(id, iter.Value())
+			if err != nil {
+				continue
+			}
+			entry = found
+		} else {
+			found, ok, err := s.Get(id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			entry = found
+		}
+		entry.ID = id
+
+		if q.Source != "" && entry.Source != q.Source || q.Type != "" && entry.Type != q.Type {
+			continue
+		}
+		if len(words) > 0 && !containsAll(Terms(entry.Command+" "+entry.Response), words) {
+			continue
+		}
+		if !fn(entry) {
+			break
+		}
+	}
+	return tracerr.Wrap(iter.Error())
+}
+
+// Terms возвращает основы слов текста, по которым работает поиск
+func Terms(text string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range strings.Fields(intent.Normalize(text)) {
+		if utf8.RuneCountInString(word) < 2 {
+			continue
+		}
+		stem := intent.Stem(word)
+		if stem == "" || seen[stem] {
+			continue
+		}
+		seen[stem] = true
+		terms = append(terms, stem)
+	}
+	return terms
+}
+
+// containsAll проверяет, что среди terms есть все words
+func containsAll(terms, words []string) bool {
+	set := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		set[term] = true
+	}
+	for _, word := range words {
+		if !set[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// putEntry добавляет в batch запись и ее индексы
+func (s *Store) putEntry(batch *leveldb.Batch, entry Entry) error {
+	data, err := s.encode(entry)
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(entryPrefix+entry.ID), data)
+	for _, key := range s.indexKeys(entry, s.cipher != nil) {
+		batch.Put([]byte(key), nil)
+	}
+	return nil
+}
+
+// deleteEntry добавляет в batch удаление записи и ее индексов
+func (s *Store) deleteEntry(batch *leveldb.Batch, entry Entry) {
+	batch.Delete([]byte(entryPrefix + entry.ID))
+	for _, key := range s.indexKeys(entry, s.cipher != nil) {
+		batch.Delete([]byte(key))
+	}
+}
+
+// indexKeys возвращает ключи индексов записи; blind — слова заменены метками
+func (s *Store) indexKeys(entry Entry, blind bool) []string {
+	var keys []string
+	if entry.Source != "" {
+		keys = append(keys, sourcePrefix+entry.Source+"\x00"+entry.ID)
+	}
+	if entry.Type != "" {
+		keys = append(keys, typePrefix+entry.Type+"\x00"+entry.ID)
+	}
+	for _, term := range Terms(entry.Command + " " + entry.Response) {
+		if blind {
+			term = s.cipher.Blind(term)
+		}
+		keys = append(keys, wordPrefix+term+"\x00"+entry.ID)
+	}
+	return keys
+}
+
+// term возвращает ключ слова в индексе
+func (s *Store) term(stem string) string {
+	if s.cipher != nil {
+		return s.cipher.Blind(stem)
+	}
+	return stem
+}
+
+// encode сериализует запись и шифрует ее, если задан Cipher
+func (s *Store) encode(entry Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	if s.cipher == nil {
+		return data, nil
+	}
+	return s.cipher.Encrypt(data, []byte(entry.ID))
+}
+
+// decode читает запись с идентификатором id. Открытая запись — это JSON,
+// он всегда начинается с "{".
+func (s *Store) decode(id string, data []byte) (Entry, error) {
+	if len(data) > 0 && data[0] != '{' {
+		if s.cipher == nil {
+			return Entry{}, tracerr.New("История зашифрована, а ключ не задан")
+		}
+		plain, err := s.cipher.Decrypt(data, []byte(id))
+		if err != nil {
+			return Entry{}, err
+		}
+		data = plain
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, tracerr.Wrap(err)
+	}
+	entry.ID = id
+	return entry, nil
+}
+
+// checkEncryption не дает открыть зашифрованную историю без ключа
+func (s *Store) checkEncryption() error {
+	data, err := s.db.Get([]byte(encryptionKey), nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	if len(data) > 0 && s.cipher == nil {
+		return tracerr.New("История зашифрована: включите encrypt_history в разделе security настроек")
+	}
+	return nil
+}
+
+// encryptAll шифрует открытые записи и заменяет слова в индексе метками.
+// Каждая порция записей переводится одной записью в базу, поэтому после
+// сбоя шифрование продолжится с того же места.
+func (s *Store) encryptAll() error {
+	if s.cipher == nil {
+		return nil
+	}
+	if data, err := s.db.Get([]byte(encryptionKey), nil); err == nil && string(data) == encrypted {
+		return nil
+	}
+
+	if err := s.db.Put([]byte(encryptionKey), []byte(encrypting), nil); err != nil {
+		return tracerr.Wrap(err)
+	}
+	converted, err := s.rewrite(func(data []byte) bool { return len(data) > 0 && data[0] == '{' }, true)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Put([]byte(encryptionKey), []byte(encrypted), nil); err != nil {
+		return tracerr.Wrap(err)
+	}
+	if converted > 0 {
+		log.Printf("История зашифрована, записей: %d", converted)
+	}
+	return nil
+}
+
+// Rekey перешифровывает все записи текущим ключом Cipher, например после
+// смены ключа, и возвращает их число
+func (s *Store) Rekey() (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	return s.rewrite(func([]byte) bool { return true }, false)
+}
+
+// rewrite перезаписывает записи, для которых match возвращает true.
+// plainIndex сообщает, что слова в индексе этих записей еще открытые.
+func (s *Store) rewrite(match func(data []byte) bool, plainIndex bool) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rewritten := 0
+	start := []byte(entryPrefix)
+	for {
+		iter := s.db.NewIterator(&util.Range{Start: start, Limit: []byte(entryPrefix + "\xff")}, nil)
+		batch := new(leveldb.Batch)
+		for batch.Len() < pruneBatch && iter.Next() {
+			if !match(iter.Value()) {
+				continue
+			}
+			id := string(iter.Key()[len(entryPrefix):])
+			entry, err := s.decode(id, iter.Value())
+			if err != nil {
+				iter.Release()
+				return rewritten, err
+			}
+			if plainIndex {
+				for _, key := range s.indexKeys(entry, false) {
+					if strings.HasPrefix(key, wordPrefix) {
+						batch.Delete([]byte(key))
+					}
+				}
+			}
+			if err := s.putEntry(batch, entry); err != nil {
+				iter.Release()
+				return rewritten, err
+			}
+			rewritten++
+		}
+		more := iter.Next()
+		if more {
+			start = append([]byte(nil), iter.Key()...)
+		}
+		err := iter.Error()
+		iter.Release()
+		if err != nil {
+			return rewritten, tracerr.Wrap(err)
+		}
+		if err := s.db.Write(batch, nil); err != nil {
+			return rewritten, tracerr.Wrap(err)
+		}
+		if !more {
+			return rewritten, nil
+		}
+	}
+}
+
+// idLength — длина идентификатора записи
+const idLength = 16
+
+func formatID(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+func parseID(id string) (uint64, bool) {
+	if len(id) != idLength {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(id, 16, 64)
+	return value, err == nil
+}
+
+func encodeCount(count int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(max(count, 0)))
+}
+
+// loadState читает число записей и последний идентификатор
+func (s *Store) loadState() error {
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(entryPrefix)), nil)
+	defer iter.Release()
+	if iter.Last() {
+		s.lastID, _ = parseID(string(iter.Key()[len(entryPrefix):]))
+	}
+	if err := iter.Error(); err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	data, err := s.db.Get([]byte(countKey), nil)
+	if err == nil && len(data) == 8 {
+		s.count = int(binary.BigEndian.Uint64(data))
+		return nil
+	}
+	if err != nil && err != leveldb.ErrNotFound {
+		return tracerr.Wrap(err)
+	}
+
+	// Счетчика нет — считаем записи один раз
+	for ok := iter.First(); ok; ok = iter.Next() {
+		s.count++
+	}
+	return tracerr.Wrap(s.db.Put([]byte(countKey), encodeCount(s.count), nil))
+}
+
+// migrate переводит историю из прежнего формата, где ключом была
+// десятичная временная метка в секундах, а записи с одной секундой
+// затирали друг друга
+func (s *Store) migrate() error {
+	data, err := s.db.Get([]byte(versionKey), nil)
+	if err == nil && string(data) == strconv.Itoa(version) {
+		return nil
+	}
+	if err != nil && err != leveldb.ErrNotFound {
+		return tracerr.Wrap(err)
+	}
+
+	iter := s.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	migrated := 0
+	for iter.Next() {
+		key := string(iter.Key())
+		seconds, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		batch.Delete([]byte(key))
+
+		var entry Entry
+		if err := json.Unmarshal(iter.Value(), &entry); err != nil {
+			continue
+		}
+		entry.ID = formatID(uint64(seconds) * uint64(time.Second))
+		entry.Timestamp = seconds
+		if err := s.putEntry(batch, entry); err != nil {
+			return err
+		}
+		migrated++
+	}
+	if err := iter.Error(); err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	// Счетчик пересчитывается после переноса
+	batch.Delete([]byte(countKey))
+	batch.Put([]byte(versionKey), []byte(strconv.Itoa(version)))
+	if err := s.db.Write(batch, nil); err != nil {
+		return tracerr.Wrap(err)
+	}
+	if migrated > 0 {
+		log.Printf("История переведена в новый формат, записей: %d", migrated)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"kot.ai/internal/secrets"
+)
+
+// openTest открывает пустую историю в памяти
+func openTest(t *testing.T, retention Retention) *Store {
+	s, err := OpenMemory(Options{Retention: retention})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// commands возвращает команды записей страницы
+func commands(page Page) []string {
+	var result []string
+	for _, entry := range page.Entries {
+		result = append(result, entry.Command)
+	}
+	return result
+}
+
+func TestAddOrdersEntries(t *testing.T) {
+	s := openTest(t, Retention{})
+
+	// Записи в одну секунду не затирают друг друга
+	var ids []string
+	for i := 0; i < 20; i++ {
+		entry, err := s.Add(Entry{Command: fmt.Sprintf("команда %d", i)})
+		assert.NoError(t, err)
+		assert.NotZero(t, entry.Timestamp)
+		ids = append(ids, entry.ID)
+	}
+	for i := 1; i < len(ids); i++ {
+		assert.Less(t, ids[i-1], ids[i])
+	}
+	assert.Equal(t, 20, s.Count())
+
+	page, err := s.Query(Query{Limit: 100})
+	assert.NoError(t, err)
+	assert.Len(t, page.Entries, 20)
+	assert.Equal(t, "команда 0", page.Entries[0].Command)
+	assert.Empty(t, page.Next)
+
+	entry, ok, err := s.Get(ids[3])
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "команда 3", entry.Command)
+
+	// Занятый идентификатор не перезаписывается
+	_, err = s.Add(Entry{ID: ids[3], Command: "другая"})
+	assert.Error(t, err)
+	_, err = s.Add(Entry{ID: "abc"})
+	assert.Error(t, err)
+}
+
+func TestQueryPaging(t *testing.T) {
+	s := openTest(t, Retention{})
+	for i := 0; i < 5; i++ {
+		s.Add(Entry{Command: fmt.Sprint(i)})
+	}
+
+	page, err := s.Query(Query{Limit: 2, Descending: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "3"}, commands(page))
+	assert.NotEmpty(t, page.Next)
+
+	page, err = s.Query(Query{Limit: 2, Descending: true, After: page.Next})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, commands(page))
+
+	page, err = s.Query(Query{Limit: 2, Descending: true, After: page.Next})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0"}, commands(page))
+	assert.Empty(t, page.Next)
+
+	page, err = s.Query(Query{Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", "1", "2"}, commands(page))
+	page, err = s.Query(Query{Limit: 3, After: page.Next})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "4"}, commands(page))
+}
+
+func TestQueryFilters(t *testing.T) {
+	s := openTest(t, Retention{})
+	s.Add(Entry{Command: "открой браузер", Response: "Открываю firefox", Source: "local", Type: "open_app"})
+	s.Add(Entry{Command: "какая погода", Response: "В Москве солнечно", Source: "web", Type: "weather"})
+	s.Add(Entry{Command: "расскажи про браузеры", Response: "Браузер показывает сайты", Source: "web", Type: "chat"})
+	s.Add(Entry{Command: "открой терминал", Response: "Открываю", Source: "web", Type: "open_app"})
+
+	page, err := s.Query(Query{Source: "web"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"какая погода", "расскажи про браузеры", "открой терминал"}, commands(page))
+
+	page, err = s.Query(Query{Type: "open_app", Source: "web"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"открой терминал"}, commands(page))
+
+	// Поиск по основам слов в команде и ответе
+	page, err = s.Query(Query{Text: "Браузера"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"открой браузер", "расскажи про браузеры"}, commands(page))
+
+	page, err = s.Query(Query{Text: "браузер сайты"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"расскажи про браузеры"}, commands(page))
+
+	page, err = s.Query(Query{Text: "москва", Type: "weather"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"какая погода"}, commands(page))
+
+	page, err = s.Query(Query{Text: "самолет"})
+	assert.NoError(t, err)
+	assert.Empty(t, page.Entries)
+
+	sources, err := s.Sources()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"local", "web"}, sources)
+}
+
+func TestQueryTimeRange(t *testing.T) {
+	s := openTest(t, Retention{})
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		_, err := s.Add(Entry{ID: formatID(uint64(base.Add(time.Duration(i) * time.Hour).UnixNano())), Command: fmt.Sprint(i)})
+		assert.NoError(t, err)
+	}
+
+	page, err := s.Query(Query{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, commands(page))
+	assert.Equal(t, base.Add(time.Hour), page.Entries[0].Time().UTC())
+	assert.Equal(t, base.Add(time.Hour).Unix(), page.Entries[0].Timestamp)
+
+	// Новые записи идут после перенесенных
+	entry, err := s.Add(Entry{Command: "сейчас"})
+	assert.NoError(t, err)
+	page, err = s.Query(Query{Limit: 1, Descending: true})
+	assert.NoError(t, err)
+	assert.Equal(t, entry.ID, page.Entries[0].ID)
+}
+
+func TestDeleteAndClear(t *testing.T) {
+	s := openTest(t, Retention{})
+	first, _ := s.Add(Entry{Command: "открой браузер", Source: "local", Type: "open_app"})
+	s.Add(Entry{Command: "открой терминал", Source: "local", Type: "open_app"})
+
+	assert.NoError(t, s.Delete(first.ID))
+	assert.Equal(t, 1, s.Count())
+	for _, q := range []Query{{Text: "браузер"}, {Source: "local", Text: "браузер"}, {Type: "open_app", Text: "браузер"}} {
+		page, err := s.Query(q)
+		assert.NoError(t, err)
+		assert.Empty(t, page.Entries)
+	}
+	// Индексы удалены вместе с записью
+	iter := s.db.NewIterator(nil, nil)
+	for iter.Next() {
+		assert.NotContains(t, string(iter.Key()), first.ID)
+	}
+	iter.Release()
+
+	assert.NoError(t, s.Clear())
+	assert.Equal(t, 0, s.Count())
+	page, err := s.Query(Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, page.Entries)
+	sources, err := s.Sources()
+	assert.NoError(t, err)
+	assert.Empty(t, sources)
+}
+
+func TestRetention(t *testing.T) {
+	s := openTest(t, Retention{MaxAge: 24 * time.Hour, MaxEntries: 3})
+	old := time.Now().Add(-48 * time.Hour)
+	s.Add(Entry{ID: formatID(uint64(old.UnixNano())), Command: "старая", Source: "local"})
+	for i := 0; i < 4; i++ {
+		s.Add(Entry{Command: fmt.Sprint(i)})
+	}
+	assert.Equal(t, 5, s.Count())
+
+	assert.NoError(t, s.Prune())
+	assert.Equal(t, 3, s.Count())
+	page, err := s.Query(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, commands(page))
+	page, err = s.Query(Query{Source: "local"})
+	assert.NoError(t, err)
+	assert.Empty(t, page.Entries)
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+
+	// Прежний формат: ключ — временная метка в секундах
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range []int64{1700000100, 1700000000} {
+		data, _ := json.Marshal(Entry{Timestamp: ts, Command: fmt.Sprintf("команда %d", ts), Source: "local"})
+		db.Put([]byte(fmt.Sprint(ts)), data, nil)
+	}
+	db.Close()
+
+	s, err := Open(path, Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, s.Count())
+	page, err := s.Query(Query{Source: "local", Text: "команда"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"команда 1700000000", "команда 1700000100"}, commands(page))
+	assert.Equal(t, time.Unix(1700000000, 0), page.Entries[0].Time())
+
+	entry, err := s.Add(Entry{Command: "новая"})
+	assert.NoError(t, err)
+	s.Close()
+
+	// Повторное открытие ничего не переносит и помнит число записей
+	s, err = Open(path, Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	assert.Equal(t, 3, s.Count())
+	next, err := s.Add(Entry{Command: "еще"})
+	assert.NoError(t, err)
+	assert.Greater(t, next.ID, entry.ID)
+}
+
+func TestEncryption(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.db")
+	keys, err := secrets.OpenKeyset(filepath.Join(dir, "keys.json"), secrets.Passphrase("пароль"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Открытая история шифруется при первом открытии с ключом
+	s, err := Open(path, Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Add(Entry{Command: "какая погода", Response: "Солнечно", Source: "web"})
+	s.Close()
+
+	s, err = Open(path, Options{Cipher: keys})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Add(Entry{Command: "погода завтра", Response: "Дождь", Source: "local"})
+	page, err := s.Query(Query{Text: "погоду"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"какая погода", "погода завтра"}, commands(page))
+
+	// После смены ключа записи перешифровываются, старый ключ не нужен
+	_, err = keys.Rotate()
+	assert.NoError(t, err)
+	count, err := s.Rekey()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, keys.Retire())
+	page, err = s.Query(Query{Text: "дождь"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"погода завтра"}, commands(page))
+	s.Close()
+
+	// В базе нет открытого текста ни в записях, ни в индексе
+	db, err := leveldb.OpenFile(path, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	iter := db.NewIterator(util.BytesPrefix([]byte(entryPrefix)), nil)
+	entries := 0
+	for iter.Next() {
+		assert.False(t, bytes.Contains(iter.Value(), []byte("погода")))
+		entries++
+	}
+	iter.Release()
+	assert.Equal(t, 2, entries)
+	has, _ := db.Has([]byte(wordPrefix+"погод\x00"), nil)
+	assert.False(t, has)
+	iter = db.NewIterator(util.BytesPrefix([]byte(wordPrefix+"погод")), nil)
+	assert.False(t, iter.Next())
+	iter.Release()
+	db.Close()
+
+	// Без ключа зашифрованная история не открывается
+	_, err = Open(path, Options{})
+	assert.ErrorContains(t, err, "encrypt_history")
+}
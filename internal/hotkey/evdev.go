@@ -0,0 +1,194 @@
+package hotkey
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Событие evdev (struct input_event): время, тип, код и значение. Время —
+// два long, поэтому размер зависит от разрядности.
+var eventSize = 2*strconv.IntSize/8 + 8
+
+const (
+	evKey = 1    // тип события: клавиша
+	evRep = 0x14 // бит автоповтора в маске EV: он есть только у клавиатур
+)
+
+// evdevModifiers сопоставляет коды левых и правых модификаторов их флагам
+var evdevModifiers = map[uint16]Modifier{
+	42: ModShift, 54: ModShift,
+	29: ModCtrl, 97: ModCtrl,
+	56: ModAlt, 100: ModAlt,
+	125: ModSuper, 126: ModSuper,
+}
+
+// evdevListener читает нажатия с клавиатур
+type evdevListener struct {
+	files  []*os.File
+	events chan Event
+	done   sync.WaitGroup
+}
+
+// listenEvdev открывает устройство device или все клавиатуры
+func listenEvdev(combo Combo, device string) (Listener, error) {
+	paths := []string{device}
+	if device == "" {
+		devices, err := os.Open("/proc/bus/input/devices")
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		paths = keyboards(devices)
+		devices.Close()
+		if len(paths) == 0 {
+			return nil, tracerr.New("Клавиатуры не найдены")
+		}
+	}
+
+	l := &evdevListener{events: make(chan Event, 8)}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			l.Close()
+			return nil, tracerr.New(fmt.Sprintf("Нет доступа к %s (нужна группа input): %v", path, err))
+		}
+		l.files = append(l.files, file)
+	}
+	for _, file := range l.files {
+		l.done.Add(1)
+		go func(file *os.File) {
+			defer l.done.Done()
+			readEvdev(file, combo, l.events)
+		}(file)
+	}
+	go func() {
+		l.done.Wait()
+		close(l.events)
+	}()
+	return l, nil
+}
+
+// Events возвращает канал нажатий
+func (l *evdevListener) Events() <-chan Event {
+	return l.events
+}
+
+// Close закрывает устройства
+func (l *evdevListener) Close() error {
+	for _, file := range l.files {
+		file.Close()
+	}
+	return nil
+}
+
+// readEvdev читает события одного устройства, пока оно не закроется
+func readEvdev(r io.Reader, combo Combo, events chan<- Event) {
+	m := matcher{combo: combo, code: keys[combo.Key].code, held: map[uint16]bool{}}
+	buffer := make([]byte, eventSize)
+	for {
+		if _, err := io.ReadFull(r, buffer); err != nil {
+			return
+		}
+		eventType := binary.LittleEndian.Uint16(buffer[eventSize-8:])
+		code := binary.LittleEndian.Uint16(buffer[eventSize-6:])
+		value := int32(binary.LittleEndian.Uint32(buffer[eventSize-4:]))
+		if eventType != evKey {
+			continue
+		}
+		if event, ok := m.key(code, value); ok {
+			events <- event
+		}
+	}
+}
+
+// matcher следит за модификаторами и узнает нажатие сочетания
+type matcher struct {
+	combo   Combo
+	code    uint16          // код основной клавиши
+	held    map[uint16]bool // нажатые модификаторы
+	pressed bool
+}
+
+// key обрабатывает нажатие (value 1), отпускание (0) или автоповтор (2)
+func (m *matcher) key(code uint16, value int32) (Event, bool) {
+	if _, ok := evdevModifiers[code]; ok {
+		m.held[code] = value != 0
+		return Event{}, false
+	}
+	if code != m.code {
+		return Event{}, false
+	}
+
+	switch {
+	case value == 1 && !m.pressed && m.modifiers() == m.combo.Modifiers:
+		m.pressed = true
+		return Event{Pressed: true}, true
+	case value == 0 && m.pressed:
+		m.pressed = false
+		return Event{Pressed: false}, true
+	}
+	return Event{}, false
+}
+
+// modifiers возвращает нажатые сейчас модификаторы
+func (m *matcher) modifiers() Modifier {
+	var modifiers Modifier
+	for code, held := range m.held {
+		if held {
+			modifiers |= evdevModifiers[code]
+		}
+	}
+	return modifiers
+}
+
+// keyboards находит клавиатуры в описании устройств /proc/bus/input/devices:
+// у них есть обработчик kbd и автоповтор клавиш
+func keyboards(r io.Reader) []string {
+	var paths []string
+	var handlers []string
+	var repeat bool
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "H: Handlers="):
+			handlers = strings.Fields(strings.TrimPrefix(line, "H: Handlers="))
+		case strings.HasPrefix(line, "B: EV="):
+			mask, err := strconv.ParseUint(strings.TrimPrefix(line, "B: EV="), 16, 64)
+			repeat = err == nil && mask&(1<<evKey) != 0 && mask&(1<<evRep) != 0
+		case line == "":
+			// Конец описания устройства
+			paths = append(paths, keyboardEvent(handlers, repeat)...)
+			handlers, repeat = nil, false
+		}
+	}
+	return append(paths, keyboardEvent(handlers, repeat)...)
+}
+
+// keyboardEvent возвращает устройство eventN клавиатуры
+func keyboardEvent(handlers []string, repeat bool) []string {
+	if !repeat {
+		return nil
+	}
+	isKeyboard := false
+	var event string
+	for _, handler := range handlers {
+		isKeyboard = isKeyboard || handler == "kbd"
+		if strings.HasPrefix(handler, "event") {
+			event = handler
+		}
+	}
+	if !isKeyboard || event == "" {
+		return nil
+	}
+	return []string{filepath.Join("/dev/input", event)}
+}
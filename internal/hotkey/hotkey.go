@@ -0,0 +1,167 @@
+// Package hotkey следит за глобальным сочетанием клавиш в Linux: через
+// X-сервер или напрямую через устройства ввода evdev, что работает и в
+// Wayland, и в консоли.
+package hotkey
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Способы получать нажатия
+const (
+	BackendAuto  = "auto"  // X11, если есть DISPLAY, иначе evdev
+	BackendX11   = "x11"   // захват сочетания на X-сервере
+	BackendEvdev = "evdev" // чтение /dev/input; нужен доступ к устройствам (группа input)
+)
+
+// Modifier — набор клавиш-модификаторов
+type Modifier uint8
+
+// Модификаторы
+const (
+	ModShift Modifier = 1 << iota
+	ModCtrl
+	ModAlt
+	ModSuper
+)
+
+// modifierNames сопоставляет названия модификаторов их флагам
+var modifierNames = map[string]Modifier{
+	"shift": ModShift,
+	"ctrl":  ModCtrl, "control": ModCtrl,
+	"alt":   ModAlt,
+	"super": ModSuper, "win": ModSuper, "meta": ModSuper,
+}
+
+// key — код клавиши для evdev и ее символ (keysym) для X11
+type key struct {
+	code   uint16
+	keysym uint32
+}
+
+// keys содержит клавиши, которые можно назначить
+var keys = map[string]key{
+	"space":      {57, 0x20},
+	"enter":      {28, 0xff0d},
+	"tab":        {15, 0xff09},
+	"escape":     {1, 0xff1b},
+	"pause":      {119, 0xff13},
+	"scrolllock": {70, 0xff14},
+	"insert":     {110, 0xff63},
+	"delete":     {111, 0xffff},
+	"home":       {102, 0xff50},
+	"end":        {107, 0xff57},
+	"pageup":     {104, 0xff55},
+	"pagedown":   {109, 0xff56},
+	"menu":       {127, 0xff67},
+	"f1":         {59, 0xffbe},
+	"f2":         {60, 0xffbf},
+	"f3":         {61, 0xffc0},
+	"f4":         {62, 0xffc1},
+	"f5":         {63, 0xffc2},
+	"f6":         {64, 0xffc3},
+	"f7":         {65, 0xffc4},
+	"f8":         {66, 0xffc5},
+	"f9":         {67, 0xffc6},
+	"f10":        {68, 0xffc7},
+	"f11":        {87, 0xffc8},
+	"f12":        {88, 0xffc9},
+}
+
+func init() {
+	// Буквы и цифры: коды evdev идут по рядам клавиатуры
+	rows := []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+	starts := []uint16{2, 16, 30, 44}
+	for i, row := range rows {
+		for j, r := range row {
+			keys[string(r)] = key{code: starts[i] + uint16(j), keysym: uint32(r)}
+		}
+	}
+}
+
+// Combo — сочетание клавиш: модификаторы и основная клавиша
+type Combo struct {
+	Modifiers Modifier
+	Key       string
+}
+
+// Parse разбирает сочетание вида "ctrl+alt+space" без учета регистра
+func Parse(spec string) (Combo, error) {
+	var combo Combo
+	for _, part := range strings.Split(strings.ToLower(spec), "+") {
+		part = strings.TrimSpace(part)
+		if modifier, ok := modifierNames[part]; ok {
+			combo.Modifiers |= modifier
+			continue
+		}
+		if _, ok := keys[part]; !ok {
+			return Combo{}, tracerr.New(fmt.Sprintf("Неизвестная клавиша %q в сочетании %q", part, spec))
+		}
+		if combo.Key != "" {
+			return Combo{}, tracerr.New(fmt.Sprintf("В сочетании %q больше одной клавиши, кроме модификаторов", spec))
+		}
+		combo.Key = part
+	}
+	if combo.Key == "" {
+		return Combo{}, tracerr.New(fmt.Sprintf("В сочетании %q нет основной клавиши", spec))
+	}
+	return combo, nil
+}
+
+// String возвращает сочетание в виде "ctrl+alt+space"
+func (c Combo) String() string {
+	var parts []string
+	for _, name := range []string{"ctrl", "alt", "shift", "super"} {
+		if c.Modifiers&modifierNames[name] != 0 {
+			parts = append(parts, name)
+		}
+	}
+	return strings.Join(append(parts, c.Key), "+")
+}
+
+// Event — нажатие или отпускание сочетания
+type Event struct {
+	Pressed bool
+}
+
+// Listener присылает нажатия сочетания, пока его не закроют
+type Listener interface {
+	Events() <-chan Event
+	Close() error
+}
+
+// Listen начинает следить за сочетанием spec. device — устройство evdev,
+// например /dev/input/event3; пусто — все клавиатуры.
+func Listen(spec, backend, device string) (Listener, error) {
+	combo, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case BackendX11:
+		return listenX11(combo)
+	case BackendEvdev:
+		return listenEvdev(combo, device)
+	case BackendAuto, "":
+		if os.Getenv("DISPLAY") != "" {
+			listener, err := listenX11(combo)
+			if err == nil {
+				return listener, nil
+			}
+			// Например, сочетание уже занято: пробуем устройства ввода
+			evdev, evdevErr := listenEvdev(combo, device)
+			if evdevErr != nil {
+				return nil, tracerr.New(fmt.Sprintf("%v; %v", err, evdevErr))
+			}
+			return evdev, nil
+		}
+		return listenEvdev(combo, device)
+	default:
+		return nil, tracerr.New(fmt.Sprintf("Неизвестный способ получать нажатия: %s", backend))
+	}
+}
@@ -0,0 +1,264 @@
+package hotkey
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	combo, err := Parse("Ctrl+Alt+Space")
+	assert.NoError(t, err)
+	assert.Equal(t, Combo{Modifiers: ModCtrl | ModAlt, Key: "space"}, combo)
+	assert.Equal(t, "ctrl+alt+space", combo.String())
+
+	combo, err = Parse("super + k")
+	assert.NoError(t, err)
+	assert.Equal(t, Combo{Modifiers: ModSuper, Key: "k"}, combo)
+
+	combo, err = Parse("pause")
+	assert.NoError(t, err)
+	assert.Equal(t, Combo{Key: "pause"}, combo)
+
+	for _, spec := range []string{"", "ctrl+alt", "ctrl+a+b", "ctrl+пробел"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// evdevEvent кодирует событие evdev
+func evdevEvent(eventType, code uint16, value int32) []byte {
+	event := make([]byte, eventSize)
+	binary.LittleEndian.PutUint16(event[eventSize-8:], eventType)
+	binary.LittleEndian.PutUint16(event[eventSize-6:], code)
+	binary.LittleEndian.PutUint32(event[eventSize-4:], uint32(value))
+	return event
+}
+
+func TestEvdev(t *testing.T) {
+	combo, err := Parse("ctrl+space")
+	assert.NoError(t, err)
+
+	var stream bytes.Buffer
+	for _, event := range [][3]int{
+		{evKey, 57, 1}, {evKey, 57, 0}, // пробел без Ctrl не считается
+		{evKey, 97, 1}, // правый Ctrl
+		{evKey, 57, 1},
+		{evKey, 57, 2}, {evKey, 57, 2}, // автоповтор
+		{0, 0, 0}, // синхронизация
+		{evKey, 97, 0},
+		{evKey, 57, 0},
+		{evKey, 29, 1}, {evKey, 42, 1}, {evKey, 57, 1}, {evKey, 57, 0}, // лишний Shift
+	} {
+		stream.Write(evdevEvent(uint16(event[0]), uint16(event[1]), int32(event[2])))
+	}
+
+	events := make(chan Event, 10)
+	readEvdev(&stream, combo, events)
+	close(events)
+	var received []Event
+	for event := range events {
+		received = append(received, event)
+	}
+	assert.Equal(t, []Event{{Pressed: true}, {Pressed: false}}, received)
+}
+
+func TestKeyboards(t *testing.T) {
+	devices := `I: Bus=0019 Vendor=0000 Product=0001 Version=0000
+N: Name="Power Button"
+H: Handlers=kbd event0
+B: EV=3
+
+I: Bus=0011 Vendor=0001 Product=0001 Version=ab41
+N: Name="AT Translated Set 2 keyboard"
+H: Handlers=sysrq kbd event3 leds
+B: EV=120013
+
+I: Bus=0003 Vendor=046d Product=c52b Version=0111
+N: Name="Logitech USB Receiver Mouse"
+H: Handlers=mouse0 event5
+B: EV=17
+
+I: Bus=0003 Vendor=046d Product=c52b Version=0111
+N: Name="Logitech USB Receiver Keyboard"
+H: Handlers=sysrq kbd leds event6
+B: EV=120013`
+	assert.Equal(t, []string{"/dev/input/event3", "/dev/input/event6"}, keyboards(strings.NewReader(devices)))
+}
+
+// fakeX11 — X-сервер для тестов: отвечает на рукопожатие, раскладку и
+// захват, запоминает захваченные сочетания
+type fakeX11 struct {
+	conn      net.Conn
+	grabbed   []uint16 // маски модификаторов
+	keycode   byte
+	failGrabs bool
+}
+
+func (x *fakeX11) serve(t *testing.T) {
+	// Рукопожатие
+	request := make([]byte, 12)
+	if _, err := io.ReadFull(x.conn, request); err != nil {
+		return
+	}
+	auth := make([]byte, pad(int(binary.LittleEndian.Uint16(request[6:])))+pad(int(binary.LittleEndian.Uint16(request[8:]))))
+	io.ReadFull(x.conn, auth)
+
+	vendor := padded([]byte("Fake"))
+	body := make([]byte, 32, 32+len(vendor)+8+40)
+	binary.LittleEndian.PutUint16(body[16:], 4)
+	body[20] = 1 // экранов
+	body[21] = 1 // форматов
+	body[26], body[27] = 8, 255
+	body = append(body, vendor...)
+	body = append(body, make([]byte, 8)...) // формат
+	screen := make([]byte, 40)
+	binary.LittleEndian.PutUint32(screen, 0x100)
+	body = append(body, screen...)
+	header := make([]byte, 8)
+	header[0] = 1
+	binary.LittleEndian.PutUint16(header[6:], uint16(len(body)/4))
+	x.conn.Write(append(header, body...))
+
+	// Ошибки захвата отправляем перед ответом на следующий запрос: net.Pipe
+	// не буферизует, а клиент читает только после всех запросов
+	var errors []byte
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(x.conn, header); err != nil {
+			return
+		}
+		request := make([]byte, 4*int(binary.LittleEndian.Uint16(header[2:]))-4)
+		io.ReadFull(x.conn, request)
+
+		switch header[0] {
+		case x11GetKeyboardMapping:
+			// Один символ на клавишу: на коде 65 — пробел
+			count := int(request[1])
+			reply := make([]byte, 32+4*count)
+			reply[0], reply[1] = x11Reply, 1
+			binary.LittleEndian.PutUint32(reply[4:], uint32(count))
+			binary.LittleEndian.PutUint32(reply[32+4*(65-8):], 0x20)
+			x.conn.Write(reply)
+		case x11GrabKey:
+			assert.Equal(t, uint32(0x100), binary.LittleEndian.Uint32(request))
+			x.grabbed = append(x.grabbed, binary.LittleEndian.Uint16(request[4:]))
+			x.keycode = request[6]
+			if x.failGrabs {
+				reply := make([]byte, 32)
+				reply[0], reply[1], reply[10] = x11Error, x11BadAccess, x11GrabKey
+				errors = append(errors, reply...)
+			}
+		case x11GetInputFocus:
+			reply := make([]byte, 32)
+			reply[0] = x11Reply
+			x.conn.Write(append(errors, reply...))
+			return
+		}
+	}
+}
+
+// key отправляет событие клавиши с временем at
+func (x *fakeX11) key(code byte, keycode byte, at uint32) {
+	event := make([]byte, 32)
+	event[0], event[1] = code, keycode
+	binary.LittleEndian.PutUint32(event[4:], at)
+	x.conn.Write(event)
+}
+
+func TestX11(t *testing.T) {
+	combo, err := Parse("ctrl+space")
+	assert.NoError(t, err)
+
+	client, server := net.Pipe()
+	x := &fakeX11{conn: server}
+	go x.serve(t)
+	listener, err := newX11Listener(client, "MIT-MAGIC-COOKIE-1", []byte("0123456789abcdef"), combo)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer listener.Close()
+
+	// Сочетание захвачено и с Caps Lock и Num Lock
+	assert.Equal(t, byte(65), x.keycode)
+	assert.Equal(t, []uint16{4, 4 | 2, 4 | 16, 4 | 2 | 16}, x.grabbed)
+
+	go func() {
+		x.key(x11KeyPress, 65, 1)
+		// Автоповтор: отпускание и нажатие с одним временем
+		x.key(x11KeyRelease, 65, 2)
+		x.key(x11KeyPress, 65, 2)
+		x.key(x11KeyRelease, 65, 3)
+		x.key(x11KeyPress, 66, 4) // другая клавиша
+		x.key(x11KeyPress, 65, 5)
+	}()
+
+	var received []Event
+	for len(received) < 3 {
+		select {
+		case event := <-listener.Events():
+			received = append(received, event)
+		case <-time.After(time.Second):
+			t.Fatal("нет события")
+		}
+	}
+	assert.Equal(t, []Event{{Pressed: true}, {Pressed: false}, {Pressed: true}}, received)
+
+	// Закрытие соединения закрывает канал
+	server.Close()
+	_, ok := <-listener.Events()
+	assert.False(t, ok)
+}
+
+func TestX11GrabTaken(t *testing.T) {
+	combo, err := Parse("ctrl+space")
+	assert.NoError(t, err)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	x := &fakeX11{conn: server, failGrabs: true}
+	go x.serve(t)
+	_, err = newX11Listener(client, "", nil, combo)
+	assert.ErrorContains(t, err, "занято")
+}
+
+func TestDisplayAddress(t *testing.T) {
+	network, address, number, err := displayAddress(":1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"unix", "/tmp/.X11-unix/X1", "1"}, []string{network, address, number})
+
+	network, address, number, err = displayAddress("localhost:10.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tcp", "localhost:6010", "10"}, []string{network, address, number})
+
+	_, _, _, err = displayAddress("wayland-0")
+	assert.Error(t, err)
+}
+
+func TestFindCookie(t *testing.T) {
+	entry := func(display, name, data string) []byte {
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.BigEndian, uint16(256))
+		for _, field := range []string{"host", display, name, data} {
+			binary.Write(&buffer, binary.BigEndian, uint16(len(field)))
+			buffer.WriteString(field)
+		}
+		return buffer.Bytes()
+	}
+	data := append(entry("0", "MIT-MAGIC-COOKIE-1", "first"), entry("1", "MIT-MAGIC-COOKIE-1", "second")...)
+
+	name, cookie := findCookie(data, "1")
+	assert.Equal(t, "MIT-MAGIC-COOKIE-1", name)
+	assert.Equal(t, []byte("second"), cookie)
+
+	name, _ = findCookie(data, "2")
+	assert.Empty(t, name)
+	name, _ = findCookie(data[:10], "0")
+	assert.Empty(t, name)
+}
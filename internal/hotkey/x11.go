@@ -0,0 +1,351 @@
+package hotkey
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Коды запросов, событий и ошибок протокола X11
+const (
+	x11GrabKey            = 33
+	x11GetInputFocus      = 43
+	x11GetKeyboardMapping = 101
+
+	x11Error      = 0
+	x11Reply      = 1
+	x11KeyPress   = 2
+	x11KeyRelease = 3
+
+	x11BadAccess = 10 // сочетание захвачено другой программой
+)
+
+// Маски модификаторов X11
+const (
+	x11ShiftMask   = 1
+	x11LockMask    = 2 // Caps Lock
+	x11ControlMask = 4
+	x11Mod1Mask    = 8  // Alt
+	x11Mod2Mask    = 16 // Num Lock
+	x11Mod4Mask    = 64 // Super
+)
+
+// repeatWindow — сколько ждать нажатия после отпускания: X-сервер
+// изображает автоповтор парами «отпускание — нажатие» с одним временем
+const repeatWindow = 30 * time.Millisecond
+
+// x11Listener получает нажатия сочетания, захваченного на X-сервере
+type x11Listener struct {
+	conn   net.Conn
+	events chan Event
+}
+
+// listenX11 подключается к X-серверу из DISPLAY и захватывает сочетание
+func listenX11(combo Combo) (Listener, error) {
+	display := os.Getenv("DISPLAY")
+	network, address, number, err := displayAddress(display)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	authName, authData := xauthCookie(number)
+	listener, err := newX11Listener(conn, authName, authData, combo)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// newX11Listener проходит рукопожатие на соединении conn, захватывает
+// сочетание и начинает читать события
+func newX11Listener(conn net.Conn, authName string, authData []byte, combo Combo) (*x11Listener, error) {
+	root, minKeycode, maxKeycode, err := x11Setup(conn, authName, authData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Код клавиши ищем по ее символу в раскладке сервера
+	keycode, err := x11Keycode(conn, minKeycode, maxKeycode, keys[combo.Key].keysym)
+	if err != nil {
+		return nil, err
+	}
+
+	// Захватываем сочетание и при включенных Caps Lock и Num Lock
+	modifiers := x11Modifiers(combo.Modifiers)
+	for _, extra := range []uint16{0, x11LockMask, x11Mod2Mask, x11LockMask | x11Mod2Mask} {
+		request := make([]byte, 16)
+		request[0] = x11GrabKey
+		request[1] = 1 // события приходят и окну, и нам
+		binary.LittleEndian.PutUint16(request[2:], 4)
+		binary.LittleEndian.PutUint32(request[4:], root)
+		binary.LittleEndian.PutUint16(request[8:], modifiers|extra)
+		request[10] = keycode
+		request[11] = 1 // асинхронно
+		request[12] = 1
+		if _, err := conn.Write(request); err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+	}
+
+	// Ошибки захвата приходят асинхронно: дожидаемся ответа на следующий запрос
+	request := make([]byte, 4)
+	request[0] = x11GetInputFocus
+	binary.LittleEndian.PutUint16(request[2:], 1)
+	if _, err := conn.Write(request); err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	if _, err := x11ReadReply(conn); err != nil {
+		return nil, err
+	}
+
+	l := &x11Listener{conn: conn, events: make(chan Event, 8)}
+	go l.read(keycode)
+	return l, nil
+}
+
+// Events возвращает канал нажатий
+func (l *x11Listener) Events() <-chan Event {
+	return l.events
+}
+
+// Close закрывает соединение; захват снимается вместе с ним
+func (l *x11Listener) Close() error {
+	return l.conn.Close()
+}
+
+// read читает события, пока соединение не закроется
+func (l *x11Listener) read(keycode byte) {
+	defer close(l.events)
+
+	pressed := false
+	var pending []byte
+	for {
+		event := pending
+		pending = nil
+		if event == nil {
+			l.conn.SetReadDeadline(time.Time{})
+			event = make([]byte, 32)
+			if _, err := io.ReadFull(l.conn, event); err != nil {
+				return
+			}
+		}
+
+		code := event[0] & 0x7f
+		if (code != x11KeyPress && code != x11KeyRelease) || event[1] != keycode {
+			continue
+		}
+		if code == x11KeyPress {
+			if !pressed {
+				pressed = true
+				l.events <- Event{Pressed: true}
+			}
+			continue
+		}
+
+		// Отпускание, за которым сразу следует нажатие с тем же временем, —
+		// автоповтор, а не настоящее отпускание
+		next := make([]byte, 32)
+		l.conn.SetReadDeadline(time.Now().Add(repeatWindow))
+		n, err := io.ReadFull(l.conn, next)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() && n > 0 {
+			// Событие пришло частями, дочитываем его
+			l.conn.SetReadDeadline(time.Time{})
+			_, err = io.ReadFull(l.conn, next[n:])
+		}
+		if err == nil && next[0]&0x7f == x11KeyPress && next[1] == keycode && string(next[4:8]) == string(event[4:8]) {
+			continue
+		}
+		if err == nil {
+			pending = next
+		} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return
+		}
+		if pressed {
+			pressed = false
+			l.events <- Event{Pressed: false}
+		}
+	}
+}
+
+// x11Setup проходит рукопожатие и возвращает корневое окно первого экрана
+// и диапазон кодов клавиш
+func x11Setup(conn net.Conn, authName string, authData []byte) (uint32, byte, byte, error) {
+	request := make([]byte, 12, 12+pad(len(authName))+pad(len(authData)))
+	request[0] = 'l' // little-endian
+	binary.LittleEndian.PutUint16(request[2:], 11)
+	binary.LittleEndian.PutUint16(request[6:], uint16(len(authName)))
+	binary.LittleEndian.PutUint16(request[8:], uint16(len(authData)))
+	request = append(request, padded([]byte(authName))...)
+	request = append(request, padded(authData)...)
+	if _, err := conn.Write(request); err != nil {
+		return 0, 0, 0, tracerr.Wrap(err)
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, 0, 0, tracerr.Wrap(err)
+	}
+	body := make([]byte, 4*int(binary.LittleEndian.Uint16(header[6:])))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, 0, 0, tracerr.Wrap(err)
+	}
+	if header[0] != 1 {
+		reason := string(body[:min(int(header[1]), len(body))])
+		return 0, 0, 0, tracerr.New(fmt.Sprintf("X-сервер отказал в подключении: %s", reason))
+	}
+	if len(body) < 32 {
+		return 0, 0, 0, tracerr.New("Некорректный ответ X-сервера")
+	}
+
+	vendorLength := int(binary.LittleEndian.Uint16(body[16:]))
+	formats := int(body[21])
+	minKeycode, maxKeycode := body[26], body[27]
+	screen := 32 + pad(vendorLength) + 8*formats
+	if len(body) < screen+4 {
+		return 0, 0, 0, tracerr.New("Некорректный ответ X-сервера")
+	}
+	return binary.LittleEndian.Uint32(body[screen:]), minKeycode, maxKeycode, nil
+}
+
+// x11Keycode находит код клавиши с символом keysym
+func x11Keycode(conn net.Conn, minKeycode, maxKeycode byte, keysym uint32) (byte, error) {
+	request := make([]byte, 8)
+	request[0] = x11GetKeyboardMapping
+	binary.LittleEndian.PutUint16(request[2:], 2)
+	request[4] = minKeycode
+	request[5] = maxKeycode - minKeycode + 1
+	if _, err := conn.Write(request); err != nil {
+		return 0, tracerr.Wrap(err)
+	}
+
+	reply, err := x11ReadReply(conn)
+	if err != nil {
+		return 0, err
+	}
+	perKeycode := int(reply[1])
+	keysyms := reply[32:]
+	for i := 0; perKeycode > 0 && (i+1)*perKeycode*4 <= len(keysyms); i++ {
+		// Первый символ — без Shift, его и сравниваем
+		if binary.LittleEndian.Uint32(keysyms[i*perKeycode*4:]) == keysym {
+			return minKeycode + byte(i), nil
+		}
+	}
+	return 0, tracerr.New("Клавиши нет в раскладке X-сервера")
+}
+
+// x11ReadReply читает ответ на запрос, пропуская события. Ошибка в ответ
+// на запрос возвращается как error.
+func x11ReadReply(conn net.Conn) ([]byte, error) {
+	for {
+		message := make([]byte, 32)
+		if _, err := io.ReadFull(conn, message); err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		switch message[0] {
+		case x11Error:
+			if message[1] == x11BadAccess {
+				return nil, tracerr.New("Сочетание клавиш уже занято другой программой")
+			}
+			return nil, tracerr.New(fmt.Sprintf("Ошибка X-сервера %d в запросе %d", message[1], message[10]))
+		case x11Reply:
+			extra := make([]byte, 4*int(binary.LittleEndian.Uint32(message[4:])))
+			if _, err := io.ReadFull(conn, extra); err != nil {
+				return nil, tracerr.Wrap(err)
+			}
+			return append(message, extra...), nil
+		}
+	}
+}
+
+// x11Modifiers переводит модификаторы в маску X11
+func x11Modifiers(modifiers Modifier) uint16 {
+	var mask uint16
+	for modifier, x11 := range map[Modifier]uint16{ModShift: x11ShiftMask, ModCtrl: x11ControlMask, ModAlt: x11Mod1Mask, ModSuper: x11Mod4Mask} {
+		if modifiers&modifier != 0 {
+			mask |= x11
+		}
+	}
+	return mask
+}
+
+// displayAddress разбирает DISPLAY вида "[хост]:номер[.экран]"
+func displayAddress(display string) (network, address, number string, err error) {
+	colon := strings.LastIndex(display, ":")
+	if colon < 0 {
+		return "", "", "", tracerr.New(fmt.Sprintf("Некорректный DISPLAY: %q", display))
+	}
+	host := display[:colon]
+	number, _, _ = strings.Cut(display[colon+1:], ".")
+	n, convErr := strconv.Atoi(number)
+	if convErr != nil {
+		return "", "", "", tracerr.New(fmt.Sprintf("Некорректный DISPLAY: %q", display))
+	}
+	if host == "" || host == "unix" {
+		return "unix", fmt.Sprintf("/tmp/.X11-unix/X%d", n), number, nil
+	}
+	return "tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)), number, nil
+}
+
+// xauthCookie читает из XAUTHORITY или ~/.Xauthority ключ MIT-MAGIC-COOKIE-1
+// для дисплея number. Без ключа подключение возможно, если сервер его не требует.
+func xauthCookie(number string) (string, []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".Xauthority")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil
+	}
+	return findCookie(data, number)
+}
+
+// findCookie ищет ключ в содержимом файла .Xauthority. Каждая запись —
+// семейство адреса и четыре строки с длиной: адрес, номер дисплея, имя
+// способа и данные.
+func findCookie(data []byte, number string) (string, []byte) {
+	for len(data) >= 2 {
+		data = data[2:]
+		var fields [4][]byte
+		for i := range fields {
+			if len(data) < 2 {
+				return "", nil
+			}
+			length := int(binary.BigEndian.Uint16(data))
+			if len(data) < 2+length {
+				return "", nil
+			}
+			fields[i] = data[2 : 2+length]
+			data = data[2+length:]
+		}
+		display, name := string(fields[1]), string(fields[2])
+		if name == "MIT-MAGIC-COOKIE-1" && (display == "" || display == number) {
+			return name, fields[3]
+		}
+	}
+	return "", nil
+}
+
+// pad округляет длину до кратной четырем
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
+
+// padded дополняет данные нулями до длины, кратной четырем
+func padded(data []byte) []byte {
+	return append(data[:len(data):len(data)], make([]byte, pad(len(data))-len(data))...)
+}
@@ -0,0 +1,238 @@
+// Package intent распознает намерения пользователя в командах на русском языке.
+// Фраза нормализуется, слова сводятся к основам с учетом синонимов, а затем
+// сравниваются с образцами фраз намерений. Из оставшихся слов извлекаются
+// типизированные слоты: числа, проценты, длительности, приложения и адреса.
+package intent
+
+// DefaultThreshold — минимальная уверенность, при которой совпадение
+// считается командой, а не вопросом для языковой модели
+const DefaultThreshold = 0.7
+
+// Slot описывает параметр намерения
+type Slot struct {
+	Name     string
+	Kind     SlotKind
+	Required bool
+}
+
+// Intent описывает намерение: образцы фраз и параметры
+type Intent struct {
+	Name    string
+	Phrases []string // например "увеличь громкость", "громче"
+	Slots   []Slot
+}
+
+// Match содержит результат распознавания фразы
+type Match struct {
+	Intent     string
+	Confidence float64           // от 0 до 1
+	Slots      map[string]string // значения найденных слотов
+}
+
+// Синонимы приводятся к одному слову до сравнения основ
+var synonyms = map[string]string{
+	"запусти":   "открой",
+	"звук":      "громкость",
+	"погромче":  "громче",
+	"потише":    "тише",
+	"прибавь":   "увеличь",
+	"повысь":    "увеличь",
+	"подними":   "увеличь",
+	"убавь":     "уменьши",
+	"понизь":    "уменьши",
+	"снизь":     "уменьши",
+	"поставь":   "установи",
+	"выставь":   "установи",
+	"скрин":     "скриншот",
+	"страница":  "сайт",
+	"страничка": "сайт",
+	"убей":      "заверши",
+	"беседа":    "разговор",
+}
+
+// Слова, которые не влияют на смысл команды
+var stopWords = map[string]bool{
+	"пожалуйста": true, "сделай": true, "сделайте": true, "можешь": true, "можете": true,
+	"давай": true, "мне": true, "ты": true, "ка": true, "ну": true, "а": true, "и": true,
+	"бы": true, "эй": true, "быстро": true, "немного": true, "немножко": true, "чуть": true,
+	"чуть-чуть": true, "на": true, "в": true, "до": true, "по": true,
+}
+
+// synonymStems отображает основы синонимов на основы канонических слов
+var synonymStems = func() map[string]string {
+	stems := make(map[string]string, len(synonyms))
+	for word, target := range synonyms {
+		stems[Stem(word)] = Stem(target)
+	}
+	return stems
+}()
+
+// canonical заменяет основу синонима основой канонического слова
+func canonical(stem string) string {
+	if target, ok := synonymStems[stem]; ok {
+		return target
+	}
+	return stem
+}
+
+// phrase представляет образец фразы в виде основ
+type phrase struct {
+	intent *Intent
+	stems  []string
+}
+
+// Parser сопоставляет фразы пользователя с намерениями
+type Parser struct {
+	intents []Intent
+	phrases []phrase
+}
+
+// NewParser создает парсер для указанных намерений
+func NewParser(intents []Intent) *Parser {
+	p := &Parser{intents: append([]Intent(nil), intents...)}
+	for i := range p.intents {
+		in := &p.intents[i]
+		for _, text := range in.Phrases {
+			var stems []string
+			for _, t := range tokenize(text) {
+				stems = append(stems, t.stem)
+			}
+			if len(stems) > 0 {
+				p.phrases = append(p.phrases, phrase{intent: in, stems: stems})
+			}
+		}
+	}
+	return p
+}
+
+// candidate содержит совпадение вместе с признаками для выбора лучшего
+type candidate struct {
+	match    Match
+	keywords int // число слов образца
+	typed    int // число найденных типизированных слотов
+}
+
+// better проверяет, предпочтительнее ли кандидат c кандидата other
+func (c candidate) better(other candidate) bool {
+	const epsilon = 1e-9
+	if d := c.match.Confidence - other.match.Confidence; d > epsilon || d < -epsilon {
+		return d > 0
+	}
+	if c.keywords != other.keywords {
+		return c.keywords > other.keywords
+	}
+	return c.typed > other.typed
+}
+
+// Parse возвращает наиболее вероятное намерение для фразы.
+// Второе значение ложно, если ни одно слово не совпало ни с одним образцом.
+func (p *Parser) Parse(text string) (Match, bool) {
+	tokens := tokenize(text)
+
+	var best candidate
+	found := false
+	for _, ph := range p.phrases {
+		c, ok := score(ph, tokens)
+		if ok && (!found || c.better(best)) {
+			best, found = c, true
+		}
+	}
+	return best.match, found
+}
+
+// score сопоставляет фразу с образцом.
+//
+// Уверенность складывается из доли найденных слов образца и доли слов фразы,
+// которые удалось объяснить ключевыми словами и слотами. Слова текстовых
+// слотов учитываются с половинным весом, чтобы конкретный образец
+// ("открой сайт") побеждал общий ("открой" + название приложения).
+// Отсутствие обязательного слота и ключевое слово не в начале фразы
+// снижают уверенность.
+func score(ph phrase, tokens []token) (candidate, bool) {
+	used := make([]bool, len(tokens))
+	matched, first, last := 0, len(tokens), -1
+	explained := 0.0
+	for _, stem := range ph.stems {
+		for i, t := range tokens {
+			if !used[i] && t.stem == stem {
+				used[i] = true
+				matched++
+				if !stopWords[t.raw] {
+					explained++
+				}
+				if i < first {
+					first = i
+				}
+				if i > last {
+					last = i
+				}
+				break
+			}
+		}
+	}
+	if matched == 0 {
+		return candidate{}, false
+	}
+
+	c := candidate{
+		match:    Match{Intent: ph.intent.Name, Slots: make(map[string]string)},
+		keywords: len(ph.stems),
+	}
+
+	penalty := 1.0
+
+	// Сначала типизированные слоты, затем текстовые из оставшихся слов
+	for _, textual := range []bool{false, true} {
+		for _, slot := range ph.intent.Slots {
+			isText := slot.Kind == SlotText || slot.Kind == SlotApp || slot.Kind == SlotPlace
+			if isText != textual {
+				continue
+			}
+			value, positions, ok := extractSlot(slot.Kind, tokens, used, last+1)
+			if !ok {
+				if slot.Required {
+					penalty *= 0.9
+				}
+				continue
+			}
+			c.match.Slots[slot.Name] = value
+			for _, i := range positions {
+				used[i] = true
+				if !stopWords[tokens[i].raw] {
+					if textual {
+						explained += 0.5
+					} else {
+						explained++
+					}
+				}
+			}
+			if !textual {
+				c.typed++
+			}
+		}
+	}
+
+	total := 0.0
+	for _, t := range tokens {
+		if !stopWords[t.raw] {
+			total++
+		}
+	}
+
+	// Команды обычно начинаются с ключевого слова
+	for i := 0; i < first; i++ {
+		if !stopWords[tokens[i].raw] {
+			penalty *= 0.8
+			break
+		}
+	}
+
+	coverage := 1.0
+	if total > 0 {
+		coverage = explained / total
+	}
+	share := float64(matched) / float64(len(ph.stems))
+	c.match.Confidence = share * (0.3 + 0.7*coverage) * penalty
+
+	return c, true
+}
@@ -0,0 +1,150 @@
+package intent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testIntents повторяет основные команды ассистента
+var testIntents = []Intent{
+	{Name: "open_application", Phrases: []string{"открой"}, Slots: []Slot{{Name: "name", Kind: SlotApp, Required: true}}},
+	{Name: "open_url", Phrases: []string{"открой сайт", "открой"}, Slots: []Slot{{Name: "url", Kind: SlotURL, Required: true}}},
+	{Name: "increase_volume", Phrases: []string{"увеличь громкость", "громче"}, Slots: []Slot{{Name: "amount", Kind: SlotPercent}}},
+	{Name: "decrease_volume", Phrases: []string{"уменьши громкость", "тише"}, Slots: []Slot{{Name: "amount", Kind: SlotPercent}}},
+	{Name: "set_volume", Phrases: []string{"установи громкость", "громкость"}, Slots: []Slot{{Name: "level", Kind: SlotPercent, Required: true}}},
+	{Name: "mute_volume", Phrases: []string{"выключи звук", "без звука"}},
+	{Name: "take_screenshot", Phrases: []string{"скриншот", "снимок экрана"}},
+	{Name: "kill_process", Phrases: []string{"завершить процесс"}, Slots: []Slot{{Name: "name", Kind: SlotText, Required: true}}},
+	{Name: "set_timer", Phrases: []string{"поставь таймер", "таймер"}, Slots: []Slot{{Name: "duration", Kind: SlotDuration, Required: true}}},
+	{Name: "exit", Phrases: []string{"выход", "закрыть", "завершить работу"}},
+}
+
+func TestParse(t *testing.T) {
+	parser := NewParser(testIntents)
+
+	tests := []struct {
+		text   string
+		intent string
+		slots  map[string]string
+	}{
+		// Ключевое слово не в начале фразы
+		{"сделай скриншот", "take_screenshot", nil},
+		{"Сделай, пожалуйста, скриншот!", "take_screenshot", nil},
+		{"снимок экрана", "take_screenshot", nil},
+
+		// Числа, проценты и синонимы
+		{"установи громкость 50", "set_volume", map[string]string{"level": "50"}},
+		{"поставь громкость на 30%", "set_volume", map[string]string{"level": "30"}},
+		{"громкость двадцать пять процентов", "set_volume", map[string]string{"level": "25"}},
+		{"прибавь звук", "increase_volume", nil},
+		{"увеличь громкость на 20 процентов", "increase_volume", map[string]string{"amount": "20"}},
+		{"сделай потише", "decrease_volume", nil},
+		{"выключи звук", "mute_volume", nil},
+
+		// Приложения и сайты: более конкретный образец побеждает
+		{"открой браузер", "open_application", map[string]string{"name": "браузер"}},
+		{"запусти пожалуйста google chrome", "open_application", map[string]string{"name": "google chrome"}},
+		{"открой сайт google.com", "open_url", map[string]string{"url": "google.com"}},
+		{"открой страницу https://ya.ru/maps", "open_url", map[string]string{"url": "https://ya.ru/maps"}},
+		{"открой google точка com", "open_url", map[string]string{"url": "google.com"}},
+
+		// Текст и длительности
+		{"завершить процесс chrome", "kill_process", map[string]string{"name": "chrome"}},
+		{"убей процесс notepad", "kill_process", map[string]string{"name": "notepad"}},
+		{"поставь таймер на 5 минут", "set_timer", map[string]string{"duration": "5m0s"}},
+		{"таймер на полчаса", "set_timer", map[string]string{"duration": "30m0s"}},
+		{"таймер на две минуты", "set_timer", map[string]string{"duration": "2m0s"}},
+
+		{"выход", "exit", nil},
+	}
+
+	for _, tt := range tests {
+		match, ok := parser.Parse(tt.text)
+		if !assert.True(t, ok, tt.text) {
+			continue
+		}
+		assert.Equal(t, tt.intent, match.Intent, tt.text)
+		assert.GreaterOrEqual(t, match.Confidence, DefaultThreshold, tt.text)
+		for name, value := range tt.slots {
+			assert.Equal(t, value, match.Slots[name], "%s: слот %s", tt.text, name)
+		}
+	}
+}
+
+func TestParsePlace(t *testing.T) {
+	parser := NewParser([]Intent{
+		{Name: "weather", Phrases: []string{"какая погода", "погода"}, Slots: []Slot{{Name: "location", Kind: SlotPlace}}},
+	})
+
+	// Название места остается, как его произнесли
+	for text, location := range map[string]string{
+		"какая погода в Москве?":         "Москве",
+		"Погода в Нижнем Новгороде":      "Нижнем Новгороде",
+		"погода в Орле, пожалуйста":      "Орле",
+		"погода в Щёлково":               "Щёлково",
+		"какая погода в Ростове-на-Дону": "Ростове-на-Дону",
+	} {
+		match, ok := parser.Parse(text)
+		if assert.True(t, ok, text) {
+			assert.Equal(t, location, match.Slots["location"], text)
+		}
+	}
+
+	match, _ := parser.Parse("какая погода")
+	assert.Empty(t, match.Slots["location"])
+}
+
+func TestParseLowConfidence(t *testing.T) {
+	parser := NewParser(testIntents)
+
+	// Вопросы, в которых встречаются ключевые слова, уходят языковой модели
+	for _, text := range []string{
+		"расскажи как открыть файл в питоне",
+		"закрой браузер",
+		"почему громкость на ноутбуке такая низкая",
+		"сделай скриншот экрана и отправь его маме по почте",
+	} {
+		match, _ := parser.Parse(text)
+		assert.Less(t, match.Confidence, DefaultThreshold, "%s: %s", text, match.Intent)
+	}
+
+	// Фраза без единого ключевого слова
+	_, ok := parser.Parse("какая погода завтра")
+	assert.False(t, ok)
+
+	// Без обязательного слота команда распознается, а значение
+	// запрашивает обработчик
+	match, ok := parser.Parse("открой")
+	assert.True(t, ok)
+	assert.Equal(t, "open_application", match.Intent)
+	assert.GreaterOrEqual(t, match.Confidence, DefaultThreshold)
+	assert.Empty(t, match.Slots)
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "еще раз открой google.com", Normalize("  Ещё раз, открой «google точка com»!  "))
+	assert.Equal(t, "громкость 50 %", Normalize("Громкость 50%"))
+	assert.Equal(t, "", Normalize("?!"))
+	assert.Equal(t, "открой google.com", Normalize("Открой Google Точка com"))
+}
+
+func TestReadNumber(t *testing.T) {
+	tests := []struct {
+		text  string
+		value float64
+		words int
+	}{
+		{"125", 125, 1},
+		{"2,5", 2.5, 1},
+		{"сто двадцать пять", 125, 3},
+		{"двадцать", 20, 1},
+		{"пять шесть", 5, 1},
+		{"сорок два минуты", 42, 2},
+	}
+	for _, tt := range tests {
+		value, n := readNumber(tokenize(tt.text), 0)
+		assert.Equal(t, tt.value, value, tt.text)
+		assert.Equal(t, tt.words, n, tt.text)
+	}
+}
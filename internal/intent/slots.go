@@ -0,0 +1,246 @@
+package intent
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SlotKind определяет тип значения слота
+type SlotKind string
+
+// Поддерживаемые типы слотов
+const (
+	SlotText     SlotKind = "text"     // произвольный текст после ключевых слов
+	SlotApp      SlotKind = "app"      // название приложения
+	SlotPlace    SlotKind = "place"    // название места, как его произнесли: "Москве", "Нижнем Новгороде"
+	SlotNumber   SlotKind = "number"   // число цифрами или словами: "50", "двадцать пять"
+	SlotPercent  SlotKind = "percent"  // проценты: "50%", "тридцать процентов" или просто число
+	SlotDuration SlotKind = "duration" // длительность: "5 минут", "полчаса"
+	SlotURL      SlotKind = "url"      // адрес сайта: "google.com", "https://ya.ru/maps"
+)
+
+// token представляет одно слово нормализованной фразы
+type token struct {
+	raw    string  // слово в нижнем регистре без знаков препинания
+	text   string  // слово, как во фразе, без знаков препинания
+	stem   string  // основа слова с учетом синонимов
+	number float64 // значение, если слово является числом
+	isNum  bool
+	isURL  bool
+}
+
+var (
+	urlPattern    = regexp.MustCompile(`^(https?://)?[\p{L}0-9-]+(\.[\p{L}0-9-]+)*\.\p{L}{2,}(:\d+)?(/\S*)?$`)
+	numberPattern = regexp.MustCompile(`^\d+([.,]\d+)?$`)
+	spokenDot     = regexp.MustCompile(`(\S) (?i:точка) (\S)`)
+)
+
+// Числительные, которые распознаются в словесной форме
+var numberWords = map[string]float64{
+	"ноль": 0, "один": 1, "одна": 1, "одну": 1, "два": 2, "две": 2, "три": 3, "четыре": 4,
+	"пять": 5, "шесть": 6, "семь": 7, "восемь": 8, "девять": 9, "десять": 10,
+	"одиннадцать": 11, "двенадцать": 12, "тринадцать": 13, "четырнадцать": 14, "пятнадцать": 15,
+	"шестнадцать": 16, "семнадцать": 17, "восемнадцать": 18, "девятнадцать": 19,
+	"двадцать": 20, "тридцать": 30, "сорок": 40, "пятьдесят": 50, "шестьдесят": 60,
+	"семьдесят": 70, "восемьдесят": 80, "девяносто": 90, "сто": 100,
+	"двести": 200, "триста": 300, "четыреста": 400, "пятьсот": 500,
+}
+
+// Единицы измерения длительности по основам слов
+var durationUnits = map[string]time.Duration{
+	"секунд": time.Second,
+	"сек":    time.Second,
+	"минут":  time.Minute,
+	"мин":    time.Minute,
+	"час":    time.Hour,
+}
+
+// Слова, которые обозначают длительность без числа
+var durationWords = map[string]time.Duration{
+	"полчаса":   30 * time.Minute,
+	"полчасика": 30 * time.Minute,
+	"полминуты": 30 * time.Second,
+}
+
+// Normalize приводит фразу к нижнему регистру, заменяет "ё" на "е",
+// собирает продиктованные адреса ("google точка com") и убирает знаки препинания.
+func Normalize(text string) string {
+	var words []string
+	for _, t := range tokenize(text) {
+		words = append(words, t.raw)
+	}
+	return strings.Join(words, " ")
+}
+
+// tokenize разбивает фразу на слова и распознает числа и адреса
+func tokenize(text string) []token {
+	for spokenDot.MatchString(text) {
+		text = spokenDot.ReplaceAllString(text, "$1.$2")
+	}
+
+	var tokens []token
+	for _, original := range strings.Fields(text) {
+		original = strings.TrimFunc(original, func(r rune) bool {
+			return unicode.IsPunct(r) && r != '%' || unicode.IsSymbol(r)
+		})
+		field := strings.ReplaceAll(strings.ToLower(original), "ё", "е")
+
+		percent := strings.HasSuffix(field, "%")
+		field = strings.TrimSuffix(field, "%")
+
+		switch {
+		case field == "":
+		case numberPattern.MatchString(field):
+			value, _ := strconv.ParseFloat(strings.Replace(field, ",", ".", 1), 64)
+			tokens = append(tokens, token{raw: field, text: field, stem: field, number: value, isNum: true})
+		case urlPattern.MatchString(field):
+			tokens = append(tokens, token{raw: field, text: field, stem: field, isURL: true})
+		default:
+			word := strings.Map(wordRune, field)
+			if word == "" {
+				break
+			}
+			t := token{raw: word, text: strings.Map(wordRune, original), stem: canonical(Stem(word))}
+			if value, ok := numberWords[word]; ok {
+				t.number, t.isNum = value, true
+			}
+			tokens = append(tokens, t)
+		}
+
+		if percent {
+			tokens = append(tokens, token{raw: "%", text: "%", stem: "%"})
+		}
+	}
+	return tokens
+}
+
+// wordRune оставляет в слове буквы, цифры и дефисы
+func wordRune(r rune) rune {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+		return r
+	}
+	return -1
+}
+
+// readNumber читает число, начинающееся с позиции i: "125" или
+// "сто двадцать пять". Возвращает значение и число прочитанных слов.
+func readNumber(tokens []token, i int) (float64, int) {
+	if i >= len(tokens) || !tokens[i].isNum {
+		return 0, 0
+	}
+	if numberPattern.MatchString(tokens[i].raw) {
+		return tokens[i].number, 1
+	}
+
+	// Составные числительные идут от старших разрядов к младшим
+	value, last, n := 0.0, 0.0, 0
+	for j := i; j < len(tokens) && tokens[j].isNum && !numberPattern.MatchString(tokens[j].raw); j++ {
+		if n > 0 && (tokens[j].number >= last || last < 20) {
+			break
+		}
+		value += tokens[j].number
+		last = tokens[j].number
+		n++
+	}
+	return value, n
+}
+
+// formatNumber записывает число без лишних нулей
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// extractSlot ищет значение слота среди свободных слов. Для текстовых слотов
+// берутся слова после последнего ключевого слова. Возвращает значение,
+// позиции использованных слов и признак успеха.
+func extractSlot(kind SlotKind, tokens []token, used []bool, after int) (string, []int, bool) {
+	switch kind {
+	case SlotURL:
+		for i, t := range tokens {
+			if !used[i] && t.isURL {
+				return t.raw, []int{i}, true
+			}
+		}
+
+	case SlotNumber, SlotPercent:
+		for i := range tokens {
+			if used[i] {
+				continue
+			}
+			value, n := readNumber(tokens, i)
+			if n == 0 {
+				continue
+			}
+			positions := span(i, n)
+			if kind == SlotPercent && i+n < len(tokens) && !used[i+n] &&
+				(tokens[i+n].raw == "%" || tokens[i+n].stem == "процент") {
+				positions = append(positions, i+n)
+			}
+			return formatNumber(value), positions, true
+		}
+
+	case SlotDuration:
+		for i, t := range tokens {
+			if used[i] {
+				continue
+			}
+			if d, ok := durationWords[t.raw]; ok {
+				return d.String(), []int{i}, true
+			}
+			if unit, ok := durationUnits[t.stem]; ok {
+				// "минуту" без числа означает одну минуту
+				return unit.String(), []int{i}, true
+			}
+			value, n := readNumber(tokens, i)
+			if n == 0 || i+n >= len(tokens) || used[i+n] {
+				continue
+			}
+			if unit, ok := durationUnits[tokens[i+n].stem]; ok {
+				d := time.Duration(value * float64(unit))
+				return d.String(), span(i, n+1), true
+			}
+		}
+
+	case SlotText, SlotApp, SlotPlace:
+		start := after
+		for start < len(tokens) && (used[start] || stopWords[tokens[start].raw]) {
+			start++
+		}
+		end := len(tokens)
+		for end > start && (used[end-1] || stopWords[tokens[end-1].raw]) {
+			end--
+		}
+		var words []string
+		var positions []int
+		for i := start; i < end; i++ {
+			if used[i] {
+				continue
+			}
+			// Название места передается, как его произнесли: сервисам нужен
+			// исходный регистр, а "е" вместо "ё" меняет название
+			if kind == SlotPlace {
+				words = append(words, tokens[i].text)
+			} else {
+				words = append(words, tokens[i].raw)
+			}
+			positions = append(positions, i)
+		}
+		if len(words) > 0 {
+			return strings.Join(words, " "), positions, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// span возвращает позиции с start по start+n-1
+func span(start, n int) []int {
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = start + i
+	}
+	return positions
+}
@@ -0,0 +1,151 @@
+package intent
+
+import "strings"
+
+// Окончания для стеммера Портера (Snowball) для русского языка.
+// Группы "A" допустимы только после "а" или "я".
+var (
+	perfectiveGerundA = []string{"вшись", "вши", "в"}
+	perfectiveGerundB = []string{"ившись", "ывшись", "ивши", "ывши", "ив", "ыв"}
+	adjectiveEndings  = []string{
+		"ими", "ыми", "его", "ого", "ему", "ому",
+		"ее", "ие", "ые", "ое", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом",
+		"их", "ых", "ую", "юю", "ая", "яя", "ою", "ею",
+	}
+	participleA      = []string{"ем", "нн", "вш", "ющ", "щ"}
+	participleB      = []string{"ивш", "ывш", "ующ"}
+	reflexiveEndings = []string{"ся", "сь"}
+	verbA            = []string{"ете", "йте", "ешь", "нно", "ла", "на", "ли", "ем", "ло", "но", "ет", "ют", "ны", "ть", "й", "л", "н"}
+	verbB            = []string{
+		"ейте", "уйте", "ила", "ыла", "ена", "ите", "или", "ыли", "ило", "ыло", "ено",
+		"ует", "уют", "ены", "ить", "ыть", "ишь", "ей", "уй", "ил", "ыл", "им", "ым",
+		"ен", "ят", "ит", "ыт", "ую", "ю",
+	}
+	nounEndings = []string{
+		"иями", "ями", "ами", "ией", "иям", "ием", "иях",
+		"ев", "ов", "ие", "ье", "еи", "ии", "ей", "ой", "ий", "ям", "ем", "ам", "ом", "ах", "ях", "ию", "ью", "ия", "ья",
+		"а", "е", "и", "й", "о", "у", "ы", "ь", "ю", "я",
+	}
+	superlativeEndings  = []string{"ейше", "ейш"}
+	derivationalEndings = []string{"ость", "ост"}
+)
+
+// isVowel проверяет, является ли буква гласной
+func isVowel(r rune) bool {
+	return strings.ContainsRune("аеиоуыэюя", r)
+}
+
+// Stem возвращает основу русского слова по алгоритму Snowball.
+// Слова без кириллицы возвращаются без изменений.
+func Stem(word string) string {
+	w := []rune(strings.ReplaceAll(strings.ToLower(word), "ё", "е"))
+
+	// RV — часть слова после первой гласной, R2 — после второго сочетания
+	// "гласная + согласная"
+	rv := len(w)
+	for i, r := range w {
+		if isVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	r2 := region(w, region(w, 0))
+
+	// Шаг 1: деепричастие, иначе возвратное окончание и затем
+	// прилагательное, глагол или существительное
+	if n, ok := cutPreceded(w, rv, perfectiveGerundA); ok {
+		w = w[:n]
+	} else if n, ok := cut(w, rv, perfectiveGerundB); ok {
+		w = w[:n]
+	} else {
+		if n, ok := cut(w, rv, reflexiveEndings); ok {
+			w = w[:n]
+		}
+		if n, ok := cut(w, rv, adjectiveEndings); ok {
+			w = w[:n]
+			if n, ok := cutPreceded(w, rv, participleA); ok {
+				w = w[:n]
+			} else if n, ok := cut(w, rv, participleB); ok {
+				w = w[:n]
+			}
+		} else if n, ok := cutPreceded(w, rv, verbA); ok {
+			w = w[:n]
+		} else if n, ok := cut(w, rv, verbB); ok {
+			w = w[:n]
+		} else if n, ok := cut(w, rv, nounEndings); ok {
+			w = w[:n]
+		}
+	}
+
+	// Шаг 2: конечная "и"
+	if n, ok := cut(w, rv, []string{"и"}); ok {
+		w = w[:n]
+	}
+
+	// Шаг 3: словообразовательное окончание целиком в R2
+	if n, ok := cut(w, r2, derivationalEndings); ok {
+		w = w[:n]
+	}
+
+	// Шаг 4: "нн", превосходная степень или мягкий знак
+	if n, ok := cut(w, rv, []string{"нн"}); ok {
+		w = w[:n+1]
+	} else if n, ok := cut(w, rv, superlativeEndings); ok {
+		w = w[:n]
+		if n, ok := cut(w, rv, []string{"нн"}); ok {
+			w = w[:n+1]
+		}
+	} else if n, ok := cut(w, rv, []string{"ь"}); ok {
+		w = w[:n]
+	}
+
+	return string(w)
+}
+
+// region возвращает начало области после первого сочетания
+// "гласная + согласная", начиная с позиции start
+func region(w []rune, start int) int {
+	for i := start + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// cut ищет самое длинное окончание из списка, целиком лежащее в области,
+// начинающейся с limit, и возвращает длину слова без него
+func cut(w []rune, limit int, endings []string) (int, bool) {
+	best := -1
+	for _, ending := range endings {
+		e := []rune(ending)
+		n := len(w) - len(e)
+		if n < limit || n < 0 || string(w[n:]) != ending {
+			continue
+		}
+		if best == -1 || n < best {
+			best = n
+		}
+	}
+	return best, best != -1
+}
+
+// cutPreceded работает как cut, но окончание должно следовать за "а" или "я",
+// которые остаются частью основы
+func cutPreceded(w []rune, limit int, endings []string) (int, bool) {
+	best := -1
+	for _, ending := range endings {
+		e := []rune(ending)
+		n := len(w) - len(e)
+		if n-1 < limit || n < 1 || string(w[n:]) != ending {
+			continue
+		}
+		if w[n-1] != 'а' && w[n-1] != 'я' {
+			continue
+		}
+		if best == -1 || n < best {
+			best = n
+		}
+	}
+	return best, best != -1
+}
@@ -0,0 +1,37 @@
+package intent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStem(t *testing.T) {
+	// Разные формы одного слова сводятся к одной основе
+	groups := [][]string{
+		{"открой", "открыть"},
+		{"запусти", "запустить"},
+		{"громкость", "громкости"},
+		{"процесс", "процессов", "процессы"},
+		{"заверши", "завершить"},
+		{"выключи", "выключись"},
+		{"минут", "минуты", "минуту"},
+		{"процент", "процентов", "процента"},
+		{"история", "историю"},
+	}
+	for _, group := range groups {
+		for _, word := range group[1:] {
+			assert.Equal(t, Stem(group[0]), Stem(word), "%s и %s", group[0], word)
+		}
+	}
+
+	assert.Equal(t, "громкост", Stem("громкость"))
+	assert.Equal(t, "скриншот", Stem("скриншоты"))
+
+	// Разные слова не совпадают
+	assert.NotEqual(t, Stem("включи"), Stem("выключи"))
+
+	// Латиница и ё
+	assert.Equal(t, "chrome", Stem("Chrome"))
+	assert.Equal(t, Stem("еще"), Stem("ещё"))
+}
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/config"
 )
 
 // MobileManager управляет подключением и взаимодействием с мобильными устройствами
@@ -24,15 +26,8 @@ type MobileManager struct {
 	mutex        sync.Mutex
 }
 
-// MobileConfig содержит настройки для мобильного подключения
-type MobileConfig struct {
-	Enabled       bool   `json:"enabled"`       // Включено ли мобильное подключение
-	USBEnabled    bool   `json:"usb_enabled"`    // Включено ли USB-подключение
-	ADBPath       string `json:"adb_path"`       // Путь к ADB (Android Debug Bridge)
-	WebUIEnabled  bool   `json:"webui_enabled"`  // Включен ли веб-интерфейс для мобильных устройств
-	WebUIPort     int    `json:"webui_port"`     // Порт для веб-интерфейса мобильных устройств
-	AutoConnect   bool   `json:"auto_connect"`   // Автоматически подключаться к устройству при запуске
-}
+// MobileConfig содержит настройки для мобильного подключения, см. config.MobileConfig
+type MobileConfig = config.MobileConfig
 
 // NewMobileManager создает новый экземпляр MobileManager
 func NewMobileManager(config MobileConfig) *MobileManager {
@@ -84,6 +79,19 @@ func (mm *MobileManager) Stop() {
 	mm.isRunning = false
 }
 
+// Reconfigure применяет новые настройки: останавливает менеджер и
+// запускает его заново
+func (mm *MobileManager) Reconfigure(config MobileConfig) error {
+	mm.Stop()
+
+	mm.mutex.Lock()
+	mm.config = config
+	mm.adbPath = config.ADBPath
+	mm.mutex.Unlock()
+
+	return mm.Start()
+}
+
 // initADB инициализирует ADB и проверяет его доступность
 func (mm *MobileManager) initADB() error {
 	// Если путь к ADB не указан, пытаемся найти его
@@ -0,0 +1,356 @@
+// Package protocol описывает сообщения WebSocket между веб-интерфейсом
+// и ассистентом.
+//
+// Каждое сообщение — JSON-объект с версией протокола, типом, необязательным
+// идентификатором и полезной нагрузкой:
+//
+//	{"v": 1, "type": "command", "id": "7", "payload": {"text": "который час"}}
+//
+// Ответ на запрос повторяет его идентификатор, поэтому клиент может
+// сопоставить ответы с запросами. Ошибки приходят сообщением типа "error"
+// с кодом и текстом. Первым сообщением клиент отправляет "hello", а сервер
+// отвечает "welcome" со списком доступных типов запросов.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version — текущая версия протокола
+const Version = 1
+
+// Типы запросов клиента
+const (
+	TypeHello            = "hello"
+	TypeCommand          = "command" // команда ассистенту из веб-интерфейса
+	TypeChat             = "chat"    // сообщение ассистенту из мобильного интерфейса
+	TypeGetHistory       = "get_history"
+	TypeNewConversation  = "new_conversation"
+	TypeGetConversations = "get_conversations"
+	TypePairingCode      = "pairing_code"
+	TypeGetConfig        = "get_config"
+	TypeSetConfig        = "set_config" // изменить и сохранить настройки
+	TypeSystemInfo       = "system_info"
+	TypeExecute          = "execute"
+	TypeScreenshot       = "screenshot"
+	TypeMobileCommand    = "mobile_command"
+	TypeMobileScreenshot = "mobile_screenshot"
+	TypeCancel           = "cancel" // прервать выполняемую команду
+	TypeGetAudioDevices  = "get_audio_devices"
+	TypeSetAudioDevice   = "set_audio_device"   // выбрать микрофон или динамик
+	TypeAudioStart       = "audio_start"        // начало записи команды в браузере
+	TypeAudioChunk       = "audio_chunk"        // часть записи
+	TypeAudioEnd         = "audio_end"          // конец записи: ее нужно распознать и выполнить
+	TypeVoiceStreamStart = "voice_stream_start" // начать поток звука в двоичных кадрах
+	TypeVoiceStreamStop  = "voice_stream_stop"
+	TypeExportHistory    = "export_history" // выгрузить историю в файл
+)
+
+// Типы сообщений сервера. Ответы на pairing_code, system_info и screenshot
+// имеют тот же тип, что и запрос.
+const (
+	TypeWelcome       = "welcome"
+	TypeResponse      = "response"
+	TypeResponseDelta = "response_delta" // часть ответа для клиентов с возможностью stream
+	TypeResponseDone  = "response_done"  // конец потокового ответа
+	TypeHistory       = "history"
+	TypeConversation  = "conversation"
+	TypeConversations = "conversations"
+	TypeConfig        = "config"
+	TypeCommandResult = "command_result"
+	TypeShowSettings  = "show_settings"
+	TypeAudioDevices  = "audio_devices"  // ответ на get_audio_devices и set_audio_device
+	TypeVoiceState    = "voice_state"    // голосовой модуль начал или перестал слушать команду
+	TypeTranscript    = "transcript"     // распознанный текст записи из браузера
+	TypeVoiceStream   = "voice_stream"   // ответ на voice_stream_start и voice_stream_stop
+	TypeHistoryExport = "history_export" // ответ на export_history
+	TypeError         = "error"
+)
+
+// RequestTypes содержит все типы запросов клиента
+var RequestTypes = []string{
+	TypeHello, TypeCommand, TypeChat, TypeGetHistory, TypeNewConversation,
+	TypeGetConversations, TypePairingCode, TypeGetConfig, TypeSystemInfo,
+	TypeExecute, TypeScreenshot, TypeMobileCommand, TypeMobileScreenshot,
+	TypeCancel, TypeGetAudioDevices, TypeSetAudioDevice,
+	TypeAudioStart, TypeAudioChunk, TypeAudioEnd, TypeVoiceStreamStart,
+	TypeVoiceStreamStop, TypeExportHistory, TypeSetConfig,
+}
+
+// Возможности, о которых клиент и сервер сообщают в hello и welcome
+const (
+	CapabilityStream = "stream" // ответ ассистента приходит частями response_delta и завершается response_done
+	CapabilityCancel = "cancel" // выполняемую команду можно прервать запросом cancel
+)
+
+// Коды ошибок
+const (
+	CodeBadRequest         = "bad_request"         // сообщение или его нагрузка не разобраны
+	CodeUnsupportedVersion = "unsupported_version" // клиент говорит на другой версии протокола
+	CodeHandshakeRequired  = "handshake_required"  // запрос пришел раньше hello
+	CodeUnknownType        = "unknown_type"        // сервер не знает такого типа сообщения
+	CodeForbidden          = "forbidden"           // у устройства нет нужного права
+	CodeUnavailable        = "unavailable"         // возможность сейчас недоступна, например нет телефона
+	CodeInternal           = "internal"            // ошибка при выполнении запроса
+)
+
+// Message — сообщение протокола в любом направлении
+type Message struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Error — ошибка протокола с кодом. Ее же содержит нагрузка сообщения
+// типа "error".
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error возвращает текст ошибки
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Errorf создает ошибку протокола с кодом
+func Errorf(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Parse разбирает сообщение клиента. Сообщение без версии считается
+// сообщением текущей версии.
+func Parse(data []byte) (Message, *Error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return Message{}, Errorf(CodeBadRequest, "Некорректное сообщение: %v", err)
+	}
+	if msg.Type == "" {
+		return msg, Errorf(CodeBadRequest, "Не указан тип сообщения")
+	}
+	if msg.Version == 0 {
+		msg.Version = Version
+	}
+	if msg.Version != Version {
+		return msg, Errorf(CodeUnsupportedVersion, "Версия протокола %d не поддерживается, сервер использует версию %d", msg.Version, Version)
+	}
+	return msg, nil
+}
+
+// Decode разбирает нагрузку сообщения в v. Пустая нагрузка оставляет v
+// без изменений.
+func (m Message) Decode(v interface{}) *Error {
+	if len(m.Payload) == 0 || string(m.Payload) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(m.Payload, v); err != nil {
+		return Errorf(CodeBadRequest, "Некорректные данные сообщения %s: %v", m.Type, err)
+	}
+	return nil
+}
+
+// New создает сообщение с нагрузкой. Если нагрузку не удалось
+// сериализовать, вместо него возвращается сообщение об ошибке.
+func New(msgType, id string, payload interface{}) Message {
+	msg := Message{Version: Version, Type: msgType, ID: id}
+	if payload == nil {
+		return msg
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return NewError(id, Errorf(CodeInternal, "Не удалось сформировать ответ: %v", err))
+	}
+	msg.Payload = data
+	return msg
+}
+
+// NewError создает сообщение об ошибке в ответ на запрос id
+func NewError(id string, err *Error) Message {
+	data, _ := json.Marshal(err)
+	return Message{Version: Version, Type: TypeError, ID: id, Payload: data}
+}
+
+// HelloPayload — первое сообщение клиента
+type HelloPayload struct {
+	Client       string   `json:"client"`                 // название клиента, например "desktop" или "mobile"
+	Capabilities []string `json:"capabilities,omitempty"` // возможности клиента
+}
+
+// WelcomePayload — ответ сервера на hello
+type WelcomePayload struct {
+	Version      int      `json:"version"`
+	Device       string   `json:"device"`       // имя подключенного устройства
+	Scopes       []string `json:"scopes"`       // права устройства
+	Types        []string `json:"types"`        // типы запросов, доступные устройству
+	Capabilities []string `json:"capabilities"` // возможности сервера
+}
+
+// TextPayload — текст команды или сообщения ассистенту
+type TextPayload struct {
+	Text string `json:"text"`
+}
+
+// ResponsePayload — ответ ассистента. Для прерванной команды содержит
+// часть ответа, полученную до отмены.
+type ResponsePayload struct {
+	Text      string `json:"text"`
+	Cancelled bool   `json:"cancelled,omitempty"`
+}
+
+// DeltaPayload — очередная часть потокового ответа
+type DeltaPayload struct {
+	Text string `json:"text"`
+}
+
+// CancelPayload — запрос на отмену команды с идентификатором ID (пусто —
+// текущей команды) и ответ на него
+type CancelPayload struct {
+	ID        string `json:"id,omitempty"`
+	Cancelled bool   `json:"cancelled"` // в ответе: была ли команда прервана
+}
+
+// NewConversationPayload — запрос нового разговора
+type NewConversationPayload struct {
+	Source string `json:"source,omitempty"` // "mobile" для разговора мобильного интерфейса
+}
+
+// ConversationPayload — идентификатор нового разговора
+type ConversationPayload struct {
+	SessionID string `json:"session_id"`
+}
+
+// GetHistoryPayload — запрос страницы истории. Пустые поля не
+// ограничивают выборку, по умолчанию сначала идут новые записи.
+type GetHistoryPayload struct {
+	Query       string    `json:"query,omitempty"`        // слова, которые должны встречаться в команде или ответе
+	Source      string    `json:"source,omitempty"`       // local, web, mobile, voice
+	Type        string    `json:"type,omitempty"`         // имя команды или "chat"
+	Since       time.Time `json:"since,omitempty"`        // не раньше
+	Until       time.Time `json:"until,omitempty"`        // раньше
+	After       string    `json:"after,omitempty"`        // next из предыдущей страницы
+	Limit       int       `json:"limit,omitempty"`        // размер страницы, по умолчанию 50
+	OldestFirst bool      `json:"oldest_first,omitempty"` // сначала старые записи
+}
+
+// HistoryPayload — страница истории команд
+type HistoryPayload struct {
+	History interface{} `json:"history"`
+	Next    string      `json:"next,omitempty"` // продолжение для следующей страницы; пусто — записей больше нет
+}
+
+// ExportHistoryPayload — запрос выгрузки истории. Пустые поля не
+// ограничивают выборку.
+type ExportHistoryPayload struct {
+	Format string    `json:"format"` // jsonl, csv или md
+	Query  string    `json:"query,omitempty"`
+	Source string    `json:"source,omitempty"`
+	Type   string    `json:"type,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+	Until  time.Time `json:"until,omitempty"`
+}
+
+// HistoryExportPayload — выгруженная история
+type HistoryExportPayload struct {
+	Format   string `json:"format"`
+	FileName string `json:"file_name"` // предлагаемое имя файла
+	Data     string `json:"data"`      // содержимое файла
+	Count    int    `json:"count"`     // число записей
+}
+
+// ConversationsPayload — список прошлых разговоров
+type ConversationsPayload struct {
+	Conversations interface{} `json:"conversations"`
+}
+
+// PairingCodePayload — код подключения нового устройства
+type PairingCodePayload struct {
+	Code    string    `json:"code"`
+	Expires time.Time `json:"expires"`
+}
+
+// ConfigPayload — настройки программы, как в файле, со скрытыми ключами
+// API. Это ответ на get_config и set_config.
+type ConfigPayload struct {
+	Config    interface{} `json:"config"`
+	Overrides []string    `json:"overrides,omitempty"` // настройки, заданные переменными окружения
+	Changes   interface{} `json:"changes,omitempty"`   // что изменил set_config и что применится после перезапуска
+}
+
+// SetConfigPayload — новые настройки целиком. Скрытые ключи API остаются
+// прежними.
+type SetConfigPayload struct {
+	Config json.RawMessage `json:"config"`
+}
+
+// SystemInfoPayload — информация о системе
+type SystemInfoPayload struct {
+	Info interface{} `json:"info"`
+}
+
+// ExecutePayload — команда оболочки компьютера или телефона
+type ExecutePayload struct {
+	Command string `json:"command"`
+}
+
+// CommandResultPayload — вывод команды оболочки
+type CommandResultPayload struct {
+	Source string `json:"source,omitempty"` // "mobile" для команды телефона
+	Output string `json:"output"`
+}
+
+// ScreenshotPayload — скриншот в формате PNG, закодированный в base64
+type ScreenshotPayload struct {
+	Source string `json:"source,omitempty"` // "mobile" для скриншота телефона
+	Data   string `json:"data"`
+}
+
+// AudioDevicesPayload — микрофоны и динамики компьютера и выбранные из них
+type AudioDevicesPayload struct {
+	Devices interface{} `json:"devices"`
+}
+
+// SetAudioDevicePayload — выбор микрофона или динамика
+type SetAudioDevicePayload struct {
+	Kind   string `json:"kind"`   // input — микрофон, output — динамик
+	Device string `json:"device"` // имя или идентификатор; пусто — по умолчанию
+}
+
+// VoiceStatePayload — что слушает голосовой модуль: idle — ключевое слово,
+// command — команду после него, follow_up — продолжение разговора без
+// ключевого слова
+type VoiceStatePayload struct {
+	State  string `json:"state"`
+	Stream bool   `json:"stream,omitempty"` // состояние потока звука этого клиента, а не микрофона компьютера
+}
+
+// AudioChunkPayload — часть записи из браузера: 16 кГц, моно, 16 бит
+// little-endian, в JSON — base64
+type AudioChunkPayload struct {
+	Data []byte `json:"data"`
+}
+
+// TranscriptPayload — распознанный текст записи. Приходит с идентификатором
+// audio_end перед ответом ассистента.
+type TranscriptPayload struct {
+	Text string `json:"text"`
+}
+
+// VoiceStreamStartPayload начинает поток звука с микрофона клиента. После
+// него клиент присылает запись двоичными кадрами WebSocket, а ассистент
+// слушает ее так же, как микрофон компьютера: ждет ключевое слово и
+// выполняет команду после него.
+type VoiceStreamStartPayload struct {
+	Format     string `json:"format"`           // pcm_s16le или pcm_f32le
+	SampleRate int    `json:"sample_rate"`      // частота записи, например 48000
+	Channels   int    `json:"channels"`         // 0 — моно
+	ReplyAudio bool   `json:"reply_audio"`      // присылать ответ звуком: каждое предложение — двоичный кадр с файлом MP3 или WAV
+	Source     string `json:"source,omitempty"` // "mobile" — команды идут в разговор мобильного интерфейса
+}
+
+// VoiceStreamPayload — идет ли поток звука клиента
+type VoiceStreamPayload struct {
+	Active bool `json:"active"`
+}
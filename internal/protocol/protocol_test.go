@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		data string
+		code string
+	}{
+		{`{"v":1,"type":"command","id":"1","payload":{"text":"привет"}}`, ""},
+		{`{"type":"get_history"}`, ""},
+		{`{"v":2,"type":"command"}`, CodeUnsupportedVersion},
+		{`{"v":1}`, CodeBadRequest},
+		{`не json`, CodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		msg, err := Parse([]byte(tt.data))
+		if tt.code == "" {
+			assert.Nil(t, err, tt.data)
+			assert.Equal(t, Version, msg.Version, tt.data)
+		} else if assert.NotNil(t, err, tt.data) {
+			assert.Equal(t, tt.code, err.Code, tt.data)
+		}
+	}
+
+	// Нагрузка разбирается в типизированную структуру
+	msg, _ := Parse([]byte(`{"type":"command","id":"1","payload":{"text":"привет"}}`))
+	var text TextPayload
+	assert.Nil(t, msg.Decode(&text))
+	assert.Equal(t, "привет", text.Text)
+
+	msg, _ = Parse([]byte(`{"type":"command","payload":{"text":5}}`))
+	err := msg.Decode(&text)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, CodeBadRequest, err.Code)
+	}
+
+	// Пустая нагрузка допустима
+	msg, _ = Parse([]byte(`{"type":"new_conversation"}`))
+	var conversation NewConversationPayload
+	assert.Nil(t, msg.Decode(&conversation))
+
+	// Запись из браузера приходит в base64
+	msg, _ = Parse([]byte(`{"type":"audio_chunk","id":"3","payload":{"data":"AAD/fw=="}}`))
+	var chunk AudioChunkPayload
+	assert.Nil(t, msg.Decode(&chunk))
+	assert.Equal(t, []byte{0, 0, 0xff, 0x7f}, chunk.Data)
+	msg, _ = Parse([]byte(`{"type":"audio_chunk","payload":{"data":"не base64"}}`))
+	assert.NotNil(t, msg.Decode(&chunk))
+}
+
+func TestNew(t *testing.T) {
+	data, err := json.Marshal(New(TypeResponse, "7", ResponsePayload{Text: "Готово"}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"v":1,"type":"response","id":"7","payload":{"text":"Готово"}}`, string(data))
+
+	data, _ = json.Marshal(New(TypeShowSettings, "", nil))
+	assert.JSONEq(t, `{"v":1,"type":"show_settings"}`, string(data))
+
+	// Состояние потока звука клиента отличается от состояния микрофона компьютера
+	data, _ = json.Marshal(New(TypeVoiceState, "", VoiceStatePayload{State: "command"}))
+	assert.JSONEq(t, `{"v":1,"type":"voice_state","payload":{"state":"command"}}`, string(data))
+	data, _ = json.Marshal(New(TypeVoiceState, "", VoiceStatePayload{State: "command", Stream: true}))
+	assert.JSONEq(t, `{"v":1,"type":"voice_state","payload":{"state":"command","stream":true}}`, string(data))
+
+	// Ошибки всегда приходят в одном виде и повторяют идентификатор запроса
+	data, _ = json.Marshal(NewError("8", Errorf(CodeUnknownType, "Неизвестный тип сообщения: %s", "dance")))
+	assert.JSONEq(t, `{"v":1,"type":"error","id":"8","payload":{"code":"unknown_type","message":"Неизвестный тип сообщения: dance"}}`, string(data))
+
+	// Несериализуемая нагрузка превращается в ошибку, а не теряется
+	msg := New(TypeConfig, "9", ConfigPayload{Config: math.NaN()})
+	assert.Equal(t, TypeError, msg.Type)
+	assert.Equal(t, "9", msg.ID)
+	var e Error
+	assert.NoError(t, json.Unmarshal(msg.Payload, &e))
+	assert.Equal(t, CodeInternal, e.Code)
+}
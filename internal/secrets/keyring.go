@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ztrue/tracerr"
+)
+
+// keyringService — имя, под которым ассистент хранит значения в связке ключей
+const keyringService = "kot.ai"
+
+// ErrNotFound сообщает, что значения с таким именем нет
+var ErrNotFound = errors.New("значение не найдено")
+
+// Keyring — хранилище паролей операционной системы: Secret Service
+// (GNOME Keyring, KWallet) на Linux, связка ключей на macOS, DPAPI
+// на Windows
+type Keyring interface {
+	// Get возвращает значение или ErrNotFound
+	Get(name string) (string, error)
+	// Set сохраняет значение, заменяя прежнее
+	Set(name, value string) error
+	// Delete удаляет значение; отсутствие значения не ошибка
+	Delete(name string) error
+}
+
+// SystemKeyring возвращает связку ключей операционной системы. На Windows
+// значения, защищенные DPAPI, хранятся в каталоге dir.
+func SystemKeyring(dir string) Keyring {
+	return newSystemKeyring(dir)
+}
+
+// unsupportedKeyring используется там, где связки ключей нет
+type unsupportedKeyring struct {
+	reason string
+}
+
+func (k unsupportedKeyring) err() error {
+	return tracerr.New(fmt.Sprintf("Связка ключей недоступна: %s. Используйте пароль (key_source: passphrase)", k.reason))
+}
+
+func (k unsupportedKeyring) Get(name string) (string, error) {
+	return "", k.err()
+}
+
+func (k unsupportedKeyring) Set(name, value string) error {
+	return k.err()
+}
+
+func (k unsupportedKeyring) Delete(name string) error {
+	return k.err()
+}
@@ -0,0 +1,58 @@
+//go:build darwin
+
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// securityKeyring работает со связкой ключей macOS через программу security
+type securityKeyring struct{}
+
+func newSystemKeyring(dir string) Keyring {
+	return securityKeyring{}
+}
+
+// errItemNotFound — код завершения security, когда записи нет
+const errItemNotFound = 44
+
+func (securityKeyring) Get(name string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == errItemNotFound {
+			return "", ErrNotFound
+		}
+		return "", tracerr.New(fmt.Sprintf("security: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+func (securityKeyring) Set(name, value string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "add-generic-password", "-U", "-s", keyringService, "-a", name, "-w", value)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return tracerr.New(fmt.Sprintf("security: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
+
+func (securityKeyring) Delete(name string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", name)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == errItemNotFound {
+			return nil
+		}
+		return tracerr.New(fmt.Sprintf("security: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
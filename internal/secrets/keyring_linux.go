@@ -0,0 +1,60 @@
+//go:build linux
+
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// secretToolKeyring работает с Secret Service через secret-tool из libsecret
+type secretToolKeyring struct {
+	path string
+}
+
+func newSystemKeyring(dir string) Keyring {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return unsupportedKeyring{reason: "не найдена программа secret-tool (пакет libsecret-tools)"}
+	}
+	return secretToolKeyring{path: path}
+}
+
+func (k secretToolKeyring) Get(name string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(k.path, "lookup", "service", keyringService, "account", name)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		// secret-tool завершается с кодом 1 без вывода, если значения нет
+		if _, ok := err.(*exec.ExitError); ok && strings.TrimSpace(stderr.String()) == "" {
+			return "", ErrNotFound
+		}
+		return "", tracerr.New(fmt.Sprintf("secret-tool: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+func (k secretToolKeyring) Set(name, value string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(k.path, "store", "--label", keyringService+": "+name, "service", keyringService, "account", name)
+	cmd.Stdin = strings.NewReader(value)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return tracerr.New(fmt.Sprintf("secret-tool: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
+
+func (k secretToolKeyring) Delete(name string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(k.path, "clear", "service", keyringService, "account", name)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil && strings.TrimSpace(stderr.String()) != "" {
+		return tracerr.New(fmt.Sprintf("secret-tool: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !windows && !linux && !darwin
+
+package secrets
+
+func newSystemKeyring(dir string) Keyring {
+	return unsupportedKeyring{reason: "нет реализации для этой системы"}
+}
@@ -0,0 +1,85 @@
+//go:build windows
+
+package secrets
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/ztrue/tracerr"
+	"golang.org/x/sys/windows"
+)
+
+// dpapiKeyring хранит значения в файлах, зашифрованных DPAPI: расшифровать
+// их может только тот же пользователь Windows
+type dpapiKeyring struct {
+	dir string
+}
+
+func newSystemKeyring(dir string) Keyring {
+	return dpapiKeyring{dir: dir}
+}
+
+// path возвращает файл значения; имя кодируется, чтобы не зависеть от
+// допустимых в именах файлов символов
+func (k dpapiKeyring) path(name string) string {
+	return filepath.Join(k.dir, hex.EncodeToString([]byte(name))+".dpapi")
+}
+
+func (k dpapiKeyring) Get(name string) (string, error) {
+	data, err := os.ReadFile(k.path(name))
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+	value, err := dpapi(data, false)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func (k dpapiKeyring) Set(name, value string) error {
+	if err := os.MkdirAll(k.dir, 0700); err != nil {
+		return tracerr.Wrap(err)
+	}
+	data, err := dpapi([]byte(value), true)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(k.path(name), data)
+}
+
+func (k dpapiKeyring) Delete(name string) error {
+	if err := os.Remove(k.path(name)); err != nil && !os.IsNotExist(err) {
+		return tracerr.Wrap(err)
+	}
+	return nil
+}
+
+// dpapi шифрует или расшифровывает данные ключом текущего пользователя
+func dpapi(data []byte, protect bool) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(data))}
+	if len(data) > 0 {
+		in.Data = &data[0]
+	}
+	var out windows.DataBlob
+	var err error
+	if protect {
+		err = windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	} else {
+		err = windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	}
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	result := make([]byte, out.Size)
+	copy(result, unsafe.Slice(out.Data, out.Size))
+	return result, nil
+}
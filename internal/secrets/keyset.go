@@ -0,0 +1,486 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ztrue/tracerr"
+	"golang.org/x/crypto/argon2"
+)
+
+// Откуда берется главный ключ, которым зашифрованы ключи данных
+const (
+	SourceKeyring    = "keyring"    // случайный ключ в связке ключей системы
+	SourcePassphrase = "passphrase" // ключ выводится из пароля
+)
+
+const (
+	keySize   = 32 // AES-256
+	saltSize  = 16
+	nonceSize = 12
+
+	// ciphertextVersion — первый байт зашифрованных данных. Открытые
+	// данные JSON начинаются с "{", поэтому их легко отличить.
+	ciphertextVersion = 1
+	headerSize        = 1 + 4 + nonceSize
+
+	// masterKeyName — имя главного ключа в связке ключей
+	masterKeyName = "master-key"
+)
+
+// ErrWrongKey сообщает, что главный ключ или пароль не подходит к ключам
+var ErrWrongKey = errors.New("неверный пароль или ключ шифрования")
+
+// MasterKey дает главный ключ, которым зашифрованы ключи данных
+type MasterKey interface {
+	// Source возвращает SourceKeyring или SourcePassphrase
+	Source() string
+	// Key возвращает ключ для соли salt
+	Key(salt []byte) ([]byte, error)
+}
+
+// passphraseKey выводит главный ключ из пароля
+type passphraseKey string
+
+// Passphrase возвращает главный ключ, выводимый из пароля по Argon2id
+func Passphrase(passphrase string) MasterKey {
+	return passphraseKey(passphrase)
+}
+
+func (p passphraseKey) Source() string {
+	return SourcePassphrase
+}
+
+func (p passphraseKey) Key(salt []byte) ([]byte, error) {
+	if p == "" {
+		return nil, tracerr.New(fmt.Sprintf("Не задан пароль ключей шифрования (переменная окружения %s)", PassphraseEnv))
+	}
+	return argon2.IDKey([]byte(p), salt, 1, 64*1024, 4, keySize), nil
+}
+
+// keyringKey хранит случайный главный ключ в связке ключей системы
+type keyringKey struct {
+	keyring Keyring
+}
+
+// KeyringMaster возвращает главный ключ из связки ключей. Если ключа еще
+// нет, он создается.
+func KeyringMaster(keyring Keyring) MasterKey {
+	return keyringKey{keyring: keyring}
+}
+
+func (k keyringKey) Source() string {
+	return SourceKeyring
+}
+
+func (k keyringKey) Key(salt []byte) ([]byte, error) {
+	value, err := k.keyring.Get(masterKeyName)
+	if err == ErrNotFound {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		if err := k.keyring.Set(masterKeyName, base64.StdEncoding.EncodeToString(key)); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != keySize {
+		return nil, tracerr.New("Главный ключ в связке ключей поврежден")
+	}
+	return key, nil
+}
+
+// keyFile — файл ключей: ключи данных, зашифрованные главным ключом
+type keyFile struct {
+	Source  string       `json:"source"`
+	Salt    []byte       `json:"salt"`
+	Current uint32       `json:"current"`
+	Index   []byte       `json:"index"` // ключ поисковых меток
+	Keys    []wrappedKey `json:"keys"`
+}
+
+// wrappedKey — ключ данных, зашифрованный главным ключом
+type wrappedKey struct {
+	ID      uint32    `json:"id"`
+	Key     []byte    `json:"key"`
+	Created time.Time `json:"created"`
+}
+
+// KeyInfo описывает ключ данных
+type KeyInfo struct {
+	ID      uint32
+	Created time.Time
+	Current bool
+}
+
+// Keyset шифрует данные AES-GCM. Новые данные шифруются текущим ключом,
+// а прежние ключи остаются, пока их данные не перешифрованы, поэтому
+// ключ можно сменить без простоя. Ключи данных хранятся в файле,
+// зашифрованные главным ключом из связки ключей или пароля.
+type Keyset struct {
+	path   string
+	master []byte
+
+	mutex sync.RWMutex
+	file  keyFile
+	keys  map[uint32]cipher.AEAD
+	index []byte
+}
+
+// OpenKeyset открывает файл ключей path или создает его с первым ключом
+func OpenKeyset(path string, master MasterKey) (*Keyset, error) {
+	k := &Keyset{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		salt, err := randomBytes(saltSize)
+		if err != nil {
+			return nil, err
+		}
+		k.file = keyFile{Source: master.Source(), Salt: salt}
+		if k.master, err = master.Key(salt); err != nil {
+			return nil, err
+		}
+		index, err := randomBytes(keySize)
+		if err != nil {
+			return nil, err
+		}
+		if k.file.Index, err = k.wrap(index, 0); err != nil {
+			return nil, err
+		}
+		k.index = index
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	case err != nil:
+		return nil, tracerr.Wrap(err)
+	}
+
+	if err := json.Unmarshal(data, &k.file); err != nil {
+		return nil, tracerr.New(fmt.Sprintf("Файл ключей %s поврежден: %v", path, err))
+	}
+	if k.file.Source != master.Source() {
+		return nil, tracerr.New(fmt.Sprintf("Ключи в %s защищены способом %s, а в настройках указан %s", path, k.file.Source, master.Source()))
+	}
+	if k.master, err = master.Key(k.file.Salt); err != nil {
+		return nil, err
+	}
+	if err := k.unwrapAll(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// unwrapAll расшифровывает ключи данных из файла
+func (k *Keyset) unwrapAll() error {
+	index, err := k.unwrap(k.file.Index, 0)
+	if err != nil {
+		return err
+	}
+	keys := make(map[uint32]cipher.AEAD)
+	for _, wrapped := range k.file.Keys {
+		key, err := k.unwrap(wrapped.Key, wrapped.ID)
+		if err != nil {
+			return err
+		}
+		if keys[wrapped.ID], err = newAEAD(key); err != nil {
+			return err
+		}
+	}
+	if keys[k.file.Current] == nil {
+		return tracerr.New(fmt.Sprintf("В файле ключей %s нет текущего ключа", k.path))
+	}
+	k.index, k.keys = index, keys
+	return nil
+}
+
+// Encrypt шифрует plaintext текущим ключом. associated — данные, к которым
+// привязан шифротекст, например ключ записи: с другими он не расшифруется.
+func (k *Keyset) Encrypt(plaintext, associated []byte) ([]byte, error) {
+	k.mutex.RLock()
+	id := k.file.Current
+	aead := k.keys[id]
+	k.mutex.RUnlock()
+
+	out := make([]byte, headerSize, headerSize+len(plaintext)+aead.Overhead())
+	out[0] = ciphertextVersion
+	binary.BigEndian.PutUint32(out[1:], id)
+	if _, err := rand.Read(out[5:headerSize]); err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	return aead.Seal(out, out[5:headerSize], plaintext, append(out[:5:5], associated...)), nil
+}
+
+// Decrypt расшифровывает данные, зашифрованные любым из ключей
+func (k *Keyset) Decrypt(ciphertext, associated []byte) ([]byte, error) {
+	if len(ciphertext) < headerSize || ciphertext[0] != ciphertextVersion {
+		return nil, tracerr.New("Данные не зашифрованы или повреждены")
+	}
+	id := binary.BigEndian.Uint32(ciphertext[1:])
+	k.mutex.RLock()
+	aead := k.keys[id]
+	k.mutex.RUnlock()
+	if aead == nil {
+		return nil, tracerr.New(fmt.Sprintf("Ключ %d удален, данные не расшифровать", id))
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[5:headerSize], ciphertext[headerSize:], append(ciphertext[:5:5], associated...))
+	if err != nil {
+		return nil, tracerr.New("Данные повреждены или зашифрованы другим ключом")
+	}
+	return plaintext, nil
+}
+
+// KeyID возвращает номер ключа, которым зашифрованы данные
+func KeyID(ciphertext []byte) (uint32, bool) {
+	if len(ciphertext) < headerSize || ciphertext[0] != ciphertextVersion {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(ciphertext[1:]), true
+}
+
+// Current возвращает номер текущего ключа
+func (k *Keyset) Current() uint32 {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.file.Current
+}
+
+// Blind возвращает метку для поиска по слову: одинаковые слова дают
+// одинаковые метки, но по метке слово не восстановить. Ключ меток не
+// меняется при смене ключа данных.
+func (k *Keyset) Blind(term string) string {
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(term))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Keys возвращает ключи данных
+func (k *Keyset) Keys() []KeyInfo {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	var keys []KeyInfo
+	for _, wrapped := range k.file.Keys {
+		keys = append(keys, KeyInfo{ID: wrapped.ID, Created: wrapped.Created, Current: wrapped.ID == k.file.Current})
+	}
+	return keys
+}
+
+// Rotate создает новый ключ данных и делает его текущим. Прежние ключи
+// остаются для расшифровки, пока их не удалит Retire.
+func (k *Keyset) Rotate() (uint32, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, err := randomBytes(keySize)
+	if err != nil {
+		return 0, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+
+	id := uint32(1)
+	for _, wrapped := range k.file.Keys {
+		id = max(id, wrapped.ID+1)
+	}
+	wrapped, err := k.wrap(key, id)
+	if err != nil {
+		return 0, err
+	}
+
+	file := k.file
+	file.Keys = append(append([]wrappedKey(nil), k.file.Keys...), wrappedKey{ID: id, Key: wrapped, Created: time.Now()})
+	file.Current = id
+	if err := k.save(file); err != nil {
+		return 0, err
+	}
+	k.file = file
+	if k.keys == nil {
+		k.keys = make(map[uint32]cipher.AEAD)
+	}
+	k.keys[id] = aead
+	return id, nil
+}
+
+// Retire удаляет все ключи, кроме текущего. Вызывайте после того, как
+// данные перешифрованы текущим ключом.
+func (k *Keyset) Retire() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	file := k.file
+	file.Keys = nil
+	for _, wrapped := range k.file.Keys {
+		if wrapped.ID == k.file.Current {
+			file.Keys = append(file.Keys, wrapped)
+		}
+	}
+	if err := k.save(file); err != nil {
+		return err
+	}
+	k.file = file
+	for id := range k.keys {
+		if id != file.Current {
+			delete(k.keys, id)
+		}
+	}
+	return nil
+}
+
+// ChangeMaster заново шифрует ключи данных другим главным ключом,
+// например новым паролем. Зашифрованные данные при этом не меняются.
+func (k *Keyset) ChangeMaster(master MasterKey) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	salt, err := randomBytes(saltSize)
+	if err != nil {
+		return err
+	}
+	key, err := master.Key(salt)
+	if err != nil {
+		return err
+	}
+
+	// Расшифровываем старым главным ключом и шифруем новым
+	next := &Keyset{master: key}
+	file := keyFile{Source: master.Source(), Salt: salt, Current: k.file.Current}
+	index, err := k.unwrap(k.file.Index, 0)
+	if err != nil {
+		return err
+	}
+	if file.Index, err = next.wrap(index, 0); err != nil {
+		return err
+	}
+	for _, wrapped := range k.file.Keys {
+		plain, err := k.unwrap(wrapped.Key, wrapped.ID)
+		if err != nil {
+			return err
+		}
+		if wrapped.Key, err = next.wrap(plain, wrapped.ID); err != nil {
+			return err
+		}
+		file.Keys = append(file.Keys, wrapped)
+	}
+	if err := k.save(file); err != nil {
+		return err
+	}
+	k.file, k.master = file, key
+	return nil
+}
+
+// wrap шифрует ключ данных главным ключом
+func (k *Keyset) wrap(key []byte, id uint32) ([]byte, error) {
+	aead, err := newAEAD(k.master)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(nonceSize)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, wrapAssociated(id)), nil
+}
+
+// unwrap расшифровывает ключ данных главным ключом
+func (k *Keyset) unwrap(wrapped []byte, id uint32) ([]byte, error) {
+	aead, err := newAEAD(k.master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < nonceSize {
+		return nil, tracerr.New(fmt.Sprintf("Файл ключей %s поврежден", k.path))
+	}
+	key, err := aead.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], wrapAssociated(id))
+	if err != nil {
+		return nil, tracerr.Wrap(ErrWrongKey)
+	}
+	return key, nil
+}
+
+// wrapAssociated привязывает зашифрованный ключ к его номеру
+func wrapAssociated(id uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte("kot.ai key "), id)
+}
+
+// save записывает файл ключей
+func (k *Keyset) save(file keyFile) error {
+	sort.Slice(file.Keys, func(i, j int) bool { return file.Keys[i].ID < file.Keys[j].ID })
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	return writeFileAtomic(k.path, data)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	return aead, nil
+}
+
+func randomBytes(size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	return data, nil
+}
+
+// writeFileAtomic записывает файл, доступный только владельцу, так, чтобы
+// при сбое остался прежний файл целиком
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return tracerr.Wrap(err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	defer os.Remove(temp.Name())
+	if err := temp.Chmod(0600); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		temp.Close()
+		return tracerr.Wrap(err)
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return tracerr.Wrap(err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return tracerr.Wrap(err)
+	}
+	if err := temp.Close(); err != nil {
+		return tracerr.Wrap(err)
+	}
+	return tracerr.Wrap(os.Rename(temp.Name(), path))
+}
@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryKeyring — связка ключей в памяти для тестов
+type memoryKeyring map[string]string
+
+func (k memoryKeyring) Get(name string) (string, error) {
+	value, ok := k[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (k memoryKeyring) Set(name, value string) error {
+	k[name] = value
+	return nil
+}
+
+func (k memoryKeyring) Delete(name string) error {
+	delete(k, name)
+	return nil
+}
+
+func TestKeysetEncryptDecrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keyring := memoryKeyring{}
+	keys, err := OpenKeyset(path, KeyringMaster(keyring))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, keyring, masterKeyName)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := keys.Encrypt([]byte("секрет"), []byte("a"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "секрет")
+
+	plain, err := keys.Decrypt(data, []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "секрет", string(plain))
+
+	// Шифротекст привязан к associated data
+	_, err = keys.Decrypt(data, []byte("b"))
+	assert.Error(t, err)
+	data[len(data)-1] ^= 1
+	_, err = keys.Decrypt(data, []byte("a"))
+	assert.Error(t, err)
+	_, err = keys.Decrypt([]byte(`{"command":"x"}`), nil)
+	assert.Error(t, err)
+
+	// Повторное открытие дает те же ключи
+	reopened, err := OpenKeyset(path, KeyringMaster(keyring))
+	assert.NoError(t, err)
+	data, _ = keys.Encrypt([]byte("снова"), nil)
+	plain, err = reopened.Decrypt(data, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "снова", string(plain))
+	assert.Equal(t, keys.Blind("погода"), reopened.Blind("погода"))
+	assert.NotEqual(t, keys.Blind("погода"), keys.Blind("музыка"))
+}
+
+func TestKeysetRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys, err := OpenKeyset(path, Passphrase("пароль"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	blind := keys.Blind("погода")
+	old, _ := keys.Encrypt([]byte("старое"), nil)
+
+	id, err := keys.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), id)
+	assert.Len(t, keys.Keys(), 2)
+	fresh, _ := keys.Encrypt([]byte("новое"), nil)
+	oldID, _ := KeyID(old)
+	freshID, _ := KeyID(fresh)
+	assert.Equal(t, uint32(1), oldID)
+	assert.Equal(t, uint32(2), freshID)
+
+	// Старые данные читаются, пока ключ не удален
+	reopened, err := OpenKeyset(path, Passphrase("пароль"))
+	assert.NoError(t, err)
+	plain, err := reopened.Decrypt(old, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "старое", string(plain))
+	assert.Equal(t, blind, reopened.Blind("погода"))
+
+	assert.NoError(t, keys.Retire())
+	assert.Equal(t, []KeyInfo{{ID: 2, Created: keys.Keys()[0].Created, Current: true}}, keys.Keys())
+	_, err = keys.Decrypt(old, nil)
+	assert.Error(t, err)
+	_, err = keys.Decrypt(fresh, nil)
+	assert.NoError(t, err)
+}
+
+func TestKeysetPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys, err := OpenKeyset(path, Passphrase("пароль"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, _ := keys.Encrypt([]byte("данные"), nil)
+
+	_, err = OpenKeyset(path, Passphrase("другой"))
+	assert.True(t, errors.Is(err, ErrWrongKey))
+	_, err = OpenKeyset(path, Passphrase(""))
+	assert.ErrorContains(t, err, PassphraseEnv)
+	_, err = OpenKeyset(path, KeyringMaster(memoryKeyring{}))
+	assert.ErrorContains(t, err, SourcePassphrase)
+
+	// Смена пароля не меняет ключи данных
+	assert.NoError(t, keys.ChangeMaster(Passphrase("новый")))
+	_, err = OpenKeyset(path, Passphrase("пароль"))
+	assert.Error(t, err)
+	reopened, err := OpenKeyset(path, Passphrase("новый"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	plain, err := reopened.Decrypt(data, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "данные", string(plain))
+}
@@ -0,0 +1,220 @@
+// Package secrets хранит ключи шифрования и секреты ассистента: ключи API,
+// токены и т.п. Секреты шифруются AES-GCM ключами из Keyset, а главный
+// ключ берется из связки ключей системы или выводится из пароля.
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ztrue/tracerr"
+)
+
+// PassphraseEnv — переменная окружения с паролем, если ключи защищены паролем
+const PassphraseEnv = "KOT_PASSPHRASE"
+
+// ReferencePrefix начинает ссылку на секрет в настройках: "secret:openai"
+const ReferencePrefix = "secret:"
+
+// Store — файл секретов. Каждое значение зашифровано отдельно и привязано
+// к своему имени.
+type Store struct {
+	path string
+	keys *Keyset
+
+	mutex  sync.RWMutex
+	values map[string][]byte
+}
+
+// OpenStore открывает файл секретов path; если файла нет, хранилище пусто
+func OpenStore(path string, keys *Keyset) (*Store, error) {
+	s := &Store{path: path, keys: keys, values: make(map[string][]byte)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	if err := json.Unmarshal(data, &s.values); err != nil {
+		return nil, tracerr.New(fmt.Sprintf("Файл секретов %s поврежден: %v", path, err))
+	}
+	return s, nil
+}
+
+// Get возвращает секрет или ErrNotFound
+func (s *Store) Get(name string) (string, error) {
+	s.mutex.RLock()
+	data, ok := s.values[name]
+	s.mutex.RUnlock()
+	if !ok {
+		return "", ErrNotFound
+	}
+	value, err := s.keys.Decrypt(data, []byte(name))
+	if err != nil {
+		return "", tracerr.New(fmt.Sprintf("Секрет %s: %v", name, err))
+	}
+	return string(value), nil
+}
+
+// Set сохраняет секрет, заменяя прежнее значение
+func (s *Store) Set(name, value string) error {
+	if name == "" {
+		return tracerr.New("Не указано имя секрета")
+	}
+	data, err := s.keys.Encrypt([]byte(value), []byte(name))
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	previous, existed := s.values[name]
+	s.values[name] = data
+	if err := s.save(); err != nil {
+		if existed {
+			s.values[name] = previous
+		} else {
+			delete(s.values, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete удаляет секрет; удалять отсутствующий не ошибка
+func (s *Store) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	previous, ok := s.values[name]
+	if !ok {
+		return nil
+	}
+	delete(s.values, name)
+	if err := s.save(); err != nil {
+		s.values[name] = previous
+		return err
+	}
+	return nil
+}
+
+// Names возвращает имена секретов по алфавиту
+func (s *Store) Names() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rekey перешифровывает секреты текущим ключом и возвращает их число
+func (s *Store) Rekey() (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := s.keys.Current()
+	values := make(map[string][]byte, len(s.values))
+	count := 0
+	for name, data := range s.values {
+		if id, ok := KeyID(data); ok && id == current {
+			values[name] = data
+			continue
+		}
+		plain, err := s.keys.Decrypt(data, []byte(name))
+		if err != nil {
+			return 0, tracerr.New(fmt.Sprintf("Секрет %s: %v", name, err))
+		}
+		if values[name], err = s.keys.Encrypt(plain, []byte(name)); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	previous := s.values
+	s.values = values
+	if err := s.save(); err != nil {
+		s.values = previous
+		return 0, err
+	}
+	return count, nil
+}
+
+// save записывает файл секретов
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.values, "", "  ")
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// IsReference сообщает, ссылается ли значение настройки на секрет
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, ReferencePrefix)
+}
+
+// Resolve заменяет ссылку "secret:имя" значением секрета из lookup.
+// Остальные значения возвращаются без изменений.
+func Resolve(value string, lookup func(name string) (string, error)) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	name := strings.TrimPrefix(value, ReferencePrefix)
+	secret, err := lookup(name)
+	if err == ErrNotFound {
+		return "", tracerr.New(fmt.Sprintf("Секрет %s не найден: добавьте его командой kot secrets set %s", name, name))
+	}
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Vault объединяет ключи и хранилище секретов
+type Vault struct {
+	Keys    *Keyset
+	Secrets *Store
+}
+
+// Master возвращает главный ключ для способа source: SourceKeyring или
+// SourcePassphrase. keysPath — файл ключей; рядом с ним на Windows
+// хранится связка ключей DPAPI.
+func Master(source, keysPath string) (MasterKey, error) {
+	switch source {
+	case "", SourceKeyring:
+		return KeyringMaster(SystemKeyring(filepath.Join(filepath.Dir(keysPath), "keyring"))), nil
+	case SourcePassphrase:
+		return Passphrase(os.Getenv(PassphraseEnv)), nil
+	default:
+		return nil, tracerr.New(fmt.Sprintf("Неизвестный источник ключа: %s (ожидается %s или %s)", source, SourceKeyring, SourcePassphrase))
+	}
+}
+
+// Open открывает ключи keysPath и секреты secretsPath, создавая их при
+// первом запуске
+func Open(keysPath, secretsPath, source string) (*Vault, error) {
+	master, err := Master(source, keysPath)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := OpenKeyset(keysPath, master)
+	if err != nil {
+		return nil, err
+	}
+	store, err := OpenStore(secretsPath, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{Keys: keys, Secrets: store}, nil
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	keyring := memoryKeyring{}
+	keys, err := OpenKeyset(filepath.Join(dir, "keys.json"), KeyringMaster(keyring))
+	if !assert.NoError(t, err) {
+		return
+	}
+	path := filepath.Join(dir, "secrets.json")
+	store, err := OpenStore(path, keys)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = store.Get("openai")
+	assert.Equal(t, ErrNotFound, err)
+	assert.NoError(t, store.Set("openai", "sk-test"))
+	assert.NoError(t, store.Set("google", "g-test"))
+	assert.Error(t, store.Set("", "x"))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "sk-test")
+
+	reopened, err := OpenStore(path, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"google", "openai"}, reopened.Names())
+	value, err := reopened.Get("openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-test", value)
+
+	// После смены ключа секреты перешифровываются и старый ключ не нужен
+	_, err = keys.Rotate()
+	assert.NoError(t, err)
+	count, err := reopened.Rekey()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = reopened.Rekey()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.NoError(t, keys.Retire())
+	value, err = reopened.Get("google")
+	assert.NoError(t, err)
+	assert.Equal(t, "g-test", value)
+
+	assert.NoError(t, reopened.Delete("google"))
+	assert.NoError(t, reopened.Delete("google"))
+	assert.Equal(t, []string{"openai"}, reopened.Names())
+}
+
+func TestResolve(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "openai" {
+			return "sk-test", nil
+		}
+		return "", ErrNotFound
+	}
+
+	value, err := Resolve("sk-plain", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-plain", value)
+
+	value, err = Resolve("secret:openai", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-test", value)
+
+	_, err = Resolve("secret:google", lookup)
+	assert.ErrorContains(t, err, "kot secrets set google")
+}
+
+func TestOpenVault(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(PassphraseEnv, "пароль")
+	vault, err := Open(filepath.Join(dir, "keys.json"), filepath.Join(dir, "secrets.json"), SourcePassphrase)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, vault.Secrets.Set("openai", "sk-test"))
+
+	_, err = Open(filepath.Join(dir, "keys.json"), filepath.Join(dir, "secrets.json"), "file")
+	assert.Error(t, err)
+
+	t.Setenv(PassphraseEnv, "другой")
+	_, err = Open(filepath.Join(dir, "keys.json"), filepath.Join(dir, "secrets.json"), SourcePassphrase)
+	assert.ErrorIs(t, err, ErrWrongKey)
+}
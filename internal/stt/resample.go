@@ -0,0 +1,128 @@
+package stt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Форматы записи, которые можно перевести для распознавателя
+const (
+	FormatS16LE = "pcm_s16le" // 16 бит со знаком, little-endian
+	FormatF32LE = "pcm_f32le" // 32 бита с плавающей точкой от -1 до 1, little-endian, как в Web Audio
+)
+
+// maxInputRate ограничивает частоту входной записи
+const maxInputRate = 192000
+
+// Resampler переводит поток записи в формат распознавателя: SampleRate,
+// моно, 16 бит. Каналы усредняются. При понижении частоты отсчеты
+// усредняются по окну, чтобы высокие частоты не превращались в шум, при
+// повышении — интерполируются. Запись можно передавать частями любой
+// длины: незаконченные отсчеты ждут следующей части.
+type Resampler struct {
+	format     string
+	channels   int
+	step       float64   // входных отсчетов на один выходной
+	partial    []byte    // начало неполного кадра
+	samples    []float64 // еще не использованные отсчеты, моно
+	position   float64   // положение следующего выходного отсчета в samples
+	sampleSize int
+}
+
+// NewResampler создает преобразователь записи с частотой sampleRate и
+// числом каналов channels в формате format
+func NewResampler(format string, sampleRate, channels int) (*Resampler, error) {
+	var sampleSize int
+	switch format {
+	case FormatS16LE:
+		sampleSize = 2
+	case FormatF32LE:
+		sampleSize = 4
+	default:
+		return nil, tracerr.New(fmt.Sprintf("Неподдерживаемый формат записи: %s", format))
+	}
+	if sampleRate <= 0 || sampleRate > maxInputRate {
+		return nil, tracerr.New(fmt.Sprintf("Некорректная частота записи: %d", sampleRate))
+	}
+	if channels <= 0 || channels > 8 {
+		return nil, tracerr.New(fmt.Sprintf("Некорректное число каналов: %d", channels))
+	}
+	return &Resampler{
+		format:     format,
+		channels:   channels,
+		step:       float64(sampleRate) / SampleRate,
+		sampleSize: sampleSize,
+	}, nil
+}
+
+// Write принимает очередную часть записи и возвращает готовую часть
+// в формате распознавателя
+func (r *Resampler) Write(data []byte) []byte {
+	frameSize := r.sampleSize * r.channels
+	data = append(r.partial, data...)
+	frames := len(data) / frameSize
+	r.partial = append([]byte(nil), data[frames*frameSize:]...)
+
+	for i := 0; i < frames; i++ {
+		var sum float64
+		for channel := 0; channel < r.channels; channel++ {
+			sum += r.sample(data[(i*r.channels+channel)*r.sampleSize:])
+		}
+		r.samples = append(r.samples, sum/float64(r.channels))
+	}
+
+	var out []byte
+	for {
+		var value float64
+		if r.step > 1 {
+			// Среднее по окну [position, position+step)
+			start := int(r.position)
+			end := int(math.Ceil(r.position + r.step))
+			if end > len(r.samples) {
+				break
+			}
+			var sum float64
+			for _, sample := range r.samples[start:end] {
+				sum += sample
+			}
+			value = sum / float64(end-start)
+		} else {
+			// Линейная интерполяция между соседними отсчетами
+			index := int(r.position)
+			if index+1 >= len(r.samples) {
+				break
+			}
+			fraction := r.position - float64(index)
+			value = r.samples[index]*(1-fraction) + r.samples[index+1]*fraction
+		}
+		out = binary.LittleEndian.AppendUint16(out, uint16(toS16(value)))
+		r.position += r.step
+	}
+
+	// Использованные отсчеты больше не нужны
+	used := min(int(r.position), len(r.samples))
+	r.samples = append(r.samples[:0], r.samples[used:]...)
+	r.position -= float64(used)
+	return out
+}
+
+// sample читает один отсчет и приводит его к диапазону -1..1
+func (r *Resampler) sample(data []byte) float64 {
+	if r.format == FormatF32LE {
+		value := float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+		if math.IsNaN(value) {
+			return 0
+		}
+		return value
+	}
+	return float64(int16(binary.LittleEndian.Uint16(data))) / 32768
+}
+
+// toS16 переводит отсчет из диапазона -1..1 в 16 бит
+func toS16(value float64) int16 {
+	value = max(-1, min(1, value))
+	return int16(math.Round(value * 32767))
+}
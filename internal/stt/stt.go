@@ -0,0 +1,79 @@
+package stt
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Поддерживаемые движки офлайн-распознавания
+const (
+	EngineWhisperCpp = "whisper.cpp" // whisper.cpp, запускаемый для каждой фразы
+	EngineVosk       = "vosk"        // vosk-server по протоколу WebSocket
+)
+
+// SampleRate — частота дискретизации записей, которые получает распознаватель
+const SampleRate = 16000
+
+// Recognizer распознает речь в записи
+type Recognizer interface {
+	// Recognize распознает речь в PCM-записи: 16 кГц, моно, 16 бит
+	Recognize(ctx context.Context, pcm []byte) (string, error)
+}
+
+// Config содержит настройки офлайн-распознавания
+type Config struct {
+	Engine    string // whisper.cpp, vosk; пусто — whisper.cpp
+	ModelPath string // файл модели whisper.cpp (ggml-*.bin)
+	Language  string // язык речи, например "ru-RU"
+	Threads   int    // потоков процессора; 0 — по числу ядер
+	Command   string // программа whisper.cpp; пусто — whisper-cli
+	ServerURL string // адрес vosk-server; пусто — ws://localhost:2700
+}
+
+// NewRecognizer создает распознаватель по настройкам
+func NewRecognizer(config Config) (Recognizer, error) {
+	switch config.Engine {
+	case "", EngineWhisperCpp:
+		if config.ModelPath == "" {
+			return nil, tracerr.New("Не указан путь к модели whisper.cpp")
+		}
+		command := config.Command
+		if command == "" {
+			command = defaultWhisperCommand
+		}
+		threads := config.Threads
+		if threads <= 0 {
+			threads = runtime.NumCPU()
+		}
+		return &WhisperCpp{
+			command:  command,
+			model:    config.ModelPath,
+			language: shortLanguage(config.Language),
+			threads:  threads,
+		}, nil
+	case EngineVosk:
+		serverURL := config.ServerURL
+		if serverURL == "" {
+			serverURL = defaultVoskURL
+		}
+		return &Vosk{serverURL: serverURL}, nil
+	default:
+		return nil, tracerr.New(fmt.Sprintf("Неизвестный движок распознавания речи: %s", config.Engine))
+	}
+}
+
+// shortLanguage превращает "ru-RU" в "ru". Пустой язык — автоопределение.
+func shortLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		language = language[:i]
+	}
+	if language == "" {
+		return "auto"
+	}
+	return language
+}
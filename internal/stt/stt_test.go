@@ -0,0 +1,237 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// readFixture читает запись из testdata
+func readFixture(t *testing.T, name string) []byte {
+	file, err := os.Open(filepath.Join("testdata", name))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer file.Close()
+
+	pcm, sampleRate, err := ReadWAV(file)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, SampleRate, sampleRate)
+	return pcm
+}
+
+func TestWAV(t *testing.T) {
+	// Блок LIST, который добавляет ffmpeg, пропускается
+	pcm := readFixture(t, "command.wav")
+	assert.Len(t, pcm, 2*SampleRate)
+
+	var buffer bytes.Buffer
+	assert.NoError(t, WriteWAV(&buffer, pcm, SampleRate))
+	assert.Equal(t, 44+len(pcm), buffer.Len())
+
+	decoded, sampleRate, err := ReadWAV(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, SampleRate, sampleRate)
+	assert.Equal(t, pcm, decoded)
+
+	_, _, err = ReadWAV(strings.NewReader("не wav"))
+	assert.Error(t, err)
+}
+
+func TestNewRecognizer(t *testing.T) {
+	_, err := NewRecognizer(Config{})
+	assert.Error(t, err, "без модели whisper.cpp не работает")
+
+	recognizer, err := NewRecognizer(Config{ModelPath: "ggml-small.bin", Language: "ru-RU"})
+	assert.NoError(t, err)
+	whisper := recognizer.(*WhisperCpp)
+	assert.Equal(t, "whisper-cli", whisper.command)
+	assert.Equal(t, "ru", whisper.language)
+	assert.Equal(t, runtime.NumCPU(), whisper.threads)
+
+	recognizer, err = NewRecognizer(Config{Engine: EngineVosk})
+	assert.NoError(t, err)
+	assert.Equal(t, "ws://localhost:2700", recognizer.(*Vosk).serverURL)
+
+	_, err = NewRecognizer(Config{Engine: "kaldi"})
+	assert.Error(t, err)
+
+	assert.Equal(t, "auto", shortLanguage(""))
+	assert.Equal(t, "en", shortLanguage("en_US"))
+}
+
+func TestWhisperCpp(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("тест использует sh")
+	}
+
+	// Заглушка whisper.cpp записывает аргументы и распознает запись по размеру:
+	// тишина короче команды
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := `#!/bin/sh
+echo "$@" > ` + argsFile + `
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-f" ]; then file="$2"; fi
+	shift
+done
+if [ $(wc -c < "$file") -gt 20000 ]; then
+	echo " Включи музыку."
+else
+	echo " [BLANK_AUDIO]"
+fi
+`
+	command := filepath.Join(dir, "whisper-cli")
+	assert.NoError(t, os.WriteFile(command, []byte(script), 0755))
+
+	recognizer, err := NewRecognizer(Config{
+		Command:   command,
+		ModelPath: "/models/ggml-small.bin",
+		Language:  "ru-RU",
+		Threads:   2,
+	})
+	assert.NoError(t, err)
+
+	text, err := recognizer.Recognize(context.Background(), readFixture(t, "command.wav"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Включи музыку.", text)
+
+	args, _ := os.ReadFile(argsFile)
+	assert.Contains(t, string(args), "-m /models/ggml-small.bin")
+	assert.Contains(t, string(args), "-l ru -t 2")
+
+	// Пометки вместо речи не считаются текстом
+	text, err = recognizer.Recognize(context.Background(), readFixture(t, "silence.wav"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", text)
+
+	// Ошибка программы возвращается вместе с ее выводом
+	failing := filepath.Join(dir, "failing")
+	assert.NoError(t, os.WriteFile(failing, []byte("#!/bin/sh\necho 'модель не найдена' >&2\nexit 1\n"), 0755))
+	recognizer, _ = NewRecognizer(Config{Command: failing, ModelPath: "missing.bin"})
+	_, err = recognizer.Recognize(context.Background(), readFixture(t, "command.wav"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "модель не найдена")
+	}
+}
+
+func TestVosk(t *testing.T) {
+	// Сервер по протоколу vosk-server: после каждой части записи — partial,
+	// фраза заканчивается на тишине, остаток приходит в ответ на eof
+	var received []byte
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		var config voskConfig
+		assert.NoError(t, conn.ReadJSON(&config))
+		assert.Equal(t, SampleRate, config.Config.SampleRate)
+
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.TextMessage {
+				var eof map[string]int
+				assert.NoError(t, json.Unmarshal(data, &eof))
+				assert.Equal(t, 1, eof["eof"])
+				conn.WriteJSON(map[string]string{"text": "музыку"})
+				return
+			}
+
+			received = append(received, data...)
+			if len(received) == 2*SampleRate {
+				conn.WriteJSON(map[string]string{"text": "включи"})
+			} else {
+				conn.WriteJSON(map[string]string{"partial": "вклю"})
+			}
+		}
+	}))
+	defer server.Close()
+
+	recognizer, err := NewRecognizer(Config{Engine: EngineVosk, ServerURL: "ws" + strings.TrimPrefix(server.URL, "http")})
+	assert.NoError(t, err)
+
+	pcm := readFixture(t, "command.wav")
+	text, err := recognizer.Recognize(context.Background(), pcm)
+	assert.NoError(t, err)
+	assert.Equal(t, "включи музыку", text)
+	assert.Equal(t, pcm, received)
+
+	// Без сервера — ошибка, а не пустой текст
+	server.Close()
+	_, err = recognizer.Recognize(context.Background(), pcm)
+	assert.Error(t, err)
+}
+
+func TestResampler(t *testing.T) {
+	// Стерео 48 кГц с плавающей точкой: тон 440 Гц в левом канале и тишина в правом
+	var input []byte
+	for i := 0; i < 4800; i++ {
+		value := float32(0.5 * math.Sin(2*math.Pi*440*float64(i)/48000))
+		input = binary.LittleEndian.AppendUint32(input, math.Float32bits(value))
+		input = binary.LittleEndian.AppendUint32(input, 0)
+	}
+
+	resampler, err := NewResampler(FormatF32LE, 48000, 2)
+	assert.NoError(t, err)
+	whole := resampler.Write(input)
+	assert.Equal(t, 1600*2, len(whole))
+
+	// Тот же тон 16 кГц с половинной громкостью (каналы усредняются).
+	// Середина окна из трех отсчетов сдвинута на треть выходного отсчета.
+	for i := 0; i < 1600; i += 37 {
+		sample := float64(int16(binary.LittleEndian.Uint16(whole[i*2:]))) / 32767
+		expected := 0.25 * math.Sin(2*math.Pi*440*(float64(i)+1.0/3)/16000)
+		assert.InDelta(t, expected, sample, 0.01, i)
+	}
+
+	// Части произвольной длины дают ту же запись
+	resampler, _ = NewResampler(FormatF32LE, 48000, 2)
+	var parts []byte
+	for start := 0; start < len(input); start += 1001 {
+		parts = append(parts, resampler.Write(input[start:min(start+1001, len(input))])...)
+	}
+	assert.Equal(t, whole, parts)
+
+	// Повышение частоты: 8 кГц, 16 бит — отсчеты между исходными интерполируются
+	resampler, err = NewResampler(FormatS16LE, 8000, 1)
+	assert.NoError(t, err)
+	var low []byte
+	for _, value := range []int16{0, 1000, 2000, 3000} {
+		low = binary.LittleEndian.AppendUint16(low, uint16(value))
+	}
+	high := resampler.Write(low)
+	var values []int16
+	for i := 0; i < len(high); i += 2 {
+		values = append(values, int16(binary.LittleEndian.Uint16(high[i:])))
+	}
+	assert.Equal(t, []int16{0, 500, 1000, 1500, 2000, 2500}, values)
+
+	for _, config := range []struct {
+		format               string
+		sampleRate, channels int
+	}{{"opus", 48000, 1}, {FormatS16LE, 0, 1}, {FormatS16LE, 16000, 0}} {
+		_, err := NewResampler(config.format, config.sampleRate, config.channels)
+		assert.Error(t, err, config.format)
+	}
+}
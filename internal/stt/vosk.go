@@ -0,0 +1,84 @@
+package stt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/ztrue/tracerr"
+)
+
+const (
+	defaultVoskURL = "ws://localhost:2700"
+	voskChunkSize  = 8000 // 0,25 секунды записи в одном сообщении
+)
+
+// Vosk распознает речь сервером vosk-server. Модель, язык и число потоков
+// задаются при запуске сервера, который работает без сети.
+type Vosk struct {
+	serverURL string
+}
+
+// voskConfig — первое сообщение сессии распознавания
+type voskConfig struct {
+	Config struct {
+		SampleRate int `json:"sample_rate"`
+	} `json:"config"`
+}
+
+// voskResult — ответ сервера на очередную часть записи. Пока фраза не
+// закончена, приходит только partial.
+type voskResult struct {
+	Text    string `json:"text"`
+	Partial string `json:"partial"`
+}
+
+// Recognize передает запись серверу частями и собирает законченные фразы
+func (v *Vosk) Recognize(ctx context.Context, pcm []byte) (string, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, v.serverURL, nil)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+	defer conn.Close()
+
+	// Прерываем чтение, если контекст отменен
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var config voskConfig
+	config.Config.SampleRate = SampleRate
+	if err := conn.WriteJSON(config); err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	// Сервер отвечает на каждое сообщение
+	var phrases []string
+	exchange := func(send func() error) error {
+		if err := send(); err != nil {
+			return tracerr.Wrap(err)
+		}
+		var result voskResult
+		if err := conn.ReadJSON(&result); err != nil {
+			return tracerr.Wrap(err)
+		}
+		if result.Text != "" {
+			phrases = append(phrases, result.Text)
+		}
+		return nil
+	}
+
+	for start := 0; start < len(pcm); start += voskChunkSize {
+		chunk := pcm[start:min(start+voskChunkSize, len(pcm))]
+		err := exchange(func() error { return conn.WriteMessage(websocket.BinaryMessage, chunk) })
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Конец записи: сервер возвращает оставшуюся фразу
+	err = exchange(func() error { return conn.WriteMessage(websocket.TextMessage, []byte(`{"eof" : 1}`)) })
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(phrases, " "), nil
+}
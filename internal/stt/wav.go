@@ -0,0 +1,95 @@
+package stt
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/ztrue/tracerr"
+)
+
+// wavHeader — заголовок WAV-файла с PCM-записью без сжатия
+type wavHeader struct {
+	RIFF          [4]byte
+	FileSize      uint32
+	WAVE          [4]byte
+	Fmt           [4]byte
+	FmtSize       uint32
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// WriteWAV записывает PCM-запись (моно, 16 бит) в формате WAV
+func WriteWAV(w io.Writer, pcm []byte, sampleRate int) error {
+	header := wavHeader{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		FileSize:      uint32(len(pcm) + 36),
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1, // PCM
+		Channels:      1,
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * 2),
+		BlockAlign:    2,
+		BitsPerSample: 16,
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return tracerr.Wrap(err)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		return tracerr.Wrap(err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(pcm))); err != nil {
+		return tracerr.Wrap(err)
+	}
+	_, err := w.Write(pcm)
+	return tracerr.Wrap(err)
+}
+
+// ReadWAV читает WAV-файл с PCM-записью (моно, 16 бит) и возвращает
+// запись и частоту дискретизации. Дополнительные блоки вроде LIST
+// пропускаются.
+func ReadWAV(r io.Reader) ([]byte, int, error) {
+	var header wavHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, 0, tracerr.Wrap(err)
+	}
+	if string(header.RIFF[:]) != "RIFF" || string(header.WAVE[:]) != "WAVE" || string(header.Fmt[:]) != "fmt " {
+		return nil, 0, tracerr.New("Файл не в формате WAV")
+	}
+	if header.AudioFormat != 1 || header.Channels != 1 || header.BitsPerSample != 16 {
+		return nil, 0, tracerr.New("Поддерживаются только WAV-файлы PCM, моно, 16 бит")
+	}
+	if header.FmtSize > 16 {
+		if _, err := io.CopyN(io.Discard, r, int64(header.FmtSize-16)); err != nil {
+			return nil, 0, tracerr.Wrap(err)
+		}
+	}
+
+	for {
+		var id [4]byte
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+			return nil, 0, tracerr.Wrap(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, 0, tracerr.Wrap(err)
+		}
+		if string(id[:]) != "data" {
+			if _, err := io.CopyN(io.Discard, r, int64(size+size%2)); err != nil {
+				return nil, 0, tracerr.Wrap(err)
+			}
+			continue
+		}
+
+		pcm := make([]byte, size)
+		if _, err := io.ReadFull(r, pcm); err != nil {
+			return nil, 0, tracerr.Wrap(err)
+		}
+		return pcm, int(header.SampleRate), nil
+	}
+}
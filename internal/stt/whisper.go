@@ -0,0 +1,65 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+const defaultWhisperCommand = "whisper-cli"
+
+// nonSpeech находит пометки whisper.cpp вместо речи: [BLANK_AUDIO], (музыка)
+var nonSpeech = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)`)
+
+// WhisperCpp распознает речь программой whisper.cpp. Для каждой фразы
+// запускается отдельный процесс, поэтому сеть не нужна.
+type WhisperCpp struct {
+	command  string
+	model    string
+	language string
+	threads  int
+}
+
+// Recognize сохраняет запись во временный WAV-файл и распознает его
+func (w *WhisperCpp) Recognize(ctx context.Context, pcm []byte) (string, error) {
+	tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("kot_stt_%d.wav", time.Now().UnixNano()))
+	defer os.Remove(tmpFile)
+
+	file, err := os.Create(tmpFile)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+	err = WriteWAV(file, pcm, SampleRate)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+
+	// -nt убирает отметки времени, -np — служебный вывод: в stdout остается
+	// только распознанный текст
+	cmd := exec.CommandContext(ctx, w.command,
+		"-m", w.model,
+		"-f", tmpFile,
+		"-l", w.language,
+		"-t", strconv.Itoa(w.threads),
+		"-nt", "-np",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", tracerr.New(fmt.Sprintf("Ошибка whisper.cpp: %v: %s", err, strings.TrimSpace(stderr.String())))
+	}
+
+	text := nonSpeech.ReplaceAllString(string(output), " ")
+	return strings.Join(strings.Fields(text), " "), nil
+}
@@ -0,0 +1,343 @@
+//go:build linux
+
+package system
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// linuxBackend управляет рабочим столом Linux через стандартные утилиты:
+// xdg-open, .desktop-файлы, wpctl/pactl для звука и grim/scrot/import
+// для снимков экрана
+type linuxBackend struct {
+	run      func(name string, args ...string) (string, error) // выполняет утилиту и возвращает ее вывод
+	start    func(name string, args ...string) error           // запускает программу без ожидания
+	lookPath func(file string) (string, error)
+	getenv   func(key string) string
+}
+
+func newBackend() Backend {
+	return &linuxBackend{
+		run:      runTool,
+		start:    startProgram,
+		lookPath: exec.LookPath,
+		getenv:   os.Getenv,
+	}
+}
+
+// runTool выполняет утилиту и возвращает ее вывод
+func runTool(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return string(output), tracerr.New(fmt.Sprintf("%s: %v: %s", name, err, strings.TrimSpace(string(output))))
+	}
+	return string(output), nil
+}
+
+// startProgram запускает программу и не ждет ее завершения
+func startProgram(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return tracerr.Wrap(err)
+	}
+	// Забираем код завершения, чтобы не оставлять зомби-процессов
+	go cmd.Wait()
+	return nil
+}
+
+// OpenApplication запускает приложение по пути, по имени исполняемого файла
+// в PATH или по названию из .desktop-файла ("калькулятор", "Firefox")
+func (b *linuxBackend) OpenApplication(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return tracerr.New("Не указано приложение")
+	}
+
+	if strings.Contains(name, "/") {
+		if _, err := os.Stat(name); err == nil {
+			return b.start(name)
+		}
+	}
+
+	lower := strings.ToLower(name)
+	for _, candidate := range []string{name, lower, strings.ReplaceAll(lower, " ", "-")} {
+		if path, ok := findInPath(candidate, b.getenv("PATH")); ok {
+			return b.start(path)
+		}
+	}
+
+	if entry, ok := findDesktopEntry(lower, applicationDirs(b.getenv)); ok {
+		args := execArgs(entry.Exec)
+		if len(args) == 0 {
+			return tracerr.New(fmt.Sprintf("Некорректная команда запуска в %s", entry.Path))
+		}
+		return b.start(args[0], args[1:]...)
+	}
+
+	return tracerr.New(fmt.Sprintf("Приложение %s не найдено", name))
+}
+
+// Launch запускает приложение из каталога
+func (b *linuxBackend) Launch(command []string) error {
+	if len(command) == 0 {
+		return tracerr.New("Не указана команда запуска")
+	}
+	return b.start(command[0], command[1:]...)
+}
+
+// scanApplications собирает каталог приложений из .desktop-файлов и PATH
+func scanApplications() []AppEntry {
+	return mergeApplications(
+		scanDesktopDirs(applicationDirs(os.Getenv)),
+		scanPathDirs(filepath.SplitList(os.Getenv("PATH")), nil),
+	)
+}
+
+// findInPath ищет исполняемый файл в каталогах PATH, разделенных ":"
+func findInPath(file, pathEnv string) (string, bool) {
+	if file == "" || strings.Contains(file, "/") {
+		return "", false
+	}
+	for _, dir := range strings.Split(pathEnv, ":") {
+		if dir == "" {
+			dir = "."
+		}
+		path := filepath.Join(dir, file)
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// findDesktopEntry ищет приложение по названию. Точное совпадение названия
+// или имени файла важнее частичного; при равенстве побеждает каталог,
+// который идет раньше.
+func findDesktopEntry(query string, dirs []string) (desktopEntry, bool) {
+	var best desktopEntry
+	bestScore := 0
+	seen := make(map[string]bool)
+
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".desktop") {
+				return nil
+			}
+			// Файл из пользовательского каталога перекрывает системный
+			id := strings.TrimSuffix(filepath.Base(path), ".desktop")
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+
+			entry, ok := parseDesktopFile(path)
+			if !ok {
+				return nil
+			}
+			if score := matchDesktopEntry(entry, query); score > bestScore {
+				best, bestScore = entry, score
+			}
+			return nil
+		})
+	}
+
+	return best, bestScore > 0
+}
+
+// matchDesktopEntry оценивает совпадение приложения с названием
+func matchDesktopEntry(entry desktopEntry, query string) int {
+	// Идентификатор вида org.gnome.Calculator совпадает с "calculator"
+	id := strings.ToLower(entry.ID)
+	if id == query || strings.HasSuffix(id, "."+query) {
+		return 3
+	}
+
+	score := 0
+	for _, name := range append(entry.Names, entry.Keywords...) {
+		if name == query {
+			return 3
+		}
+		if strings.Contains(name, query) {
+			score = 2
+		}
+	}
+	if score == 0 && strings.Contains(id, query) {
+		score = 1
+	}
+	return score
+}
+
+// OpenURL открывает адрес через xdg-open
+func (b *linuxBackend) OpenURL(url string) error {
+	if _, err := b.lookPath("xdg-open"); err != nil {
+		return notSupported("открытие ссылок: не найден xdg-open")
+	}
+	return b.start("xdg-open", url)
+}
+
+// mixer возвращает утилиту управления звуком: wpctl для PipeWire
+// или pactl для PulseAudio (и pipewire-pulse)
+func (b *linuxBackend) mixer() (string, error) {
+	for _, tool := range []string{"wpctl", "pactl"} {
+		if _, err := b.lookPath(tool); err == nil {
+			return tool, nil
+		}
+	}
+	return "", notSupported("управление звуком: не найдены wpctl или pactl")
+}
+
+// GetVolume возвращает громкость устройства вывода по умолчанию
+func (b *linuxBackend) GetVolume() (int, error) {
+	tool, err := b.mixer()
+	if err != nil {
+		return 0, err
+	}
+
+	if tool == "wpctl" {
+		output, err := b.run("wpctl", "get-volume", "@DEFAULT_AUDIO_SINK@")
+		if err != nil {
+			return 0, err
+		}
+		volume, _, err := parseWpctlVolume(output)
+		return volume, err
+	}
+
+	output, err := b.run("pactl", "get-sink-volume", "@DEFAULT_SINK@")
+	if err != nil {
+		return 0, err
+	}
+	return parsePactlVolume(output)
+}
+
+// SetVolume устанавливает громкость устройства вывода по умолчанию
+func (b *linuxBackend) SetVolume(level int) error {
+	tool, err := b.mixer()
+	if err != nil {
+		return err
+	}
+
+	if tool == "wpctl" {
+		_, err = b.run("wpctl", "set-volume", "@DEFAULT_AUDIO_SINK@", fmt.Sprintf("%.2f", float64(level)/100))
+	} else {
+		_, err = b.run("pactl", "set-sink-volume", "@DEFAULT_SINK@", fmt.Sprintf("%d%%", level))
+	}
+	return err
+}
+
+// IsMuted проверяет, выключен ли звук устройства вывода по умолчанию
+func (b *linuxBackend) IsMuted() (bool, error) {
+	tool, err := b.mixer()
+	if err != nil {
+		return false, err
+	}
+
+	if tool == "wpctl" {
+		output, err := b.run("wpctl", "get-volume", "@DEFAULT_AUDIO_SINK@")
+		if err != nil {
+			return false, err
+		}
+		_, muted, err := parseWpctlVolume(output)
+		return muted, err
+	}
+
+	output, err := b.run("pactl", "get-sink-mute", "@DEFAULT_SINK@")
+	if err != nil {
+		return false, err
+	}
+	return parsePactlMute(output)
+}
+
+// SetMute выключает или включает звук устройства вывода по умолчанию
+func (b *linuxBackend) SetMute(muted bool) error {
+	tool, err := b.mixer()
+	if err != nil {
+		return err
+	}
+
+	value := "0"
+	if muted {
+		value = "1"
+	}
+	if tool == "wpctl" {
+		_, err = b.run("wpctl", "set-mute", "@DEFAULT_AUDIO_SINK@", value)
+	} else {
+		_, err = b.run("pactl", "set-sink-mute", "@DEFAULT_SINK@", value)
+	}
+	return err
+}
+
+var (
+	wpctlVolumePattern = regexp.MustCompile(`Volume:\s*([0-9.]+)`)
+	pactlVolumePattern = regexp.MustCompile(`(\d+)%`)
+	pactlMutePattern   = regexp.MustCompile(`Mute:\s*(yes|no)`)
+)
+
+// parseWpctlVolume разбирает вывод "Volume: 0.40 [MUTED]"
+func parseWpctlVolume(output string) (int, bool, error) {
+	match := wpctlVolumePattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0, false, tracerr.New(fmt.Sprintf("Неожиданный ответ wpctl: %s", strings.TrimSpace(output)))
+	}
+	volume, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false, tracerr.Wrap(err)
+	}
+	return int(volume*100 + 0.5), strings.Contains(output, "[MUTED]"), nil
+}
+
+// parsePactlVolume берет громкость первого канала из вывода
+// "Volume: front-left: 26214 /  40% / -23.88 dB, ..."
+func parsePactlVolume(output string) (int, error) {
+	match := pactlVolumePattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0, tracerr.New(fmt.Sprintf("Неожиданный ответ pactl: %s", strings.TrimSpace(output)))
+	}
+	volume, _ := strconv.Atoi(match[1])
+	return volume, nil
+}
+
+// parsePactlMute разбирает вывод "Mute: yes"
+func parsePactlMute(output string) (bool, error) {
+	match := pactlMutePattern.FindStringSubmatch(output)
+	if match == nil {
+		return false, tracerr.New(fmt.Sprintf("Неожиданный ответ pactl: %s", strings.TrimSpace(output)))
+	}
+	return match[1] == "yes", nil
+}
+
+// TakeScreenshot сохраняет снимок экрана первой найденной утилитой:
+// grim для Wayland, scrot или import из ImageMagick для X11
+func (b *linuxBackend) TakeScreenshot(filePath string) error {
+	tools := [][]string{
+		{"scrot", "-o", filePath},
+		{"import", "-window", "root", filePath},
+	}
+	grim := []string{"grim", filePath}
+	if b.getenv("WAYLAND_DISPLAY") != "" {
+		tools = append([][]string{grim}, tools...)
+	} else {
+		tools = append(tools, grim)
+	}
+
+	for _, tool := range tools {
+		if _, err := b.lookPath(tool[0]); err != nil {
+			continue
+		}
+		_, err := b.run(tool[0], tool[1:]...)
+		return err
+	}
+	return notSupported("снимки экрана: не найдены grim, scrot или import")
+}
+
+// Close ничего не освобождает: утилиты запускаются на время операции
+func (b *linuxBackend) Close() {}
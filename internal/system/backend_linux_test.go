@@ -0,0 +1,191 @@
+//go:build linux
+
+package system
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testLinuxBackend создает бэкенд с подмененными утилитами: доступны только
+// tools, а ответы на команды берутся из outputs
+func testLinuxBackend(env map[string]string, tools []string, outputs map[string]string) (*linuxBackend, *[]string) {
+	var calls []string
+	backend := &linuxBackend{
+		run: func(name string, args ...string) (string, error) {
+			call := strings.Join(append([]string{name}, args...), " ")
+			calls = append(calls, call)
+			return outputs[call], nil
+		},
+		start: func(name string, args ...string) error {
+			calls = append(calls, "start "+strings.Join(append([]string{name}, args...), " "))
+			return nil
+		},
+		lookPath: func(file string) (string, error) {
+			for _, tool := range tools {
+				if tool == file {
+					return "/usr/bin/" + file, nil
+				}
+			}
+			return "", errors.New("not found")
+		},
+		getenv: func(key string) string { return env[key] },
+	}
+	return backend, &calls
+}
+
+func TestLinuxVolumeWpctl(t *testing.T) {
+	backend, calls := testLinuxBackend(nil, []string{"wpctl", "pactl"}, map[string]string{
+		"wpctl get-volume @DEFAULT_AUDIO_SINK@": "Volume: 0.40 [MUTED]\n",
+	})
+
+	volume, err := backend.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 40, volume)
+
+	muted, err := backend.IsMuted()
+	assert.NoError(t, err)
+	assert.True(t, muted)
+
+	assert.NoError(t, backend.SetVolume(55))
+	assert.NoError(t, backend.SetMute(false))
+	assert.Equal(t, []string{
+		"wpctl get-volume @DEFAULT_AUDIO_SINK@",
+		"wpctl get-volume @DEFAULT_AUDIO_SINK@",
+		"wpctl set-volume @DEFAULT_AUDIO_SINK@ 0.55",
+		"wpctl set-mute @DEFAULT_AUDIO_SINK@ 0",
+	}, *calls)
+}
+
+func TestLinuxVolumePactl(t *testing.T) {
+	backend, calls := testLinuxBackend(nil, []string{"pactl"}, map[string]string{
+		"pactl get-sink-volume @DEFAULT_SINK@": "Volume: front-left: 26214 /  40% / -23.88 dB,   front-right: 26214 /  40% / -23.88 dB\n",
+		"pactl get-sink-mute @DEFAULT_SINK@":   "Mute: no\n",
+	})
+
+	volume, err := backend.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 40, volume)
+
+	muted, err := backend.IsMuted()
+	assert.NoError(t, err)
+	assert.False(t, muted)
+
+	assert.NoError(t, backend.SetVolume(70))
+	assert.NoError(t, backend.SetMute(true))
+	assert.Equal(t, "pactl set-sink-volume @DEFAULT_SINK@ 70%", (*calls)[2])
+	assert.Equal(t, "pactl set-sink-mute @DEFAULT_SINK@ 1", (*calls)[3])
+}
+
+func TestLinuxNotSupported(t *testing.T) {
+	// Без утилит операции возвращают понятную ошибку
+	backend, _ := testLinuxBackend(nil, nil, nil)
+
+	_, err := backend.GetVolume()
+	assert.ErrorIs(t, err, ErrNotSupported)
+	assert.ErrorIs(t, backend.SetMute(true), ErrNotSupported)
+	assert.ErrorIs(t, backend.OpenURL("https://example.com"), ErrNotSupported)
+	assert.ErrorIs(t, backend.TakeScreenshot("/tmp/screen.png"), ErrNotSupported)
+}
+
+func TestLinuxScreenshot(t *testing.T) {
+	// В X11 используется scrot, если он установлен
+	backend, calls := testLinuxBackend(nil, []string{"grim", "scrot"}, nil)
+	assert.NoError(t, backend.TakeScreenshot("/tmp/a.png"))
+	assert.Equal(t, []string{"scrot -o /tmp/a.png"}, *calls)
+
+	// В Wayland первым пробуется grim
+	backend, calls = testLinuxBackend(map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, []string{"grim", "scrot"}, nil)
+	assert.NoError(t, backend.TakeScreenshot("/tmp/b.png"))
+	assert.Equal(t, []string{"grim /tmp/b.png"}, *calls)
+
+	// ImageMagick как запасной вариант
+	backend, calls = testLinuxBackend(nil, []string{"import"}, nil)
+	assert.NoError(t, backend.TakeScreenshot("/tmp/c.png"))
+	assert.Equal(t, []string{"import -window root /tmp/c.png"}, *calls)
+}
+
+func TestLinuxOpenURL(t *testing.T) {
+	backend, calls := testLinuxBackend(nil, []string{"xdg-open"}, nil)
+	assert.NoError(t, backend.OpenURL("https://example.com"))
+	assert.Equal(t, []string{"start xdg-open https://example.com"}, *calls)
+}
+
+func TestLinuxOpenApplication(t *testing.T) {
+	dir := t.TempDir()
+
+	// Исполняемый файл в одном из каталогов PATH
+	binDir := filepath.Join(dir, "bin")
+	assert.NoError(t, os.MkdirAll(binDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "google-chrome"), []byte("#!/bin/sh\n"), 0755))
+
+	// Приложения в каталоге .desktop-файлов пользователя
+	appsDir := filepath.Join(dir, "share", "applications")
+	assert.NoError(t, os.MkdirAll(appsDir, 0755))
+	writeDesktop := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(appsDir, name), []byte(content), 0644))
+	}
+	writeDesktop("org.gnome.Calculator.desktop", `[Desktop Entry]
+Name=Calculator
+Name[ru]=Калькулятор
+Name[de]=Rechner
+Exec=gnome-calculator %U
+Type=Application
+
+[Desktop Action new]
+Name=New Window
+Exec=gnome-calculator --new-window
+`)
+	writeDesktop("firefox.desktop", `[Desktop Entry]
+Name=Firefox
+GenericName[ru]=Веб-браузер
+Keywords=Internet;WWW;Browser;
+Exec="/opt/firefox/firefox" --name "Firefox Web" %u
+Type=Application
+`)
+	writeDesktop("hidden.desktop", `[Desktop Entry]
+Name=Браузер скрытый
+Exec=hidden
+NoDisplay=true
+Type=Application
+`)
+
+	env := map[string]string{
+		"PATH":          "/nonexistent:" + binDir,
+		"XDG_DATA_HOME": filepath.Join(dir, "share"),
+		"XDG_DATA_DIRS": filepath.Join(dir, "none"),
+	}
+
+	tests := []struct {
+		name string
+		call string
+	}{
+		{"google chrome", "start " + filepath.Join(binDir, "google-chrome")},
+		{"Калькулятор", "start gnome-calculator"},
+		{"calculator", "start gnome-calculator"},
+		{"браузер", "start /opt/firefox/firefox --name Firefox Web"},
+		{"browser", "start /opt/firefox/firefox --name Firefox Web"},
+	}
+	for _, tt := range tests {
+		backend, calls := testLinuxBackend(env, nil, nil)
+		if assert.NoError(t, backend.OpenApplication(tt.name), tt.name) {
+			assert.Equal(t, []string{tt.call}, *calls, tt.name)
+		}
+	}
+
+	backend, _ := testLinuxBackend(env, nil, nil)
+	assert.Error(t, backend.OpenApplication("rechner"))
+	assert.Error(t, backend.OpenApplication("hidden"))
+}
+
+func TestExecArgs(t *testing.T) {
+	assert.Equal(t, []string{"gimp", "--new"}, execArgs("gimp --new %F"))
+	assert.Equal(t, []string{"/opt/My App/app", "--title", "100%"}, execArgs(`"/opt/My App/app" --title 100%%`))
+	assert.Equal(t, []string{"sh", "-c", "echo $HOME"}, execArgs(`sh -c "echo \$HOME"`))
+	assert.Empty(t, execArgs(""))
+}
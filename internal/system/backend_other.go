@@ -0,0 +1,50 @@
+//go:build !windows && !linux
+
+package system
+
+// unsupportedBackend используется на платформах без собственной реализации:
+// все платформенные операции возвращают ErrNotSupported
+type unsupportedBackend struct{}
+
+func newBackend() Backend {
+	return unsupportedBackend{}
+}
+
+func (unsupportedBackend) OpenApplication(name string) error {
+	return notSupported("запуск приложений")
+}
+
+func (unsupportedBackend) Launch(command []string) error {
+	return notSupported("запуск приложений")
+}
+
+func (unsupportedBackend) OpenURL(url string) error {
+	return notSupported("открытие ссылок")
+}
+
+func (unsupportedBackend) GetVolume() (int, error) {
+	return 0, notSupported("управление громкостью")
+}
+
+func (unsupportedBackend) SetVolume(level int) error {
+	return notSupported("управление громкостью")
+}
+
+func (unsupportedBackend) IsMuted() (bool, error) {
+	return false, notSupported("управление звуком")
+}
+
+func (unsupportedBackend) SetMute(muted bool) error {
+	return notSupported("управление звуком")
+}
+
+func (unsupportedBackend) TakeScreenshot(filePath string) error {
+	return notSupported("снимки экрана")
+}
+
+func (unsupportedBackend) Close() {}
+
+// scanApplications возвращает пустой каталог: запуск приложений не поддерживается
+func scanApplications() []AppEntry {
+	return nil
+}
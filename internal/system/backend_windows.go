@@ -0,0 +1,217 @@
+//go:build windows
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+	"github.com/ztrue/tracerr"
+)
+
+// windowsBackend управляет звуком через WASAPI, а приложениями и снимками
+// экрана — через стандартные средства Windows
+type windowsBackend struct {
+	initializedOLE bool
+}
+
+func newBackend() Backend {
+	return &windowsBackend{}
+}
+
+// OpenApplication ищет приложение по пути или в PATH, в том числе с расширением .exe
+func (b *windowsBackend) OpenApplication(appPath string) error {
+	// Проверяем, существует ли файл
+	if _, err := os.Stat(appPath); os.IsNotExist(err) {
+		// Пробуем найти приложение в PATH
+		pathEnv := os.Getenv("PATH")
+		paths := strings.Split(pathEnv, ";")
+
+		found := false
+		for _, path := range paths {
+			possiblePath := filepath.Join(path, appPath)
+			if _, err := os.Stat(possiblePath); !os.IsNotExist(err) {
+				appPath = possiblePath
+				found = true
+				break
+			}
+
+			// Проверяем с расширением .exe
+			if !strings.HasSuffix(appPath, ".exe") {
+				possiblePath = filepath.Join(path, appPath+".exe")
+				if _, err := os.Stat(possiblePath); !os.IsNotExist(err) {
+					appPath = possiblePath
+					found = true
+					break
+				}
+			}
+		}
+
+		if !found {
+			return tracerr.New(fmt.Sprintf("Приложение %s не найдено", appPath))
+		}
+	}
+
+	cmd := exec.Command(appPath)
+	err := cmd.Start()
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	return nil
+}
+
+// Launch запускает приложение из каталога. Ярлыки .lnk открываются
+// через оболочку, как при запуске из меню "Пуск".
+func (b *windowsBackend) Launch(command []string) error {
+	if len(command) == 0 {
+		return tracerr.New("Не указана команда запуска")
+	}
+
+	var cmd *exec.Cmd
+	if strings.EqualFold(filepath.Ext(command[0]), ".lnk") {
+		cmd = exec.Command("cmd", "/c", "start", "", command[0])
+	} else {
+		cmd = exec.Command(command[0], command[1:]...)
+	}
+	if err := cmd.Start(); err != nil {
+		return tracerr.Wrap(err)
+	}
+	return nil
+}
+
+// scanApplications собирает каталог приложений из ярлыков меню "Пуск"
+// и исполняемых файлов PATH
+func scanApplications() []AppEntry {
+	return mergeApplications(
+		scanStartMenu(startMenuDirs()),
+		scanPathDirs(filepath.SplitList(os.Getenv("PATH")), []string{".exe"}),
+	)
+}
+
+// startMenuDirs возвращает каталоги меню "Пуск" пользователя и общий
+func startMenuDirs() []string {
+	var dirs []string
+	for _, root := range []string{os.Getenv("APPDATA"), os.Getenv("ProgramData")} {
+		if root != "" {
+			dirs = append(dirs, filepath.Join(root, "Microsoft", "Windows", "Start Menu", "Programs"))
+		}
+	}
+	return dirs
+}
+
+// OpenURL открывает URL через обработчик протоколов Windows
+func (b *windowsBackend) OpenURL(url string) error {
+	cmd := exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	if err := cmd.Start(); err != nil {
+		return tracerr.Wrap(err)
+	}
+	return nil
+}
+
+func (b *windowsBackend) getAudioEndpointVolume() (*wca.IAudioEndpointVolume, error) {
+	if !b.initializedOLE {
+		if err := ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED); err != nil {
+			return nil, err
+		}
+		b.initializedOLE = true
+	}
+
+	var mmde *wca.IMMDeviceEnumerator
+	if err := wca.CoCreateInstance(wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL, wca.IID_IMMDeviceEnumerator, &mmde); err != nil {
+		return nil, err
+	}
+	defer mmde.Release()
+
+	var mmd *wca.IMMDevice
+	if err := mmde.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &mmd); err != nil {
+		return nil, err
+	}
+	defer mmd.Release()
+
+	var aev *wca.IAudioEndpointVolume
+	if err := mmd.Activate(wca.IID_IAudioEndpointVolume, wca.CLSCTX_ALL, nil, &aev); err != nil {
+		return nil, err
+	}
+
+	return aev, nil
+}
+
+// SetVolume устанавливает громкость устройства вывода по умолчанию
+func (b *windowsBackend) SetVolume(level int) error {
+	aev, err := b.getAudioEndpointVolume()
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	defer aev.Release()
+
+	return tracerr.Wrap(aev.SetMasterVolumeLevelScalar(float32(level)/100.0, nil))
+}
+
+// GetVolume возвращает громкость устройства вывода по умолчанию
+func (b *windowsBackend) GetVolume() (int, error) {
+	aev, err := b.getAudioEndpointVolume()
+	if err != nil {
+		return 0, tracerr.Wrap(err)
+	}
+	defer aev.Release()
+
+	var level float32
+	if err := aev.GetMasterVolumeLevelScalar(&level); err != nil {
+		return 0, tracerr.Wrap(err)
+	}
+	return int(level*100 + 0.5), nil
+}
+
+// IsMuted проверяет, выключен ли звук устройства вывода по умолчанию
+func (b *windowsBackend) IsMuted() (bool, error) {
+	aev, err := b.getAudioEndpointVolume()
+	if err != nil {
+		return false, tracerr.Wrap(err)
+	}
+	defer aev.Release()
+
+	var muted bool
+	if err := aev.GetMute(&muted); err != nil {
+		return false, tracerr.Wrap(err)
+	}
+	return muted, nil
+}
+
+// SetMute выключает или включает звук устройства вывода по умолчанию
+func (b *windowsBackend) SetMute(muted bool) error {
+	aev, err := b.getAudioEndpointVolume()
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	defer aev.Release()
+
+	return tracerr.Wrap(aev.SetMute(muted, nil))
+}
+
+// TakeScreenshot делает снимок экрана через буфер обмена и PowerShell
+func (b *windowsBackend) TakeScreenshot(filePath string) error {
+	cmd := exec.Command("powershell", "-command", fmt.Sprintf(
+		"Add-Type -AssemblyName System.Windows.Forms; "+
+			"[System.Windows.Forms.SendKeys]::SendWait('{PRTSC}'); "+
+			"$img = [System.Windows.Forms.Clipboard]::GetImage(); "+
+			"$img.Save('%s');", filePath))
+
+	if err := cmd.Run(); err != nil {
+		return tracerr.Wrap(err)
+	}
+	return nil
+}
+
+// Close освобождает COM
+func (b *windowsBackend) Close() {
+	if b.initializedOLE {
+		ole.CoUninitialize()
+		b.initializedOLE = false
+	}
+}
@@ -0,0 +1,616 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/intent"
+)
+
+// Источники записей каталога приложений
+const (
+	AppSourceDesktop   = "desktop"   // .desktop-файлы XDG
+	AppSourceStartMenu = "startmenu" // ярлыки .lnk меню "Пуск"
+	AppSourcePath      = "path"      // исполняемые файлы из PATH
+)
+
+// DefaultCatalogRefresh — период обновления каталога приложений по умолчанию
+const DefaultCatalogRefresh = time.Hour
+
+// Пороги нечеткого поиска приложений
+const (
+	minAppScore       = 0.6  // минимальная оценка совпадения
+	appScoreMargin    = 0.04 // приложения с оценкой в пределах отступа от лучшей считаются равными
+	maxAppCandidates  = 5    // сколько вариантов предлагать для уточнения
+	keywordScoreRatio = 0.85 // ключевые слова и общее название весят меньше названия
+)
+
+// AppEntry описывает установленное приложение
+type AppEntry struct {
+	ID       string   `json:"id"`                 // имя .desktop-файла, ярлыка или исполняемого файла
+	Name     string   `json:"name"`               // отображаемое название
+	Names    []string `json:"names,omitempty"`    // названия, включая локализованные
+	Keywords []string `json:"keywords,omitempty"` // общее название и ключевые слова
+	Command  []string `json:"command"`            // команда запуска
+	Source   string   `json:"source"`
+}
+
+// AmbiguousAppError возвращается, если названию соответствует несколько приложений
+type AmbiguousAppError struct {
+	Query      string
+	Candidates []AppEntry
+}
+
+func (e *AmbiguousAppError) Error() string {
+	names := make([]string, len(e.Candidates))
+	for i, candidate := range e.Candidates {
+		names[i] = candidate.Name
+	}
+	return fmt.Sprintf("Найдено несколько приложений для \"%s\": %s", e.Query, strings.Join(names, ", "))
+}
+
+// Catalog хранит список установленных приложений и ищет в нем приложение
+// по произнесенному названию. Список сохраняется в файл кэша и обновляется
+// в фоне.
+type Catalog struct {
+	cachePath string
+	aliases   map[string][]string
+	scan      func() []AppEntry
+
+	entries []AppEntry
+	updated time.Time
+	mutex   sync.RWMutex
+
+	stop chan struct{}
+}
+
+// catalogCache — формат файла кэша каталога
+type catalogCache struct {
+	Updated time.Time  `json:"updated"`
+	Entries []AppEntry `json:"entries"`
+}
+
+// NewCatalog создает каталог приложений. Кэш хранится в cachePath
+// (пусто — без кэша). aliases задает пользовательские названия:
+// "браузер" → ["firefox", "chrome"]; используется первое найденное приложение.
+func NewCatalog(cachePath string, aliases map[string][]string) *Catalog {
+	normalized := make(map[string][]string, len(aliases))
+	for alias, targets := range aliases {
+		if alias = normalizeAppName(alias); alias != "" {
+			normalized[alias] = targets
+		}
+	}
+	return &Catalog{
+		cachePath: cachePath,
+		aliases:   normalized,
+		scan:      scanApplications,
+	}
+}
+
+// Load загружает каталог из файла кэша. Отсутствие кэша не считается ошибкой.
+func (c *Catalog) Load() error {
+	if c.cachePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.cachePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	var cache catalogCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	c.mutex.Lock()
+	c.entries = cache.Entries
+	c.updated = cache.Updated
+	c.mutex.Unlock()
+	return nil
+}
+
+// Refresh заново собирает список приложений и сохраняет его в кэш
+func (c *Catalog) Refresh() error {
+	entries := c.scan()
+	updated := time.Now()
+
+	c.mutex.Lock()
+	c.entries = entries
+	c.updated = updated
+	c.mutex.Unlock()
+
+	if c.cachePath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(catalogCache{Updated: updated, Entries: entries}, "", "  ")
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0755); err != nil {
+		return tracerr.Wrap(err)
+	}
+	return tracerr.Wrap(os.WriteFile(c.cachePath, data, 0644))
+}
+
+// StartRefresh обновляет каталог в фоне каждые interval. Если кэш пуст или
+// устарел, первое обновление выполняется сразу.
+func (c *Catalog) StartRefresh(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCatalogRefresh
+	}
+
+	c.mutex.Lock()
+	if c.stop != nil {
+		c.mutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	stale := len(c.entries) == 0 || time.Since(c.updated) >= interval
+	c.mutex.Unlock()
+
+	go func() {
+		refresh := func() {
+			if err := c.Refresh(); err != nil {
+				log.Printf("Ошибка обновления каталога приложений: %v", err)
+			}
+		}
+		if stale {
+			refresh()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refresh()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает фоновое обновление
+func (c *Catalog) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// Entries возвращает копию списка приложений
+func (c *Catalog) Entries() []AppEntry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]AppEntry(nil), c.entries...)
+}
+
+// Updated возвращает время последнего обновления каталога
+func (c *Catalog) Updated() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.updated
+}
+
+// Find ищет приложение по произнесенному названию. Сначала проверяются
+// псевдонимы, затем названия приложений. Возвращает одно приложение,
+// несколько равноценных вариантов для уточнения или ничего.
+func (c *Catalog) Find(query string) []AppEntry {
+	query = normalizeAppName(query)
+	if query == "" {
+		return nil
+	}
+	entries := c.Entries()
+
+	for alias, targets := range c.aliases {
+		if !sameWords(alias, query) {
+			continue
+		}
+		for _, target := range targets {
+			target = normalizeAppName(target)
+			for _, entry := range entries {
+				if entryHasName(entry, target) {
+					return []AppEntry{entry}
+				}
+			}
+		}
+	}
+
+	return MatchApplications(entries, query)
+}
+
+// MatchApplications выбирает из entries приложения, которые лучше всего
+// подходят под название: одно, если оно явно лучше остальных, иначе
+// несколько равноценных вариантов
+func MatchApplications(entries []AppEntry, query string) []AppEntry {
+	query = normalizeAppName(query)
+	if query == "" {
+		return nil
+	}
+
+	type scored struct {
+		entry AppEntry
+		score float64
+	}
+	var matches []scored
+	best := 0.0
+	for _, entry := range entries {
+		score := scoreEntry(entry, query)
+		if score < minAppScore {
+			continue
+		}
+		matches = append(matches, scored{entry, score})
+		if score > best {
+			best = score
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	var result []AppEntry
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if match.score < best-appScoreMargin || len(result) == maxAppCandidates {
+			break
+		}
+		// Одно и то же приложение может встретиться под разными источниками
+		key := strings.ToLower(match.entry.Name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, match.entry)
+	}
+	return result
+}
+
+// scoreEntry оценивает совпадение приложения с названием от 0 до 1
+func scoreEntry(entry AppEntry, query string) float64 {
+	best := 0.0
+	for _, name := range appNames(entry) {
+		if score := scoreName(query, name); score > best {
+			best = score
+		}
+	}
+	for _, keyword := range entry.Keywords {
+		if score := scoreName(query, normalizeAppName(keyword)) * keywordScoreRatio; score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// appNames возвращает нормализованные названия приложения, включая
+// идентификатор и его последнюю часть ("org.gnome.Calculator" → "calculator")
+func appNames(entry AppEntry) []string {
+	names := []string{normalizeAppName(entry.Name), normalizeAppName(entry.ID)}
+	if i := strings.LastIndex(entry.ID, "."); i >= 0 {
+		names = append(names, normalizeAppName(entry.ID[i+1:]))
+	}
+	for _, name := range entry.Names {
+		names = append(names, normalizeAppName(name))
+	}
+	return names
+}
+
+// entryHasName проверяет точное совпадение названия, идентификатора или
+// исполняемого файла приложения
+func entryHasName(entry AppEntry, name string) bool {
+	for _, candidate := range appNames(entry) {
+		if candidate == name {
+			return true
+		}
+	}
+	return len(entry.Command) > 0 && normalizeAppName(executableName(entry.Command[0])) == name
+}
+
+// scoreName сравнивает нормализованные названия. Точное совпадение дает 1,
+// совпадение слов с точностью до окончаний или опечаток — меньше;
+// лишние слова в названии приложения снижают оценку.
+func scoreName(query, name string) float64 {
+	if name == "" {
+		return 0
+	}
+	if query == name {
+		return 1
+	}
+
+	queryWords, nameWords := strings.Fields(query), strings.Fields(name)
+	if len(queryWords) > len(nameWords) {
+		return 0
+	}
+
+	total := 0.0
+	for _, queryWord := range queryWords {
+		best := 0.0
+		for _, nameWord := range nameWords {
+			if similarity := wordSimilarity(queryWord, nameWord); similarity > best {
+				best = similarity
+			}
+		}
+		if best < 0.75 {
+			return 0
+		}
+		total += best
+	}
+
+	coverage := float64(len(queryWords)) / float64(len(nameWords))
+	return total / float64(len(queryWords)) * (0.75 + 0.2*coverage)
+}
+
+// sameWords проверяет, что фразы совпадают с точностью до окончаний
+func sameWords(a, b string) bool {
+	wordsA, wordsB := strings.Fields(a), strings.Fields(b)
+	if len(wordsA) != len(wordsB) {
+		return false
+	}
+	for i := range wordsA {
+		if intent.Stem(wordsA[i]) != intent.Stem(wordsB[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// wordSimilarity сравнивает слова с учетом окончаний, опечаток и
+// написания английских названий русскими буквами ("хром" и "chrome")
+func wordSimilarity(a, b string) float64 {
+	if a == b || intent.Stem(a) == intent.Stem(b) {
+		return 1
+	}
+	similarity := levenshteinRatio(a, b)
+	if ratio := levenshteinRatio(phonetic(a), phonetic(b)); ratio > similarity {
+		similarity = ratio
+	}
+	return similarity
+}
+
+// levenshteinRatio возвращает сходство строк от 0 до 1 по расстоянию Левенштейна
+func levenshteinRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	longest := max(len(ra), len(rb))
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+// translitTable задает латинское написание русских букв
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+	'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "h", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y",
+	'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// phoneticReplacer сводит английские буквосочетания к тому, как их
+// обычно записывают русскими буквами: "steam" и "стим" дают "stim"
+var phoneticReplacer = strings.NewReplacer(
+	"ph", "f", "ch", "h", "kh", "h", "ck", "k", "ea", "i", "ee", "i", "oo", "u",
+	"x", "ks", "c", "k", "q", "k", "w", "v", "y", "i",
+)
+
+// phonetic записывает слово латиницей в упрощенном виде для сравнения
+// по звучанию: без немой "e" на конце и удвоенных букв
+func phonetic(word string) string {
+	var b strings.Builder
+	for _, r := range word {
+		if latin, ok := translitTable[r]; ok {
+			b.WriteString(latin)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	simplified := []rune(phoneticReplacer.Replace(b.String()))
+	if n := len(simplified); n > 3 && simplified[n-1] == 'e' {
+		simplified = simplified[:n-1]
+	}
+	result := simplified[:0]
+	for i, r := range simplified {
+		if i == 0 || r != simplified[i-1] {
+			result = append(result, r)
+		}
+	}
+	return string(result)
+}
+
+// normalizeAppName приводит название к нижнему регистру, заменяет "ё" на "е",
+// а дефисы, точки и прочие разделители — на пробелы
+func normalizeAppName(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// executableName возвращает имя исполняемого файла без каталога и расширения
+func executableName(path string) string {
+	base := filepath.Base(strings.ReplaceAll(path, "\\", "/"))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// scanDesktopDirs собирает приложения из .desktop-файлов. Файл из каталога,
+// который идет раньше, перекрывает одноименный из следующих.
+func scanDesktopDirs(dirs []string) []AppEntry {
+	var entries []AppEntry
+	seen := make(map[string]bool)
+
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".desktop") {
+				return nil
+			}
+			id := strings.TrimSuffix(filepath.Base(path), ".desktop")
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+
+			desktop, ok := parseDesktopFile(path)
+			if !ok {
+				return nil
+			}
+			command := execArgs(desktop.Exec)
+			if len(command) == 0 {
+				return nil
+			}
+			name := desktop.Title
+			if name == "" {
+				name = id
+			}
+			entries = append(entries, AppEntry{
+				ID:       id,
+				Name:     name,
+				Names:    desktop.Names,
+				Keywords: desktop.Keywords,
+				Command:  command,
+				Source:   AppSourceDesktop,
+			})
+			return nil
+		})
+	}
+	return entries
+}
+
+// scanStartMenu собирает ярлыки .lnk из меню "Пуск". Ярлыки удаления
+// программ пропускаются.
+func scanStartMenu(dirs []string) []AppEntry {
+	var entries []AppEntry
+	seen := make(map[string]bool)
+
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".lnk") {
+				return nil
+			}
+			name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			lower := strings.ToLower(name)
+			if seen[lower] || strings.Contains(lower, "uninstall") || strings.Contains(lower, "удал") {
+				return nil
+			}
+			seen[lower] = true
+
+			entries = append(entries, AppEntry{
+				ID:      lower,
+				Name:    name,
+				Command: []string{path},
+				Source:  AppSourceStartMenu,
+			})
+			return nil
+		})
+	}
+	return entries
+}
+
+// scanPathDirs собирает исполняемые файлы из каталогов PATH. Если exts
+// не пуст, берутся только файлы с этими расширениями (".exe"), иначе —
+// файлы с правом на выполнение.
+func scanPathDirs(dirs []string, exts []string) []AppEntry {
+	var entries []AppEntry
+	seen := make(map[string]bool)
+
+	for _, dir := range dirs {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := file.Name()
+			if len(exts) > 0 {
+				ext := strings.ToLower(filepath.Ext(name))
+				if !containsString(exts, ext) {
+					continue
+				}
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			} else {
+				info, err := file.Info()
+				if err != nil || !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+					continue
+				}
+			}
+			if seen[strings.ToLower(name)] {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+
+			entries = append(entries, AppEntry{
+				ID:      strings.ToLower(name),
+				Name:    name,
+				Command: []string{filepath.Join(dir, file.Name())},
+				Source:  AppSourcePath,
+			})
+		}
+	}
+	return entries
+}
+
+// mergeApplications объединяет списки приложений. Исполняемый файл из PATH
+// пропускается, если его уже запускает приложение из предыдущих списков.
+func mergeApplications(primary []AppEntry, fromPath []AppEntry) []AppEntry {
+	launched := make(map[string]bool)
+	for _, entry := range primary {
+		if len(entry.Command) > 0 {
+			launched[strings.ToLower(executableName(entry.Command[0]))] = true
+		}
+	}
+
+	merged := append([]AppEntry(nil), primary...)
+	for _, entry := range fromPath {
+		if !launched[entry.ID] {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package system
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testApps — каталог приложений типичного рабочего стола
+var testApps = []AppEntry{
+	{ID: "firefox", Name: "Firefox", Keywords: []string{"веб-браузер", "internet", "browser"}, Command: []string{"firefox"}, Source: AppSourceDesktop},
+	{ID: "google-chrome", Name: "Google Chrome", Keywords: []string{"веб-браузер", "browser"}, Command: []string{"/usr/bin/google-chrome-stable"}, Source: AppSourceDesktop},
+	{ID: "org.gnome.Calculator", Name: "Калькулятор", Names: []string{"calculator", "калькулятор"}, Command: []string{"gnome-calculator"}, Source: AppSourceDesktop},
+	{ID: "org.telegram.desktop", Name: "Telegram Desktop", Command: []string{"telegram-desktop"}, Source: AppSourceDesktop},
+	{ID: "gedit", Name: "gedit", Command: []string{"/usr/bin/gedit"}, Source: AppSourcePath},
+	{ID: "steam", Name: "Steam", Command: []string{"steam"}, Source: AppSourceDesktop},
+}
+
+func testCatalog(aliases map[string][]string) *Catalog {
+	catalog := NewCatalog("", aliases)
+	catalog.scan = func() []AppEntry { return testApps }
+	catalog.Refresh()
+	return catalog
+}
+
+func names(entries []AppEntry) []string {
+	var result []string
+	for _, entry := range entries {
+		result = append(result, entry.Name)
+	}
+	return result
+}
+
+func TestCatalogFind(t *testing.T) {
+	catalog := testCatalog(map[string][]string{
+		"блокнот": {"notepad", "gedit"},
+	})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Точное название и идентификатор
+		{"Firefox", []string{"Firefox"}},
+		{"калькулятор", []string{"Калькулятор"}},
+		{"calculator", []string{"Калькулятор"}},
+		// Падежи и части названия
+		{"калькулятора", []string{"Калькулятор"}},
+		{"chrome", []string{"Google Chrome"}},
+		// Название, записанное русскими буквами, и опечатки
+		{"телеграм", []string{"Telegram Desktop"}},
+		{"стим", []string{"Steam"}},
+		{"firefx", []string{"Firefox"}},
+		// Псевдоним: notepad не установлен, поэтому используется gedit
+		{"блокнот", []string{"gedit"}},
+		// Несколько равноценных вариантов
+		{"браузер", []string{"Firefox", "Google Chrome"}},
+		// Нет подходящих
+		{"фотошоп", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, names(catalog.Find(tt.query)), tt.query)
+	}
+}
+
+func TestCatalogAliasPreferred(t *testing.T) {
+	// Псевдоним снимает неоднозначность
+	catalog := testCatalog(map[string][]string{"Браузер": {"firefox"}})
+	assert.Equal(t, []string{"Firefox"}, names(catalog.Find("браузер")))
+	assert.Equal(t, []string{"Firefox"}, names(catalog.Find("браузера")))
+}
+
+func TestCatalogCache(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "apps.json")
+
+	catalog := NewCatalog(cachePath, nil)
+	catalog.scan = func() []AppEntry { return testApps }
+	assert.NoError(t, catalog.Refresh())
+
+	// Новый каталог загружает список из кэша без сканирования
+	loaded := NewCatalog(cachePath, nil)
+	loaded.scan = func() []AppEntry {
+		t.Error("каталог не должен сканироваться")
+		return nil
+	}
+	assert.NoError(t, loaded.Load())
+	assert.Equal(t, testApps, loaded.Entries())
+	assert.WithinDuration(t, catalog.Updated(), loaded.Updated(), time.Second)
+
+	// Отсутствие кэша не ошибка
+	assert.NoError(t, NewCatalog(filepath.Join(t.TempDir(), "none.json"), nil).Load())
+}
+
+func TestCatalogStartRefresh(t *testing.T) {
+	scanned := make(chan struct{}, 1)
+	catalog := NewCatalog("", nil)
+	catalog.scan = func() []AppEntry {
+		select {
+		case scanned <- struct{}{}:
+		default:
+		}
+		return testApps
+	}
+
+	// Пустой каталог обновляется сразу
+	catalog.StartRefresh(time.Hour)
+	defer catalog.Stop()
+
+	select {
+	case <-scanned:
+	case <-time.After(time.Second):
+		t.Fatal("каталог не обновился")
+	}
+	assert.Eventually(t, func() bool { return len(catalog.Entries()) == len(testApps) }, time.Second, 10*time.Millisecond)
+}
+
+func TestOpenApplicationWithCatalog(t *testing.T) {
+	backend := &fakeBackend{}
+	sm := NewSystemManagerWithBackend(backend)
+	sm.SetCatalog(testCatalog(nil))
+
+	// Найденное приложение запускается командой из каталога
+	assert.NoError(t, sm.OpenApplication("хром"))
+	assert.Equal(t, []string{"/usr/bin/google-chrome-stable"}, backend.opened)
+
+	// Неоднозначное название возвращает варианты
+	err := sm.OpenApplication("браузер")
+	var ambiguous *AmbiguousAppError
+	if assert.True(t, errors.As(err, &ambiguous)) {
+		assert.Equal(t, []string{"Firefox", "Google Chrome"}, names(ambiguous.Candidates))
+	}
+
+	// Не найденное в каталоге передается платформенной реализации
+	assert.NoError(t, sm.OpenApplication("/opt/tool"))
+	assert.Equal(t, "/opt/tool", backend.opened[len(backend.opened)-1])
+}
+
+func TestScanApplications(t *testing.T) {
+	dir := t.TempDir()
+
+	appsDir := filepath.Join(dir, "applications")
+	assert.NoError(t, os.MkdirAll(appsDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(appsDir, "firefox.desktop"), []byte(`[Desktop Entry]
+Name=Firefox
+Name[ru]=Firefox Браузер
+GenericName[ru]=Веб-браузер
+Exec=firefox %u
+Type=Application
+`), 0644))
+
+	binDir := filepath.Join(dir, "bin")
+	assert.NoError(t, os.MkdirAll(binDir, 0755))
+	for _, name := range []string{"firefox", "gedit"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\n"), 0755))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "README"), []byte("text"), 0644))
+
+	menuDir := filepath.Join(dir, "Start Menu", "Programs", "Paint.NET")
+	assert.NoError(t, os.MkdirAll(menuDir, 0755))
+	for _, name := range []string{"Paint.NET.lnk", "Uninstall Paint.NET.lnk", "readme.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(menuDir, name), nil, 0644))
+	}
+
+	desktop := scanDesktopDirs([]string{appsDir})
+	if assert.Len(t, desktop, 1) {
+		assert.Equal(t, "Firefox Браузер", desktop[0].Name)
+		assert.Equal(t, []string{"firefox"}, desktop[0].Command)
+		assert.Equal(t, []string{"веб-браузер"}, desktop[0].Keywords)
+	}
+
+	// firefox из PATH уже запускается .desktop-файлом
+	merged := mergeApplications(desktop, scanPathDirs([]string{binDir}, nil))
+	assert.Equal(t, []string{"Firefox Браузер", "gedit"}, names(merged))
+
+	menu := scanStartMenu([]string{filepath.Join(dir, "Start Menu")})
+	if assert.Len(t, menu, 1) {
+		assert.Equal(t, "Paint.NET", menu[0].Name)
+		assert.Equal(t, AppSourceStartMenu, menu[0].Source)
+	}
+}
@@ -0,0 +1,161 @@
+package system
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Разбор .desktop-файлов по спецификации freedesktop.org. Используется
+// бэкендом Linux и каталогом приложений.
+
+// desktopEntry содержит нужные поля .desktop-файла
+type desktopEntry struct {
+	ID       string   // имя файла без .desktop
+	Path     string   // путь к файлу
+	Title    string   // отображаемое название, по возможности на русском
+	Names    []string // Name, включая русский вариант, в нижнем регистре
+	Keywords []string // GenericName и Keywords, включая русские варианты, в нижнем регистре
+	Exec     string
+}
+
+// applicationDirs возвращает каталоги с .desktop-файлами по спецификации XDG,
+// начиная с пользовательского
+func applicationDirs(getenv func(string) string) []string {
+	dataHome := getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		if home := getenv("HOME"); home != "" {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+	}
+	dataDirs := getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	var dirs []string
+	if dataHome != "" {
+		dirs = append(dirs, filepath.Join(dataHome, "applications"),
+			filepath.Join(dataHome, "flatpak", "exports", "share", "applications"))
+	}
+	for _, dir := range strings.Split(dataDirs, ":") {
+		if dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "applications"))
+		}
+	}
+	return append(dirs, "/var/lib/flatpak/exports/share/applications")
+}
+
+// parseDesktopFile читает группу [Desktop Entry]. Скрытые приложения и
+// записи, которые не являются приложениями, пропускаются.
+func parseDesktopFile(path string) (desktopEntry, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return desktopEntry{}, false
+	}
+	defer file.Close()
+
+	entry := desktopEntry{
+		ID:   strings.TrimSuffix(filepath.Base(path), ".desktop"),
+		Path: path,
+	}
+	inEntry := false
+	isApplication := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		if !inEntry {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		// Локализованные ключи учитываются только для русского языка
+		base, locale, localized := strings.Cut(strings.TrimSuffix(key, "]"), "[")
+		if localized && !strings.HasPrefix(locale, "ru") {
+			continue
+		}
+
+		switch base {
+		case "Type":
+			isApplication = value == "Application"
+		case "Hidden", "NoDisplay":
+			if value == "true" {
+				return desktopEntry{}, false
+			}
+		case "Exec":
+			entry.Exec = value
+		case "Name":
+			if localized || entry.Title == "" {
+				entry.Title = value
+			}
+			entry.Names = append(entry.Names, strings.ToLower(value))
+		case "GenericName":
+			entry.Keywords = append(entry.Keywords, strings.ToLower(value))
+		case "Keywords":
+			for _, keyword := range strings.Split(value, ";") {
+				if keyword = strings.TrimSpace(keyword); keyword != "" {
+					entry.Keywords = append(entry.Keywords, strings.ToLower(keyword))
+				}
+			}
+		}
+	}
+
+	return entry, isApplication && entry.Exec != ""
+}
+
+// execArgs разбирает строку Exec на аргументы, учитывая кавычки и
+// удаляя коды полей вроде %U и %f
+func execArgs(command string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes, hasArg := false, false
+
+	flush := func() {
+		if hasArg {
+			arg := current.String()
+			if len(arg) == 2 && arg[0] == '%' && arg[1] != '%' {
+				// Код поля: файлы, ссылки, значок и т.п. не передаются
+			} else {
+				args = append(args, strings.ReplaceAll(arg, "%%", "%"))
+			}
+		}
+		current.Reset()
+		hasArg = false
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			hasArg = true
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			flush()
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	flush()
+
+	return args
+}
@@ -1,15 +1,13 @@
 package system
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"os/exec"
-	"path/filepath"
-	"strings"
+	"runtime"
+	"sync"
 	"time"
 
-	"github.com/go-ole/go-ole"
-	"github.com/moutend/go-wca/pkg/wca"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
@@ -18,14 +16,54 @@ import (
 	"github.com/ztrue/tracerr"
 )
 
+// ErrNotSupported возвращается, если операция недоступна на текущей платформе
+// или в системе не найдены нужные утилиты
+var ErrNotSupported = errors.New("не поддерживается на этой платформе")
+
+// notSupported возвращает ошибку ErrNotSupported с описанием операции
+func notSupported(operation string) error {
+	return tracerr.Wrap(fmt.Errorf("%s: %w", operation, ErrNotSupported))
+}
+
+// Backend реализует операции, которые зависят от операционной системы.
+// Реализация выбирается тегами сборки в файлах backend_*.go.
+type Backend interface {
+	// OpenApplication запускает приложение по пути, имени файла или названию
+	OpenApplication(name string) error
+	// Launch запускает приложение из каталога по его команде запуска
+	Launch(command []string) error
+	// OpenURL открывает адрес в браузере по умолчанию
+	OpenURL(url string) error
+	// GetVolume возвращает громкость системы (0-100)
+	GetVolume() (int, error)
+	// SetVolume устанавливает громкость системы (0-100)
+	SetVolume(level int) error
+	// IsMuted проверяет, выключен ли звук
+	IsMuted() (bool, error)
+	// SetMute выключает или включает звук
+	SetMute(muted bool) error
+	// TakeScreenshot сохраняет снимок экрана в PNG-файл
+	TakeScreenshot(filePath string) error
+	// Close освобождает ресурсы
+	Close()
+}
+
 // SystemManager управляет системными операциями
 type SystemManager struct {
-	initializedOLE bool
+	backend Backend
+	catalog *Catalog
+	mutex   sync.RWMutex
 }
 
-// NewSystemManager создает новый экземпляр SystemManager
+// NewSystemManager создает новый экземпляр SystemManager для текущей платформы
 func NewSystemManager() *SystemManager {
-	return &SystemManager{}
+	return NewSystemManagerWithBackend(newBackend())
+}
+
+// NewSystemManagerWithBackend создает SystemManager с указанной реализацией
+// платформенных операций, например для тестов
+func NewSystemManagerWithBackend(backend Backend) *SystemManager {
+	return &SystemManager{backend: backend}
 }
 
 // RunCommand запускает команду в системе
@@ -38,59 +76,55 @@ func (sm *SystemManager) RunCommand(command string, args ...string) (string, err
 	return string(output), nil
 }
 
-// OpenApplication открывает приложение
+// RunShell выполняет строку в командной оболочке системы:
+// cmd /c в Windows и sh -c в остальных
+func (sm *SystemManager) RunShell(line string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return sm.RunCommand("cmd", "/c", line)
+	}
+	return sm.RunCommand("sh", "-c", line)
+}
+
+// SetCatalog подключает каталог приложений, в котором OpenApplication
+// ищет приложение по названию
+func (sm *SystemManager) SetCatalog(catalog *Catalog) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.catalog = catalog
+}
+
+// Catalog возвращает подключенный каталог приложений или nil
+func (sm *SystemManager) Catalog() *Catalog {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.catalog
+}
+
+// OpenApplication открывает приложение. Название сначала ищется в каталоге
+// приложений; если подходит несколько, возвращается *AmbiguousAppError
+// со списком вариантов. Не найденное в каталоге название передается
+// платформенной реализации как путь или имя файла.
 func (sm *SystemManager) OpenApplication(appPath string) error {
-	// Проверяем, существует ли файл
-	if _, err := os.Stat(appPath); os.IsNotExist(err) {
-		// Пробуем найти приложение в PATH
-		pathEnv := os.Getenv("PATH")
-		paths := strings.Split(pathEnv, ";")
-
-		found := false
-		for _, path := range paths {
-			possiblePath := filepath.Join(path, appPath)
-			if _, err := os.Stat(possiblePath); !os.IsNotExist(err) {
-				appPath = possiblePath
-				found = true
-				break
-			}
-
-			// Проверяем с расширением .exe
-			if !strings.HasSuffix(appPath, ".exe") {
-				possiblePath = filepath.Join(path, appPath+".exe")
-				if _, err := os.Stat(possiblePath); !os.IsNotExist(err) {
-					appPath = possiblePath
-					found = true
-					break
-				}
-			}
+	if catalog := sm.Catalog(); catalog != nil {
+		matches := catalog.Find(appPath)
+		if len(matches) == 1 {
+			return sm.LaunchApplication(matches[0])
 		}
-
-		if !found {
-			return tracerr.New(fmt.Sprintf("Приложение %s не найдено", appPath))
+		if len(matches) > 1 {
+			return tracerr.Wrap(&AmbiguousAppError{Query: appPath, Candidates: matches})
 		}
 	}
+	return sm.backend.OpenApplication(appPath)
+}
 
-	cmd := exec.Command(appPath)
-	err := cmd.Start()
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
-
-	return nil
+// LaunchApplication запускает приложение из каталога
+func (sm *SystemManager) LaunchApplication(app AppEntry) error {
+	return sm.backend.Launch(app.Command)
 }
 
 // OpenURL открывает URL в браузере по умолчанию
 func (sm *SystemManager) OpenURL(url string) error {
-	var cmd *exec.Cmd
-
-	cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
-	err := cmd.Start()
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
-
-	return nil
+	return sm.backend.OpenURL(url)
 }
 
 // GetSystemInfo возвращает информацию о системе
@@ -224,121 +258,40 @@ func (sm *SystemManager) SetVolume(level int) error {
 		level = 100
 	}
 
-	return sm.setMasterVolume(float32(level) / 100.0)
+	return sm.backend.SetVolume(level)
 }
 
 // GetVolume возвращает текущий уровень громкости (0-100)
-func (sm *SystemManager) GetVolume() int {
-	volume, err := sm.getMasterVolume()
-	if err != nil {
-		return 0 // Возвращаем 0 в случае ошибки
-	}
-	return int(volume * 100)
+func (sm *SystemManager) GetVolume() (int, error) {
+	return sm.backend.GetVolume()
 }
 
 // ToggleMute включает/выключает звук
 func (sm *SystemManager) ToggleMute() error {
-	return sm.toggleMasterMute()
-}
-
-// --- Вспомогательные функции для управления звуком --- 
-
-func (sm *SystemManager) getAudioEndpointVolume() (*wca.IAudioEndpointVolume, error) {
-	if !sm.initializedOLE {
-		if err := ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED); err != nil {
-			return nil, err
-		}
-		sm.initializedOLE = true
-	}
-
-	var mmde *wca.IMMDeviceEnumerator
-	if err := wca.CoCreateInstance(wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL, wca.IID_IMMDeviceEnumerator, &mmde); err != nil {
-		return nil, err
-	}
-	defer mmde.Release()
-
-	var mmd *wca.IMMDevice
-	if err := mmde.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &mmd); err != nil {
-		return nil, err
-	}
-	defer mmd.Release()
-
-	var aev *wca.IAudioEndpointVolume
-	if err := mmd.Activate(wca.IID_IAudioEndpointVolume, wca.CLSCTX_ALL, nil, &aev); err != nil {
-		return nil, err
-	}
-
-	return aev, nil
-}
-
-func (sm *SystemManager) setMasterVolume(level float32) error {
-	aev, err := sm.getAudioEndpointVolume()
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
-	defer aev.Release()
-
-	return tracerr.Wrap(aev.SetMasterVolumeLevelScalar(level, nil))
-}
-
-func (sm *SystemManager) getMasterVolume() (float32, error) {
-	aev, err := sm.getAudioEndpointVolume()
+	muted, err := sm.backend.IsMuted()
 	if err != nil {
-		return 0, tracerr.Wrap(err)
-	}
-	defer aev.Release()
-
-	var level float32
-	if err := aev.GetMasterVolumeLevelScalar(&level); err != nil {
-		return 0, tracerr.Wrap(err)
+		return err
 	}
-	return level, nil
+	return sm.backend.SetMute(!muted)
 }
 
-func (sm *SystemManager) toggleMasterMute() error {
-	aev, err := sm.getAudioEndpointVolume()
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
-	defer aev.Release()
-
-	var muted bool
-	if err := aev.GetMute(&muted); err != nil {
-		return tracerr.Wrap(err)
-	}
-
-	return tracerr.Wrap(aev.SetMute(!muted, nil))
+// IsMuted проверяет, выключен ли звук
+func (sm *SystemManager) IsMuted() (bool, error) {
+	return sm.backend.IsMuted()
 }
 
 // TakeScreenshot делает снимок экрана и сохраняет его в указанный файл
 func (sm *SystemManager) TakeScreenshot(filePath string) error {
-
-
-	// Создаем команду для использования утилиты screencapture
-	cmd := exec.Command("powershell", "-command", fmt.Sprintf(
-		"Add-Type -AssemblyName System.Windows.Forms; "+
-		"[System.Windows.Forms.SendKeys]::SendWait('{PRTSC}'); "+
-		"$img = [System.Windows.Forms.Clipboard]::GetImage(); "+
-		"$img.Save('%s');", filePath))
-
-	err := cmd.Run()
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
-
-	return nil
+	return sm.backend.TakeScreenshot(filePath)
 }
 
 // Cleanup освобождает ресурсы
 func (sm *SystemManager) Cleanup() {
-	if sm.initializedOLE {
-		ole.CoUninitialize()
-		sm.initializedOLE = false
-	}
+	sm.backend.Close()
 }
 
 // PrintStatus выводит информацию о статусе приложения в консоль
 func (sm *SystemManager) PrintStatus() {
 	status := sm.CheckStatus()
 	fmt.Println(status.GetStatusSummary())
-}
\ No newline at end of file
+}
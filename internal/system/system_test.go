@@ -1,18 +1,68 @@
 package system
 
 import (
+	"errors"
 	"os"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// fakeBackend запоминает состояние звука и вызовы платформенных операций
+type fakeBackend struct {
+	volume      int
+	muted       bool
+	opened      []string
+	screenshots []string
+	err         error
+	closed      bool
+}
+
+func (b *fakeBackend) OpenApplication(name string) error {
+	b.opened = append(b.opened, name)
+	return b.err
+}
+
+func (b *fakeBackend) Launch(command []string) error {
+	b.opened = append(b.opened, strings.Join(command, " "))
+	return b.err
+}
+
+func (b *fakeBackend) OpenURL(url string) error {
+	b.opened = append(b.opened, url)
+	return b.err
+}
+
+func (b *fakeBackend) GetVolume() (int, error) { return b.volume, b.err }
+
+func (b *fakeBackend) SetVolume(level int) error {
+	b.volume = level
+	return b.err
+}
+
+func (b *fakeBackend) IsMuted() (bool, error) { return b.muted, b.err }
+
+func (b *fakeBackend) SetMute(muted bool) error {
+	b.muted = muted
+	return b.err
+}
+
+func (b *fakeBackend) TakeScreenshot(filePath string) error {
+	b.screenshots = append(b.screenshots, filePath)
+	return b.err
+}
+
+func (b *fakeBackend) Close() { b.closed = true }
+
 func TestNewSystemManager(t *testing.T) {
 	// Создаем новый экземпляр SystemManager
 	sm := NewSystemManager()
 
-	// Проверяем, что SystemManager создан
+	// Проверяем, что SystemManager создан с реализацией для текущей платформы
 	assert.NotNil(t, sm)
+	assert.NotNil(t, sm.backend)
 }
 
 func TestGetSystemInfo(t *testing.T) {
@@ -25,14 +75,10 @@ func TestGetSystemInfo(t *testing.T) {
 	// Проверяем, что информация получена без ошибок
 	assert.NoError(t, err)
 	// Проверяем, что поля информации не пустые
-	assert.NotEmpty(t, info.Hostname)
-	assert.NotEmpty(t, info.OS)
-	assert.NotEmpty(t, info.CPUModel)
-	assert.NotEmpty(t, info.CPUCores)
-	assert.NotEmpty(t, info.MemoryTotal)
-	assert.NotEmpty(t, info.MemoryFree)
-	assert.NotEmpty(t, info.DiskTotal)
-	assert.NotEmpty(t, info.DiskFree)
+	assert.NotEmpty(t, info["hostname"])
+	assert.NotEmpty(t, info["os"])
+	assert.NotEmpty(t, info["total_memory"])
+	assert.Contains(t, info, "disks")
 }
 
 func TestListProcesses(t *testing.T) {
@@ -40,26 +86,35 @@ func TestListProcesses(t *testing.T) {
 	sm := NewSystemManager()
 
 	// Получаем список процессов
-	processes, err := sm.ListProcesses()
+	processes, err := sm.GetRunningProcesses()
 
 	// Проверяем, что список получен без ошибок
 	assert.NoError(t, err)
 	// Проверяем, что список не пустой
 	assert.NotEmpty(t, processes)
 
-	// Проверяем, что у каждого процесса есть PID и имя
+	// Текущий процесс есть в списке
+	found := false
 	for _, proc := range processes {
-		assert.NotZero(t, proc.PID)
-		assert.NotEmpty(t, proc.Name)
+		if proc["pid"].(int32) == int32(os.Getpid()) {
+			found = true
+		}
 	}
+	assert.True(t, found)
 }
 
 func TestRunCommand(t *testing.T) {
 	// Создаем новый экземпляр SystemManager
 	sm := NewSystemManager()
 
-	// Запускаем простую команду (echo для Windows)
-	output, err := sm.RunCommand("cmd", "/c", "echo", "test")
+	// Запускаем простую команду
+	var output string
+	var err error
+	if runtime.GOOS == "windows" {
+		output, err = sm.RunCommand("cmd", "/c", "echo", "test")
+	} else {
+		output, err = sm.RunCommand("echo", "test")
+	}
 
 	// Проверяем, что команда выполнена без ошибок
 	assert.NoError(t, err)
@@ -67,52 +122,50 @@ func TestRunCommand(t *testing.T) {
 	assert.Contains(t, output, "test")
 }
 
-func TestGetVolume(t *testing.T) {
-	// Создаем новый экземпляр SystemManager
-	sm := NewSystemManager()
+func TestVolume(t *testing.T) {
+	backend := &fakeBackend{volume: 40}
+	sm := NewSystemManagerWithBackend(backend)
 
-	// Получаем текущую громкость
+	// Громкость ограничивается диапазоном 0-100
 	volume, err := sm.GetVolume()
-
-	// Проверяем, что громкость получена без ошибок
 	assert.NoError(t, err)
-	// Проверяем, что громкость в допустимом диапазоне (0-100)
-	assert.GreaterOrEqual(t, volume, 0)
-	assert.LessOrEqual(t, volume, 100)
-}
-
-func TestIsMuted(t *testing.T) {
-	// Создаем новый экземпляр SystemManager
-	sm := NewSystemManager()
-
-	// Получаем статус отключения звука
+	assert.Equal(t, 40, volume)
+	assert.NoError(t, sm.SetVolume(150))
+	assert.Equal(t, 100, backend.volume)
+	assert.NoError(t, sm.SetVolume(-5))
+	assert.Equal(t, 0, backend.volume)
+
+	// Переключение звука
+	assert.NoError(t, sm.ToggleMute())
 	muted, err := sm.IsMuted()
-
-	// Проверяем, что статус получен без ошибок
 	assert.NoError(t, err)
-	// Проверяем, что статус имеет булево значение
-	assert.IsType(t, bool(false), muted)
+	assert.True(t, muted)
+	assert.NoError(t, sm.ToggleMute())
+	assert.False(t, backend.muted)
+
+	// Ошибка платформы возвращается вызывающему
+	backend.err = notSupported("управление звуком")
+	_, err = sm.GetVolume()
+	assert.ErrorIs(t, err, ErrNotSupported)
+	assert.ErrorIs(t, sm.ToggleMute(), ErrNotSupported)
 }
 
-func TestTakeScreenshot(t *testing.T) {
-	// Создаем новый экземпляр SystemManager
-	sm := NewSystemManager()
-
-	// Создаем временный файл для скриншота
-	tempFile, err := os.CreateTemp("", "screenshot-*.png")
-	assert.NoError(t, err)
-	tempFile.Close()
-	screenshotPath := tempFile.Name()
-	defer os.Remove(screenshotPath) // Удаляем файл после теста
+func TestBackendDelegation(t *testing.T) {
+	backend := &fakeBackend{}
+	sm := NewSystemManagerWithBackend(backend)
 
-	// Делаем скриншот
-	err = sm.TakeScreenshot(screenshotPath)
+	assert.NoError(t, sm.OpenApplication("калькулятор"))
+	assert.NoError(t, sm.OpenURL("https://example.com"))
+	assert.NoError(t, sm.TakeScreenshot("/tmp/screen.png"))
+	assert.Equal(t, []string{"калькулятор", "https://example.com"}, backend.opened)
+	assert.Equal(t, []string{"/tmp/screen.png"}, backend.screenshots)
 
-	// Проверяем, что скриншот сделан без ошибок
-	assert.NoError(t, err)
+	sm.Cleanup()
+	assert.True(t, backend.closed)
+}
 
-	// Проверяем, что файл скриншота существует и не пустой
-	fileInfo, err := os.Stat(screenshotPath)
-	assert.NoError(t, err)
-	assert.Greater(t, fileInfo.Size(), int64(0))
-}
\ No newline at end of file
+func TestNotSupported(t *testing.T) {
+	err := notSupported("снимки экрана")
+	assert.True(t, errors.Is(err, ErrNotSupported))
+	assert.Contains(t, err.Error(), "снимки экрана")
+}
@@ -0,0 +1,60 @@
+package tts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Cache хранит синтезированные фразы на диске, чтобы частые ответы вроде
+// «Слушаю» не синтезировались заново
+type Cache struct {
+	synthesizer Synthesizer
+	dir         string
+	key         string
+}
+
+// NewCache создает кэш в каталоге dir. key различает голоса и их настройки
+// (см. Config.Key): фразы разных голосов хранятся отдельно.
+func NewCache(synthesizer Synthesizer, dir, key string) *Cache {
+	return &Cache{synthesizer: synthesizer, dir: dir, key: key}
+}
+
+// Synthesize возвращает фразу из кэша или синтезирует и сохраняет ее.
+// Ошибка записи в кэш не мешает воспроизведению.
+func (c *Cache) Synthesize(ctx context.Context, text string) (Audio, error) {
+	sum := sha256.Sum256([]byte(c.key + "\x00" + text))
+	name := hex.EncodeToString(sum[:])
+
+	for _, format := range []string{FormatWAV, FormatMP3} {
+		if data, err := os.ReadFile(filepath.Join(c.dir, name+"."+format)); err == nil {
+			return Audio{Format: format, Data: data}, nil
+		}
+	}
+
+	audio, err := c.synthesizer.Synthesize(ctx, text)
+	if err != nil {
+		return Audio{}, err
+	}
+	if len(audio.Data) > 0 {
+		c.store(filepath.Join(c.dir, name+"."+audio.Format), audio.Data)
+	}
+	return audio, nil
+}
+
+// store записывает фразу через временный файл, чтобы при сбое в кэше не
+// остался обрезанный файл
+func (c *Cache) store(path string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return tracerr.Wrap(err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return tracerr.Wrap(err)
+	}
+	return tracerr.Wrap(os.Rename(tmpPath, path))
+}
@@ -0,0 +1,92 @@
+package tts
+
+import (
+	"context"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultEspeakCommand  = "espeak-ng"
+	defaultRHVoiceCommand = "RHVoice-test"
+	defaultPiperCommand   = "piper"
+
+	espeakWordsPerMinute = 175 // обычная скорость espeak-ng
+	espeakPitch          = 50  // обычная высота espeak-ng, допустимо 0..99
+)
+
+// Espeak синтезирует речь программой espeak-ng
+type Espeak struct {
+	command string
+	voice   string
+	rate    float64
+	pitch   float64
+}
+
+// Synthesize запускает espeak-ng, который пишет WAV в stdout
+func (e *Espeak) Synthesize(ctx context.Context, text string) (Audio, error) {
+	pitch := min(int(espeakPitch*e.pitch), 99)
+	data, err := runEngine(ctx, e.command, []string{
+		"-v", e.voice,
+		"-s", strconv.Itoa(int(espeakWordsPerMinute * e.rate)),
+		"-p", strconv.Itoa(pitch),
+		"--stdin", "--stdout",
+	}, text, "")
+	if err != nil {
+		return Audio{}, err
+	}
+	return Audio{Format: FormatWAV, Data: data}, nil
+}
+
+// RHVoice синтезирует речь программой RHVoice-test
+type RHVoice struct {
+	command string
+	voice   string
+	rate    float64
+	pitch   float64
+}
+
+// Synthesize запускает RHVoice-test, который пишет речь во временный файл.
+// Скорость и высота задаются в процентах от обычных.
+func (r *RHVoice) Synthesize(ctx context.Context, text string) (Audio, error) {
+	output := tempWAV()
+	defer os.Remove(output)
+
+	args := []string{
+		"-r", strconv.Itoa(int(100 * r.rate)),
+		"-t", strconv.Itoa(int(100 * r.pitch)),
+		"-o", output,
+	}
+	if r.voice != "" {
+		args = append(args, "-p", r.voice)
+	}
+	data, err := runEngine(ctx, r.command, args, text, output)
+	if err != nil {
+		return Audio{}, err
+	}
+	return Audio{Format: FormatWAV, Data: data}, nil
+}
+
+// Piper синтезирует речь нейросетевой моделью Piper
+type Piper struct {
+	command string
+	model   string
+	rate    float64
+}
+
+// Synthesize запускает piper, который пишет речь во временный файл.
+// Скорость задается длительностью звуков, поэтому она обратна rate.
+func (p *Piper) Synthesize(ctx context.Context, text string) (Audio, error) {
+	output := tempWAV()
+	defer os.Remove(output)
+
+	data, err := runEngine(ctx, p.command, []string{
+		"--model", p.model,
+		"--output_file", output,
+		"--length_scale", strconv.FormatFloat(1/p.rate, 'f', 2, 64),
+	}, text, output)
+	if err != nil {
+		return Audio{}, err
+	}
+	return Audio{Format: FormatWAV, Data: data}, nil
+}
@@ -0,0 +1,100 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+const (
+	defaultGoogleURL = "https://translate.google.com/translate_tts"
+	googleMaxLength  = 200 // Google Translate не озвучивает фразы длиннее
+)
+
+// Google синтезирует речь облачным сервисом Google Translate. Нужна сеть.
+type Google struct {
+	url      string
+	language string
+	rate     float64
+	client   *http.Client
+}
+
+// Synthesize озвучивает текст частями не длиннее 200 символов и склеивает
+// MP3-фрагменты: они воспроизводятся подряд как один файл
+func (g *Google) Synthesize(ctx context.Context, text string) (Audio, error) {
+	var data []byte
+	for _, part := range splitText(text, googleMaxLength) {
+		chunk, err := g.fetch(ctx, part)
+		if err != nil {
+			return Audio{}, err
+		}
+		data = append(data, chunk...)
+	}
+	return Audio{Format: FormatMP3, Data: data}, nil
+}
+
+// fetch запрашивает речь для одной части текста
+func (g *Google) fetch(ctx context.Context, text string) ([]byte, error) {
+	query := url.Values{
+		"ie":       {"UTF-8"},
+		"client":   {"tw-ob"},
+		"tl":       {g.language},
+		"q":        {text},
+		"ttsspeed": {strconv.FormatFloat(g.rate, 'f', 2, 64)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, tracerr.New(fmt.Sprintf("Ошибка синтеза речи Google: %s", resp.Status))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	return data, nil
+}
+
+// splitText делит текст на части не длиннее limit символов по границам слов.
+// Слово длиннее limit режется посередине.
+func splitText(text string, limit int) []string {
+	var parts []string
+	var current []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > limit {
+			if len(current) > 0 {
+				parts = append(parts, string(current))
+				current = nil
+			}
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		if len(current) > 0 && len(current)+1+len(runes) > limit {
+			parts = append(parts, string(current))
+			current = nil
+		}
+		if len(current) > 0 {
+			current = append(current, ' ')
+		}
+		current = append(current, runes...)
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
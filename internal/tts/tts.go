@@ -0,0 +1,159 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Поддерживаемые движки синтеза речи
+const (
+	EngineEspeak  = "espeak-ng" // espeak-ng, работает без сети
+	EngineRHVoice = "rhvoice"   // RHVoice, работает без сети
+	EnginePiper   = "piper"     // Piper, работает без сети
+	EngineGoogle  = "google"    // облачный синтез Google Translate
+	EngineLocal   = "local"     // устаревшее название, означает espeak-ng
+)
+
+// Форматы синтезированной речи
+const (
+	FormatWAV = "wav"
+	FormatMP3 = "mp3"
+)
+
+// Audio — синтезированная речь
+type Audio struct {
+	Format string // wav, mp3
+	Data   []byte
+}
+
+// Synthesizer превращает текст в речь
+type Synthesizer interface {
+	// Synthesize синтезирует речь для текста
+	Synthesize(ctx context.Context, text string) (Audio, error)
+}
+
+// Config содержит настройки синтеза речи
+type Config struct {
+	Engine   string  // espeak-ng, rhvoice, piper, google; пусто — espeak-ng
+	Voice    string  // голос: для espeak-ng и RHVoice — имя, для Piper — файл модели .onnx
+	Rate     float64 // скорость речи, 1 — обычная
+	Pitch    float64 // высота голоса, 1 — обычная; Piper и Google ее не меняют
+	Language string  // язык речи, например "ru-RU"
+	Command  string  // программа синтеза; пусто — стандартная для движка
+	URL      string  // адрес облачного синтеза; пусто — Google Translate
+}
+
+// Key возвращает строку, которая различает голоса и их настройки. Она входит
+// в ключ кэша, чтобы после смены голоса не звучали старые фразы.
+func (c Config) Key() string {
+	return fmt.Sprintf("%s|%s|%g|%g|%s", c.Engine, c.Voice, orOne(c.Rate), orOne(c.Pitch), c.Language)
+}
+
+// NewSynthesizer создает синтезатор по настройкам
+func NewSynthesizer(config Config) (Synthesizer, error) {
+	rate := orOne(config.Rate)
+	pitch := orOne(config.Pitch)
+
+	switch config.Engine {
+	case "", EngineEspeak, EngineLocal:
+		voice := config.Voice
+		if voice == "" {
+			voice = shortLanguage(config.Language)
+		}
+		return &Espeak{
+			command: orDefault(config.Command, defaultEspeakCommand),
+			voice:   voice,
+			rate:    rate,
+			pitch:   pitch,
+		}, nil
+	case EngineRHVoice:
+		return &RHVoice{
+			command: orDefault(config.Command, defaultRHVoiceCommand),
+			voice:   config.Voice,
+			rate:    rate,
+			pitch:   pitch,
+		}, nil
+	case EnginePiper:
+		if config.Voice == "" {
+			return nil, tracerr.New("Не указан файл голоса Piper (.onnx)")
+		}
+		return &Piper{
+			command: orDefault(config.Command, defaultPiperCommand),
+			model:   config.Voice,
+			rate:    rate,
+		}, nil
+	case EngineGoogle:
+		return &Google{
+			url:      orDefault(config.URL, defaultGoogleURL),
+			language: shortLanguage(config.Language),
+			rate:     rate,
+			client:   &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	default:
+		return nil, tracerr.New(fmt.Sprintf("Неизвестный движок синтеза речи: %s", config.Engine))
+	}
+}
+
+// orOne заменяет незаданный множитель скорости или высоты на обычный
+func orOne(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+	return value
+}
+
+// orDefault возвращает value или значение по умолчанию, если value пусто
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// shortLanguage превращает "ru-RU" в "ru". Пустой язык — русский.
+func shortLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		language = language[:i]
+	}
+	if language == "" {
+		return "ru"
+	}
+	return language
+}
+
+// runEngine запускает программу синтеза и передает ей текст на stdin.
+// Речь читается из файла output, если программа пишет в файл, иначе из stdout.
+func runEngine(ctx context.Context, name string, args []string, text, output string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, tracerr.New(fmt.Sprintf("Ошибка синтеза речи %s: %v: %s", filepath.Base(name), err, strings.TrimSpace(stderr.String())))
+	}
+
+	if output == "" {
+		return stdout.Bytes(), nil
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	return data, nil
+}
+
+// tempWAV возвращает имя временного файла для речи
+func tempWAV() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("kot_tts_%d.wav", time.Now().UnixNano()))
+}
@@ -0,0 +1,192 @@
+package tts
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEngine создает заглушку программы синтеза, которая записывает
+// аргументы и текст и возвращает «речь» в stdout или в файл после флага
+// outputFlag
+func fakeEngine(t *testing.T, outputFlag string) (command, argsFile, textFile string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("тест использует sh")
+	}
+
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	textFile = filepath.Join(dir, "text")
+	script := `#!/bin/sh
+echo "$@" > ` + argsFile + `
+cat > ` + textFile + `
+output=""
+while [ $# -gt 0 ]; do
+	if [ "$1" = "` + outputFlag + `" ]; then output="$2"; fi
+	shift
+done
+if [ -n "$output" ]; then
+	printf 'RIFF' > "$output"
+else
+	printf 'RIFF'
+fi
+`
+	command = filepath.Join(dir, "engine")
+	assert.NoError(t, os.WriteFile(command, []byte(script), 0755))
+	return command, argsFile, textFile
+}
+
+func TestNewSynthesizer(t *testing.T) {
+	synthesizer, err := NewSynthesizer(Config{Language: "en-US"})
+	assert.NoError(t, err)
+	espeak := synthesizer.(*Espeak)
+	assert.Equal(t, "espeak-ng", espeak.command)
+	assert.Equal(t, "en", espeak.voice)
+	assert.Equal(t, 1.0, espeak.rate)
+
+	synthesizer, err = NewSynthesizer(Config{Engine: EngineLocal})
+	assert.NoError(t, err)
+	assert.Equal(t, "ru", synthesizer.(*Espeak).voice)
+
+	synthesizer, err = NewSynthesizer(Config{Engine: EngineGoogle})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultGoogleURL, synthesizer.(*Google).url)
+
+	_, err = NewSynthesizer(Config{Engine: EnginePiper})
+	assert.Error(t, err, "без модели Piper не работает")
+
+	_, err = NewSynthesizer(Config{Engine: "festival"})
+	assert.Error(t, err)
+
+	assert.NotEqual(t, Config{Voice: "anna"}.Key(), Config{Voice: "elena"}.Key())
+	assert.Equal(t, Config{}.Key(), Config{Rate: 1, Pitch: 1}.Key())
+}
+
+func TestEngines(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     Config
+		outputFlag string
+		args       []string
+	}{
+		{
+			name:   "espeak-ng",
+			config: Config{Engine: EngineEspeak, Voice: "ru", Rate: 1.2, Pitch: 3},
+			args:   []string{"-v ru", "-s 210", "-p 99", "--stdin --stdout"},
+		},
+		{
+			name:       "RHVoice",
+			config:     Config{Engine: EngineRHVoice, Voice: "anna", Rate: 0.8, Pitch: 1.1},
+			outputFlag: "-o",
+			args:       []string{"-r 80", "-t 110", "-p anna"},
+		},
+		{
+			name:       "Piper",
+			config:     Config{Engine: EnginePiper, Voice: "/voices/ru_RU-irina-medium.onnx", Rate: 2},
+			outputFlag: "--output_file",
+			args:       []string{"--model /voices/ru_RU-irina-medium.onnx", "--length_scale 0.50"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, argsFile, textFile := fakeEngine(t, tt.outputFlag)
+			tt.config.Command = command
+			synthesizer, err := NewSynthesizer(tt.config)
+			assert.NoError(t, err)
+
+			audio, err := synthesizer.Synthesize(context.Background(), "Привет, я Кот")
+			assert.NoError(t, err)
+			assert.Equal(t, Audio{Format: FormatWAV, Data: []byte("RIFF")}, audio)
+
+			args, _ := os.ReadFile(argsFile)
+			for _, arg := range tt.args {
+				assert.Contains(t, string(args), arg)
+			}
+			text, _ := os.ReadFile(textFile)
+			assert.Equal(t, "Привет, я Кот", string(text))
+		})
+	}
+
+	// Ошибка программы возвращается вместе с ее выводом
+	dir := t.TempDir()
+	failing := filepath.Join(dir, "failing")
+	assert.NoError(t, os.WriteFile(failing, []byte("#!/bin/sh\necho 'голос не найден' >&2\nexit 1\n"), 0755))
+	synthesizer, _ := NewSynthesizer(Config{Engine: EngineRHVoice, Command: failing})
+	_, err := synthesizer.Synthesize(context.Background(), "Привет")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "голос не найден")
+	}
+}
+
+func TestGoogle(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "ru", r.URL.Query().Get("tl"))
+		assert.Equal(t, "1.50", r.URL.Query().Get("ttsspeed"))
+		queries = append(queries, r.URL.Query().Get("q"))
+		w.Write([]byte("mp3"))
+	}))
+	defer server.Close()
+
+	synthesizer, err := NewSynthesizer(Config{Engine: EngineGoogle, URL: server.URL, Language: "ru-RU", Rate: 1.5})
+	assert.NoError(t, err)
+
+	// Длинный ответ озвучивается частями
+	text := strings.Repeat("слово ", 60)
+	audio, err := synthesizer.Synthesize(context.Background(), text)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatMP3, audio.Format)
+	assert.Len(t, queries, 2)
+	assert.Equal(t, strings.Repeat("mp3", len(queries)), string(audio.Data))
+	assert.Equal(t, strings.TrimSpace(text), strings.Join(queries, " "))
+
+	server.Close()
+	_, err = synthesizer.Synthesize(context.Background(), "Привет")
+	assert.Error(t, err)
+}
+
+func TestSplitText(t *testing.T) {
+	assert.Equal(t, []string{"раз два", "три"}, splitText("раз два три", 7))
+	assert.Equal(t, []string{"раз", "длинн", "оесло", "во"}, splitText("раз длинноеслово", 5))
+	assert.Empty(t, splitText("  ", 5))
+}
+
+// countingSynthesizer считает обращения к синтезу
+type countingSynthesizer struct {
+	calls int
+}
+
+func (c *countingSynthesizer) Synthesize(ctx context.Context, text string) (Audio, error) {
+	c.calls++
+	return Audio{Format: FormatMP3, Data: []byte(text)}, nil
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	synthesizer := &countingSynthesizer{}
+	cache := NewCache(synthesizer, dir, Config{Voice: "anna"}.Key())
+
+	for i := 0; i < 2; i++ {
+		audio, err := cache.Synthesize(context.Background(), "Слушаю")
+		assert.NoError(t, err)
+		assert.Equal(t, Audio{Format: FormatMP3, Data: []byte("Слушаю")}, audio)
+	}
+	assert.Equal(t, 1, synthesizer.calls, "повторная фраза берется из кэша")
+
+	// Другой голос не получает фразы первого
+	other := NewCache(synthesizer, dir, Config{Voice: "elena"}.Key())
+	_, err := other.Synthesize(context.Background(), "Слушаю")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, synthesizer.calls)
+
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 2)
+}
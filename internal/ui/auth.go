@@ -0,0 +1,165 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"kot.ai/internal/assistant"
+	"kot.ai/internal/auth"
+	"kot.ai/internal/protocol"
+)
+
+// desktopDeviceName — имя временного устройства для окна, которое
+// ассистент открывает сам
+const desktopDeviceName = "Рабочий стол"
+
+// messageScopes задает право доступа, нужное для каждого типа сообщения.
+// Сообщения, которых здесь нет, доступны любому подключенному устройству.
+var messageScopes = map[string]string{
+	protocol.TypeCommand:          auth.ScopeChat,
+	protocol.TypeChat:             auth.ScopeChat,
+	protocol.TypeNewConversation:  auth.ScopeChat,
+	protocol.TypeGetConversations: auth.ScopeChat,
+	protocol.TypeGetAudioDevices:  auth.ScopeChat,
+	protocol.TypeAudioStart:       auth.ScopeChat,
+	protocol.TypeAudioChunk:       auth.ScopeChat,
+	protocol.TypeAudioEnd:         auth.ScopeChat,
+	protocol.TypeVoiceStreamStart: auth.ScopeChat,
+	protocol.TypeVoiceStreamStop:  auth.ScopeChat,
+	protocol.TypeSetAudioDevice:   auth.ScopeSystem,
+	protocol.TypeGetHistory:       auth.ScopeSystem, // история хранит команды всех устройств
+	protocol.TypeExportHistory:    auth.ScopeSystem,
+	protocol.TypeSystemInfo:       auth.ScopeSystem,
+	protocol.TypeExecute:          auth.ScopeSystem,
+	protocol.TypeScreenshot:       auth.ScopeSystem,
+	protocol.TypePairingCode:      auth.ScopeSystem,
+	protocol.TypeGetConfig:        auth.ScopeSystem,
+	protocol.TypeSetConfig:        auth.ScopeSystem,
+	protocol.TypeMobileCommand:    auth.ScopeMobile,
+	protocol.TypeMobileScreenshot: auth.ScopeMobile,
+}
+
+// pairRequest — запрос на подключение устройства по коду
+type pairRequest struct {
+	Code   string   `json:"code"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// pairResponse содержит токен подключенного устройства
+type pairResponse struct {
+	Token  string   `json:"token"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// handlePair подключает устройство по одноразовому коду
+func (um *UIManager) handlePair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if !auth.CheckOrigin(r, um.currentConfig().AllowedOrigins) {
+		http.Error(w, "Источник запроса не разрешен", http.StatusForbidden)
+		return
+	}
+
+	var req pairRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Некорректный запрос", http.StatusBadRequest)
+		return
+	}
+
+	token, device, err := um.auth.Pair(req.Code, req.Name, req.Scopes)
+	if errors.Is(err, auth.ErrInvalidCode) || errors.Is(err, auth.ErrCodeExpired) {
+		log.Printf("Неудачная попытка подключения устройства с %s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, auth.ErrNoScopes) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка подключения устройства: %v", err)
+		http.Error(w, "Не удалось подключить устройство", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Подключено устройство %s (%s), права: %v", device.Name, r.RemoteAddr, device.Scopes)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pairResponse{Token: token, Name: device.Name, Scopes: device.Scopes})
+}
+
+// handleSession сообщает странице, действует ли ее токен и какие у него права
+func (um *UIManager) handleSession(w http.ResponseWriter, r *http.Request) {
+	device, ok := um.auth.Authenticate(auth.TokenFromRequest(r))
+	if !ok {
+		http.Error(w, "Устройство не подключено", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":   device.Name,
+		"scopes": device.Scopes,
+	})
+}
+
+// limitClient ограничивает команды ассистента для устройства без права
+// system: ему доступны только безопасные команды
+func (um *UIManager) limitClient(c *client) {
+	if um.assistant == nil || c.device.HasScope(auth.ScopeSystem) {
+		return
+	}
+	for _, source := range []string{assistant.OriginWeb, assistant.OriginMobile} {
+		um.assistant.SetRiskLimit(c.origin(source), assistant.RiskLow)
+	}
+}
+
+// releaseClient снимает ограничения отключившегося клиента и забывает его
+// разговоры
+func (um *UIManager) releaseClient(c *client) {
+	if um.assistant == nil {
+		return
+	}
+	for _, source := range []string{assistant.OriginWeb, assistant.OriginMobile} {
+		um.assistant.ReleaseOrigin(c.origin(source))
+	}
+}
+
+// PairingCode выдает одноразовый код подключения со всеми правами
+func (um *UIManager) PairingCode() (string, time.Time, error) {
+	return um.auth.NewPairingCode(nil)
+}
+
+// DeviceNames возвращает имена подключенных устройств
+func (um *UIManager) DeviceNames() []string {
+	var names []string
+	for _, device := range um.auth.Devices() {
+		names = append(names, device.Name)
+	}
+	return names
+}
+
+// RevokeDevice отзывает доступ устройства и закрывает его соединения
+func (um *UIManager) RevokeDevice(name string) (int, error) {
+	revoked, err := um.auth.Revoke(name)
+	if err != nil {
+		return 0, err
+	}
+
+	um.clientMutex.Lock()
+	defer um.clientMutex.Unlock()
+	for conn, c := range um.clients {
+		for _, r := range revoked {
+			if c.device.ID == r.ID {
+				conn.Close()
+				delete(um.clients, conn)
+			}
+		}
+	}
+	return len(revoked), nil
+}
@@ -0,0 +1,180 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"kot.ai/internal/auth"
+	"kot.ai/internal/protocol"
+)
+
+// pair отправляет запрос на подключение устройства с заголовком Origin
+func pair(t *testing.T, url, origin, body string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url+"/api/pair", strings.NewReader(body))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// session запрашивает /api/session с токеном
+func session(t *testing.T, url, token string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, url+"/api/session", nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestHandlePair(t *testing.T) {
+	um := NewUIManager(testConfig(t), nil, nil)
+	server := newTestServer(t, um)
+
+	// Подключение только методом POST
+	resp, err := http.Get(server.URL + "/api/pair")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	code, _, err := um.auth.NewPairingCode([]string{auth.ScopeChat})
+	assert.NoError(t, err)
+	body := `{"code": "` + code + `", "name": "Телефон", "scopes": ["chat", "system"]}`
+
+	// Чужая страница не может подключить устройство
+	resp = pair(t, server.URL, "https://evil.example", body)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Неверный код и некорректный запрос
+	resp = pair(t, server.URL, "", `{"code": "не код", "name": "Телефон"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = pair(t, server.URL, "", `{"code":`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Без разрешенных кодом прав устройство не подключается
+	resp = pair(t, server.URL, "", `{"code": "`+code+`", "name": "Телефон", "scopes": ["system"]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Права устройства не шире прав кода
+	resp = pair(t, server.URL, server.URL, body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var paired pairResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&paired))
+	assert.NotEmpty(t, paired.Token)
+	assert.Equal(t, "Телефон", paired.Name)
+	assert.Equal(t, []string{auth.ScopeChat}, paired.Scopes)
+
+	// Код одноразовый
+	resp = pair(t, server.URL, "", body)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Выданный токен действует
+	resp = session(t, server.URL, paired.Token)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHandlePairAllowedOrigins(t *testing.T) {
+	config := testConfig(t)
+	config.AllowedOrigins = []string{"https://kot.example/"}
+	um := NewUIManager(config, nil, nil)
+	server := newTestServer(t, um)
+
+	code, _, err := um.auth.NewPairingCode(nil)
+	assert.NoError(t, err)
+	resp := pair(t, server.URL, "https://kot.example", `{"code": "`+code+`", "name": "Планшет"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHandleSession(t *testing.T) {
+	um := NewUIManager(testConfig(t), nil, nil)
+	server := newTestServer(t, um)
+
+	resp := session(t, server.URL, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = session(t, server.URL, "неизвестный")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	token, _, err := um.auth.IssueTemporary("Ноутбук", []string{auth.ScopeChat, auth.ScopeSystem})
+	assert.NoError(t, err)
+	resp = session(t, server.URL, token)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var result struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "Ноутбук", result.Name)
+	assert.Equal(t, []string{auth.ScopeChat, auth.ScopeSystem}, result.Scopes)
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	um := NewUIManager(testConfig(t), nil, nil)
+	server := newTestServer(t, um)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	// Без токена и с неизвестным токеном соединение не открывается
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL+"?token=неизвестный", nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	// Чужая страница не подключается даже с действующим токеном
+	token, _, err := um.auth.IssueTemporary("Тест", auth.AllScopes)
+	assert.NoError(t, err)
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL+"?token="+token, http.Header{"Origin": {"https://evil.example"}})
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	// Токен принимается и в заголовке Authorization
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {"Bearer " + token}})
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+}
+
+func TestMessageScopes(t *testing.T) {
+	um := NewUIManager(testConfig(t), nil, nil)
+	server := newTestServer(t, um)
+	conn := dial(t, um, server, auth.ScopeChat)
+	call(t, conn, protocol.TypeHello, "1", protocol.HelloPayload{Client: "test"})
+
+	// Устройству с правом chat недоступны команды оболочки и история всех устройств
+	for i, msgType := range []string{
+		protocol.TypeExecute,
+		protocol.TypeGetHistory,
+		protocol.TypeExportHistory,
+		protocol.TypeGetConfig,
+		protocol.TypeMobileCommand,
+	} {
+		e := decodeError(t, call(t, conn, msgType, string(rune('a'+i)), nil))
+		assert.Equal(t, protocol.CodeForbidden, e.Code, msgType)
+	}
+}
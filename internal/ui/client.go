@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"kot.ai/internal/auth"
+	"kot.ai/internal/protocol"
+	"kot.ai/internal/voice"
+)
+
+// client — подключенный по WebSocket клиент веб-интерфейса
+type client struct {
+	id           uint64
+	conn         *websocket.Conn
+	device       auth.Device
+	greeted      bool     // клиент прислал hello
+	capabilities []string // возможности, о которых клиент сообщил в hello
+	writeMutex   sync.Mutex
+
+	active       *activeCommand // выполняемая команда ассистента
+	activeMutex  sync.Mutex
+	commandMutex sync.Mutex // команды клиента выполняются по очереди
+
+	// Запись команды в браузере. Сообщения клиента читаются по одному,
+	// поэтому блокировка не нужна.
+	recording bool
+	audio     []byte
+
+	// Поток звука с микрофона клиента и номер последней команды из него
+	stream         *voice.RemoteStream
+	streamCommands uint64
+}
+
+// activeCommand — команда ассистента, которую клиент может прервать
+type activeCommand struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+// send отправляет сообщение клиенту. WebSocket не допускает одновременной
+// записи, а ответы и рассылки идут из разных горутин.
+func (c *client) send(msg protocol.Message) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+// sendAudio отправляет клиенту звук двоичным кадром
+func (c *client) sendAudio(data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// origin возвращает источник команд клиента для ассистента
+func (c *client) origin(source string) string {
+	return fmt.Sprintf("%s:%d", source, c.id)
+}
+
+// hasCapability проверяет, сообщил ли клиент о возможности в hello
+func (c *client) hasCapability(capability string) bool {
+	for _, value := range c.capabilities {
+		if value == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// startCommand регистрирует новую команду клиента и прерывает предыдущую
+func (c *client) startCommand(id string) (context.Context, *activeCommand) {
+	ctx, cancel := context.WithCancel(context.Background())
+	command := &activeCommand{id: id, cancel: cancel}
+
+	c.activeMutex.Lock()
+	defer c.activeMutex.Unlock()
+	if c.active != nil {
+		c.active.cancel()
+	}
+	c.active = command
+	return ctx, command
+}
+
+// finishCommand снимает регистрацию завершенной команды
+func (c *client) finishCommand(command *activeCommand) {
+	command.cancel()
+	c.activeMutex.Lock()
+	defer c.activeMutex.Unlock()
+	if c.active == command {
+		c.active = nil
+	}
+}
+
+// cancelCommand прерывает команду с идентификатором id или, если он пуст,
+// текущую команду. Возвращает false, если прерывать нечего.
+func (c *client) cancelCommand(id string) bool {
+	c.activeMutex.Lock()
+	defer c.activeMutex.Unlock()
+	if c.active == nil || (id != "" && c.active.id != id) {
+		return false
+	}
+	c.active.cancel()
+	return true
+}
+
+// allowedTypes возвращает типы запросов, доступные устройству клиента
+func (c *client) allowedTypes() []string {
+	var types []string
+	for _, msgType := range protocol.RequestTypes {
+		if scope, ok := messageScopes[msgType]; !ok || c.device.HasScope(scope) {
+			types = append(types, msgType)
+		}
+	}
+	return types
+}
@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"bytes"
+	"context"
 	"embed"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +14,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,48 +22,93 @@ import (
 	"github.com/ztrue/tracerr"
 
 	"kot.ai/internal/assistant"
+	"kot.ai/internal/auth"
+	"kot.ai/internal/config"
+	"kot.ai/internal/history"
 	"kot.ai/internal/mobile"
-	"kot.ai/internal/system"
+	"kot.ai/internal/protocol"
+	"kot.ai/internal/stt"
+	"kot.ai/internal/tts"
+	"kot.ai/internal/voice"
 )
 
 //go:embed web
 var webContent embed.FS
 
+// maxAudioBytes ограничивает запись из браузера минутой: 16 кГц, 16 бит
+const maxAudioBytes = 60 * 16000 * 2
+
 // UIManager управляет пользовательским интерфейсом
 type UIManager struct {
 	config      UIConfig
+	configMutex sync.Mutex      // защищает config при смене настроек
+	settings    *config.Manager // настройки всей программы для get_config и set_config
 	assistant   *assistant.Assistant
 	ui          lorca.UI
 	server      *http.Server
-	clients     map[*websocket.Conn]bool
+	auth        *auth.Store
+	clients     map[*websocket.Conn]*client
 	clientMutex sync.Mutex
 	upgrader    websocket.Upgrader
 	isRunning   bool
 	mobileManager *mobile.MobileManager
+	lastClientID  uint64
 }
 
-// UIConfig содержит настройки пользовательского интерфейса
-type UIConfig struct {
-	Enabled        bool   `json:"enabled"`
-	UIType         string `json:"ui_type"` // web, tray, console
-	WebPort        int    `json:"web_port"`
-	Theme          string `json:"theme"`
-	StartMinimized bool   `json:"start_minimized"`
-}
+// UIConfig содержит настройки пользовательского интерфейса, см. config.UIConfig
+type UIConfig = config.UIConfig
 
 // NewUIManager создает новый экземпляр UIManager
 func NewUIManager(config UIConfig, assistant *assistant.Assistant, mobileManager *mobile.MobileManager) *UIManager {
-	return &UIManager{
+	um := &UIManager{
 		config:    config,
 		assistant: assistant,
-		clients:   make(map[*websocket.Conn]bool),
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Разрешаем все источники для простоты
-			},
-		},
+		auth:      auth.NewStore(config.DevicesPath),
+		clients:   make(map[*websocket.Conn]*client),
 		mobileManager: mobileManager,
 	}
+	um.upgrader = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return auth.CheckOrigin(r, um.currentConfig().AllowedOrigins)
+		},
+	}
+	return um
+}
+
+// Reconfigure применяет новые настройки интерфейса. Тема и разрешенные
+// страницы меняются сразу; тип интерфейса, порт и список устройств —
+// после перезапуска.
+func (um *UIManager) Reconfigure(config UIConfig) {
+	um.configMutex.Lock()
+	defer um.configMutex.Unlock()
+	config.Enabled = um.config.Enabled
+	config.UIType = um.config.UIType
+	config.WebPort = um.config.WebPort
+	config.LocalOnly = um.config.LocalOnly
+	config.DevicesPath = um.config.DevicesPath
+	um.config = config
+}
+
+// SetConfigManager задает настройки программы, которые веб-интерфейс
+// показывает и изменяет
+func (um *UIManager) SetConfigManager(manager *config.Manager) {
+	um.configMutex.Lock()
+	defer um.configMutex.Unlock()
+	um.settings = manager
+}
+
+// configManager возвращает настройки программы или nil
+func (um *UIManager) configManager() *config.Manager {
+	um.configMutex.Lock()
+	defer um.configMutex.Unlock()
+	return um.settings
+}
+
+// currentConfig возвращает действующие настройки интерфейса
+func (um *UIManager) currentConfig() UIConfig {
+	um.configMutex.Lock()
+	defer um.configMutex.Unlock()
+	return um.config
 }
 
 // Start запускает пользовательский интерфейс
@@ -87,9 +136,9 @@ func (um *UIManager) Stop() {
 
 	// Закрываем все WebSocket соединения
 	um.clientMutex.Lock()
-	for client := range um.clients {
-		client.Close()
-		delete(um.clients, client)
+	for conn := range um.clients {
+		conn.Close()
+		delete(um.clients, conn)
 	}
 	um.clientMutex.Unlock()
 
@@ -106,17 +155,20 @@ func (um *UIManager) Stop() {
 	}
 }
 
-// SendMessage отправляет сообщение всем подключенным клиентам
-func (um *UIManager) SendMessage(message map[string]interface{}) {
+// SendMessage отправляет сообщение всем клиентам, завершившим hello
+func (um *UIManager) SendMessage(message protocol.Message) {
 	um.clientMutex.Lock()
 	defer um.clientMutex.Unlock()
 
-	for client := range um.clients {
-		err := client.WriteJSON(message)
+	for conn, c := range um.clients {
+		if !c.greeted {
+			continue
+		}
+		err := c.send(message)
 		if err != nil {
 			log.Printf("Ошибка отправки сообщения: %v", err)
-			client.Close()
-			delete(um.clients, client)
+			conn.Close()
+			delete(um.clients, conn)
 		}
 	}
 }
@@ -134,15 +186,46 @@ func (um *UIManager) startWebUI() error {
 		return tracerr.Wrap(err)
 	}
 
+	// Команда "настройки" открывает панель настроек веб-интерфейса,
+	// а команды устройств выдают коды подключения и отзывают доступ
+	if um.assistant != nil {
+		um.assistant.SetSettingsCallback(um.showSettings)
+		um.assistant.SetDeviceManager(um)
+		um.assistant.SetVoiceStateCallback(um.showVoiceState)
+	}
+
+	// Загружаем подключенные устройства. Окно рабочего стола получает
+	// временный токен, а для остальных устройств выдается код подключения.
+	if err := um.auth.Load(); err != nil {
+		log.Printf("Ошибка загрузки списка устройств: %v", err)
+	}
+	desktopToken, _, err := um.auth.IssueTemporary(desktopDeviceName, auth.AllScopes)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	code, expires, err := um.auth.NewPairingCode(nil)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	fmt.Printf("Код для подключения устройства к веб-интерфейсу: %s (действует до %s)\n", code, expires.Format("15:04"))
+
 	// Настраиваем HTTP сервер
 	mux := http.NewServeMux()
 	mux.Handle("/", http.FileServer(http.Dir(tmpDir)))
 	mux.HandleFunc("/ws", um.handleWebSocket)
 	mux.HandleFunc("/mobile", um.handleMobileUI)
+	mux.HandleFunc("/api/pair", um.handlePair)
+	mux.HandleFunc("/api/session", um.handleSession)
+
+	// По умолчанию сервер доступен только с этого компьютера
+	host := ""
+	if um.config.LocalOnly {
+		host = "127.0.0.1"
+	}
 
 	// Запускаем HTTP сервер
 	um.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", um.config.WebPort),
+		Addr:    fmt.Sprintf("%s:%d", host, um.config.WebPort),
 		Handler: mux,
 	}
 
@@ -159,12 +242,15 @@ func (um *UIManager) startWebUI() error {
 			// Даем серверу время на запуск
 			time.Sleep(500 * time.Millisecond)
 
+			// Токен передается во фрагменте адреса и не уходит на сервер в запросах
+			desktopURL := fmt.Sprintf("http://localhost:%d/#token=%s", um.config.WebPort, desktopToken)
+
 			var err error
-			um.ui, err = lorca.New(fmt.Sprintf("http://localhost:%d", um.config.WebPort), "", 800, 600)
+			um.ui, err = lorca.New(desktopURL, "", 800, 600)
 			if err != nil {
 				log.Printf("Не удалось запустить браузер: %v", err)
 				// Пробуем открыть в системном браузере
-				um.openInSystemBrowser(fmt.Sprintf("http://localhost:%d", um.config.WebPort))
+				um.openInSystemBrowser(desktopURL)
 			}
 		}()
 	}
@@ -173,6 +259,29 @@ func (um *UIManager) startWebUI() error {
 	return nil
 }
 
+// showSettings открывает настройки в подключенных клиентах,
+// а если их нет — открывает веб-интерфейс в системном браузере
+func (um *UIManager) showSettings() error {
+	um.clientMutex.Lock()
+	clients := len(um.clients)
+	um.clientMutex.Unlock()
+
+	if clients == 0 {
+		token, _, err := um.auth.IssueTemporary(desktopDeviceName, auth.AllScopes)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		return um.openInSystemBrowser(fmt.Sprintf("http://localhost:%d/#settings&token=%s", um.config.WebPort, token))
+	}
+	um.SendMessage(protocol.New(protocol.TypeShowSettings, "", nil))
+	return nil
+}
+
+// showVoiceState показывает в клиентах, что ассистент слушает команду
+func (um *UIManager) showVoiceState(state string) {
+	um.SendMessage(protocol.New(protocol.TypeVoiceState, "", protocol.VoiceStatePayload{State: state}))
+}
+
 // startTrayUI запускает интерфейс в системном трее
 func (um *UIManager) startTrayUI() error {
 	// Для простоты используем веб-интерфейс
@@ -188,34 +297,51 @@ func (um *UIManager) startConsoleUI() error {
 
 // handleWebSocket обрабатывает WebSocket соединения
 func (um *UIManager) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Подключаться могут только устройства, прошедшие подключение по коду
+	device, ok := um.auth.Authenticate(auth.TokenFromRequest(r))
+	if !ok {
+		http.Error(w, "Устройство не подключено", http.StatusUnauthorized)
+		return
+	}
+
 	conn, err := um.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Ошибка WebSocket: %v", err)
 		return
 	}
 
+	// Каждое соединение ведет собственный разговор с ассистентом
+	c := &client{
+		id:     atomic.AddUint64(&um.lastClientID, 1),
+		conn:   conn,
+		device: device,
+	}
+
 	// Регистрируем нового клиента
 	um.clientMutex.Lock()
-	um.clients[conn] = true
+	um.clients[conn] = c
 	um.clientMutex.Unlock()
+	um.limitClient(c)
 
 	// Обрабатываем сообщения от клиента
-	go um.handleMessages(conn)
+	go um.handleMessages(c)
 }
 
 // handleMessages обрабатывает сообщения от клиента
-func (um *UIManager) handleMessages(conn *websocket.Conn) {
+func (um *UIManager) handleMessages(c *client) {
 	defer func() {
-		conn.Close()
+		c.conn.Close()
 		um.clientMutex.Lock()
-		delete(um.clients, conn)
+		delete(um.clients, c.conn)
 		um.clientMutex.Unlock()
+		c.cancelCommand("")
+		um.stopStream(c)
+		um.releaseClient(c)
 	}()
 
 	for {
 		// Читаем сообщение
-		var message map[string]interface{}
-		err := conn.ReadJSON(&message)
+		messageType, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("Ошибка WebSocket: %v", err)
@@ -223,247 +349,515 @@ func (um *UIManager) handleMessages(conn *websocket.Conn) {
 			break
 		}
 
-		// Обрабатываем сообщение
-		um.processMessage(message, conn)
+		// Двоичные кадры — запись с микрофона клиента
+		if messageType == websocket.BinaryMessage {
+			if c.stream == nil {
+				if err := c.send(protocol.NewError("", protocol.Errorf(protocol.CodeBadRequest, "Поток звука не начат"))); err != nil {
+					break
+				}
+				continue
+			}
+			c.stream.Write(data)
+			continue
+		}
+
+		// Обрабатываем сообщение, ответ повторяет идентификатор запроса.
+		// Команды ассистента отвечают сами, когда выполнятся.
+		message, perr := protocol.Parse(data)
+		var msgType string
+		var payload interface{}
+		if perr == nil {
+			msgType, payload, perr = um.processMessage(c, message)
+		}
+
+		var reply protocol.Message
+		switch {
+		case perr != nil:
+			reply = protocol.NewError(message.ID, perr)
+		case msgType == "":
+			continue
+		default:
+			reply = protocol.New(msgType, message.ID, payload)
+		}
+
+		if err := c.send(reply); err != nil {
+			log.Printf("Ошибка отправки сообщения: %v", err)
+			break
+		}
 	}
 }
 
-// processMessage обрабатывает сообщение от клиента
-func (um *UIManager) processMessage(message map[string]interface{}, conn *websocket.Conn) {
-	// Проверяем тип сообщения
-	msgType, ok := message["type"].(string)
-	if !ok {
-		return
+// processMessage обрабатывает запрос клиента и возвращает тип и нагрузку
+// ответа или ошибку протокола. Пустой тип означает, что ответ будет
+// отправлен позже.
+func (um *UIManager) processMessage(c *client, message protocol.Message) (string, interface{}, *protocol.Error) {
+	// До hello клиент не знает, какие запросы ему доступны
+	if message.Type == protocol.TypeHello {
+		var hello protocol.HelloPayload
+		if err := message.Decode(&hello); err != nil {
+			return "", nil, err
+		}
+		um.clientMutex.Lock()
+		c.greeted = true
+		c.capabilities = hello.Capabilities
+		um.clientMutex.Unlock()
+
+		return protocol.TypeWelcome, protocol.WelcomePayload{
+			Version:      protocol.Version,
+			Device:       c.device.Name,
+			Scopes:       c.device.Scopes,
+			Types:        c.allowedTypes(),
+			Capabilities: []string{protocol.CapabilityStream, protocol.CapabilityCancel},
+		}, nil
+	}
+	if !c.greeted {
+		return "", nil, protocol.Errorf(protocol.CodeHandshakeRequired, "Сначала отправьте сообщение hello")
 	}
 
-	switch msgType {
-	case "command":
+	// Проверяем права устройства
+	if scope, ok := messageScopes[message.Type]; ok && !c.device.HasScope(scope) {
+		return "", nil, protocol.Errorf(protocol.CodeForbidden, "Недостаточно прав: нужно право %s", scope)
+	}
+
+	switch message.Type {
+	case protocol.TypeCommand, protocol.TypeChat:
 		// Получаем текст команды
-		text, ok := message["text"].(string)
-		if !ok {
-			return
+		var command protocol.TextPayload
+		if err := message.Decode(&command); err != nil {
+			return "", nil, err
+		}
+		if command.Text == "" {
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "Пустая команда")
+		}
+
+		// Команды мобильного интерфейса ведут отдельный разговор
+		origin := c.origin(assistant.OriginWeb)
+		if message.Type == protocol.TypeChat {
+			origin = c.origin(assistant.OriginMobile)
+		}
+
+		// Отправляем команду ассистенту, ответ придет отдельно
+		um.runCommand(c, message.ID, origin, command.Text, false)
+		return "", nil, nil
+
+	case protocol.TypeAudioStart:
+		// Браузер начал записывать команду
+		c.recording = true
+		c.audio = c.audio[:0]
+		return "", nil, nil
+
+	case protocol.TypeAudioChunk:
+		var chunk protocol.AudioChunkPayload
+		if err := message.Decode(&chunk); err != nil {
+			return "", nil, err
+		}
+		if !c.recording {
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "Запись не начата")
+		}
+		if len(c.audio)+len(chunk.Data) > maxAudioBytes {
+			c.recording = false
+			c.audio = nil
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "Запись длиннее минуты")
+		}
+		c.audio = append(c.audio, chunk.Data...)
+		return "", nil, nil
+
+	case protocol.TypeAudioEnd:
+		// Распознаем запись и выполняем ее как команду, ответ придет отдельно
+		if !c.recording {
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "Запись не начата")
+		}
+		audio := c.audio
+		c.recording = false
+		c.audio = nil
+		go um.runVoiceCommand(c, message.ID, audio)
+		return "", nil, nil
+
+	case protocol.TypeVoiceStreamStart:
+		// Клиент будет присылать звук своего микрофона двоичными кадрами
+		var request protocol.VoiceStreamStartPayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
+		}
+		if request.Format != stt.FormatS16LE && request.Format != stt.FormatF32LE {
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "Неподдерживаемый формат записи %q: поддерживаются %s и %s", request.Format, stt.FormatS16LE, stt.FormatF32LE)
+		}
+		origin := c.origin(assistant.OriginWeb)
+		if request.Source == assistant.OriginMobile {
+			origin = c.origin(assistant.OriginMobile)
 		}
 
-		// Отправляем команду ассистенту
-		response, err := um.assistant.ProcessCommand(text)
+		um.stopStream(c)
+		stream, err := um.assistant.NewVoiceStream(request.Format, request.SampleRate, max(request.Channels, 1),
+			func(text string) { um.runStreamCommand(c, origin, text, request.ReplyAudio) },
+			func(state string) { um.showStreamState(c, state) })
 		if err != nil {
-			log.Printf("Ошибка обработки команды: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"error": err.Error(),
-			})
-			return
+			log.Printf("Ошибка запуска потока звука: %v", err)
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "%v", err)
 		}
+		c.stream = stream
+		return protocol.TypeVoiceStream, protocol.VoiceStreamPayload{Active: true}, nil
+
+	case protocol.TypeVoiceStreamStop:
+		um.stopStream(c)
+		return protocol.TypeVoiceStream, protocol.VoiceStreamPayload{Active: false}, nil
+
+	case protocol.TypeCancel:
+		// Прерываем выполняемую команду
+		var request protocol.CancelPayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
+		}
+		return protocol.TypeCancel, protocol.CancelPayload{ID: request.ID, Cancelled: c.cancelCommand(request.ID)}, nil
 
-		// Отправляем ответ клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type":     "response",
-			"response": response,
+	case protocol.TypeGetHistory:
+		// Получаем страницу истории команд
+		var request protocol.GetHistoryPayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
+		}
+		page, err := um.assistant.QueryHistory(history.Query{
+			Text:       request.Query,
+			Source:     request.Source,
+			Type:       request.Type,
+			Since:      request.Since,
+			Until:      request.Until,
+			After:      request.After,
+			Limit:      request.Limit,
+			Descending: !request.OldestFirst,
 		})
-
-	case "get_history":
-		// Получаем историю команд
-		history, err := um.assistant.GetHistory()
 		if err != nil {
 			log.Printf("Ошибка получения истории: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"error": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
+		return protocol.TypeHistory, protocol.HistoryPayload{History: page.Entries, Next: page.Next}, nil
 
-		// Отправляем историю клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type":    "history",
-			"history": history,
+	case protocol.TypeExportHistory:
+		// Выгружаем историю в файл, который клиент предложит сохранить
+		var request protocol.ExportHistoryPayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
+		}
+		if request.Format == "" {
+			request.Format = history.FormatJSONL
+		}
+		if request.Format != history.FormatJSONL && request.Format != history.FormatCSV && request.Format != history.FormatMarkdown {
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "Неизвестный формат выгрузки: %s", request.Format)
+		}
+		var data bytes.Buffer
+		count, err := um.assistant.ExportHistory(&data, request.Format, history.Query{
+			Text:   request.Query,
+			Source: request.Source,
+			Type:   request.Type,
+			Since:  request.Since,
+			Until:  request.Until,
 		})
+		if err != nil {
+			log.Printf("Ошибка выгрузки истории: %v", err)
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
+		}
+		return protocol.TypeHistoryExport, protocol.HistoryExportPayload{
+			Format:   request.Format,
+			FileName: "kot-history-" + time.Now().Format("20060102-150405") + "." + request.Format,
+			Data:     data.String(),
+			Count:    count,
+		}, nil
+
+	case protocol.TypeNewConversation:
+		// Начинаем новый разговор для этого клиента
+		var request protocol.NewConversationPayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
+		}
+		origin := c.origin(assistant.OriginWeb)
+		if request.Source == assistant.OriginMobile {
+			origin = c.origin(assistant.OriginMobile)
+		}
+		return protocol.TypeConversation, protocol.ConversationPayload{SessionID: um.assistant.NewConversation(origin)}, nil
 
-	case "get_config":
-		// Отправляем конфигурацию клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type":   "config",
-			"config": um.config,
-		})
+	case protocol.TypeGetConversations:
+		// Получаем список прошлых разговоров
+		conversations, err := um.assistant.ListConversations()
+		if err != nil {
+			log.Printf("Ошибка получения списка разговоров: %v", err)
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
+		}
+		return protocol.TypeConversations, protocol.ConversationsPayload{Conversations: conversations}, nil
 
-	// Мобильные команды
-	case "chat":
-		// Получаем текст сообщения
-		messageText, ok := message["message"].(string)
-		if !ok {
-			return
+	case protocol.TypePairingCode:
+		// Выдаем код для подключения другого устройства
+		code, expires, err := um.PairingCode()
+		if err != nil {
+			log.Printf("Ошибка выдачи кода подключения: %v", err)
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
+		return protocol.TypePairingCode, protocol.PairingCodePayload{Code: code, Expires: expires}, nil
 
-		// Отправляем сообщение ассистенту
-		response, err := um.assistant.ProcessCommand(messageText)
+	case protocol.TypeGetConfig:
+		// Отправляем настройки как в файле, без ключей API
+		manager := um.configManager()
+		if manager == nil {
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "Настройки недоступны")
+		}
+		return protocol.TypeConfig, protocol.ConfigPayload{
+			Config:    manager.File().Redacted(),
+			Overrides: manager.Overrides(),
+		}, nil
+
+	case protocol.TypeSetConfig:
+		// Проверяем, сохраняем и применяем новые настройки
+		manager := um.configManager()
+		if manager == nil {
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "Настройки недоступны")
+		}
+		var request protocol.SetConfigPayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
+		}
+		updated, err := config.Parse(request.Config)
 		if err != nil {
-			log.Printf("Ошибка обработки сообщения: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "Некорректные настройки: %v", err)
+		}
+		changes, err := manager.Update(updated.Unredact(manager.File()))
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			return "", nil, protocol.Errorf(protocol.CodeBadRequest, "%v", err)
+		}
+		if err != nil {
+			log.Printf("Ошибка сохранения настроек: %v", err)
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
+		if changes == nil {
+			changes = []config.Change{}
+		}
+		return protocol.TypeConfig, protocol.ConfigPayload{
+			Config:    manager.File().Redacted(),
+			Overrides: manager.Overrides(),
+			Changes:   changes,
+		}, nil
+
+	case protocol.TypeGetAudioDevices:
+		// Получаем микрофоны и динамики для панели настроек
+		devices, err := um.assistant.AudioDevices()
+		if err != nil {
+			log.Printf("Ошибка получения списка аудиоустройств: %v", err)
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "%v", err)
+		}
+		return protocol.TypeAudioDevices, protocol.AudioDevicesPayload{Devices: devices}, nil
 
-		// Отправляем ответ клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type":    "chat",
-			"message": response,
-		})
+	case protocol.TypeSetAudioDevice:
+		// Переключаем микрофон или динамик и отправляем новый список
+		var request protocol.SetAudioDevicePayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
+		}
+		if err := um.assistant.SetAudioDevice(request.Kind, request.Device); err != nil {
+			log.Printf("Ошибка выбора аудиоустройства: %v", err)
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
+		}
+		devices, err := um.assistant.AudioDevices()
+		if err != nil {
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
+		}
+		return protocol.TypeAudioDevices, protocol.AudioDevicesPayload{Devices: devices}, nil
 
-	case "system_info":
+	case protocol.TypeSystemInfo:
 		// Получаем информацию о системе
-		sysInfo, err := system.GetSystemInfo()
+		sys := um.assistant.System()
+		if sys == nil {
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "Управление компьютером недоступно")
+		}
+		sysInfo, err := sys.GetSystemInfo()
 		if err != nil {
 			log.Printf("Ошибка получения информации о системе: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
+		return protocol.TypeSystemInfo, protocol.SystemInfoPayload{Info: sysInfo}, nil
 
-		// Отправляем информацию клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type": "system_info",
-			"info": sysInfo,
-		})
-
-	case "execute":
+	case protocol.TypeExecute:
 		// Получаем команду для выполнения
-		cmd, ok := message["command"].(string)
-		if !ok {
-			return
+		var request protocol.ExecutePayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
 		}
 
-		// Выполняем команду
-		output, err := system.ExecuteCommand(cmd)
+		// Выполняем команду по правилам политики ассистента: она может
+		// потребовать подтверждения командой "да" от этого же клиента
+		output, err := um.assistant.ExecuteShell(c.origin(assistant.OriginWeb), request.Command)
 		if err != nil {
 			log.Printf("Ошибка выполнения команды: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
+		return protocol.TypeCommandResult, protocol.CommandResultPayload{Output: output}, nil
 
-		// Отправляем результат клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type":   "command_result",
-			"result": output,
-		})
-
-	case "screenshot":
+	case protocol.TypeScreenshot:
 		// Делаем скриншот
+		sys := um.assistant.System()
+		if sys == nil {
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "Управление компьютером недоступно")
+		}
 		tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("kot_screenshot_%d.png", time.Now().Unix()))
-		err := system.TakeScreenshot(tmpFile)
-		if err != nil {
+		if err := sys.TakeScreenshot(tmpFile); err != nil {
 			log.Printf("Ошибка создания скриншота: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
 
-		// Читаем файл и кодируем в base64
-		imgData, err := os.ReadFile(tmpFile)
+		data, err := readScreenshot(tmpFile)
 		if err != nil {
 			log.Printf("Ошибка чтения скриншота: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
+		return protocol.TypeScreenshot, protocol.ScreenshotPayload{Data: data}, nil
 
-		// Удаляем временный файл
-		os.Remove(tmpFile)
-
-		// Отправляем скриншот клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type": "screenshot",
-			"data": base64.StdEncoding.EncodeToString(imgData),
-		})
-
-	case "mobile_command":
+	case protocol.TypeMobileCommand:
 		// Получаем команду для мобильного устройства
-		cmd, ok := message["command"].(string)
-		if !ok || um.mobileManager == nil {
-			return
+		var request protocol.ExecutePayload
+		if err := message.Decode(&request); err != nil {
+			return "", nil, err
 		}
 
 		// Проверяем, подключено ли устройство
-		if !um.mobileManager.IsConnectedUSB() {
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": "Нет подключенного USB-устройства",
-			})
-			return
+		if um.mobileManager == nil || !um.mobileManager.IsConnectedUSB() {
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "Нет подключенного USB-устройства")
 		}
 
 		// Выполняем команду на устройстве
-		output, err := um.mobileManager.ExecuteCommand(cmd)
+		output, err := um.mobileManager.ExecuteCommand(request.Command)
 		if err != nil {
 			log.Printf("Ошибка выполнения команды на устройстве: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
+		return protocol.TypeCommandResult, protocol.CommandResultPayload{Source: assistant.OriginMobile, Output: output}, nil
 
-		// Отправляем результат клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type":   "command_result",
-			"result": output,
-		})
-
-	case "mobile_screenshot":
+	case protocol.TypeMobileScreenshot:
 		// Проверяем, подключено ли устройство
 		if um.mobileManager == nil || !um.mobileManager.IsConnectedUSB() {
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": "Нет подключенного USB-устройства",
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeUnavailable, "Нет подключенного USB-устройства")
 		}
 
 		// Делаем скриншот устройства
 		tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("kot_mobile_screenshot_%d.png", time.Now().Unix()))
-		err := um.mobileManager.TakeScreenshot(tmpFile)
-		if err != nil {
+		if err := um.mobileManager.TakeScreenshot(tmpFile); err != nil {
 			log.Printf("Ошибка создания скриншота устройства: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
-			})
-			return
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
 		}
 
-		// Читаем файл и кодируем в base64
-		imgData, err := os.ReadFile(tmpFile)
+		data, err := readScreenshot(tmpFile)
 		if err != nil {
 			log.Printf("Ошибка чтения скриншота устройства: %v", err)
-			conn.WriteJSON(map[string]interface{}{
-				"type":  "error",
-				"message": err.Error(),
+			return "", nil, protocol.Errorf(protocol.CodeInternal, "%v", err)
+		}
+		return protocol.TypeScreenshot, protocol.ScreenshotPayload{Source: assistant.OriginMobile, Data: data}, nil
+	}
+
+	return "", nil, protocol.Errorf(protocol.CodeUnknownType, "Неизвестный тип сообщения: %s", message.Type)
+}
+
+// runCommand выполняет команду ассистента в отдельной горутине, чтобы
+// клиент мог прервать ее запросом cancel. Новая команда прерывает
+// предыдущую. Клиенты с возможностью stream получают ответ частями. С spoken
+// каждое предложение ответа приходит еще и звуком.
+func (um *UIManager) runCommand(c *client, id, origin, text string, spoken bool) {
+	ctx, command := c.startCommand(id)
+
+	go func() {
+		c.commandMutex.Lock()
+		defer c.commandMutex.Unlock()
+		defer c.finishCommand(command)
+
+		var onDelta func(string)
+		if c.hasCapability(protocol.CapabilityStream) {
+			onDelta = func(delta string) {
+				c.send(protocol.New(protocol.TypeResponseDelta, id, protocol.DeltaPayload{Text: delta}))
+			}
+		}
+
+		// Команда могла быть прервана, пока ждала предыдущую
+		var response string
+		err := ctx.Err()
+		switch {
+		case err != nil:
+		case spoken:
+			// Каждое предложение ответа уходит клиенту звуком
+			response, err = um.assistant.ProcessCommandSpoken(ctx, origin, text, onDelta, func(audio tts.Audio) error {
+				return c.sendAudio(audio.Data)
 			})
-			return
+		default:
+			response, err = um.assistant.ProcessCommandStream(ctx, origin, text, onDelta)
 		}
+		cancelled := errors.Is(err, context.Canceled)
 
-		// Удаляем временный файл
-		os.Remove(tmpFile)
+		var reply protocol.Message
+		switch {
+		case err != nil && !cancelled:
+			log.Printf("Ошибка обработки команды: %v", err)
+			reply = protocol.NewError(id, protocol.Errorf(protocol.CodeInternal, "%v", err))
+		case onDelta != nil:
+			reply = protocol.New(protocol.TypeResponseDone, id, protocol.ResponsePayload{Text: response, Cancelled: cancelled})
+		default:
+			reply = protocol.New(protocol.TypeResponse, id, protocol.ResponsePayload{Text: response, Cancelled: cancelled})
+		}
+		if err := c.send(reply); err != nil {
+			log.Printf("Ошибка отправки ответа: %v", err)
+		}
+	}()
+}
 
-		// Отправляем скриншот клиенту
-		conn.WriteJSON(map[string]interface{}{
-			"type": "screenshot",
-			"data": base64.StdEncoding.EncodeToString(imgData),
-		})
+// runVoiceCommand распознает запись из браузера, отправляет клиенту
+// распознанный текст и выполняет его как команду
+func (um *UIManager) runVoiceCommand(c *client, id string, audio []byte) {
+	text, err := um.assistant.Transcribe(audio)
+	if err != nil {
+		log.Printf("Ошибка распознавания записи из браузера: %v", err)
+		c.send(protocol.NewError(id, protocol.Errorf(protocol.CodeUnavailable, "%v", err)))
+		return
+	}
+	if err := c.send(protocol.New(protocol.TypeTranscript, id, protocol.TranscriptPayload{Text: text})); err != nil {
+		log.Printf("Ошибка отправки распознанного текста: %v", err)
+		return
+	}
+	if text != "" {
+		um.runCommand(c, id, c.origin(assistant.OriginWeb), text, false)
+	}
+}
 
-	default:
-		log.Printf("Неизвестный тип сообщения: %s", msgType)
+// runStreamCommand выполняет команду, услышанную в потоке звука клиента.
+// Клиент сначала получает распознанный текст, затем ответ с тем же
+// идентификатором.
+func (um *UIManager) runStreamCommand(c *client, origin, text string, spoken bool) {
+	id := fmt.Sprintf("voice-%d", atomic.AddUint64(&c.streamCommands, 1))
+	if err := c.send(protocol.New(protocol.TypeTranscript, id, protocol.TranscriptPayload{Text: text})); err != nil {
+		log.Printf("Ошибка отправки распознанного текста: %v", err)
+		return
 	}
+	um.runCommand(c, id, origin, text, spoken)
+}
+
+// showStreamState сообщает клиенту, слушает ли поток его звука команду.
+// Ключевое слово прерывает ответ на предыдущую команду.
+func (um *UIManager) showStreamState(c *client, state string) {
+	if state == voice.StateCommand {
+		c.cancelCommand("")
+	}
+	c.send(protocol.New(protocol.TypeVoiceState, "", protocol.VoiceStatePayload{State: state, Stream: true}))
+}
+
+// stopStream останавливает поток звука клиента
+func (um *UIManager) stopStream(c *client) {
+	if c.stream != nil {
+		c.stream.Close()
+		c.stream = nil
+	}
+}
+
+// readScreenshot читает скриншот, кодирует его в base64 и удаляет файл
+func readScreenshot(path string) (string, error) {
+	imgData, err := os.ReadFile(path)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+	os.Remove(path)
+	return base64.StdEncoding.EncodeToString(imgData), nil
 }
 
 // handleMobileUI обрабатывает запросы к мобильному интерфейсу
@@ -560,15 +954,91 @@ func (um *UIManager) extractWebFiles(destDir string) error {
         .input-container button:hover {
             background-color: #3a76d8;
         }
+        .input-container button.recording {
+            background-color: #d84a4a;
+        }
+        .pairing {
+            display: none;
+            flex-direction: column;
+            gap: 10px;
+            max-width: 320px;
+            margin: 40px auto;
+        }
+        .pairing input, .pairing button {
+            padding: 10px;
+            font-size: 16px;
+        }
+        .listening {
+            display: none;
+            margin-right: 10px;
+        }
+        .settings {
+            display: none;
+            flex-direction: column;
+            gap: 10px;
+            padding: 10px 20px;
+            background-color: white;
+            border-bottom: 1px solid #ddd;
+        }
+        .settings label {
+            display: flex;
+            align-items: center;
+            gap: 10px;
+        }
+        .settings select {
+            flex: 1;
+            padding: 5px;
+        }
+        #config-editor {
+            max-height: 50vh;
+            overflow-y: auto;
+        }
+        #config-editor fieldset {
+            display: flex;
+            flex-direction: column;
+            gap: 5px;
+            margin-bottom: 10px;
+        }
+        #config-editor input[type=text], #config-editor input[type=number], #config-editor textarea {
+            flex: 1;
+            padding: 5px;
+        }
+        #config-editor .override {
+            color: #999;
+        }
     </style>
 </head>
 <body>
     <div class="header">
         <h1>KOT.AI</h1>
         <div>
+            <span class="listening" id="listening"></span>
+            <button id="pair-btn">Подключить устройство</button>
             <button id="settings-btn">Настройки</button>
         </div>
     </div>
+    <div class="pairing" id="pairing">
+        <p>Введите код подключения, который ассистент показал в консоли или назвал по команде "код подключения".</p>
+        <input type="text" id="pairing-code" inputmode="numeric" placeholder="Код подключения">
+        <input type="text" id="pairing-name" placeholder="Название устройства">
+        <button id="pairing-btn">Подключить</button>
+    </div>
+    <div class="settings" id="settings">
+        <label>Микрофон <select id="input-device" data-kind="input"></select></label>
+        <label>Динамик <select id="output-device" data-kind="output"></select></label>
+        <label>История
+            <select id="export-format">
+                <option value="jsonl">JSON Lines</option>
+                <option value="csv">CSV</option>
+                <option value="md">Markdown</option>
+            </select>
+            <button id="export-btn">Выгрузить</button>
+        </label>
+        <div id="config-editor"></div>
+        <button id="config-save">Сохранить настройки</button>
+        <div id="settings-status"></div>
+        <button id="settings-close">Закрыть</button>
+    </div>
     <div class="chat-container" id="chat-container">
         <div class="message bot-message">
             Привет! Я KOT.AI, ваш персональный ассистент. Чем я могу помочь?
@@ -577,36 +1047,160 @@ func (um *UIManager) extractWebFiles(destDir string) error {
     <div class="input-container">
         <input type="text" id="message-input" placeholder="Введите сообщение...">
         <button id="send-btn">Отправить</button>
+        <button id="talk-btn" title="Удерживайте, чтобы говорить">🎤</button>
+        <button id="stop-btn">Стоп</button>
     </div>
 
     <script>
         const chatContainer = document.getElementById('chat-container');
         const messageInput = document.getElementById('message-input');
         const sendBtn = document.getElementById('send-btn');
+        const stopBtn = document.getElementById('stop-btn');
+        // Сообщения с ответами, которые еще приходят по частям
+        const streams = {};
         const settingsBtn = document.getElementById('settings-btn');
-        
+        const pairBtn = document.getElementById('pair-btn');
+        const pairing = document.getElementById('pairing');
+        const settings = document.getElementById('settings');
+        const settingsStatus = document.getElementById('settings-status');
+        const inputDevice = document.getElementById('input-device');
+        const outputDevice = document.getElementById('output-device');
+        const listening = document.getElementById('listening');
+        const talkBtn = document.getElementById('talk-btn');
+        const configEditor = document.getElementById('config-editor');
+        // Настройки в том виде, в каком их прислал сервер
+        let loadedConfig = null;
+        let ws = null;
+        let requestID = 0;
+
+        // Отправка запроса: сервер повторяет идентификатор в ответе
+        function request(type, payload) {
+            requestID++;
+            ws.send(JSON.stringify({ v: 1, type: type, id: String(requestID), payload: payload }));
+            return String(requestID);
+        }
+
+        // Токен устройства приходит во фрагменте адреса от самого ассистента
+        // или выдается после ввода кода подключения
+        const hashParams = new URLSearchParams(window.location.hash.slice(1));
+        if (hashParams.get('token')) {
+            localStorage.setItem('kotToken', hashParams.get('token'));
+            history.replaceState(null, '', window.location.pathname + (hashParams.has('settings') ? '#settings' : ''));
+        }
+
+        // Проверяем токен и подключаемся или показываем форму подключения
+        function connect() {
+            const token = localStorage.getItem('kotToken') || '';
+            fetch('/api/session', { headers: { 'Authorization': 'Bearer ' + token } })
+                .then(function(response) {
+                    if (response.ok) {
+                        pairing.style.display = 'none';
+                        chatContainer.style.display = 'flex';
+                        openSocket(token);
+                    } else {
+                        pairing.style.display = 'flex';
+                        chatContainer.style.display = 'none';
+                    }
+                });
+        }
+
+        // Подключение устройства по коду
+        document.getElementById('pairing-btn').addEventListener('click', function() {
+            fetch('/api/pair', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    code: document.getElementById('pairing-code').value,
+                    name: document.getElementById('pairing-name').value
+                })
+            }).then(function(response) {
+                if (!response.ok) {
+                    return response.text().then(function(text) { alert(text); });
+                }
+                return response.json().then(function(data) {
+                    localStorage.setItem('kotToken', data.token);
+                    connect();
+                });
+            });
+        });
+
         // Устанавливаем WebSocket соединение
-        const ws = new WebSocket('ws://' + window.location.host + '/ws');
+        function openSocket(token) {
+        ws = new WebSocket('ws://' + window.location.host + '/ws?token=' + encodeURIComponent(token));
         
         ws.onopen = function() {
             console.log('WebSocket соединение установлено');
+            request('hello', { client: 'desktop', capabilities: ['stream'] });
+            if (settings.style.display === 'flex') {
+                request('get_audio_devices');
+                request('get_config');
+            }
         };
         
         ws.onmessage = function(event) {
             const message = JSON.parse(event.data);
+            const payload = message.payload || {};
             
             switch(message.type) {
+                case 'welcome':
+                    console.log('Протокол версии ' + payload.version + ', доступные запросы:', payload.types);
+                    break;
                 case 'response':
-                    addMessage(message.response, 'bot');
+                    addMessage(payload.text, 'bot');
+                    break;
+                case 'response_delta':
+                    if (!streams[message.id]) {
+                        streams[message.id] = addMessage('', 'bot');
+                    }
+                    streams[message.id].textContent += payload.text;
+                    chatContainer.scrollTop = chatContainer.scrollHeight;
+                    break;
+                case 'response_done':
+                    const answer = streams[message.id] || addMessage(payload.text, 'bot');
+                    if (payload.cancelled) {
+                        answer.textContent += ' (прервано)';
+                    }
+                    delete streams[message.id];
                     break;
                 case 'error':
-                    addMessage('Ошибка: ' + message.error, 'bot');
+                    if (settings.style.display === 'flex') {
+                        settingsStatus.textContent = payload.message;
+                    }
+                    addMessage('Ошибка: ' + payload.message, 'bot');
+                    break;
+                case 'transcript':
+                    if (payload.text) {
+                        addMessage(payload.text, 'user');
+                    } else {
+                        addMessage('Не удалось разобрать речь', 'bot');
+                    }
+                    break;
+                case 'voice_state':
+                    showVoiceState(payload.state);
+                    break;
+                case 'audio_devices':
+                    showDevices(inputDevice, payload.devices.inputs, payload.devices.input);
+                    showDevices(outputDevice, payload.devices.outputs, payload.devices.output);
+                    settingsStatus.textContent = '';
                     break;
                 case 'history':
                     // Обработка истории
                     break;
+                case 'history_export':
+                    downloadFile(payload.file_name, payload.data, payload.format);
+                    settingsStatus.textContent = 'Выгружено записей: ' + payload.count;
+                    break;
                 case 'config':
-                    // Обработка конфигурации
+                    showConfig(payload.config, payload.overrides || []);
+                    if (payload.changes) {
+                        showChanges(payload.changes);
+                    }
+                    break;
+                case 'show_settings':
+                    openSettings();
+                    break;
+                case 'pairing_code':
+                    addMessage('Код подключения: ' + payload.code + '. Введите его на другом устройстве в течение нескольких минут.', 'bot');
                     break;
             }
         };
@@ -619,6 +1213,7 @@ func (um *UIManager) extractWebFiles(destDir string) error {
             console.log('WebSocket соединение закрыто');
             addMessage('Соединение с сервером потеряно. Пожалуйста, обновите страницу.', 'bot');
         };
+        }
         
         // Отправка сообщения
         function sendMessage() {
@@ -627,10 +1222,7 @@ func (um *UIManager) extractWebFiles(destDir string) error {
             
             addMessage(text, 'user');
             
-            ws.send(JSON.stringify({
-                type: 'command',
-                text: text
-            }));
+            request('command', { text: text });
             
             messageInput.value = '';
         }
@@ -643,10 +1235,16 @@ func (um *UIManager) extractWebFiles(destDir string) error {
             
             chatContainer.appendChild(messageDiv);
             chatContainer.scrollTop = chatContainer.scrollHeight;
+            return messageDiv;
         }
         
         // Обработчики событий
         sendBtn.addEventListener('click', sendMessage);
+
+        // Прерываем ответ, который еще генерируется
+        stopBtn.addEventListener('click', function() {
+            request('cancel', {});
+        });
         
         messageInput.addEventListener('keypress', function(e) {
             if (e.key === 'Enter') {
@@ -654,10 +1252,255 @@ func (um *UIManager) extractWebFiles(destDir string) error {
             }
         });
         
-        settingsBtn.addEventListener('click', function() {
-            // Открытие настроек
-            alert('Настройки пока не реализованы');
+        // Запись команды, пока кнопка нажата. Звук уменьшается до 16 кГц,
+        // 16 бит и уходит на сервер частями, там его распознают как речь
+        // с микрофона компьютера.
+        let recorder = null;
+
+        function startTalking(event) {
+            event.preventDefault();
+            if (recorder || !ws || ws.readyState !== WebSocket.OPEN) return;
+            const attempt = recorder = {};
+            navigator.mediaDevices.getUserMedia({ audio: true }).then(function(stream) {
+                if (recorder !== attempt) {
+                    // Кнопку отпустили, пока браузер спрашивал разрешение
+                    stream.getTracks().forEach(function(track) { track.stop(); });
+                    return;
+                }
+                const context = new AudioContext();
+                const source = context.createMediaStreamSource(stream);
+                const processor = context.createScriptProcessor(4096, 1, 1);
+                processor.onaudioprocess = function(e) {
+                    ws.send(JSON.stringify({ v: 1, type: 'audio_chunk', payload: {
+                        data: encodePCM(e.inputBuffer.getChannelData(0), context.sampleRate)
+                    } }));
+                };
+                request('audio_start', {});
+                source.connect(processor);
+                processor.connect(context.destination);
+                attempt.stream = stream;
+                attempt.context = context;
+                attempt.processor = processor;
+                talkBtn.classList.add('recording');
+            }).catch(function(err) {
+                recorder = null;
+                addMessage('Нет доступа к микрофону: ' + err.message, 'bot');
+            });
+        }
+
+        function stopTalking() {
+            const current = recorder;
+            recorder = null;
+            if (!current || !current.context) return;
+            talkBtn.classList.remove('recording');
+            current.processor.disconnect();
+            current.stream.getTracks().forEach(function(track) { track.stop(); });
+            current.context.close();
+            request('audio_end', {});
+        }
+
+        // Перевод отсчетов Web Audio в 16 кГц, 16 бит little-endian и base64
+        function encodePCM(samples, sampleRate) {
+            const ratio = sampleRate / 16000;
+            const count = Math.floor(samples.length / ratio);
+            const bytes = new Uint8Array(count * 2);
+            const view = new DataView(bytes.buffer);
+            for (let i = 0; i < count; i++) {
+                const start = Math.floor(i * ratio);
+                const end = Math.max(start + 1, Math.floor((i + 1) * ratio));
+                let sum = 0;
+                for (let j = start; j < end; j++) sum += samples[j];
+                const sample = Math.max(-1, Math.min(1, sum / (end - start)));
+                view.setInt16(i * 2, sample * 32767, true);
+            }
+            let binary = '';
+            for (let i = 0; i < bytes.length; i++) binary += String.fromCharCode(bytes[i]);
+            return btoa(binary);
+        }
+
+        talkBtn.addEventListener('mousedown', startTalking);
+        talkBtn.addEventListener('touchstart', startTalking);
+        ['mouseup', 'mouseleave', 'touchend', 'touchcancel'].forEach(function(type) {
+            talkBtn.addEventListener(type, stopTalking);
         });
+
+        // Индикатор: ассистент слушает команду или ждет продолжения разговора
+        function showVoiceState(state) {
+            const labels = { command: '🎤 Слушаю', follow_up: '🎤 Жду продолжения' };
+            listening.textContent = labels[state] || '';
+            listening.style.display = labels[state] ? 'inline' : 'none';
+        }
+
+        // Открытие настроек: список устройств запрашивается заново, чтобы
+        // показать подключенные после запуска
+        function openSettings() {
+            settings.style.display = 'flex';
+            settingsStatus.textContent = 'Загрузка устройств...';
+            if (ws && ws.readyState === WebSocket.OPEN) {
+                request('get_audio_devices');
+                request('get_config');
+            }
+        }
+
+        // Названия разделов настроек
+        const sectionTitles = { assistant: 'Ассистент', voice: 'Голос', ui: 'Интерфейс', mobile: 'Телефон', security: 'Безопасность' };
+
+        // Форма строится по присланным настройкам: флажок для логических
+        // значений, поле для чисел и строк, JSON для списков и словарей.
+        // Ключи API приходят скрытыми и остаются прежними, если их не менять.
+        function showConfig(config, overrides) {
+            loadedConfig = config;
+            configEditor.innerHTML = '';
+            Object.keys(config).forEach(function(section) {
+                const values = config[section];
+                if (values === null || typeof values !== 'object') return;
+                const fieldset = document.createElement('fieldset');
+                const legend = document.createElement('legend');
+                legend.textContent = sectionTitles[section] || section;
+                fieldset.appendChild(legend);
+                Object.keys(values).forEach(function(name) {
+                    const path = section + '.' + name;
+                    const value = values[name];
+                    let input;
+                    if (typeof value === 'boolean') {
+                        input = document.createElement('input');
+                        input.type = 'checkbox';
+                        input.checked = value;
+                    } else if (typeof value === 'number') {
+                        input = document.createElement('input');
+                        input.type = 'number';
+                        input.step = 'any';
+                        input.value = value;
+                    } else if (typeof value === 'string') {
+                        input = document.createElement('input');
+                        input.type = 'text';
+                        input.value = value;
+                    } else {
+                        input = document.createElement('textarea');
+                        input.value = JSON.stringify(value);
+                    }
+                    input.dataset.path = path;
+                    const label = document.createElement('label');
+                    label.textContent = name;
+                    label.appendChild(input);
+                    // Такая настройка сохраняется в файл, но действует значение из окружения
+                    if (overrides.indexOf(path) >= 0) {
+                        const note = document.createElement('span');
+                        note.className = 'override';
+                        note.textContent = 'задано переменной окружения';
+                        label.appendChild(note);
+                    }
+                    fieldset.appendChild(label);
+                });
+                configEditor.appendChild(fieldset);
+            });
+        }
+
+        // Сбор настроек из формы; ошибка в JSON называет поле
+        function readConfig() {
+            const config = JSON.parse(JSON.stringify(loadedConfig));
+            configEditor.querySelectorAll('[data-path]').forEach(function(input) {
+                const parts = input.dataset.path.split('.');
+                const section = config[parts[0]];
+                if (input.type === 'checkbox') {
+                    section[parts[1]] = input.checked;
+                } else if (input.type === 'number') {
+                    section[parts[1]] = Number(input.value);
+                } else if (input.tagName === 'TEXTAREA') {
+                    try {
+                        section[parts[1]] = JSON.parse(input.value || 'null');
+                    } catch (err) {
+                        throw new Error(input.dataset.path + ': ' + err.message);
+                    }
+                } else {
+                    section[parts[1]] = input.value;
+                }
+            });
+            return config;
+        }
+
+        // Итог сохранения: что применено сразу, а что после перезапуска
+        function showChanges(changes) {
+            if (changes.length === 0) {
+                settingsStatus.textContent = 'Настройки не изменились';
+                return;
+            }
+            const live = changes.filter(function(change) { return !change.restart; });
+            const restart = changes.filter(function(change) { return change.restart; });
+            let text = 'Настройки сохранены.';
+            if (live.length > 0) {
+                text += ' Применено сразу: ' + live.map(function(change) { return change.field; }).join(', ') + '.';
+            }
+            if (restart.length > 0) {
+                text += ' Применится после перезапуска: ' + restart.map(function(change) { return change.field; }).join(', ') + '.';
+            }
+            settingsStatus.textContent = text;
+        }
+
+        document.getElementById('config-save').addEventListener('click', function() {
+            if (!loadedConfig) return;
+            let config;
+            try {
+                config = readConfig();
+            } catch (err) {
+                settingsStatus.textContent = err.message;
+                return;
+            }
+            settingsStatus.textContent = 'Сохранение настроек...';
+            request('set_config', { config: config });
+        });
+
+        // Заполнение списка устройств; пустое значение — устройство по умолчанию
+        function showDevices(select, devices, selected) {
+            select.innerHTML = '';
+            select.appendChild(new Option('По умолчанию', ''));
+            (devices || []).forEach(function(device) {
+                const option = new Option(device.name + (device.default ? ' (по умолчанию)' : ''), device.name);
+                option.selected = device.name === selected || device.id === selected;
+                select.appendChild(option);
+            });
+        }
+
+        // Выбранное устройство включается сразу
+        [inputDevice, outputDevice].forEach(function(select) {
+            select.addEventListener('change', function() {
+                settingsStatus.textContent = 'Переключение...';
+                request('set_audio_device', { kind: select.dataset.kind, device: select.value });
+            });
+        });
+
+        // Сохранение выгруженной истории в файл
+        function downloadFile(name, data, format) {
+            const types = { jsonl: 'application/x-ndjson', csv: 'text/csv', md: 'text/markdown' };
+            const url = URL.createObjectURL(new Blob([data], { type: (types[format] || 'text/plain') + ';charset=utf-8' }));
+            const link = document.createElement('a');
+            link.href = url;
+            link.download = name;
+            document.body.appendChild(link);
+            link.click();
+            link.remove();
+            URL.revokeObjectURL(url);
+        }
+
+        document.getElementById('export-btn').addEventListener('click', function() {
+            settingsStatus.textContent = 'Выгрузка истории...';
+            request('export_history', { format: document.getElementById('export-format').value });
+        });
+
+        settingsBtn.addEventListener('click', openSettings);
+        document.getElementById('settings-close').addEventListener('click', function() {
+            settings.style.display = 'none';
+        });
+
+        pairBtn.addEventListener('click', function() {
+            request('pairing_code');
+        });
+
+        connect();
+
+        if (window.location.hash === '#settings') {
+            openSettings();
+        }
     </script>
 </body>
 </html>`
@@ -1,209 +1,252 @@
 package ui
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+
+	"kot.ai/internal/auth"
+	"kot.ai/internal/config"
+	"kot.ai/internal/protocol"
 )
 
-func TestNewUIManager(t *testing.T) {
-	// Создаем конфигурацию для тестирования
-	config := UIConfig{
-		Enabled:        true,
-		UIType:         "web",
-		WebPort:        8080,
-		Theme:          "dark",
-		StartMinimized: false,
+// testConfig возвращает настройки интерфейса для тестов
+func testConfig(t *testing.T) UIConfig {
+	return UIConfig{
+		Enabled:     true,
+		UIType:      "web",
+		WebPort:     8080,
+		Theme:       "dark",
+		LocalOnly:   true,
+		DevicesPath: filepath.Join(t.TempDir(), "devices.json"),
 	}
+}
 
-	// Создаем новый экземпляр UIManager
-	um, err := NewUIManager(config)
-
-	// Проверяем, что UIManager создан без ошибок
-	assert.NoError(t, err)
-	assert.NotNil(t, um)
-
-	// Проверяем, что поля UIManager инициализированы правильно
-	assert.Equal(t, config.Enabled, um.Config.Enabled)
-	assert.Equal(t, config.UIType, um.Config.UIType)
-	assert.Equal(t, config.WebPort, um.Config.WebPort)
-	assert.Equal(t, config.Theme, um.Config.Theme)
-	assert.Equal(t, config.StartMinimized, um.Config.StartMinimized)
-
-	// Проверяем, что каналы созданы
-	assert.NotNil(t, um.CommandChan)
-	assert.NotNil(t, um.ResponseChan)
-
-	// Останавливаем UIManager после теста
-	um.Stop()
+// newTestServer запускает обработчики веб-интерфейса на тестовом сервере
+func newTestServer(t *testing.T, um *UIManager) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", um.handleWebSocket)
+	mux.HandleFunc("/api/pair", um.handlePair)
+	mux.HandleFunc("/api/session", um.handleSession)
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		um.Stop()
+		server.Close()
+	})
+	return server
 }
 
-func TestWebHandler(t *testing.T) {
-	// Создаем конфигурацию для тестирования
-	config := UIConfig{
-		Enabled:        true,
-		UIType:         "web",
-		WebPort:        8080,
-		Theme:          "dark",
-		StartMinimized: false,
+// dial подключается к WebSocket с токеном устройства с правами scopes
+func dial(t *testing.T, um *UIManager, server *httptest.Server, scopes ...string) *websocket.Conn {
+	token, _, err := um.auth.IssueTemporary("Тест", scopes)
+	if !assert.NoError(t, err) {
+		t.FailNow()
 	}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
 
-	// Создаем новый экземпляр UIManager
-	um, err := NewUIManager(config)
-	assert.NoError(t, err)
-
-	// Создаем тестовый HTTP-запрос
-	req, err := http.NewRequest("GET", "/", nil)
-	assert.NoError(t, err)
-
-	// Создаем тестовый HTTP-ответ
-	rec := httptest.NewRecorder()
-
-	// Вызываем обработчик
-	um.webHandler(rec, req)
+// call отправляет запрос и возвращает ответ с тем же идентификатором
+func call(t *testing.T, conn *websocket.Conn, msgType, id string, payload interface{}) protocol.Message {
+	assert.NoError(t, conn.WriteJSON(protocol.New(msgType, id, payload)))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var reply protocol.Message
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("нет ответа на %s: %v", msgType, err)
+		}
+		if reply.ID == id {
+			return reply
+		}
+	}
+}
 
-	// Проверяем код ответа
-	assert.Equal(t, http.StatusOK, rec.Code)
+// decodeError возвращает ошибку из ответа типа error
+func decodeError(t *testing.T, reply protocol.Message) protocol.Error {
+	var e protocol.Error
+	if assert.Equal(t, protocol.TypeError, reply.Type) {
+		assert.Nil(t, reply.Decode(&e))
+	}
+	return e
+}
 
-	// Проверяем, что ответ содержит ожидаемый HTML
-	assert.Contains(t, rec.Body.String(), "<!DOCTYPE html>")
-	assert.Contains(t, rec.Body.String(), "KOT.AI")
+func TestNewUIManager(t *testing.T) {
+	config := testConfig(t)
+	um := NewUIManager(config, nil, nil)
+	assert.NotNil(t, um)
+	assert.Equal(t, config, um.currentConfig())
+
+	// Тема и разрешенные страницы меняются сразу, адрес сервера — после перезапуска
+	changed := config
+	changed.Theme = "light"
+	changed.WebPort = 9090
+	changed.AllowedOrigins = []string{"https://kot.example"}
+	um.Reconfigure(changed)
+	assert.Equal(t, "light", um.currentConfig().Theme)
+	assert.Equal(t, []string{"https://kot.example"}, um.currentConfig().AllowedOrigins)
+	assert.Equal(t, 8080, um.currentConfig().WebPort)
 
-	// Останавливаем UIManager после теста
 	um.Stop()
 }
 
 func TestSendMessage(t *testing.T) {
-	// Создаем конфигурацию для тестирования
-	config := UIConfig{
-		Enabled:        true,
-		UIType:         "console", // Используем консольный интерфейс для упрощения теста
-		WebPort:        8080,
-		Theme:          "dark",
-		StartMinimized: false,
-	}
-
-	// Создаем новый экземпляр UIManager
-	um, err := NewUIManager(config)
-	assert.NoError(t, err)
-
-	// Отправляем сообщение
-	um.SendMessage("Тестовое сообщение")
+	um := NewUIManager(testConfig(t), nil, nil)
+	server := newTestServer(t, um)
 
-	// Поскольку это консольный интерфейс, мы не можем проверить вывод,
-	// но можем убедиться, что функция не вызывает панику
+	// Сообщение без клиентов никуда не уходит
 	assert.NotPanics(t, func() {
-		um.SendMessage("Еще одно тестовое сообщение")
+		um.SendMessage(protocol.New(protocol.TypeResponse, "", protocol.TextPayload{Text: "никому"}))
 	})
 
-	// Останавливаем UIManager после теста
-	um.Stop()
-}
-
-func TestProcessCommand(t *testing.T) {
-	// Создаем конфигурацию для тестирования
-	config := UIConfig{
-		Enabled:        true,
-		UIType:         "console",
-		WebPort:        8080,
-		Theme:          "dark",
-		StartMinimized: false,
-	}
-
-	// Создаем новый экземпляр UIManager
-	um, err := NewUIManager(config)
-	assert.NoError(t, err)
-
-	// Запускаем обработчик команд в отдельной горутине
-	go func() {
-		// Ждем, пока команда будет отправлена в канал
-		command := <-um.CommandChan
-		assert.Equal(t, "тестовая команда", command)
+	// Рассылка доходит только до клиентов, завершивших hello
+	greeted := dial(t, um, server, auth.ScopeChat)
+	silent := dial(t, um, server, auth.ScopeChat)
+	call(t, greeted, protocol.TypeHello, "1", protocol.HelloPayload{Client: "test"})
 
-		// Отправляем ответ в канал
-		um.ResponseChan <- "тестовый ответ"
-	}()
+	um.SendMessage(protocol.New(protocol.TypeResponse, "", protocol.TextPayload{Text: "всем"}))
+	greeted.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message protocol.Message
+	assert.NoError(t, greeted.ReadJSON(&message))
+	assert.Equal(t, protocol.TypeResponse, message.Type)
 
-	// Обрабатываем команду
-	response := um.ProcessCommand("тестовая команда")
-
-	// Проверяем ответ
-	assert.Equal(t, "тестовый ответ", response)
-
-	// Останавливаем UIManager после теста
-	um.Stop()
+	silent.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	assert.Error(t, silent.ReadJSON(&message))
 }
 
-func TestGetHistory(t *testing.T) {
-	// Создаем конфигурацию для тестирования
-	config := UIConfig{
-		Enabled:        true,
-		UIType:         "console",
-		WebPort:        8080,
-		Theme:          "dark",
-		StartMinimized: false,
-	}
-
-	// Создаем новый экземпляр UIManager
-	um, err := NewUIManager(config)
-	assert.NoError(t, err)
-
-	// Добавляем сообщения в историю
-	um.history = append(um.history, Message{Type: "user", Text: "тестовая команда", Time: time.Now()})
-	um.history = append(um.history, Message{Type: "assistant", Text: "тестовый ответ", Time: time.Now()})
-
-	// Получаем историю
-	history := um.GetHistory()
-
-	// Проверяем, что история содержит добавленные сообщения
-	assert.Len(t, history, 2)
-	assert.Equal(t, "user", history[0].Type)
-	assert.Equal(t, "тестовая команда", history[0].Text)
-	assert.Equal(t, "assistant", history[1].Type)
-	assert.Equal(t, "тестовый ответ", history[1].Text)
+func TestProtocolHandshake(t *testing.T) {
+	um := NewUIManager(testConfig(t), nil, nil)
+	server := newTestServer(t, um)
+	conn := dial(t, um, server, auth.ScopeChat)
+
+	// До hello запросы не обрабатываются
+	e := decodeError(t, call(t, conn, protocol.TypeGetConversations, "1", nil))
+	assert.Equal(t, protocol.CodeHandshakeRequired, e.Code)
+
+	reply := call(t, conn, protocol.TypeHello, "2", protocol.HelloPayload{Client: "test", Capabilities: []string{protocol.CapabilityStream}})
+	assert.Equal(t, protocol.TypeWelcome, reply.Type)
+	var welcome protocol.WelcomePayload
+	assert.Nil(t, reply.Decode(&welcome))
+	assert.Equal(t, protocol.Version, welcome.Version)
+	assert.Equal(t, []string{auth.ScopeChat}, welcome.Scopes)
+	assert.Contains(t, welcome.Types, protocol.TypeCommand)
+	assert.NotContains(t, welcome.Types, protocol.TypeExecute)
+
+	// Неизвестный тип и чужая версия протокола
+	e = decodeError(t, call(t, conn, "teleport", "3", nil))
+	assert.Equal(t, protocol.CodeUnknownType, e.Code)
+	assert.NoError(t, conn.WriteJSON(protocol.Message{Version: 99, Type: protocol.TypeCommand, ID: "4"}))
+	var message protocol.Message
+	assert.NoError(t, conn.ReadJSON(&message))
+	assert.Equal(t, protocol.CodeUnsupportedVersion, decodeError(t, message).Code)
+
+	// Пустая команда отклоняется
+	e = decodeError(t, call(t, conn, protocol.TypeCommand, "5", protocol.TextPayload{}))
+	assert.Equal(t, protocol.CodeBadRequest, e.Code)
+}
 
-	// Останавливаем UIManager после теста
-	um.Stop()
+// configReply — ответ на get_config и set_config
+type configReply struct {
+	Config    config.Config   `json:"config"`
+	Overrides []string        `json:"overrides"`
+	Changes   []config.Change `json:"changes"`
 }
 
-func TestWebSocketHandler(t *testing.T) {
-	// Этот тест требует реальное WebSocket-соединение, поэтому мы просто проверим,
-	// что функция не вызывает панику
-
-	// Создаем конфигурацию для тестирования
-	config := UIConfig{
-		Enabled:        true,
-		UIType:         "web",
-		WebPort:        8080,
-		Theme:          "dark",
-		StartMinimized: false,
+// testManager сохраняет настройки с ключом API во временный файл
+func testManager(t *testing.T) *config.Manager {
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := config.DefaultConfig()
+	cfg.AssistantConfig.OpenAIAPIKey = "sk-настоящий"
+	assert.NoError(t, cfg.SaveFile(path))
+	manager, err := config.NewManager(path, []string{config.EnvName("voice.language") + "=en-US"})
+	if !assert.NoError(t, err) {
+		t.FailNow()
 	}
+	t.Cleanup(manager.Close)
+	return manager
+}
 
-	// Создаем новый экземпляр UIManager
-	um, err := NewUIManager(config)
+func TestConfigMessages(t *testing.T) {
+	um := NewUIManager(testConfig(t), nil, nil)
+	server := newTestServer(t, um)
+	conn := dial(t, um, server, auth.ScopeChat, auth.ScopeSystem)
+	call(t, conn, protocol.TypeHello, "1", protocol.HelloPayload{Client: "test"})
+
+	// Без менеджера настроек редактировать нечего
+	e := decodeError(t, call(t, conn, protocol.TypeGetConfig, "2", nil))
+	assert.Equal(t, protocol.CodeUnavailable, e.Code)
+
+	manager := testManager(t)
+	um.SetConfigManager(manager)
+
+	// Ключи API скрыты, переопределения из окружения отмечены
+	reply := call(t, conn, protocol.TypeGetConfig, "3", nil)
+	assert.Equal(t, protocol.TypeConfig, reply.Type)
+	var got configReply
+	assert.Nil(t, reply.Decode(&got))
+	assert.Equal(t, config.RedactedValue, got.Config.AssistantConfig.OpenAIAPIKey)
+	assert.Equal(t, []string{"voice.language"}, got.Overrides)
+	assert.Nil(t, got.Changes)
+
+	// Правка скрытых настроек сохраняет настоящий ключ
+	edited := got.Config
+	edited.VoiceConfig.WakeWord = "барсик"
+	edited.UIConfig.WebPort = 9090
+	data, err := json.Marshal(edited)
 	assert.NoError(t, err)
+	reply = call(t, conn, protocol.TypeSetConfig, "4", protocol.SetConfigPayload{Config: data})
+	assert.Equal(t, protocol.TypeConfig, reply.Type)
+	var set configReply
+	assert.Nil(t, reply.Decode(&set))
+	assert.ElementsMatch(t, []config.Change{
+		{Field: "voice.wake_word", Restart: false},
+		{Field: "ui.web_port", Restart: true},
+	}, set.Changes)
+	assert.Equal(t, config.RedactedValue, set.Config.AssistantConfig.OpenAIAPIKey)
+
+	saved, err := config.LoadFile(manager.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-настоящий", saved.AssistantConfig.OpenAIAPIKey)
+	assert.Equal(t, "барсик", saved.VoiceConfig.WakeWord)
+	assert.Equal(t, "sk-настоящий", manager.Config().AssistantConfig.OpenAIAPIKey)
 
-	// Создаем тестовый HTTP-сервер
-	server := httptest.NewServer(http.HandlerFunc(um.wsHandler))
-	defer server.Close()
-
-	// Преобразуем URL с HTTP на WebSocket
-	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	// Без изменений список изменений пустой, а не отсутствует
+	reply = call(t, conn, protocol.TypeSetConfig, "5", protocol.SetConfigPayload{Config: data})
+	assert.Contains(t, string(reply.Payload), `"changes":[]`)
 
-	// Проверяем, что функция не вызывает панику при попытке подключения
-	assert.NotPanics(t, func() {
-		// Пытаемся установить WebSocket-соединение
-		_, _, err := websocket.DefaultDialer.Dial(url, nil)
-		// Мы ожидаем ошибку, так как тестовый сервер не поддерживает WebSocket
-		// Но функция не должна вызывать панику
-		_ = err
-	})
+	// Некорректные значения — ошибка запроса, файл не меняется
+	edited.UIConfig.WebPort = 70000
+	data, err = json.Marshal(edited)
+	assert.NoError(t, err)
+	e = decodeError(t, call(t, conn, protocol.TypeSetConfig, "6", protocol.SetConfigPayload{Config: data}))
+	assert.Equal(t, protocol.CodeBadRequest, e.Code)
+	assert.Contains(t, e.Message, "ui.web_port")
+	e = decodeError(t, call(t, conn, protocol.TypeSetConfig, "7", protocol.SetConfigPayload{Config: json.RawMessage(`"не настройки"`)}))
+	assert.Equal(t, protocol.CodeBadRequest, e.Code)
+	assert.Equal(t, 9090, manager.File().UIConfig.WebPort)
+}
 
-	// Останавливаем UIManager после теста
-	um.Stop()
-}
\ No newline at end of file
+func TestConfigMessagesScope(t *testing.T) {
+	um := NewUIManager(testConfig(t), nil, nil)
+	um.SetConfigManager(testManager(t))
+	server := newTestServer(t, um)
+	conn := dial(t, um, server, auth.ScopeChat)
+	call(t, conn, protocol.TypeHello, "1", protocol.HelloPayload{Client: "test"})
+
+	// Настройки содержат ключи и пути, устройству без права system они недоступны
+	e := decodeError(t, call(t, conn, protocol.TypeGetConfig, "2", nil))
+	assert.Equal(t, protocol.CodeForbidden, e.Code)
+	e = decodeError(t, call(t, conn, protocol.TypeSetConfig, "3", protocol.SetConfigPayload{Config: json.RawMessage(`{}`)}))
+	assert.Equal(t, protocol.CodeForbidden, e.Code)
+}
@@ -0,0 +1,113 @@
+package vad
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	echoDelay         = 400 * time.Millisecond // сколько эхо может отставать от воспроизведения
+	defaultEchoMargin = 6.0                    // дБ: насколько голос пользователя громче эха
+	couplingRiseRate  = 0.3                    // как быстро оценка громкости эха растет
+	couplingFallRate  = 0.02                   // как быстро она опускается, если эхо стало тише
+	silenceLevel      = -120.0                 // дБ полной шкалы для пустой записи
+)
+
+// EchoGate отделяет голос пользователя от эха речи ассистента. Пока звучит
+// ответ, уровень записи сравнивается с уровнем воспроизводимого звука:
+// кадры не громче ожидаемого эха отбрасываются. Затухание звука от динамика
+// до микрофона оценивается на ходу по самому громкому эху: лучше потерять
+// тихую реплику, чем принять за нее ответ ассистента.
+type EchoGate struct {
+	mutex      sync.Mutex
+	marginDb   float64
+	coupling   float64 // уровень эха относительно воспроизводимого звука, дБ
+	references []reference
+}
+
+// reference — уровень звука, отданного на динамик
+type reference struct {
+	at    time.Time
+	level float64
+}
+
+// NewEchoGate создает фильтр эха. marginDb — насколько речь пользователя
+// должна быть громче ожидаемого эха; 0 — по умолчанию 6 дБ.
+func NewEchoGate(marginDb float64) *EchoGate {
+	if marginDb <= 0 {
+		marginDb = defaultEchoMargin
+	}
+	// Пока затухание неизвестно, считаем, что микрофон слышит динамик
+	// так же громко, как он звучит
+	return &EchoGate{marginDb: marginDb}
+}
+
+// Reference запоминает уровень звука, отданного на динамик в момент at
+func (g *EchoGate) Reference(level float64, at time.Time) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.references = append(g.references, reference{at: at, level: level})
+}
+
+// Playing сообщает, может ли сейчас в записи быть эхо
+func (g *EchoGate) Playing(now time.Time) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.prune(now)
+	return len(g.references) > 0
+}
+
+// IsEcho сообщает, что в кадре записи с уровнем level слышно только эхо
+// и его нужно отбросить. Такие кадры уточняют оценку затухания.
+func (g *EchoGate) IsEcho(level float64, now time.Time) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.prune(now)
+	if len(g.references) == 0 {
+		return false
+	}
+
+	played := math.Inf(-1)
+	for _, reference := range g.references {
+		played = max(played, reference.level)
+	}
+	if played <= silenceLevel {
+		// Динамик молчит, эха нет
+		return false
+	}
+	if level > played+g.coupling+g.marginDb {
+		return false
+	}
+
+	difference := level - played
+	if difference > g.coupling {
+		g.coupling += couplingRiseRate * (difference - g.coupling)
+	} else {
+		g.coupling += couplingFallRate * (difference - g.coupling)
+	}
+	return true
+}
+
+// prune забывает звук, эхо которого уже не может прийти
+func (g *EchoGate) prune(now time.Time) {
+	start := 0
+	for start < len(g.references) && now.Sub(g.references[start].at) > echoDelay {
+		start++
+	}
+	g.references = g.references[start:]
+}
+
+// Level возвращает уровень PCM-записи (16 бит, моно или стерео) в дБ
+// полной шкалы
+func Level(pcm []byte) float64 {
+	samples := toSamples(pcm)
+	if len(samples) == 0 {
+		return silenceLevel
+	}
+	var sum float64
+	for _, sample := range samples {
+		sum += sample * sample
+	}
+	return max(silenceLevel, 10*math.Log10(sum/float64(len(samples))))
+}
@@ -0,0 +1,157 @@
+package vad
+
+import (
+	"fmt"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Config содержит настройки выделения фраз. Все длительности — в миллисекундах.
+type Config struct {
+	SampleRate     int // частота записи, Гц
+	FrameMs        int // длина кадра классификатора: 10, 20 или 30
+	Aggressiveness int // 0..3: как строго отсеивается шум
+	StartMs        int // сколько речи подряд начинает фразу
+	PreRollMs      int // сколько записи до начала речи добавляется к фразе
+	HangoverMs     int // сколько тишины заканчивает фразу
+	MaxUtteranceMs int // фраза длиннее обрывается
+}
+
+// DefaultConfig возвращает настройки для записи 16 кГц
+func DefaultConfig() Config {
+	return Config{
+		SampleRate:     16000,
+		FrameMs:        20,
+		Aggressiveness: 2,
+		StartMs:        100,
+		PreRollMs:      300,
+		HangoverMs:     800,
+		MaxUtteranceMs: 15000,
+	}
+}
+
+// Endpointer выделяет из потока записи отдельные фразы: начало — когда
+// речь длится StartMs, конец — после HangoverMs тишины или по достижении
+// MaxUtteranceMs
+type Endpointer struct {
+	config     Config
+	classifier *Classifier
+	frameBytes int
+
+	pending  []byte   // байты, которых пока не хватает на кадр
+	preRoll  [][]byte // последние кадры до начала фразы
+	speechMs int      // речь подряд до начала фразы
+
+	speaking    bool
+	utterance   []byte
+	silenceMs   int
+	utteranceMs int
+}
+
+// NewEndpointer создает выделитель фраз для PCM-записи (моно, 16 бит)
+func NewEndpointer(config Config) (*Endpointer, error) {
+	classifier, err := NewClassifier(config.SampleRate, config.FrameMs, config.Aggressiveness)
+	if err != nil {
+		return nil, err
+	}
+	if config.HangoverMs <= 0 || config.MaxUtteranceMs <= config.HangoverMs {
+		return nil, tracerr.New(fmt.Sprintf("Неверная длительность фразы: окончание %d мс, максимум %d мс", config.HangoverMs, config.MaxUtteranceMs))
+	}
+	if config.StartMs < config.FrameMs {
+		config.StartMs = config.FrameMs
+	}
+
+	return &Endpointer{
+		config:     config,
+		classifier: classifier,
+		frameBytes: 2 * classifier.FrameSize(),
+	}, nil
+}
+
+// Push добавляет часть записи и возвращает фразы, которые в ней закончились
+func (e *Endpointer) Push(pcm []byte) [][]byte {
+	e.pending = append(e.pending, pcm...)
+
+	var utterances [][]byte
+	for len(e.pending) >= e.frameBytes {
+		frame := e.pending[:e.frameBytes:e.frameBytes]
+		e.pending = e.pending[e.frameBytes:]
+		if utterance := e.process(frame); utterance != nil {
+			utterances = append(utterances, utterance)
+		}
+	}
+	e.pending = append([]byte(nil), e.pending...)
+	return utterances
+}
+
+// Speaking сообщает, идет ли сейчас фраза
+func (e *Endpointer) Speaking() bool {
+	return e.speaking
+}
+
+// Reset обрывает текущую фразу. Уровень шума сохраняется.
+func (e *Endpointer) Reset() {
+	e.pending = nil
+	e.preRoll = nil
+	e.speechMs = 0
+	e.speaking = false
+	e.utterance = nil
+}
+
+// process обрабатывает один кадр и возвращает фразу, если она закончилась
+func (e *Endpointer) process(frame []byte) []byte {
+	speech := e.classifier.IsSpeech(toSamples(frame))
+	frameMs := e.config.FrameMs
+
+	if !e.speaking {
+		e.preRoll = append(e.preRoll, frame)
+		if len(e.preRoll)*frameMs > e.config.PreRollMs+e.config.StartMs {
+			e.preRoll = e.preRoll[1:]
+		}
+		if !speech {
+			e.speechMs = 0
+			return nil
+		}
+		e.speechMs += frameMs
+		if e.speechMs < e.config.StartMs {
+			return nil
+		}
+
+		// Фраза начинается с записи до речи, чтобы не потерять первый звук
+		e.speaking = true
+		e.utterance = nil
+		for _, previous := range e.preRoll {
+			e.utterance = append(e.utterance, previous...)
+		}
+		e.utteranceMs = len(e.preRoll) * frameMs
+		e.preRoll = nil
+		e.silenceMs = 0
+		return nil
+	}
+
+	e.utterance = append(e.utterance, frame...)
+	e.utteranceMs += frameMs
+	if speech {
+		e.silenceMs = 0
+	} else {
+		e.silenceMs += frameMs
+	}
+	if e.silenceMs < e.config.HangoverMs && e.utteranceMs < e.config.MaxUtteranceMs {
+		return nil
+	}
+
+	utterance := e.utterance
+	e.speaking = false
+	e.utterance = nil
+	e.speechMs = 0
+	return utterance
+}
+
+// toSamples переводит PCM-запись (16 бит, little-endian) в отсчеты -1..1
+func toSamples(pcm []byte) []float64 {
+	samples := make([]float64, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float64(int16(uint16(pcm[2*i])|uint16(pcm[2*i+1])<<8)) / 32768
+	}
+	return samples
+}
@@ -0,0 +1,174 @@
+package vad
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Допустимая длина кадра классификатора, как у WebRTC VAD
+var frameDurations = []int{10, 20, 30}
+
+// Полосы частот, в которых отдельно отслеживается уровень шума. Речь
+// поднимает энергию в нескольких полосах сразу, а гул и шипение — в одной
+// или равномерно во всех.
+var bands = [][2]float64{{80, 250}, {250, 500}, {500, 1000}, {1000, 2000}, {2000, 3000}, {3000, 4000}}
+
+// Пороги превышения шума (дБ) для уровней агрессивности 0..3: чем выше
+// уровень, тем меньше шума принимается за речь и тем чаще теряются тихие слова
+var aggressivenessThresholds = [4]float64{3, 5, 7, 10}
+
+const (
+	minEnergy       = -70.0 // дБ полной шкалы: тише — всегда тишина
+	floorFallRate   = 0.5   // как быстро уровень шума опускается к более тихому кадру
+	floorRiseRate   = 0.05  // как быстро уровень шума растет в паузах
+	floorSpeechRate = 0.01  // во время «речи»: ровный шум перестает ею считаться за пару секунд
+	initFrames      = 10    // первые кадры задают начальный уровень шума
+)
+
+// Classifier решает для каждого кадра, речь в нем или нет. Уровень шума в
+// каждой полосе подстраивается под обстановку: быстро опускается в тишине и
+// медленно растет, если шум стал громче.
+type Classifier struct {
+	sampleRate int
+	frameSize  int // отсчетов в кадре
+	fftSize    int
+	threshold  float64
+	window     []float64
+	floor      []float64 // уровень шума по полосам, дБ
+	frames     int       // обработано кадров
+}
+
+// NewClassifier создает классификатор кадров длительностью frameMs
+// (10, 20 или 30 мс). Aggressiveness от 0 до 3 — как строго отсеивается шум.
+func NewClassifier(sampleRate, frameMs, aggressiveness int) (*Classifier, error) {
+	if sampleRate < 8000 {
+		return nil, tracerr.New(fmt.Sprintf("Слишком низкая частота дискретизации: %d", sampleRate))
+	}
+	valid := false
+	for _, duration := range frameDurations {
+		valid = valid || duration == frameMs
+	}
+	if !valid {
+		return nil, tracerr.New(fmt.Sprintf("Длина кадра должна быть 10, 20 или 30 мс: %d", frameMs))
+	}
+	if aggressiveness < 0 || aggressiveness > 3 {
+		return nil, tracerr.New(fmt.Sprintf("Агрессивность должна быть от 0 до 3: %d", aggressiveness))
+	}
+
+	c := &Classifier{
+		sampleRate: sampleRate,
+		frameSize:  sampleRate * frameMs / 1000,
+		threshold:  aggressivenessThresholds[aggressiveness],
+		floor:      make([]float64, len(bands)),
+	}
+	c.fftSize = 1
+	for c.fftSize < c.frameSize {
+		c.fftSize <<= 1
+	}
+	c.window = make([]float64, c.frameSize)
+	for i := range c.window {
+		c.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(c.frameSize-1))
+	}
+	return c, nil
+}
+
+// FrameSize возвращает число отсчетов в кадре
+func (c *Classifier) FrameSize() int {
+	return c.frameSize
+}
+
+// IsSpeech классифицирует кадр из FrameSize отсчетов (-1..1) и обновляет
+// уровень шума
+func (c *Classifier) IsSpeech(samples []float64) bool {
+	energies := c.bandEnergies(samples)
+	c.frames++
+
+	if c.frames <= initFrames {
+		// Считаем, что запись начинается без речи
+		for i, energy := range energies {
+			c.floor[i] += (energy - c.floor[i]) / float64(c.frames)
+		}
+		return false
+	}
+
+	var snr float64
+	total := math.Inf(-1)
+	for i, energy := range energies {
+		snr += max(0, energy-c.floor[i])
+		total = max(total, energy)
+	}
+	snr /= float64(len(bands))
+	speech := snr >= c.threshold && total > minEnergy
+
+	for i, energy := range energies {
+		switch {
+		case energy < c.floor[i]:
+			c.floor[i] += floorFallRate * (energy - c.floor[i])
+		case speech:
+			c.floor[i] += floorSpeechRate * (energy - c.floor[i])
+		default:
+			c.floor[i] += floorRiseRate * (energy - c.floor[i])
+		}
+	}
+	return speech
+}
+
+// Reset забывает уровень шума
+func (c *Classifier) Reset() {
+	c.frames = 0
+	clear(c.floor)
+}
+
+// bandEnergies возвращает энергию кадра в полосах частот, дБ полной шкалы
+func (c *Classifier) bandEnergies(samples []float64) []float64 {
+	spectrum := make([]complex128, c.fftSize)
+	for i := 0; i < c.frameSize && i < len(samples); i++ {
+		spectrum[i] = complex(samples[i]*c.window[i], 0)
+	}
+	fft(spectrum)
+
+	energies := make([]float64, len(bands))
+	binWidth := float64(c.sampleRate) / float64(c.fftSize)
+	for i, band := range bands {
+		var sum float64
+		var count int
+		for bin := int(band[0] / binWidth); bin <= int(band[1]/binWidth) && bin <= c.fftSize/2; bin++ {
+			magnitude := cmplx.Abs(spectrum[bin])
+			sum += magnitude * magnitude
+			count++
+		}
+		power := sum / float64(max(count, 1)) / float64(c.frameSize)
+		energies[i] = 10 * math.Log10(power+1e-12)
+	}
+	return energies
+}
+
+// fft — быстрое преобразование Фурье на месте, длина — степень двойки
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package vad
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRate = 16000
+
+// signal собирает синтетическую запись: шум с заданным уровнем и участки
+// «речи» — слоги из гармоник 150 Гц по 200 мс с паузами по 60 мс
+type signal struct {
+	random  *rand.Rand
+	samples []float64
+}
+
+func newSignal() *signal {
+	return &signal{random: rand.New(rand.NewSource(1))}
+}
+
+// noise добавляет белый шум с уровнем level (дБ полной шкалы)
+func (s *signal) noise(ms int, level float64) *signal {
+	amplitude := math.Pow(10, level/20)
+	for i := 0; i < ms*testRate/1000; i++ {
+		s.samples = append(s.samples, amplitude*s.random.NormFloat64())
+	}
+	return s
+}
+
+// speech добавляет слоги громкостью level поверх шума noiseLevel
+func (s *signal) speech(ms int, level, noiseLevel float64) *signal {
+	amplitude := math.Pow(10, level/20)
+	noise := math.Pow(10, noiseLevel/20)
+	syllable := 260 * testRate / 1000
+	voiced := 200 * testRate / 1000
+	for i := 0; i < ms*testRate/1000; i++ {
+		var value float64
+		if i%syllable < voiced {
+			t := float64(i) / testRate
+			for harmonic := 1; harmonic <= 20; harmonic++ {
+				value += math.Sin(2*math.Pi*150*float64(harmonic)*t) / float64(harmonic)
+			}
+			value *= amplitude / 2
+		}
+		s.samples = append(s.samples, value+noise*s.random.NormFloat64())
+	}
+	return s
+}
+
+// pcm переводит запись в PCM, 16 бит
+func (s *signal) pcm() []byte {
+	pcm := make([]byte, 2*len(s.samples))
+	for i, sample := range s.samples {
+		value := int16(max(-1, min(1, sample)) * 32767)
+		pcm[2*i] = byte(value)
+		pcm[2*i+1] = byte(uint16(value) >> 8)
+	}
+	return pcm
+}
+
+// push передает запись частями по chunk байт
+func push(e *Endpointer, pcm []byte, chunk int) [][]byte {
+	var utterances [][]byte
+	for start := 0; start < len(pcm); start += chunk {
+		utterances = append(utterances, e.Push(pcm[start:min(start+chunk, len(pcm))])...)
+	}
+	return utterances
+}
+
+// durationMs возвращает длительность PCM-записи
+func durationMs(pcm []byte) int {
+	return len(pcm) / 2 * 1000 / testRate
+}
+
+func TestNewClassifier(t *testing.T) {
+	_, err := NewClassifier(testRate, 25, 2)
+	assert.Error(t, err)
+	_, err = NewClassifier(testRate, 20, 4)
+	assert.Error(t, err)
+	_, err = NewClassifier(4000, 20, 2)
+	assert.Error(t, err)
+
+	classifier, err := NewClassifier(48000, 30, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1440, classifier.FrameSize())
+
+	_, err = NewEndpointer(Config{SampleRate: testRate, FrameMs: 20, HangoverMs: 800, MaxUtteranceMs: 500})
+	assert.Error(t, err)
+}
+
+func TestClassifier(t *testing.T) {
+	for _, noiseLevel := range []float64{-60, -40, -25} {
+		classifier, err := NewClassifier(testRate, 20, 2)
+		assert.NoError(t, err)
+
+		// Речь на 20 дБ громче шума, независимо от абсолютного уровня
+		samples := newSignal().noise(1000, noiseLevel).speech(1040, noiseLevel+20, noiseLevel).noise(1000, noiseLevel).samples
+		var speech [3]int
+		size := classifier.FrameSize()
+		for i := 0; i+size <= len(samples); i += size {
+			if classifier.IsSpeech(samples[i : i+size]) {
+				speech[i/(testRate)]++
+			}
+		}
+		assert.Equal(t, 0, speech[0], "шум %v дБ до речи", noiseLevel)
+		assert.Greater(t, speech[1], 30, "речь на фоне шума %v дБ", noiseLevel)
+		assert.LessOrEqual(t, speech[2], 2, "шум %v дБ после речи", noiseLevel)
+	}
+}
+
+func TestClassifierAdaptsToNoise(t *testing.T) {
+	classifier, err := NewClassifier(testRate, 20, 2)
+	assert.NoError(t, err)
+
+	// Шум стал на 20 дБ громче: сначала он похож на речь, но через пару
+	// секунд становится новым уровнем тишины
+	samples := newSignal().noise(1000, -60).noise(6000, -40).samples
+	size := classifier.FrameSize()
+	first, last := -1, -1
+	for i := 0; i+size <= len(samples); i += size {
+		if classifier.IsSpeech(samples[i : i+size]) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	assert.Equal(t, testRate, first)
+	assert.Less(t, last, 4*testRate)
+}
+
+func TestEndpointer(t *testing.T) {
+	config := DefaultConfig()
+	pcm := newSignal().noise(1000, -50).speech(1040, -25, -50).noise(1500, -50).pcm()
+
+	// Размер частей записи не влияет на результат
+	var results [][][]byte
+	for _, chunk := range []int{320, 1000, 3200} {
+		endpointer, err := NewEndpointer(config)
+		assert.NoError(t, err)
+		utterances := push(endpointer, pcm, chunk)
+		assert.False(t, endpointer.Speaking())
+		results = append(results, utterances)
+	}
+	assert.Equal(t, results[0], results[1])
+	assert.Equal(t, results[0], results[2])
+
+	if assert.Len(t, results[0], 1) {
+		utterance := results[0][0]
+		// Фраза: запись до речи, речь и тишина до окончания
+		expected := config.PreRollMs + 1040 + config.HangoverMs
+		assert.InDelta(t, expected, durationMs(utterance), 150)
+
+		// Запись до речи включена в фразу
+		start := (1000 - config.PreRollMs) * testRate / 1000 * 2
+		assert.Equal(t, pcm[start:start+320], utterance[:320])
+	}
+}
+
+func TestEndpointerMaxUtterance(t *testing.T) {
+	config := DefaultConfig()
+	config.HangoverMs = 300
+	config.MaxUtteranceMs = 1000
+	endpointer, err := NewEndpointer(config)
+	assert.NoError(t, err)
+
+	// Речь без пауз длиннее максимума делится на фразы
+	pcm := newSignal().noise(500, -50).speech(3640, -25, -50).noise(1000, -50).pcm()
+	utterances := push(endpointer, pcm, 640)
+	assert.GreaterOrEqual(t, len(utterances), 3)
+	for _, utterance := range utterances {
+		assert.LessOrEqual(t, durationMs(utterance), config.MaxUtteranceMs)
+	}
+}
+
+func TestEndpointerShortNoise(t *testing.T) {
+	endpointer, err := NewEndpointer(DefaultConfig())
+	assert.NoError(t, err)
+
+	// Щелчок короче StartMs не начинает фразу
+	signal := newSignal().noise(1000, -50)
+	for i := 0; i < 3; i++ {
+		signal.speech(40, -20, -50).noise(500, -50)
+	}
+	assert.Empty(t, push(endpointer, signal.pcm(), 640))
+
+	// Reset обрывает начатую фразу
+	assert.Empty(t, push(endpointer, newSignal().speech(500, -25, -50).pcm(), 640))
+	assert.True(t, endpointer.Speaking())
+	endpointer.Reset()
+	assert.False(t, endpointer.Speaking())
+	assert.Empty(t, push(endpointer, newSignal().noise(1000, -50).pcm(), 640))
+}
+
+func TestLevel(t *testing.T) {
+	assert.Equal(t, -120.0, Level(nil))
+	assert.Equal(t, -120.0, Level(make([]byte, 640)))
+
+	// Синусоида полной громкости — около -3 дБ
+	samples := &signal{}
+	for i := 0; i < testRate/10; i++ {
+		samples.samples = append(samples.samples, 0.999*math.Sin(2*math.Pi*440*float64(i)/testRate))
+	}
+	assert.InDelta(t, -3, Level(samples.pcm()), 0.1)
+}
+
+func TestEchoGate(t *testing.T) {
+	gate := NewEchoGate(0)
+	start := time.Now()
+	frame := 10 * time.Millisecond
+	random := rand.New(rand.NewSource(1))
+
+	// Ответ из слогов по 200 мс; микрофон слышит его на 25 дБ тише
+	// и на 100 мс позже
+	played := func(i int) float64 {
+		if i%26 < 20 {
+			return -15
+		}
+		return -40
+	}
+	echo := func(i int) float64 {
+		return played(max(0, i-10)) - 25 + random.Float64()*3
+	}
+
+	assert.False(t, gate.Playing(start))
+	assert.False(t, gate.IsEcho(-20, start))
+
+	// Пока затухание не оценено, даже громкая реплика считается эхом
+	gate.Reference(played(0), start)
+	assert.True(t, gate.IsEcho(-20, start))
+
+	dropped := 0
+	for i := 1; i < 500; i++ {
+		now := start.Add(time.Duration(i) * frame)
+		gate.Reference(played(i), now)
+		assert.True(t, gate.Playing(now))
+		if gate.IsEcho(echo(i), now) {
+			dropped++
+		}
+	}
+	assert.Equal(t, 499, dropped)
+
+	// После оценки затухания реплика громче эха проходит, эхо — нет
+	now := start.Add(500 * frame)
+	gate.Reference(played(0), now)
+	assert.False(t, gate.IsEcho(-20, now))
+	assert.True(t, gate.IsEcho(echo(20), now))
+
+	// Эхо затихает через echoDelay после конца ответа
+	now = now.Add(echoDelay + frame)
+	assert.False(t, gate.Playing(now))
+	assert.False(t, gate.IsEcho(-50, now))
+}
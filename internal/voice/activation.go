@@ -0,0 +1,157 @@
+package voice
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/hotkey"
+	"kot.ai/internal/stt"
+)
+
+// Как пользователь начинает говорить команду
+const (
+	ActivationWakeWord   = "wake_word"    // ключевым словом
+	ActivationPushToTalk = "push_to_talk" // удерживая клавишу или кнопку
+	ActivationToggle     = "toggle"       // первое нажатие начинает запись, второе заканчивает
+)
+
+// maxTalkBytes ограничивает запись по клавише минутой
+const maxTalkBytes = 60 * stt.SampleRate * 2
+
+// talkState — запись команды, начатая клавишей
+type talkState struct {
+	mutex  sync.Mutex
+	active bool
+	buffer []byte
+}
+
+// keyActivated сообщает, что команды начинаются клавишей, а не ключевым словом
+func (vm *VoiceManager) keyActivated() bool {
+	return vm.config.ActivationMode == ActivationPushToTalk || vm.config.ActivationMode == ActivationToggle
+}
+
+// listenHotkey начинает следить за горячей клавишей. Без нее команды
+// можно начинать кнопкой в веб-интерфейсе, поэтому ошибка не фатальна.
+func (vm *VoiceManager) listenHotkey() {
+	if !vm.keyActivated() || vm.config.Hotkey == "" {
+		return
+	}
+	listener, err := hotkey.Listen(vm.config.Hotkey, vm.config.HotkeyBackend, vm.config.HotkeyDevice)
+	if err != nil {
+		log.Printf("Горячая клавиша %s недоступна: %v", vm.config.Hotkey, err)
+		return
+	}
+	log.Printf("Горячая клавиша: %s", vm.config.Hotkey)
+	vm.hotkey = listener
+	go vm.handleHotkey(listener)
+}
+
+// handleHotkey переводит нажатия клавиши в начало и конец записи
+func (vm *VoiceManager) handleHotkey(listener hotkey.Listener) {
+	for event := range listener.Events() {
+		switch {
+		case vm.config.ActivationMode == ActivationToggle && event.Pressed:
+			vm.ToggleTalking()
+		case vm.config.ActivationMode == ActivationPushToTalk && event.Pressed:
+			vm.StartTalking()
+		case vm.config.ActivationMode == ActivationPushToTalk:
+			vm.StopTalking()
+		}
+	}
+}
+
+// StartTalking начинает записывать команду с микрофона. Текущий ответ
+// прерывается.
+func (vm *VoiceManager) StartTalking() {
+	vm.talk.mutex.Lock()
+	if vm.talk.active {
+		vm.talk.mutex.Unlock()
+		return
+	}
+	vm.talk.active = true
+	vm.talk.buffer = nil
+	vm.talk.mutex.Unlock()
+
+	vm.StopSpeaking()
+	vm.setState(StateCommand)
+	if vm.callbacks.onWake != nil {
+		vm.callbacks.onWake()
+	}
+}
+
+// StopTalking заканчивает запись и передает команду на распознавание
+func (vm *VoiceManager) StopTalking() {
+	vm.talk.mutex.Lock()
+	if !vm.talk.active {
+		vm.talk.mutex.Unlock()
+		return
+	}
+	vm.talk.active = false
+	audio := vm.talk.buffer
+	vm.talk.buffer = nil
+	vm.talk.mutex.Unlock()
+
+	vm.setState(StateIdle)
+	go vm.processTalk(audio)
+}
+
+// ToggleTalking начинает запись или заканчивает начатую
+func (vm *VoiceManager) ToggleTalking() {
+	vm.talk.mutex.Lock()
+	active := vm.talk.active
+	vm.talk.mutex.Unlock()
+
+	if active {
+		vm.StopTalking()
+	} else {
+		vm.StartTalking()
+	}
+}
+
+// appendTalk добавляет запись к команде, если клавиша нажата
+func (vm *VoiceManager) appendTalk(data []byte) {
+	vm.talk.mutex.Lock()
+	defer vm.talk.mutex.Unlock()
+	if vm.talk.active && len(vm.talk.buffer)+len(data) <= maxTalkBytes {
+		vm.talk.buffer = append(vm.talk.buffer, data...)
+	}
+}
+
+// processTalk распознает записанную команду и передает ее
+func (vm *VoiceManager) processTalk(audio []byte) {
+	if len(audio) == 0 {
+		return
+	}
+	text, err := vm.recognizeSpeech(audio)
+	if err != nil {
+		log.Printf("Ошибка распознавания речи: %v", err)
+		return
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	log.Printf("Распознано: %s", text)
+	if vm.callbacks.onCommand != nil {
+		vm.callbacks.onCommand(text)
+	}
+}
+
+// Transcribe распознает запись, присланную не с микрофона, например из
+// браузера: 16 кГц, моно, 16 бит
+func (vm *VoiceManager) Transcribe(audio []byte) (string, error) {
+	if !vm.config.Enabled {
+		return "", tracerr.New("Голосовой модуль отключен")
+	}
+	if len(audio) == 0 {
+		return "", nil
+	}
+	text, err := vm.recognizeSpeech(audio)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
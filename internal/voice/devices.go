@@ -0,0 +1,231 @@
+package voice
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gen2brain/malgo"
+	"github.com/ztrue/tracerr"
+)
+
+// Виды аудиоустройств
+const (
+	DeviceInput  = "input"  // микрофон
+	DeviceOutput = "output" // динамик
+)
+
+// monitorInterval — как часто проверяется, не отключили ли микрофон и не
+// подключили ли выбранный
+const monitorInterval = 2 * time.Second
+
+// AudioDevice описывает микрофон или динамик
+type AudioDevice struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Default bool   `json:"default"` // устройство по умолчанию в системе
+}
+
+// AudioDevices — доступные устройства и выбранные в настройках
+type AudioDevices struct {
+	Inputs  []AudioDevice `json:"inputs"`
+	Outputs []AudioDevice `json:"outputs"`
+	Input   string        `json:"input"`  // выбранный микрофон; пусто — по умолчанию
+	Output  string        `json:"output"` // выбранный динамик; пусто — по умолчанию
+}
+
+// AudioDevices возвращает микрофоны и динамики компьютера
+func (vm *VoiceManager) AudioDevices() (AudioDevices, error) {
+	vm.deviceMutex.Lock()
+	defer vm.deviceMutex.Unlock()
+
+	if vm.context == nil {
+		return AudioDevices{}, tracerr.New("Голосовой модуль не запущен")
+	}
+	inputs, err := vm.listDevices(malgo.Capture)
+	if err != nil {
+		return AudioDevices{}, err
+	}
+	outputs, err := vm.listDevices(malgo.Playback)
+	if err != nil {
+		return AudioDevices{}, err
+	}
+	return AudioDevices{
+		Inputs:  inputs,
+		Outputs: outputs,
+		Input:   vm.config.InputDevice,
+		Output:  vm.config.OutputDevice,
+	}, nil
+}
+
+// SetAudioDevice выбирает микрофон или динамик по имени или идентификатору.
+// Пустое имя выбирает устройство по умолчанию. Микрофон переключается сразу.
+func (vm *VoiceManager) SetAudioDevice(kind, device string) error {
+	vm.deviceMutex.Lock()
+	defer vm.deviceMutex.Unlock()
+
+	if vm.context == nil {
+		return tracerr.New("Голосовой модуль не запущен")
+	}
+
+	deviceType := malgo.Capture
+	if kind == DeviceOutput {
+		deviceType = malgo.Playback
+	} else if kind != DeviceInput {
+		return tracerr.New(fmt.Sprintf("Неизвестный вид устройства: %s", kind))
+	}
+	if _, err := vm.findDevice(deviceType, device); err != nil {
+		return err
+	}
+
+	if kind == DeviceOutput {
+		vm.config.OutputDevice = device
+		log.Printf("Выбран динамик: %s", deviceLabel(device))
+		return nil
+	}
+
+	vm.config.InputDevice = device
+	vm.closeCapture()
+	if err := vm.openCapture(); err != nil {
+		return err
+	}
+	log.Printf("Выбран микрофон: %s", deviceLabel(device))
+	return nil
+}
+
+// openCapture открывает микрофон из настроек. Если он не найден, открывается
+// микрофон по умолчанию, а выбранный подключится, когда появится.
+func (vm *VoiceManager) openCapture() error {
+	config := vm.captureConfig
+	deviceID, err := vm.findDevice(malgo.Capture, vm.config.InputDevice)
+	vm.captureDefault = err != nil
+	if err != nil {
+		log.Printf("Микрофон по умолчанию вместо выбранного: %v", err)
+	}
+	if deviceID != nil {
+		config.Capture.DeviceID = deviceID.Pointer()
+	}
+
+	callbacks := malgo.DeviceCallbacks{
+		Data: vm.onAudioData,
+		// Вызывается и при отключении устройства
+		Stop: func() { vm.captureLost.Store(true) },
+	}
+	device, err := malgo.InitDevice(vm.context.Context, config, callbacks)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	if err := device.Start(); err != nil {
+		device.Uninit()
+		return tracerr.Wrap(err)
+	}
+	vm.device = device
+	vm.captureLost.Store(false)
+	return nil
+}
+
+// closeCapture закрывает микрофон
+func (vm *VoiceManager) closeCapture() {
+	if vm.device == nil {
+		return
+	}
+	vm.device.Uninit()
+	vm.device = nil
+}
+
+// monitorDevices переоткрывает микрофон, если он перестал работать, и
+// возвращается к выбранному микрофону, когда его снова подключают
+func (vm *VoiceManager) monitorDevices(done chan struct{}) {
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		vm.deviceMutex.Lock()
+		if vm.context != nil && vm.needsReopen() {
+			vm.closeCapture()
+			if err := vm.openCapture(); err != nil {
+				log.Printf("Не удалось открыть микрофон: %v", err)
+			} else {
+				log.Printf("Микрофон переподключен: %s", deviceLabel(vm.config.InputDevice))
+			}
+		}
+		vm.deviceMutex.Unlock()
+	}
+}
+
+// needsReopen сообщает, нужно ли заново открыть микрофон: он остановился,
+// выбранный микрофон пропал из системы или, наоборот, снова появился
+func (vm *VoiceManager) needsReopen() bool {
+	if vm.device == nil || vm.captureLost.Load() {
+		return true
+	}
+	if vm.config.InputDevice == "" {
+		return false
+	}
+	_, err := vm.findDevice(malgo.Capture, vm.config.InputDevice)
+	found := err == nil
+	return found == vm.captureDefault
+}
+
+// listDevices перечисляет устройства одного вида
+func (vm *VoiceManager) listDevices(kind malgo.DeviceType) ([]AudioDevice, error) {
+	infos, err := vm.context.Devices(kind)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	devices := make([]AudioDevice, 0, len(infos))
+	for _, info := range infos {
+		devices = append(devices, AudioDevice{
+			ID:      info.ID.String(),
+			Name:    info.Name(),
+			Default: info.IsDefault != 0,
+		})
+	}
+	return devices, nil
+}
+
+// findDevice ищет устройство по имени без учета регистра или по
+// идентификатору. Пустое имя или "default" означает устройство по
+// умолчанию, для него возвращается nil.
+func (vm *VoiceManager) findDevice(kind malgo.DeviceType, name string) (*malgo.DeviceID, error) {
+	if name == "" || strings.EqualFold(name, "default") {
+		return nil, nil
+	}
+
+	devices, err := vm.context.Devices(kind)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	for _, device := range devices {
+		if strings.EqualFold(device.Name(), name) || device.ID.String() == name {
+			id := device.ID
+			return &id, nil
+		}
+	}
+	return nil, tracerr.New(fmt.Sprintf("Аудиоустройство не найдено: %s", name))
+}
+
+// closeContext освобождает аудио контекст
+func (vm *VoiceManager) closeContext() {
+	if vm.context == nil {
+		return
+	}
+	vm.context.Uninit()
+	vm.context.Free()
+	vm.context = nil
+}
+
+// deviceLabel возвращает имя устройства для журнала
+func deviceLabel(name string) string {
+	if name == "" {
+		return "по умолчанию"
+	}
+	return name
+}
@@ -0,0 +1,162 @@
+package voice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/wav"
+	"github.com/gen2brain/malgo"
+	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/tts"
+	"kot.ai/internal/vad"
+)
+
+// speechState следит за звучащими фразами, чтобы их можно было прервать
+type speechState struct {
+	mutex sync.Mutex
+	stops map[chan struct{}]bool // каналы остановки фраз
+}
+
+// StopSpeaking прерывает произносимые фразы, в том числе те, что еще
+// синтезируются
+func (vm *VoiceManager) StopSpeaking() {
+	vm.speech.mutex.Lock()
+	defer vm.speech.mutex.Unlock()
+	for stop := range vm.speech.stops {
+		close(stop)
+	}
+	clear(vm.speech.stops)
+}
+
+// startSpeech регистрирует фразу и возвращает канал, который закроется,
+// если ее прервут
+func (vm *VoiceManager) startSpeech() chan struct{} {
+	vm.speech.mutex.Lock()
+	defer vm.speech.mutex.Unlock()
+	if vm.speech.stops == nil {
+		vm.speech.stops = make(map[chan struct{}]bool)
+	}
+	stop := make(chan struct{})
+	vm.speech.stops[stop] = true
+	return stop
+}
+
+// finishSpeech забывает фразу после окончания
+func (vm *VoiceManager) finishSpeech(stop chan struct{}) {
+	vm.speech.mutex.Lock()
+	defer vm.speech.mutex.Unlock()
+	delete(vm.speech.stops, stop)
+}
+
+// playAudio декодирует синтезированную речь и воспроизводит ее, пока не
+// закроется stop
+func (vm *VoiceManager) playAudio(audio tts.Audio, stop chan struct{}) error {
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+	var err error
+	switch audio.Format {
+	case tts.FormatMP3:
+		streamer, format, err = mp3.Decode(io.NopCloser(bytes.NewReader(audio.Data)))
+	case tts.FormatWAV:
+		streamer, format, err = wav.Decode(bytes.NewReader(audio.Data))
+	default:
+		return tracerr.New(fmt.Sprintf("Неподдерживаемый формат аудио: %s", audio.Format))
+	}
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	defer streamer.Close()
+
+	return vm.playStream(streamer, format, stop)
+}
+
+// playStream воспроизводит звук на устройстве output_device и ждет окончания
+// или закрытия stop. Устройство открывается на время фразы с частотой звука,
+// поэтому передискретизация не нужна. Уровень звука передается фильтру эха.
+func (vm *VoiceManager) playStream(streamer beep.Streamer, format beep.Format, stop chan struct{}) error {
+	if vm.context == nil {
+		return tracerr.New("Аудио не инициализировано")
+	}
+
+	config := malgo.DefaultDeviceConfig(malgo.Playback)
+	config.Playback.Format = malgo.FormatS16
+	config.Playback.Channels = 2
+	config.SampleRate = uint32(format.SampleRate)
+
+	// Если выбранный динамик отключен, звучит динамик по умолчанию
+	vm.deviceMutex.Lock()
+	deviceID, err := vm.findDevice(malgo.Playback, vm.config.OutputDevice)
+	vm.deviceMutex.Unlock()
+	if err != nil {
+		log.Printf("Динамик по умолчанию вместо выбранного: %v", err)
+	}
+	if deviceID != nil {
+		config.Playback.DeviceID = deviceID.Pointer()
+	}
+
+	// После конца звука отдаем еще один буфер тишины, чтобы устройство
+	// успело доиграть последний фрагмент
+	done := make(chan struct{})
+	var samples [][2]float64
+	var finished, closed bool
+	callbacks := malgo.DeviceCallbacks{
+		Data: func(output, input []byte, frames uint32) {
+			if closed {
+				return
+			}
+			if finished {
+				clear(output)
+				closed = true
+				close(done)
+				return
+			}
+
+			if len(samples) < int(frames) {
+				samples = make([][2]float64, frames)
+			}
+			n, ok := streamer.Stream(samples[:frames])
+			for i := 0; i < int(frames); i++ {
+				var left, right int16
+				if i < n {
+					left = toS16(samples[i][0])
+					right = toS16(samples[i][1])
+				}
+				binary.LittleEndian.PutUint16(output[i*4:], uint16(left))
+				binary.LittleEndian.PutUint16(output[i*4+2:], uint16(right))
+			}
+			if !ok || n < int(frames) {
+				finished = true
+			}
+			vm.echoGate.Reference(vad.Level(output), time.Now())
+		},
+	}
+
+	device, err := malgo.InitDevice(vm.context.Context, config, callbacks)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	defer device.Uninit()
+
+	if err := device.Start(); err != nil {
+		return tracerr.Wrap(err)
+	}
+	select {
+	case <-done:
+	case <-stop:
+	}
+	return tracerr.Wrap(device.Stop())
+}
+
+// toS16 переводит отсчет beep (-1..1) в 16-битный
+func toS16(sample float64) int16 {
+	sample = max(-1, min(1, sample))
+	return int16(sample * 32767)
+}
@@ -0,0 +1,189 @@
+package voice
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/stt"
+	"kot.ai/internal/tts"
+	"kot.ai/internal/vad"
+	"kot.ai/internal/wakeword"
+)
+
+// RemoteStream распознает речь, которую присылает другое устройство,
+// например телефон с открытой страницей ассистента. У потока свои детектор
+// ключевого слова и выделитель фраз, поэтому он не мешает микрофону
+// компьютера, а распознается речь так же.
+type RemoteStream struct {
+	vm         *VoiceManager
+	resampler  *stt.Resampler
+	detector   *wakeword.Detector // nil — ключевое слово ищется в распознанном тексте
+	endpointer *vad.Endpointer
+	onCommand  func(string)
+	onState    func(string)
+
+	mutex      sync.Mutex
+	active     bool      // ключевое слово сказано, ждем команду
+	wakeTime   time.Time // когда начали ждать команду
+	processing bool
+	reset      bool // детектор нужно сбросить перед следующей записью
+	closed     bool
+}
+
+// NewRemoteStream создает поток для записи в формате format (stt.FormatS16LE
+// или stt.FormatF32LE) с частотой sampleRate. onCommand получает команды,
+// сказанные после ключевого слова, onState — StateIdle и StateCommand.
+func (vm *VoiceManager) NewRemoteStream(format string, sampleRate, channels int, onCommand, onState func(string)) (*RemoteStream, error) {
+	if !vm.config.Enabled {
+		return nil, tracerr.New("Голосовой модуль отключен")
+	}
+	resampler, err := stt.NewResampler(format, sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+	endpointer, err := vad.NewEndpointer(vm.vadConfig())
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	s := &RemoteStream{
+		vm:         vm,
+		resampler:  resampler,
+		endpointer: endpointer,
+		onCommand:  onCommand,
+		onState:    onState,
+	}
+	if vm.config.WakeWordEngine != "stt" {
+		detector, err := vm.newDetector()
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		s.detector = detector
+	}
+	return s, nil
+}
+
+// Write принимает очередную часть записи. Части передаются по порядку из
+// одной горутины.
+func (s *RemoteStream) Write(data []byte) {
+	pcm := s.resampler.Write(data)
+	if len(pcm) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	active := s.active
+	expired := active && s.detector != nil && !s.endpointer.Speaking() && time.Since(s.wakeTime) > wakeTimeout
+	reset := s.reset
+	s.reset = false
+	s.mutex.Unlock()
+
+	// Пока ключевое слово не сказано, запись не покидает детектор
+	if s.detector != nil && !active {
+		if reset {
+			s.detector.Reset()
+		}
+		if s.detector.Process(pcm) {
+			s.endpointer.Reset()
+			s.setActive(true)
+		}
+		return
+	}
+	if expired {
+		// Команду так и не сказали
+		s.setActive(false)
+		return
+	}
+
+	for _, utterance := range s.endpointer.Push(pcm) {
+		s.mutex.Lock()
+		s.wakeTime = time.Now()
+		s.mutex.Unlock()
+		go s.process(utterance)
+	}
+}
+
+// Close останавливает поток: начатые фразы больше не становятся командами
+func (s *RemoteStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+}
+
+// setActive начинает или перестает ждать команду
+func (s *RemoteStream) setActive(active bool) {
+	s.mutex.Lock()
+	s.active = active
+	s.wakeTime = time.Now()
+	s.reset = !active
+	closed := s.closed
+	s.mutex.Unlock()
+
+	if closed || s.onState == nil {
+		return
+	}
+	if active {
+		s.onState(StateCommand)
+	} else {
+		s.onState(StateIdle)
+	}
+}
+
+// process распознает фразу и передает команду или ищет в ней ключевое слово
+func (s *RemoteStream) process(utterance []byte) {
+	s.mutex.Lock()
+	if s.processing {
+		s.mutex.Unlock()
+		return
+	}
+	s.processing = true
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.processing = false
+		s.mutex.Unlock()
+	}()
+
+	text, err := s.vm.recognizeSpeech(utterance)
+	if err != nil {
+		log.Printf("Ошибка распознавания речи с другого устройства: %v", err)
+		return
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	active, closed := s.active, s.closed
+	s.mutex.Unlock()
+	if closed {
+		return
+	}
+	if !active {
+		if strings.Contains(strings.ToLower(text), strings.ToLower(s.vm.config.WakeWord)) {
+			s.setActive(true)
+		}
+		return
+	}
+
+	s.setActive(false)
+	if s.onCommand != nil {
+		s.onCommand(text)
+	}
+}
+
+// Synthesize синтезирует фразу, не воспроизводя ее, например чтобы
+// отправить звук на другое устройство
+func (vm *VoiceManager) Synthesize(ctx context.Context, text string) (tts.Audio, error) {
+	if vm.synthesizer == nil {
+		return tts.Audio{}, tracerr.New("Синтез речи не инициализирован")
+	}
+	return vm.synthesizer.Synthesize(ctx, text)
+}
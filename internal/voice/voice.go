@@ -3,31 +3,38 @@ package voice
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/speech/apiv1"
 	speechpb "cloud.google.com/go/speech/apiv1/speechpb"
-	"github.com/faiface/beep"
-	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/speaker"
-	"github.com/faiface/beep/wav"
 	"github.com/gen2brain/malgo"
-	ttsengine "github.com/hegedustibor/htgo-tts"
 	"github.com/sashabaranov/go-openai"
 	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/config"
+	"kot.ai/internal/hotkey"
+	"kot.ai/internal/intent"
+	"kot.ai/internal/stt"
+	"kot.ai/internal/tts"
+	"kot.ai/internal/vad"
+	"kot.ai/internal/wakeword"
 )
 
 // VoiceManager управляет голосовыми функциями
 type VoiceManager struct {
 	config         VoiceConfig
-	context        *malgo.Context
+	context        *malgo.AllocatedContext
 	device         *malgo.Device
+	deviceMutex    sync.Mutex    // защищает устройства и их выбор в настройках
+	captureLost    atomic.Bool   // микрофон перестал работать, например его отключили
+	captureDefault bool          // выбранный микрофон недоступен, работает микрофон по умолчанию
+	done           chan struct{} // закрывается при остановке модуля
 	captureConfig  malgo.DeviceConfig
 	captureChan    chan []byte
 	isListening    bool
@@ -35,36 +42,65 @@ type VoiceManager struct {
 	mutex          sync.Mutex
 	openAIClient   *openai.Client
 	googleClient   *speech.Client
-	tts            *ttsengine.Speech
-	wakeWordActive bool
+	synthesizer    tts.Synthesizer
+	recognizer     stt.Recognizer     // офлайн-распознавание для voice_recognition: local
+	detector       *wakeword.Detector // поиск ключевого слова без распознавания речи
+	endpointer     *vad.Endpointer    // выделение фраз из потока записи
+	echoGate       *vad.EchoGate      // отбрасывает эхо речи ассистента
+	speech         speechState        // произносимые фразы, которые можно прервать
+	// Что слушает модуль. Меняется и при обработке записи, и при
+	// распознавании, поэтому защищено mutex.
+	wakeWordActive bool        // ключевое слово сказано, ждем команду
+	wakeTime       time.Time   // когда начали ждать команду
+	followUp       bool        // команда ждется без ключевого слова после ответа
+	resetDetector  bool        // детектор нужно сбросить перед следующей записью
+	state          string      // что сейчас слушает модуль
+	followUpQueued atomic.Bool // ответ закончен, можно ждать продолжения
+	talk           talkState   // запись команды по клавише
+	hotkey         hotkey.Listener
 	callbacks      struct {
 		onCommand func(string)
+		onWake    func()
+		onState   func(string)
 	}
 }
 
-// VoiceConfig содержит настройки голосового модуля
-type VoiceConfig struct {
-	Enabled           bool    `json:"enabled"`
-	WakeWord          string  `json:"wake_word"`
-	Language          string  `json:"language"`
-	VoiceRecognition  string  `json:"voice_recognition"` // google, local, whisper
-	TTSProvider       string  `json:"tts_provider"`      // google, local
-	VoiceThreshold    float64 `json:"voice_threshold"`
-	SilenceThreshold  float64 `json:"silence_threshold"`
-	InputDevice       string  `json:"input_device"`
-	OutputDevice      string  `json:"output_device"`
-	OpenAIAPIKey      string  `json:"openai_api_key"`
-	GoogleAPIKey      string  `json:"google_api_key"`
+// VoiceConfig содержит настройки голосового модуля, см. config.VoiceConfig
+type VoiceConfig = config.VoiceConfig
+
+// Что слушает голосовой модуль
+const (
+	StateIdle     = "idle"      // ждет ключевое слово
+	StateCommand  = "command"   // ждет команду после ключевого слова
+	StateFollowUp = "follow_up" // ждет продолжения разговора после ответа
+)
+
+// followUpEndWords — слова, которыми пользователь заканчивает разговор:
+// "спасибо", "всё", "хватит, спасибо"
+var followUpEndWords = map[string]bool{
+	"спасибо": true, "все": true, "хватит": true, "достаточно": true,
+	"пока": true, "больше": true, "ничего": true, "ладно": true,
 }
 
+// Что прерывает ответ ассистента
+const (
+	BargeInSpeech   = "speech"
+	BargeInWakeWord = "wake_word"
+)
+
+// wakeTimeout — сколько ждать команду после ключевого слова
+const wakeTimeout = 8 * time.Second
+
 // NewVoiceManager создает новый экземпляр VoiceManager
 func NewVoiceManager(config VoiceConfig) *VoiceManager {
 	return &VoiceManager{
 		config:         config,
 		captureChan:    make(chan []byte, 10),
+		echoGate:       vad.NewEchoGate(config.EchoMarginDb),
 		isListening:    false,
 		isProcessing:   false,
 		wakeWordActive: false,
+		state:          StateIdle,
 	}
 }
 
@@ -75,11 +111,33 @@ func (vm *VoiceManager) Start() error {
 		return nil
 	}
 
+	switch vm.config.ActivationMode {
+	case ActivationWakeWord, ActivationPushToTalk, ActivationToggle, "":
+	default:
+		return tracerr.New(fmt.Sprintf("Неизвестный способ активации: %s", vm.config.ActivationMode))
+	}
+
 	// Инициализация OpenAI клиента, если используется Whisper
 	if vm.config.VoiceRecognition == "whisper" && vm.config.OpenAIAPIKey != "" {
 		vm.openAIClient = openai.NewClient(vm.config.OpenAIAPIKey)
 	}
 
+	// Инициализация офлайн-распознавания
+	if vm.config.VoiceRecognition == "local" {
+		recognizer, err := stt.NewRecognizer(stt.Config{
+			Engine:    vm.config.STTEngine,
+			ModelPath: vm.config.STTModelPath,
+			Language:  vm.config.Language,
+			Threads:   vm.config.STTThreads,
+			Command:   vm.config.STTCommand,
+			ServerURL: vm.config.STTServerURL,
+		})
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		vm.recognizer = recognizer
+	}
+
 	// Инициализация Google Speech клиента, если используется Google
 	if (vm.config.VoiceRecognition == "google" || vm.config.TTSProvider == "google") && vm.config.GoogleAPIKey != "" {
 		ctx := context.Background()
@@ -90,14 +148,45 @@ func (vm *VoiceManager) Start() error {
 		vm.googleClient = client
 	}
 
-	// Инициализация TTS
-	vm.tts = &ttsengine.Speech{
-		Folder:   "audio",
+	// Инициализация детектора ключевого слова. С ним распознавателю
+	// передается только то, что сказано после ключевого слова.
+	if !vm.keyActivated() && vm.config.WakeWordEngine != "stt" {
+		detector, err := vm.newDetector()
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		vm.detector = detector
+		log.Printf("Детектор ключевого слова: %s", detector)
+	}
+
+	// Выделение фраз
+	endpointer, err := vad.NewEndpointer(vm.vadConfig())
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	vm.endpointer = endpointer
+
+	// Инициализация синтеза речи
+	ttsConfig := tts.Config{
+		Engine:   vm.config.TTSProvider,
+		Voice:    vm.config.TTSVoice,
+		Rate:     vm.config.TTSRate,
+		Pitch:    vm.config.TTSPitch,
 		Language: vm.config.Language,
+		Command:  vm.config.TTSCommand,
+		URL:      vm.config.TTSURL,
+	}
+	synthesizer, err := tts.NewSynthesizer(ttsConfig)
+	if err != nil {
+		return tracerr.Wrap(err)
 	}
+	if vm.config.TTSCachePath != "" {
+		synthesizer = tts.NewCache(synthesizer, vm.config.TTSCachePath, ttsConfig.Key())
+	}
+	vm.synthesizer = synthesizer
 
 	// Инициализация аудио контекста
-	ctx, err := malgo.NewContext(nil, malgo.ContextConfig{}, func(message string) {
+	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, func(message string) {
 		log.Printf("[Audio Log] %s\n", message)
 	})
 	if err != nil {
@@ -109,49 +198,75 @@ func (vm *VoiceManager) Start() error {
 	vm.captureConfig = malgo.DefaultDeviceConfig(malgo.Capture)
 	vm.captureConfig.Capture.Format = malgo.FormatS16
 	vm.captureConfig.Capture.Channels = 1
-	vm.captureConfig.SampleRate = 16000
+	vm.captureConfig.SampleRate = stt.SampleRate
 	vm.captureConfig.Alsa.NoMMap = 1
 
-	// Создание устройства захвата
-	deviceCallbacks := malgo.DeviceCallbacks{
-		Data: vm.onAudioData,
-	}
-	device, err := malgo.InitDevice(vm.context.Context, vm.captureConfig, &deviceCallbacks)
+	// Открытие микрофона из настроек
+	vm.deviceMutex.Lock()
+	err = vm.openCapture()
+	vm.deviceMutex.Unlock()
 	if err != nil {
-		vm.context.Close()
-		return tracerr.Wrap(err)
-	}
-	vm.device = device
-
-	// Запуск устройства
-	if err := vm.device.Start(); err != nil {
-		vm.device.Uninit()
-		vm.context.Close()
+		vm.closeContext()
 		return tracerr.Wrap(err)
 	}
 
-	// Запуск обработки аудио в отдельной горутине
-	go vm.processAudio()
+	// Запуск обработки аудио и наблюдения за устройствами в отдельных горутинах
+	vm.done = make(chan struct{})
+	vm.isListening = true
+	go vm.processAudio(vm.done)
+	go vm.monitorDevices(vm.done)
+	vm.listenHotkey()
 
 	return nil
 }
 
+// newDetector создает детектор ключевого слова по образцам из настроек
+func (vm *VoiceManager) newDetector() (*wakeword.Detector, error) {
+	templates, err := wakeword.LoadTemplates(vm.config.WakeWordTemplates)
+	if err != nil {
+		return nil, err
+	}
+	return wakeword.NewDetector(templates, vm.config.WakeWordSensitivity)
+}
+
+// vadConfig возвращает настройки выделения фраз: незаданные длительности
+// берутся по умолчанию
+func (vm *VoiceManager) vadConfig() vad.Config {
+	config := vad.DefaultConfig()
+	config.SampleRate = stt.SampleRate
+	config.Aggressiveness = vm.config.VADAggressiveness
+	if vm.config.VADPreRollMs > 0 {
+		config.PreRollMs = vm.config.VADPreRollMs
+	}
+	if vm.config.VADHangoverMs > 0 {
+		config.HangoverMs = vm.config.VADHangoverMs
+	}
+	if vm.config.VADMaxUtteranceMs > 0 {
+		config.MaxUtteranceMs = vm.config.VADMaxUtteranceMs
+	}
+	return config
+}
+
 // Stop останавливает голосовой модуль
 func (vm *VoiceManager) Stop() {
 	vm.mutex.Lock()
 	defer vm.mutex.Unlock()
 
-	if vm.device != nil {
-		vm.device.Stop()
-		vm.device.Uninit()
-		vm.device = nil
+	if vm.done != nil {
+		close(vm.done)
+		vm.done = nil
 	}
 
-	if vm.context != nil {
-		vm.context.Close()
-		vm.context = nil
+	if vm.hotkey != nil {
+		vm.hotkey.Close()
+		vm.hotkey = nil
 	}
 
+	vm.deviceMutex.Lock()
+	vm.closeCapture()
+	vm.closeContext()
+	vm.deviceMutex.Unlock()
+
 	if vm.googleClient != nil {
 		vm.googleClient.Close()
 		vm.googleClient = nil
@@ -161,36 +276,83 @@ func (vm *VoiceManager) Stop() {
 	vm.isProcessing = false
 }
 
+// Reconfigure применяет новые настройки: останавливает модуль и запускает
+// его заново с новыми распознаванием, синтезом и ключевым словом
+func (vm *VoiceManager) Reconfigure(config VoiceConfig) error {
+	vm.Stop()
+
+	vm.mutex.Lock()
+	vm.config = config
+	vm.echoGate = vad.NewEchoGate(config.EchoMarginDb)
+	vm.openAIClient = nil
+	vm.recognizer = nil
+	vm.detector = nil
+	vm.mutex.Unlock()
+
+	return vm.Start()
+}
+
 // SetCommandCallback устанавливает функцию обратного вызова для команд
 func (vm *VoiceManager) SetCommandCallback(callback func(string)) {
 	vm.callbacks.onCommand = callback
 }
 
+// SetWakeCallback устанавливает функцию, которая вызывается при
+// распознавании ключевого слова
+func (vm *VoiceManager) SetWakeCallback(callback func()) {
+	vm.callbacks.onWake = callback
+}
+
+// SetStateCallback устанавливает функцию, которая вызывается, когда модуль
+// начинает или перестает слушать команду (StateIdle, StateCommand,
+// StateFollowUp)
+func (vm *VoiceManager) SetStateCallback(callback func(string)) {
+	vm.callbacks.onState = callback
+}
+
+// setState сообщает, что модуль слушает
+func (vm *VoiceManager) setState(state string) {
+	vm.mutex.Lock()
+	changed := vm.state != state
+	vm.state = state
+	vm.mutex.Unlock()
+	vm.notifyState(changed, state)
+}
+
+// notifyState сообщает интерфейсу новое состояние, если оно изменилось
+func (vm *VoiceManager) notifyState(changed bool, state string) {
+	if changed && vm.callbacks.onState != nil {
+		vm.callbacks.onState(state)
+	}
+}
+
 // Speak произносит текст
 func (vm *VoiceManager) Speak(text string) error {
 	if !vm.config.Enabled {
 		return nil
 	}
 
-	switch vm.config.TTSProvider {
-	case "google":
-		return vm.speakGoogle(text)
-	case "local":
-		return vm.speakLocal(text)
-	default:
-		return vm.speakLocal(text)
+	if vm.synthesizer == nil {
+		return tracerr.New("Синтез речи не инициализирован")
 	}
-}
 
-// speakGoogle использует Google TTS для произнесения текста
-func (vm *VoiceManager) speakGoogle(text string) error {
-	// Используем локальный TTS, если Google недоступен
-	return vm.tts.Speak(text)
-}
+	// Фразу можно прервать и во время синтеза
+	stop := vm.startSpeech()
+	defer vm.finishSpeech(stop)
 
-// speakLocal использует локальный TTS для произнесения текста
-func (vm *VoiceManager) speakLocal(text string) error {
-	return vm.tts.Speak(text)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	audio, err := vm.synthesizer.Synthesize(ctx, text)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	select {
+	case <-stop:
+		return nil
+	default:
+	}
+	return vm.playAudio(audio, stop)
 }
 
 // onAudioData обрабатывает входящие аудио данные
@@ -212,110 +374,232 @@ func (vm *VoiceManager) onAudioData(pOutputSample, pInputSample []byte, framecou
 	}
 }
 
-// processAudio обрабатывает аудио данные в отдельной горутине
-func (vm *VoiceManager) processAudio() {
-	vm.isListening = true
-
-	var buffer []byte
-	var silenceCounter int
-	var isRecording bool
+// processAudio обрабатывает аудио данные в отдельной горутине, пока не
+// закроется done
+func (vm *VoiceManager) processAudio(done chan struct{}) {
+	for {
+		var data []byte
+		select {
+		case <-done:
+			return
+		case data = <-vm.captureChan:
+		}
 
-	for vm.isListening {
-		data := <-vm.captureChan
+		// После ответа команда ждется без ключевого слова
+		if vm.followUpQueued.Swap(false) {
+			vm.openFollowUp()
+		}
 
-		// Проверяем уровень громкости
-		level := vm.calculateAudioLevel(data)
+		// Состояние меняет и горутина распознавания, поэтому оно читается
+		// один раз под блокировкой
+		vm.mutex.Lock()
+		active := vm.wakeWordActive
+		expired := active && (vm.detector != nil || vm.followUp) && time.Since(vm.wakeTime) > vm.listenTimeout()
+		reset := vm.resetDetector
+		vm.resetDetector = false
+		vm.mutex.Unlock()
+		if reset && vm.detector != nil {
+			vm.detector.Reset()
+		}
 
-		if !isRecording && level > vm.config.VoiceThreshold {
-			// Начинаем запись
-			isRecording = true
-			buffer = nil
-			silenceCounter = 0
+		// Пока ассистент говорит, эхо его речи отбрасывается
+		now := time.Now()
+		playing := vm.echoGate.Playing(now)
+		if playing && vm.echoGate.IsEcho(vad.Level(data), now) {
+			continue
 		}
 
-		if isRecording {
-			// Добавляем данные в буфер
-			buffer = append(buffer, data...)
+		// Команду начинает и заканчивает клавиша, ключевое слово не ищется
+		if vm.keyActivated() {
+			vm.appendTalk(data)
+			continue
+		}
 
-			if level < vm.config.SilenceThreshold {
-				silenceCounter++
-			} else {
-				silenceCounter = 0
+		// Речь пользователя поверх ответа прерывает его и становится командой
+		if playing && !active && vm.config.BargeIn != BargeInWakeWord {
+			vm.pushAudio(data)
+			if vm.endpointer.Speaking() {
+				vm.bargeIn()
 			}
+			continue
+		}
 
-			// Если тишина длится достаточно долго, обрабатываем запись
-			if silenceCounter > 30 { // примерно 1 секунда тишины
-				isRecording = false
-
-				// Обрабатываем запись в отдельной горутине
-				go func(audioData []byte) {
-					vm.mutex.Lock()
-					if vm.isProcessing {
-						vm.mutex.Unlock()
-						return
-					}
-					vm.isProcessing = true
-					vm.mutex.Unlock()
-
-					defer func() {
-						vm.mutex.Lock()
-						vm.isProcessing = false
-						vm.mutex.Unlock()
-					}()
-
-					// Распознаем речь
-					text, err := vm.recognizeSpeech(audioData)
-					if err != nil {
-						log.Printf("Ошибка распознавания речи: %v", err)
-						return
-					}
-
-					if text == "" {
-						return
-					}
-
-					text = strings.ToLower(text)
-					log.Printf("Распознано: %s", text)
-
-					// Проверяем наличие ключевого слова
-					if !vm.wakeWordActive {
-						if strings.Contains(text, strings.ToLower(vm.config.WakeWord)) {
-							vm.wakeWordActive = true
-							vm.Speak("Слушаю")
-						}
-						return
-					}
-
-					// Обрабатываем команду
-					if vm.callbacks.onCommand != nil {
-						vm.callbacks.onCommand(text)
-						vm.wakeWordActive = false // Сбрасываем активацию после выполнения команды
-					}
-				}(buffer)
+		// Пока ключевое слово не сказано, запись не покидает детектор
+		if vm.detector != nil && !active {
+			if vm.detector.Process(data) {
+				vm.activate()
+				vm.endpointer.Reset()
 			}
+			continue
+		}
+		if expired && !vm.endpointer.Speaking() {
+			// Команду так и не сказали
+			vm.listen(StateIdle)
+			continue
 		}
+
+		vm.pushAudio(data)
 	}
 }
 
-// calculateAudioLevel вычисляет уровень громкости аудио
-func (vm *VoiceManager) calculateAudioLevel(data []byte) float64 {
-	if len(data) == 0 {
-		return 0
+// pushAudio передает запись выделителю фраз. Законченные фразы
+// обрабатываются в отдельной горутине.
+func (vm *VoiceManager) pushAudio(data []byte) {
+	for _, utterance := range vm.endpointer.Push(data) {
+		// Ожидание отсчитывается заново, пока фраза распознается
+		vm.mutex.Lock()
+		vm.wakeTime = time.Now()
+		vm.mutex.Unlock()
+		go vm.processUtterance(utterance)
 	}
+}
 
-	var sum float64
-	for i := 0; i < len(data); i += 2 {
-		if i+1 >= len(data) {
-			break
+// listenTimeout возвращает, сколько ждать команду. Вызывается под vm.mutex.
+func (vm *VoiceManager) listenTimeout() time.Duration {
+	if vm.followUp {
+		return time.Duration(vm.config.FollowUpSeconds) * time.Second
+	}
+	return wakeTimeout
+}
+
+// switchListening переключает, что слушает модуль: StateIdle — ключевое
+// слово, StateCommand — команду, StateFollowUp — продолжение разговора без
+// ключевого слова. Ожидание команды отсчитывается заново. Вызывается под
+// vm.mutex, возвращает, изменилось ли состояние.
+func (vm *VoiceManager) switchListening(state string) bool {
+	vm.wakeWordActive = state != StateIdle
+	vm.followUp = state == StateFollowUp
+	vm.wakeTime = time.Now()
+	if state == StateIdle {
+		vm.resetDetector = true
+	}
+	changed := vm.state != state
+	vm.state = state
+	return changed
+}
+
+// listen переключает, что слушает модуль, и сообщает новое состояние
+func (vm *VoiceManager) listen(state string) {
+	vm.mutex.Lock()
+	changed := vm.switchListening(state)
+	vm.mutex.Unlock()
+	vm.notifyState(changed, state)
+}
+
+// openFollowUp начинает ждать продолжения разговора после ответа
+func (vm *VoiceManager) openFollowUp() {
+	vm.mutex.Lock()
+	if vm.wakeWordActive {
+		// Ответ уже прервали следующей командой
+		vm.mutex.Unlock()
+		return
+	}
+	changed := vm.switchListening(StateFollowUp)
+	vm.mutex.Unlock()
+
+	vm.endpointer.Reset()
+	vm.notifyState(changed, StateFollowUp)
+}
+
+// bargeIn прерывает ответ, когда пользователь заговорил поверх него.
+// Начатая фраза становится командой, переспрашивать не нужно.
+func (vm *VoiceManager) bargeIn() {
+	log.Println("Ответ прерван пользователем")
+	vm.StopSpeaking()
+	vm.listen(StateCommand)
+	if vm.callbacks.onWake != nil {
+		vm.callbacks.onWake()
+	}
+}
+
+// processUtterance распознает фразу и передает команду или ищет в ней
+// ключевое слово
+func (vm *VoiceManager) processUtterance(audioData []byte) {
+	vm.mutex.Lock()
+	if vm.isProcessing {
+		vm.mutex.Unlock()
+		return
+	}
+	vm.isProcessing = true
+	vm.mutex.Unlock()
+
+	defer func() {
+		vm.mutex.Lock()
+		vm.isProcessing = false
+		vm.mutex.Unlock()
+	}()
+
+	// Распознаем речь
+	text, err := vm.recognizeSpeech(audioData)
+	if err != nil {
+		log.Printf("Ошибка распознавания речи: %v", err)
+		return
+	}
+
+	if text == "" {
+		return
+	}
+
+	log.Printf("Распознано: %s", text)
+
+	// Состояние меняет и горутина записи
+	vm.mutex.Lock()
+	active, followUp := vm.wakeWordActive, vm.followUp
+	vm.mutex.Unlock()
+
+	// Проверяем наличие ключевого слова. Команда передается как есть:
+	// регистр нужен, например, в названиях городов.
+	if !active {
+		if strings.Contains(strings.ToLower(text), strings.ToLower(vm.config.WakeWord)) {
+			vm.activate()
 		}
+		return
+	}
+
+	// "Спасибо" или "всё" после ответа заканчивают разговор
+	if followUp && isFollowUpEnd(text) {
+		log.Println("Разговор закончен")
+		vm.listen(StateIdle)
+		return
+	}
+
+	// Обрабатываем команду. Ответ может быть долгим, поэтому
+	// распознавание продолжается: ключевое слово прерывает ответ.
+	// После ответа продолжение ждется без ключевого слова.
+	if vm.callbacks.onCommand != nil {
+		vm.listen(StateIdle) // Сбрасываем активацию после выполнения команды
+		go func() {
+			vm.callbacks.onCommand(text)
+			if vm.config.FollowUpSeconds > 0 {
+				vm.followUpQueued.Store(true)
+			}
+		}()
+	}
+}
 
-		// Преобразуем два байта в 16-битное значение
-		sample := int16(data[i]) | (int16(data[i+1]) << 8)
-		value := float64(sample) / 32768.0 // Нормализуем до [-1, 1]
-		sum += value * value
+// isFollowUpEnd сообщает, что фраза только заканчивает разговор
+func isFollowUpEnd(text string) bool {
+	words := strings.Fields(intent.Normalize(text))
+	for _, word := range words {
+		if !followUpEndWords[word] {
+			return false
+		}
 	}
+	return len(words) > 0
+}
 
-	return sum / float64(len(data)/2)
+// activate включает прием команды после ключевого слова. Ключевое слово
+// прерывает и текущий ответ.
+func (vm *VoiceManager) activate() {
+	vm.StopSpeaking()
+	vm.listen(StateCommand)
+	if vm.callbacks.onWake != nil {
+		vm.callbacks.onWake()
+	}
+	// Отклик синтезируется и звучит, пока запись продолжает обрабатываться:
+	// команду часто начинают сразу после ключевого слова. Эхо отклика
+	// отбрасывается фильтром.
+	go vm.Speak("Слушаю")
 }
 
 // recognizeSpeech распознает речь из аудио данных
@@ -325,11 +609,29 @@ func (vm *VoiceManager) recognizeSpeech(audioData []byte) (string, error) {
 		return vm.recognizeWithWhisper(audioData)
 	case "google":
 		return vm.recognizeWithGoogle(audioData)
+	case "local":
+		return vm.recognizeLocal(audioData)
 	default:
-		return vm.recognizeWithWhisper(audioData)
+		return "", tracerr.New(fmt.Sprintf("Неизвестный способ распознавания речи: %s", vm.config.VoiceRecognition))
 	}
 }
 
+// recognizeLocal распознает речь без сети движком из stt_engine
+func (vm *VoiceManager) recognizeLocal(audioData []byte) (string, error) {
+	if vm.recognizer == nil {
+		return "", tracerr.New("Офлайн-распознавание не инициализировано")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	text, err := vm.recognizer.Recognize(ctx, audioData)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+	return text, nil
+}
+
 // recognizeWithWhisper распознает речь с помощью OpenAI Whisper API
 func (vm *VoiceManager) recognizeWithWhisper(audioData []byte) (string, error) {
 	if vm.openAIClient == nil {
@@ -402,71 +704,6 @@ func (vm *VoiceManager) recognizeWithGoogle(audioData []byte) (string, error) {
 
 // saveAudioAsWAV сохраняет аудио данные в WAV формате
 func (vm *VoiceManager) saveAudioAsWAV(audioData []byte, filePath string) error {
-	// Создаем WAV заголовок
-	header := make([]byte, 44)
-
-	// "RIFF" chunk descriptor
-	copy(header[0:4], []byte("RIFF"))
-
-	// Размер файла - 8
-	fileSize := uint32(len(audioData) + 36)
-	header[4] = byte(fileSize)
-	header[5] = byte(fileSize >> 8)
-	header[6] = byte(fileSize >> 16)
-	header[7] = byte(fileSize >> 24)
-
-	// "WAVE" формат
-	copy(header[8:12], []byte("WAVE"))
-
-	// "fmt " subchunk
-	copy(header[12:16], []byte("fmt "))
-
-	// Размер subchunk (16 для PCM)
-	header[16] = 16
-	header[17] = 0
-	header[18] = 0
-	header[19] = 0
-
-	// Аудио формат (1 для PCM)
-	header[20] = 1
-	header[21] = 0
-
-	// Количество каналов (1 для моно)
-	header[22] = 1
-	header[23] = 0
-
-	// Частота дискретизации (16000 Hz)
-	sampleRate := uint32(16000)
-	header[24] = byte(sampleRate)
-	header[25] = byte(sampleRate >> 8)
-	header[26] = byte(sampleRate >> 16)
-	header[27] = byte(sampleRate >> 24)
-
-	// Байт в секунду (16000 * 2 = 32000)
-	byteRate := uint32(32000)
-	header[28] = byte(byteRate)
-	header[29] = byte(byteRate >> 8)
-	header[30] = byte(byteRate >> 16)
-	header[31] = byte(byteRate >> 24)
-
-	// Выравнивание блока (2 байта)
-	header[32] = 2
-	header[33] = 0
-
-	// Бит на сэмпл (16 бит)
-	header[34] = 16
-	header[35] = 0
-
-	// "data" subchunk
-	copy(header[36:40], []byte("data"))
-
-	// Размер данных
-	dataSize := uint32(len(audioData))
-	header[40] = byte(dataSize)
-	header[41] = byte(dataSize >> 8)
-	header[42] = byte(dataSize >> 16)
-	header[43] = byte(dataSize >> 24)
-
 	// Создаем файл
 	file, err := os.Create(filePath)
 	if err != nil {
@@ -475,81 +712,26 @@ func (vm *VoiceManager) saveAudioAsWAV(audioData []byte, filePath string) error
 	defer file.Close()
 
 	// Записываем заголовок и данные
-	if _, err := file.Write(header); err != nil {
-		return tracerr.Wrap(err)
-	}
-
-	if _, err := file.Write(audioData); err != nil {
-		return tracerr.Wrap(err)
-	}
-
-	return nil
+	return stt.WriteWAV(file, audioData, stt.SampleRate)
 }
 
 // PlayAudioFile воспроизводит аудио файл
 func (vm *VoiceManager) PlayAudioFile(filePath string) error {
-	// Открываем файл
-	file, err := os.Open(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return tracerr.Wrap(err)
 	}
-	defer file.Close()
+
+	stop := vm.startSpeech()
+	defer vm.finishSpeech(stop)
 
 	// Определяем тип файла по расширению
 	switch filepath.Ext(filePath) {
 	case ".mp3":
-		return vm.playMP3(file)
+		return vm.playAudio(tts.Audio{Format: tts.FormatMP3, Data: data}, stop)
 	case ".wav":
-		return vm.playWAV(file)
+		return vm.playAudio(tts.Audio{Format: tts.FormatWAV, Data: data}, stop)
 	default:
 		return tracerr.New("Неподдерживаемый формат аудио")
 	}
 }
-
-// playMP3 воспроизводит MP3 файл
-func (vm *VoiceManager) playMP3(file io.ReadCloser) error {
-	// Декодируем MP3
-	streamer, format, err := mp3.Decode(file)
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
-	defer streamer.Close()
-
-	// Инициализируем динамик
-	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
-
-	// Воспроизводим
-	done := make(chan bool)
-	speaker.Play(beep.Seq(streamer, beep.Callback(func() {
-		done <- true
-	})))
-
-	// Ждем завершения воспроизведения
-	<-done
-
-	return nil
-}
-
-// playWAV воспроизводит WAV файл
-func (vm *VoiceManager) playWAV(file io.ReadCloser) error {
-	// Декодируем WAV
-	streamer, format, err := wav.Decode(file)
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
-	defer streamer.Close()
-
-	// Инициализируем динамик
-	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
-
-	// Воспроизводим
-	done := make(chan bool)
-	speaker.Play(beep.Seq(streamer, beep.Callback(func() {
-		done <- true
-	})))
-
-	// Ждем завершения воспроизведения
-	<-done
-
-	return nil
-}
\ No newline at end of file
@@ -1,143 +1,240 @@
 package voice
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"kot.ai/internal/tts"
+	"kot.ai/internal/vad"
+	"kot.ai/internal/wakeword"
 )
 
-func TestNewVoiceManager(t *testing.T) {
-	// Создаем конфигурацию для тестирования
-	config := VoiceConfig{
-		Enabled:          true,
-		WakeWord:         "тест",
-		Language:         "ru-RU",
-		VoiceRecognition: "google",
-		TTSProvider:      "google",
-		VoiceThreshold:   0.5,
-		SilenceThreshold: 0.1,
-		InputDevice:      "",
-		OutputDevice:     "",
+// frameBytes — 20 мс записи 16 кГц, моно, 16 бит
+const frameBytes = 640
+
+// slowSynthesizer сообщает о начале синтеза и ждет, пока его отпустят
+type slowSynthesizer struct {
+	started chan string
+	release chan struct{}
+}
+
+func (s *slowSynthesizer) Synthesize(ctx context.Context, text string) (tts.Audio, error) {
+	s.started <- text
+	select {
+	case <-s.release:
+		return tts.Audio{}, nil
+	case <-ctx.Done():
+		return tts.Audio{}, ctx.Err()
 	}
+}
 
-	// Создаем новый экземпляр VoiceManager
-	vm, err := NewVoiceManager(config)
+// textRecognizer «распознает» текст, записанный в тесте вместо звука
+type textRecognizer struct{}
 
-	// Проверяем, что VoiceManager создан без ошибок
-	assert.NoError(t, err)
-	assert.NotNil(t, vm)
+func (textRecognizer) Recognize(ctx context.Context, pcm []byte) (string, error) {
+	return string(pcm), nil
+}
 
-	// Проверяем, что поля VoiceManager инициализированы правильно
-	assert.Equal(t, config.Enabled, vm.Config.Enabled)
-	assert.Equal(t, config.WakeWord, vm.Config.WakeWord)
-	assert.Equal(t, config.Language, vm.Config.Language)
-	assert.Equal(t, config.VoiceRecognition, vm.Config.VoiceRecognition)
-	assert.Equal(t, config.TTSProvider, vm.Config.TTSProvider)
-	assert.Equal(t, config.VoiceThreshold, vm.Config.VoiceThreshold)
-	assert.Equal(t, config.SilenceThreshold, vm.Config.SilenceThreshold)
-
-	// Проверяем, что каналы созданы
-	assert.NotNil(t, vm.CommandChan)
-	assert.NotNil(t, vm.ResponseChan)
-
-	// Останавливаем VoiceManager после теста
-	vm.Stop()
+// capture передает запись циклу обработки частями по 20 мс. Если цикл
+// перестал забирать записи, тест падает.
+func capture(t *testing.T, vm *VoiceManager, pcm []byte) {
+	for start := 0; start < len(pcm); start += frameBytes {
+		select {
+		case vm.captureChan <- pcm[start:min(start+frameBytes, len(pcm))]:
+		case <-time.After(time.Second):
+			t.Fatal("запись не обрабатывается")
+		}
+	}
 }
 
-func TestDetectWakeWord(t *testing.T) {
-	// Этот тест требует реальный аудиовход, поэтому мы просто проверим,
-	// что функция не вызывает панику и возвращает ожидаемый тип
-
-	// Создаем конфигурацию для тестирования
-	config := VoiceConfig{
-		Enabled:          true,
-		WakeWord:         "тест",
-		Language:         "ru-RU",
-		VoiceRecognition: "google",
-		TTSProvider:      "google",
-		VoiceThreshold:   0.5,
-		SilenceThreshold: 0.1,
+// testConfig возвращает настройки голосового модуля для тестов
+func testConfig() VoiceConfig {
+	return VoiceConfig{
+		Enabled:           true,
+		WakeWord:          "тест",
+		Language:          "ru-RU",
+		VoiceRecognition:  "google",
+		TTSProvider:       "google",
+		VADAggressiveness: 2,
+		VADHangoverMs:     800,
+		FollowUpSeconds:   5,
 	}
+}
 
-	// Создаем новый экземпляр VoiceManager
-	vm, err := NewVoiceManager(config)
-	assert.NoError(t, err)
+func TestNewVoiceManager(t *testing.T) {
+	config := testConfig()
+	vm := NewVoiceManager(config)
+	assert.NotNil(t, vm)
 
-	// Устанавливаем короткий таймаут для теста
-	vm.wakeWordTimeout = 100 * time.Millisecond
+	// Проверяем, что поля VoiceManager инициализированы правильно
+	assert.Equal(t, config, vm.config)
+	assert.Equal(t, StateIdle, vm.state)
+	assert.NotNil(t, vm.echoGate)
+	assert.NotNil(t, vm.captureChan)
+	assert.False(t, vm.wakeWordActive)
+
+	// Остановка без запуска не вызывает панику
+	assert.NotPanics(t, vm.Stop)
+}
 
-	// Запускаем детектор ключевого слова в отдельной горутине
-	go func() {
-		// Останавливаем детектор через короткое время
-		time.Sleep(200 * time.Millisecond)
-		vm.Stop()
-	}()
+func TestStartDisabled(t *testing.T) {
+	config := testConfig()
+	config.Enabled = false
+	vm := NewVoiceManager(config)
+
+	// Отключенный модуль не открывает устройства
+	assert.NoError(t, vm.Start())
+	assert.Nil(t, vm.device)
+	vm.Stop()
+}
 
-	// Проверяем, что функция не вызывает панику
-	assert.NotPanics(t, func() {
-		vm.detectWakeWord()
+func TestVADConfig(t *testing.T) {
+	// Незаданные длительности берутся по умолчанию
+	vm := NewVoiceManager(VoiceConfig{VADAggressiveness: 3})
+	config := vm.vadConfig()
+	defaults := vad.DefaultConfig()
+	assert.Equal(t, 3, config.Aggressiveness)
+	assert.Equal(t, defaults.PreRollMs, config.PreRollMs)
+	assert.Equal(t, defaults.HangoverMs, config.HangoverMs)
+	assert.Equal(t, defaults.MaxUtteranceMs, config.MaxUtteranceMs)
+
+	vm = NewVoiceManager(VoiceConfig{
+		VADPreRollMs:      500,
+		VADHangoverMs:     1200,
+		VADMaxUtteranceMs: 20000,
 	})
+	config = vm.vadConfig()
+	assert.Equal(t, 500, config.PreRollMs)
+	assert.Equal(t, 1200, config.HangoverMs)
+	assert.Equal(t, 20000, config.MaxUtteranceMs)
 }
 
-func TestTextToSpeech(t *testing.T) {
-	// Создаем конфигурацию для тестирования
-	config := VoiceConfig{
-		Enabled:          true,
-		WakeWord:         "тест",
-		Language:         "ru-RU",
-		VoiceRecognition: "google",
-		TTSProvider:      "local", // Используем локальный провайдер для теста
-		VoiceThreshold:   0.5,
-		SilenceThreshold: 0.1,
-	}
+func TestListenTimeout(t *testing.T) {
+	vm := NewVoiceManager(testConfig())
+	assert.Equal(t, wakeTimeout, vm.listenTimeout())
 
-	// Создаем новый экземпляр VoiceManager
-	vm, err := NewVoiceManager(config)
-	assert.NoError(t, err)
+	vm.followUp = true
+	assert.Equal(t, 5*time.Second, vm.listenTimeout())
+}
 
-	// Тестируем преобразование текста в речь
-	// Поскольку это требует реальный аудиовыход, мы просто проверим,
-	// что функция не вызывает панику
-	assert.NotPanics(t, func() {
-		vm.TextToSpeech("Это тестовое сообщение")
+func TestSetState(t *testing.T) {
+	vm := NewVoiceManager(testConfig())
+	var states []string
+	vm.SetStateCallback(func(state string) {
+		states = append(states, state)
 	})
 
-	// Останавливаем VoiceManager после теста
-	vm.Stop()
+	// О повторном состоянии не сообщается
+	vm.setState(StateCommand)
+	vm.setState(StateCommand)
+	vm.setState(StateIdle)
+	assert.Equal(t, []string{StateCommand, StateIdle}, states)
 }
 
-func TestListenForCommand(t *testing.T) {
-	// Этот тест требует реальный аудиовход, поэтому мы просто проверим,
-	// что функция не вызывает панику и возвращает ожидаемый тип
-
-	// Создаем конфигурацию для тестирования
-	config := VoiceConfig{
-		Enabled:          true,
-		WakeWord:         "тест",
-		Language:         "ru-RU",
-		VoiceRecognition: "local", // Используем локальный провайдер для теста
-		TTSProvider:      "local",
-		VoiceThreshold:   0.5,
-		SilenceThreshold: 0.1,
-	}
+func TestIsFollowUpEnd(t *testing.T) {
+	assert.True(t, isFollowUpEnd("спасибо"))
+	assert.True(t, isFollowUpEnd("Всё, хватит, спасибо!"))
+	assert.False(t, isFollowUpEnd("спасибо, а какая завтра погода"))
+	assert.False(t, isFollowUpEnd(""))
+}
 
-	// Создаем новый экземпляр VoiceManager
-	vm, err := NewVoiceManager(config)
+func TestWakeAcknowledgement(t *testing.T) {
+	config := testConfig()
+	config.WakeWordTemplates = filepath.Join("..", "wakeword", "testdata", "templates")
+	vm := NewVoiceManager(config)
+	detector, err := vm.newDetector()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	vm.detector = detector
+	vm.endpointer, err = vad.NewEndpointer(vm.vadConfig())
 	assert.NoError(t, err)
+	synthesizer := &slowSynthesizer{started: make(chan string, 1), release: make(chan struct{})}
+	vm.synthesizer = synthesizer
 
-	// Устанавливаем короткий таймаут для теста
-	vm.commandTimeout = 100 * time.Millisecond
+	done := make(chan struct{})
+	defer close(done)
+	go vm.processAudio(done)
 
-	// Запускаем слушатель команд в отдельной горутине
+	words, err := wakeword.LoadTemplates(filepath.Join("..", "wakeword", "testdata", "positive"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	capture(t, vm, words[0])
+	select {
+	case text := <-synthesizer.started:
+		assert.Equal(t, "Слушаю", text)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ключевое слово не найдено")
+	}
+
+	// Пока отклик синтезируется, запись продолжает обрабатываться и
+	// начало команды не теряется
+	capture(t, vm, make([]byte, 5*cap(vm.captureChan)*frameBytes))
+	close(synthesizer.release)
+
+	vm.mutex.Lock()
+	assert.Equal(t, StateCommand, vm.state)
+	vm.mutex.Unlock()
+}
+
+func TestFollowUpConcurrency(t *testing.T) {
+	config := testConfig()
+	config.VoiceRecognition = "local"
+	config.WakeWordEngine = "stt"
+	vm := NewVoiceManager(config)
+	vm.recognizer = textRecognizer{}
+	var err error
+	vm.endpointer, err = vad.NewEndpointer(vm.vadConfig())
+	assert.NoError(t, err)
+	synthesizer := &slowSynthesizer{started: make(chan string, 10), release: make(chan struct{})}
+	close(synthesizer.release)
+	vm.synthesizer = synthesizer
+	commands := make(chan string, 1)
+	vm.SetCommandCallback(func(text string) { commands <- text })
+	state := func() string {
+		vm.mutex.Lock()
+		defer vm.mutex.Unlock()
+		return vm.state
+	}
+	command := func() string {
+		select {
+		case text := <-commands:
+			return text
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	// Фразы распознаются, пока запись продолжает обрабатываться
+	done := make(chan struct{})
+	defer close(done)
+	go vm.processAudio(done)
 	go func() {
-		// Останавливаем слушатель через короткое время
-		time.Sleep(200 * time.Millisecond)
-		vm.Stop()
+		silence := make([]byte, frameBytes)
+		for {
+			select {
+			case <-done:
+				return
+			case vm.captureChan <- silence:
+			}
+		}
 	}()
 
-	// Проверяем, что функция не вызывает панику
-	assert.NotPanics(t, func() {
-		vm.listenForCommand()
-	})
-}
\ No newline at end of file
+	// Ключевое слово, команда, продолжение без ключевого слова и конец разговора
+	vm.processUtterance([]byte("Тест"))
+	assert.Equal(t, StateCommand, state())
+	vm.processUtterance([]byte("Какая погода в Казани"))
+	assert.Equal(t, "Какая погода в Казани", command())
+	assert.Eventually(t, func() bool { return state() == StateFollowUp }, time.Second, 10*time.Millisecond)
+	vm.processUtterance([]byte("А завтра"))
+	assert.Equal(t, "А завтра", command())
+	assert.Eventually(t, func() bool { return state() == StateFollowUp }, time.Second, 10*time.Millisecond)
+	vm.processUtterance([]byte("Спасибо"))
+	assert.Equal(t, StateIdle, state())
+	assert.Empty(t, commands)
+}
@@ -0,0 +1,279 @@
+package wakeword
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+
+	"kot.ai/internal/stt"
+)
+
+const (
+	minTemplateFrames = 20   // образец короче 0,2 секунды не отличить от шума
+	checkEvery        = 5    // сравнение с образцами каждые 50 мс
+	speechEnergy      = 0.01 // громкость кадра, ниже которой считаем тишиной
+	trimEnergy        = 0.1  // доля пиковой громкости для обрезки тишины по краям образца
+	windowStretch     = 1.5  // во сколько раз сказанное слово может быть длиннее образца
+
+	// DefaultSensitivity — чувствительность по умолчанию
+	DefaultSensitivity = 0.5
+	// defaultSpread — типичное расстояние между образцами одного голоса.
+	// Используется, когда образец один и сравнить его не с чем.
+	defaultSpread = 10.0
+)
+
+// Detector ищет ключевое слово в потоке записи, сравнивая его с образцами —
+// записями ключевого слова — по MFCC с динамической трансформацией времени.
+// Сеть и распознаватель речи для этого не нужны.
+type Detector struct {
+	templates [][]features
+	threshold float64
+
+	extractor *extractor
+	frames    []frame // последние кадры, не длиннее окна сравнения
+	maxFrames int
+	pending   int // кадров с прошлого сравнения
+}
+
+// NewDetector создает детектор по образцам — PCM-записям ключевого слова
+// (16 кГц, моно, 16 бит). Sensitivity от 0 до 1: чем больше, тем чаще
+// срабатывает детектор, в том числе ошибочно; 0 — значение по умолчанию.
+func NewDetector(templates [][]byte, sensitivity float64) (*Detector, error) {
+	if len(templates) == 0 {
+		return nil, tracerr.New("Нет образцов ключевого слова")
+	}
+	if sensitivity < 0 || sensitivity > 1 {
+		return nil, tracerr.New(fmt.Sprintf("Чувствительность должна быть от 0 до 1: %g", sensitivity))
+	}
+	if sensitivity == 0 {
+		sensitivity = DefaultSensitivity
+	}
+
+	d := &Detector{extractor: newExtractor()}
+	for i, pcm := range templates {
+		extractor := newExtractor()
+		template := trimSilence(extractor.push(toSamples(pcm)))
+		if len(template) < minTemplateFrames {
+			return nil, tracerr.New(fmt.Sprintf("Образец ключевого слова %d слишком короткий или тихий", i+1))
+		}
+		d.templates = append(d.templates, template)
+		d.maxFrames = max(d.maxFrames, int(float64(len(template))*windowStretch))
+	}
+
+	// Порог зависит от того, насколько различаются сами образцы: у
+	// разных микрофонов и голосов расстояния разные
+	spread := d.templateSpread()
+	if spread == 0 {
+		spread = defaultSpread
+	}
+	d.threshold = spread * (1 + 0.8*sensitivity)
+	return d, nil
+}
+
+// LoadTemplates читает образцы ключевого слова — WAV-файлы из каталога dir
+func LoadTemplates(dir string) ([][]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wav"))
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	if len(paths) == 0 {
+		return nil, tracerr.New(fmt.Sprintf("В каталоге %s нет образцов ключевого слова (*.wav)", dir))
+	}
+
+	var templates [][]byte
+	for _, path := range paths {
+		pcm, err := readWAV(path)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, pcm)
+	}
+	return templates, nil
+}
+
+// readWAV читает запись 16 кГц из WAV-файла
+func readWAV(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	defer file.Close()
+
+	pcm, rate, err := stt.ReadWAV(file)
+	if err != nil {
+		return nil, tracerr.New(fmt.Sprintf("%s: %v", filepath.Base(path), err))
+	}
+	if rate != sampleRate {
+		return nil, tracerr.New(fmt.Sprintf("%s: нужна частота %d Гц, а не %d", filepath.Base(path), sampleRate, rate))
+	}
+	return pcm, nil
+}
+
+// Process добавляет часть записи и сообщает, было ли в ней сказано
+// ключевое слово. После срабатывания накопленная запись забывается, чтобы
+// одно слово не сработало дважды.
+func (d *Detector) Process(pcm []byte) bool {
+	detected := false
+	for _, frame := range d.extractor.push(toSamples(pcm)) {
+		d.frames = append(d.frames, frame)
+		if len(d.frames) > d.maxFrames {
+			d.frames = d.frames[len(d.frames)-d.maxFrames:]
+		}
+
+		d.pending++
+		if d.pending < checkEvery {
+			continue
+		}
+		d.pending = 0
+		if d.Distance() <= d.threshold {
+			detected = true
+			d.frames = nil
+		}
+	}
+	return detected
+}
+
+// Distance возвращает расстояние от последних кадров до ближайшего образца.
+// Если в окне нет речи, расстояние бесконечно.
+func (d *Detector) Distance() float64 {
+	speech := false
+	for _, frame := range d.frames {
+		if frame.energy >= speechEnergy {
+			speech = true
+			break
+		}
+	}
+	if !speech {
+		return math.Inf(1)
+	}
+
+	window := make([]features, len(d.frames))
+	for i, frame := range d.frames {
+		window[i] = frame.mfcc
+	}
+	best := math.Inf(1)
+	for _, template := range d.templates {
+		if len(window) < len(template)/2 {
+			continue
+		}
+		best = min(best, subsequenceDTW(template, window))
+	}
+	return best
+}
+
+// Reset забывает накопленную запись
+func (d *Detector) Reset() {
+	d.extractor.reset()
+	d.frames = nil
+	d.pending = 0
+}
+
+// templateSpread — среднее расстояние между образцами. Чужие слова должны
+// быть заметно дальше от образцов, чем образцы друг от друга.
+func (d *Detector) templateSpread() float64 {
+	var sum float64
+	var count int
+	for i := range d.templates {
+		for j := range d.templates {
+			if i != j {
+				sum += subsequenceDTW(d.templates[i], d.templates[j])
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// trimSilence убирает тихие кадры в начале и конце образца
+func trimSilence(frames []frame) []features {
+	var peak float64
+	for _, frame := range frames {
+		peak = max(peak, frame.energy)
+	}
+
+	// Запись без речи обрезается целиком
+	threshold := max(peak*trimEnergy, speechEnergy)
+	start, end := 0, len(frames)
+	for start < end && frames[start].energy < threshold {
+		start++
+	}
+	for end > start && frames[end-1].energy < threshold {
+		end--
+	}
+
+	result := make([]features, 0, end-start)
+	for _, frame := range frames[start:end] {
+		result = append(result, frame.mfcc)
+	}
+	return result
+}
+
+// subsequenceDTW находит в window участок, ближайший к template, и
+// возвращает среднее расстояние между кадрами вдоль пути выравнивания.
+// Начало и конец участка в window свободны.
+func subsequenceDTW(template, window []features) float64 {
+	cost := make([]float64, len(window))
+	length := make([]int, len(window))
+	previousCost := make([]float64, len(window))
+	previousLength := make([]int, len(window))
+
+	for i, t := range template {
+		for j, w := range window {
+			distance := frameDistance(t, w)
+			if i == 0 {
+				// Участок может начинаться в любом кадре окна
+				cost[j], length[j] = distance, 1
+				continue
+			}
+
+			bestCost, bestLength := previousCost[j], previousLength[j]
+			if j > 0 {
+				if average(previousCost[j-1], previousLength[j-1]) < average(bestCost, bestLength) {
+					bestCost, bestLength = previousCost[j-1], previousLength[j-1]
+				}
+				if average(cost[j-1], length[j-1]) < average(bestCost, bestLength) {
+					bestCost, bestLength = cost[j-1], length[j-1]
+				}
+			}
+			cost[j], length[j] = bestCost+distance, bestLength+1
+		}
+		cost, previousCost = previousCost, cost
+		length, previousLength = previousLength, length
+	}
+
+	best := math.Inf(1)
+	for j := range window {
+		best = min(best, average(previousCost[j], previousLength[j]))
+	}
+	return best
+}
+
+func average(cost float64, length int) float64 {
+	return cost / float64(length)
+}
+
+// frameDistance — евклидово расстояние между признаками кадров
+func frameDistance(a, b features) float64 {
+	var sum float64
+	for i := range a {
+		diff := a[i] - b[i]
+		sum += diff * diff
+	}
+	return math.Sqrt(sum)
+}
+
+// String описывает детектор для журнала
+func (d *Detector) String() string {
+	lengths := make([]string, len(d.templates))
+	for i, template := range d.templates {
+		lengths[i] = fmt.Sprintf("%d мс", len(template)*frameShift*1000/sampleRate)
+	}
+	return fmt.Sprintf("образцов: %d (%s), порог: %.2f", len(d.templates), strings.Join(lengths, ", "), d.threshold)
+}
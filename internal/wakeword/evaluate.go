@@ -0,0 +1,111 @@
+package wakeword
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// chunkSize — размер части записи при воспроизведении, как у захвата звука
+const chunkSize = 1600 // 50 мс
+
+// Sample — запись для проверки детектора
+type Sample struct {
+	Name     string
+	PCM      []byte
+	Positive bool // в записи есть ключевое слово
+}
+
+// Report — результат проверки детектора на записях
+type Report struct {
+	Positives   int           // записей с ключевым словом
+	Hits        int           // из них найдено
+	Negatives   int           // записей без ключевого слова
+	FalseAlarms int           // срабатываний на записях без ключевого слова
+	Duration    time.Duration // длительность записей без ключевого слова
+	Missed      []string      // записи, где слово не найдено
+	Alarms      []string      // записи с ложными срабатываниями
+}
+
+// HitRate — доля найденных ключевых слов
+func (r Report) HitRate() float64 {
+	if r.Positives == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Positives)
+}
+
+// FalseAlarmRate — число ложных срабатываний в час записи без ключевого слова
+func (r Report) FalseAlarmRate() float64 {
+	if r.Duration == 0 {
+		return 0
+	}
+	return float64(r.FalseAlarms) / r.Duration.Hours()
+}
+
+// String описывает результат для журнала
+func (r Report) String() string {
+	return fmt.Sprintf("найдено %d из %d (%.0f%%), ложных срабатываний: %d на %d записях (%.1f в час)",
+		r.Hits, r.Positives, 100*r.HitRate(), r.FalseAlarms, r.Negatives, r.FalseAlarmRate())
+}
+
+// Evaluate воспроизводит записи через детектор частями, как при захвате
+// звука, и считает найденные слова и ложные срабатывания
+func Evaluate(detector *Detector, samples []Sample) Report {
+	var report Report
+	for _, sample := range samples {
+		detector.Reset()
+		detections := 0
+		for start := 0; start < len(sample.PCM); start += chunkSize {
+			if detector.Process(sample.PCM[start:min(start+chunkSize, len(sample.PCM))]) {
+				detections++
+			}
+		}
+
+		if sample.Positive {
+			report.Positives++
+			if detections > 0 {
+				report.Hits++
+			} else {
+				report.Missed = append(report.Missed, sample.Name)
+			}
+			continue
+		}
+		report.Negatives++
+		report.Duration += time.Duration(len(sample.PCM)/2) * time.Second / sampleRate
+		if detections > 0 {
+			report.FalseAlarms += detections
+			report.Alarms = append(report.Alarms, sample.Name)
+		}
+	}
+	return report
+}
+
+// LoadSamples читает записи для проверки: WAV-файлы с ключевым словом из
+// подкаталога positive и без него из подкаталога negative
+func LoadSamples(dir string) ([]Sample, error) {
+	var samples []Sample
+	for _, kind := range []string{"positive", "negative"} {
+		paths, err := filepath.Glob(filepath.Join(dir, kind, "*.wav"))
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		for _, path := range paths {
+			pcm, err := readWAV(path)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, Sample{
+				Name:     filepath.Join(kind, filepath.Base(path)),
+				PCM:      pcm,
+				Positive: kind == "positive",
+			})
+		}
+	}
+	if len(samples) == 0 {
+		return nil, tracerr.New(fmt.Sprintf("В каталоге %s нет записей positive/*.wav и negative/*.wav", dir))
+	}
+	return samples, nil
+}
@@ -0,0 +1,173 @@
+package wakeword
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Параметры признаков для записи 16 кГц
+const (
+	sampleRate  = 16000
+	frameLength = 400 // 25 мс
+	frameShift  = 160 // 10 мс
+	fftSize     = 512
+	melFilters  = 26
+	cepstra     = 12 // коэффициенты 1..12: нулевой зависит только от громкости
+	preEmphasis = 0.97
+)
+
+// features — мел-кепстральные коэффициенты одного кадра
+type features [cepstra]float64
+
+// frame — признаки кадра и его громкость (среднеквадратичное значение)
+type frame struct {
+	mfcc   features
+	energy float64
+}
+
+// extractor нарезает поток отсчетов на перекрывающиеся кадры и считает
+// для них MFCC
+type extractor struct {
+	window  []float64
+	filters [][]float64 // melFilters × (fftSize/2+1)
+	dct     [][]float64 // cepstra × melFilters
+	samples []float64   // отсчеты, которых пока не хватает на кадр
+}
+
+func newExtractor() *extractor {
+	e := &extractor{
+		window:  make([]float64, frameLength),
+		filters: melFilterbank(),
+		dct:     make([][]float64, cepstra),
+	}
+	for i := range e.window {
+		e.window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(frameLength-1))
+	}
+	for i := range e.dct {
+		e.dct[i] = make([]float64, melFilters)
+		for j := range e.dct[i] {
+			e.dct[i][j] = math.Cos(math.Pi * float64(i+1) * (float64(j) + 0.5) / melFilters)
+		}
+	}
+	return e
+}
+
+// push добавляет отсчеты и возвращает кадры, которые удалось собрать
+func (e *extractor) push(samples []float64) []frame {
+	e.samples = append(e.samples, samples...)
+
+	var frames []frame
+	for len(e.samples) >= frameLength {
+		frames = append(frames, e.compute(e.samples[:frameLength]))
+		e.samples = e.samples[frameShift:]
+	}
+	// Не даем срезу бесконечно расти за счет отброшенного начала
+	e.samples = append([]float64(nil), e.samples...)
+	return frames
+}
+
+// reset забывает незаконченный кадр
+func (e *extractor) reset() {
+	e.samples = nil
+}
+
+// compute считает признаки одного кадра
+func (e *extractor) compute(samples []float64) frame {
+	var result frame
+	spectrum := make([]complex128, fftSize)
+	var energy float64
+	for i, sample := range samples {
+		energy += sample * sample
+		previous := sample
+		if i > 0 {
+			previous = samples[i-1]
+		}
+		spectrum[i] = complex((sample-preEmphasis*previous)*e.window[i], 0)
+	}
+	result.energy = math.Sqrt(energy / float64(len(samples)))
+
+	fft(spectrum)
+	power := make([]float64, fftSize/2+1)
+	for i := range power {
+		magnitude := cmplx.Abs(spectrum[i])
+		power[i] = magnitude * magnitude / fftSize
+	}
+
+	logMel := make([]float64, melFilters)
+	for i, filter := range e.filters {
+		var sum float64
+		for j, weight := range filter {
+			sum += weight * power[j]
+		}
+		logMel[i] = math.Log(sum + 1e-10)
+	}
+
+	for i, row := range e.dct {
+		for j, weight := range row {
+			result.mfcc[i] += weight * logMel[j]
+		}
+	}
+	return result
+}
+
+// melFilterbank строит треугольные фильтры, равномерные по шкале мел
+func melFilterbank() [][]float64 {
+	toMel := func(hz float64) float64 { return 2595 * math.Log10(1+hz/700) }
+	toHz := func(mel float64) float64 { return 700 * (math.Pow(10, mel/2595) - 1) }
+
+	low, high := toMel(20), toMel(sampleRate/2)
+	bins := make([]int, melFilters+2)
+	for i := range bins {
+		hz := toHz(low + (high-low)*float64(i)/float64(melFilters+1))
+		bins[i] = int(math.Floor((fftSize + 1) * hz / sampleRate))
+	}
+
+	filters := make([][]float64, melFilters)
+	for i := range filters {
+		filters[i] = make([]float64, fftSize/2+1)
+		left, center, right := bins[i], bins[i+1], bins[i+2]
+		for j := left; j < center; j++ {
+			filters[i][j] = float64(j-left) / float64(center-left)
+		}
+		for j := center; j < right && j < len(filters[i]); j++ {
+			filters[i][j] = float64(right-j) / float64(right-center)
+		}
+	}
+	return filters
+}
+
+// fft — быстрое преобразование Фурье на месте, длина — степень двойки
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// toSamples переводит PCM-запись (16 бит, little-endian) в отсчеты -1..1
+func toSamples(pcm []byte) []float64 {
+	samples := make([]float64, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float64(int16(uint16(pcm[2*i])|uint16(pcm[2*i+1])<<8)) / 32768
+	}
+	return samples
+}
@@ -0,0 +1,135 @@
+package wakeword
+
+import (
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Записи в testdata синтезированы формантным синтезатором: образцы и
+// positive — слово «кот» разными голосами, с разной скоростью и
+// громкостью, negative — похожие слова («кит», «кто тук»), другие слова и шум
+
+// newTestDetector создает детектор по образцам из testdata
+func newTestDetector(t *testing.T, sensitivity float64) *Detector {
+	templates, err := LoadTemplates(filepath.Join("testdata", "templates"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	detector, err := NewDetector(templates, sensitivity)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return detector
+}
+
+func TestFFT(t *testing.T) {
+	// Синусоида попадает в один отсчет спектра и симметричный ему
+	x := make([]complex128, 16)
+	for i := range x {
+		x[i] = complex(math.Cos(2*math.Pi*2*float64(i)/16), 0)
+	}
+	fft(x)
+	for i, value := range x {
+		if i == 2 || i == 14 {
+			assert.InDelta(t, 8, cmplx.Abs(value), 1e-9)
+		} else {
+			assert.InDelta(t, 0, cmplx.Abs(value), 1e-9)
+		}
+	}
+}
+
+func TestNewDetector(t *testing.T) {
+	_, err := NewDetector(nil, 0.5)
+	assert.Error(t, err)
+
+	templates, err := LoadTemplates(filepath.Join("testdata", "templates"))
+	assert.NoError(t, err)
+	assert.Len(t, templates, 3)
+
+	_, err = NewDetector(templates, 1.5)
+	assert.Error(t, err)
+
+	// Тишина не годится в образцы
+	_, err = NewDetector([][]byte{make([]byte, 2*sampleRate)}, 0.5)
+	assert.Error(t, err)
+
+	// Чем выше чувствительность, тем дальше порог
+	strict := newTestDetector(t, 0.1)
+	loose := newTestDetector(t, 1)
+	assert.Less(t, strict.threshold, loose.threshold)
+	assert.Equal(t, newTestDetector(t, DefaultSensitivity).threshold, newTestDetector(t, 0).threshold)
+
+	_, err = LoadTemplates(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestDetector(t *testing.T) {
+	samples, err := LoadSamples("testdata")
+	assert.NoError(t, err)
+
+	report := Evaluate(newTestDetector(t, DefaultSensitivity), samples)
+	t.Log(report)
+	assert.Equal(t, 4, report.Positives)
+	assert.Equal(t, 5, report.Negatives)
+	assert.Equal(t, 1.0, report.HitRate(), "не найдено: %v", report.Missed)
+	assert.Equal(t, 0, report.FalseAlarms, "ложные срабатывания: %v", report.Alarms)
+
+	// Слишком высокая чувствительность путает похожие слова
+	report = Evaluate(newTestDetector(t, 1), samples)
+	assert.Equal(t, 1.0, report.HitRate())
+	assert.Greater(t, report.FalseAlarmRate(), 0.0)
+}
+
+func TestDetectorStream(t *testing.T) {
+	detector := newTestDetector(t, DefaultSensitivity)
+	pcm, err := readWAV(filepath.Join("testdata", "positive", "mama_kot.wav"))
+	assert.NoError(t, err)
+
+	// Размер частей записи не важен, а одно слово срабатывает один раз
+	detections := 0
+	for start := 0; start < len(pcm); start += 1234 {
+		if detector.Process(pcm[start:min(start+1234, len(pcm))]) {
+			detections++
+		}
+	}
+	assert.Equal(t, 1, detections)
+
+	// Тишина не сравнивается с образцами
+	detector.Reset()
+	assert.False(t, detector.Process(make([]byte, 2*sampleRate)))
+	assert.True(t, math.IsInf(detector.Distance(), 1))
+}
+
+// TestRecordings проверяет детектор на своих записях. Каталог из переменной
+// KOT_WAKEWORD_DATA должен содержать templates/, positive/ и negative/ с
+// WAV-файлами 16 кГц, моно:
+//
+//	KOT_WAKEWORD_DATA=~/wakeword go test -run TestRecordings -v ./internal/wakeword
+func TestRecordings(t *testing.T) {
+	dir := os.Getenv("KOT_WAKEWORD_DATA")
+	if dir == "" {
+		t.Skip("KOT_WAKEWORD_DATA не задан")
+	}
+
+	templates, err := LoadTemplates(filepath.Join(dir, "templates"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	samples, err := LoadSamples(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, sensitivity := range []float64{0.25, 0.5, 0.75, 1} {
+		detector, err := NewDetector(templates, sensitivity)
+		if !assert.NoError(t, err) {
+			return
+		}
+		report := Evaluate(detector, samples)
+		t.Logf("чувствительность %.2f: %s; пропущены: %v; ложные: %v", sensitivity, report, report.Missed, report.Alarms)
+	}
+}
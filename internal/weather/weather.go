@@ -0,0 +1,146 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Поддерживаемые источники погоды
+const (
+	ProviderWttr = "wttr" // wttr.in или совместимый сервер
+	ProviderNone = "none" // погода отключена
+)
+
+const (
+	defaultWttrURL = "https://wttr.in"
+	requestTimeout = 10 * time.Second
+)
+
+// Report содержит текущую погоду
+type Report struct {
+	Location    string
+	TempC       float64
+	FeelsLikeC  float64
+	Humidity    int
+	WindKmph    float64
+	Description string
+}
+
+// Provider определяет источник сведений о погоде
+type Provider interface {
+	// Current возвращает текущую погоду. Пустое место означает место
+	// по умолчанию из настроек или определение по IP-адресу.
+	Current(ctx context.Context, location string) (Report, error)
+}
+
+// NewProvider создает источник погоды по имени. Пустое имя означает wttr.
+// Для ProviderNone возвращается nil без ошибки.
+func NewProvider(name, baseURL, defaultLocation string) (Provider, error) {
+	switch name {
+	case "", ProviderWttr:
+		if baseURL == "" {
+			baseURL = defaultWttrURL
+		}
+		return &WttrProvider{
+			baseURL:  strings.TrimSuffix(baseURL, "/"),
+			location: defaultLocation,
+			client:   &http.Client{Timeout: requestTimeout},
+		}, nil
+	case ProviderNone:
+		return nil, nil
+	default:
+		return nil, tracerr.New(fmt.Sprintf("Неизвестный источник погоды: %s", name))
+	}
+}
+
+// WttrProvider получает погоду в формате JSON wttr.in (format=j1)
+type WttrProvider struct {
+	baseURL  string
+	location string
+	client   *http.Client
+}
+
+// wttrResponse представляет нужную часть ответа wttr.in
+type wttrResponse struct {
+	CurrentCondition []struct {
+		TempC       string `json:"temp_C"`
+		FeelsLikeC  string `json:"FeelsLikeC"`
+		Humidity    string `json:"humidity"`
+		WindKmph    string `json:"windspeedKmph"`
+		WeatherDesc []struct {
+			Value string `json:"value"`
+		} `json:"weatherDesc"`
+		LangRu []struct {
+			Value string `json:"value"`
+		} `json:"lang_ru"`
+	} `json:"current_condition"`
+	NearestArea []struct {
+		AreaName []struct {
+			Value string `json:"value"`
+		} `json:"areaName"`
+	} `json:"nearest_area"`
+}
+
+// Current запрашивает текущую погоду
+func (p *WttrProvider) Current(ctx context.Context, location string) (Report, error) {
+	if location == "" {
+		location = p.location
+	}
+
+	requestURL := fmt.Sprintf("%s/%s?format=j1&lang=ru", p.baseURL, url.PathEscape(location))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return Report{}, tracerr.Wrap(err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Report{}, tracerr.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Report{}, tracerr.New(fmt.Sprintf("Ошибка сервиса погоды: %s", resp.Status))
+	}
+
+	var data wttrResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return Report{}, tracerr.Wrap(err)
+	}
+	if len(data.CurrentCondition) == 0 {
+		return Report{}, tracerr.New("Сервис погоды не вернул текущую погоду")
+	}
+
+	current := data.CurrentCondition[0]
+	report := Report{
+		Location:   location,
+		TempC:      parseFloat(current.TempC),
+		FeelsLikeC: parseFloat(current.FeelsLikeC),
+		Humidity:   int(parseFloat(current.Humidity)),
+		WindKmph:   parseFloat(current.WindKmph),
+	}
+	if len(current.LangRu) > 0 {
+		report.Description = current.LangRu[0].Value
+	} else if len(current.WeatherDesc) > 0 {
+		report.Description = current.WeatherDesc[0].Value
+	}
+	if len(data.NearestArea) > 0 && len(data.NearestArea[0].AreaName) > 0 {
+		report.Location = data.NearestArea[0].AreaName[0].Value
+	}
+
+	return report, nil
+}
+
+// parseFloat разбирает число из строки ответа, возвращая 0 при ошибке
+func parseFloat(s string) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return value
+}
@@ -0,0 +1,76 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWttrProvider(t *testing.T) {
+	// Локальная заглушка, совместимая с wttr.in
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "j1", r.URL.Query().Get("format"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"current_condition": [{
+				"temp_C": "12", "FeelsLikeC": "10", "humidity": "81", "windspeedKmph": "14",
+				"weatherDesc": [{"value": "Partly cloudy"}],
+				"lang_ru": [{"value": "Переменная облачность"}]
+			}],
+			"nearest_area": [{"areaName": [{"value": "Moscow"}]}]
+		}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderWttr, server.URL+"/", "Москва")
+	assert.NoError(t, err)
+
+	report, err := provider.Current(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, Report{
+		Location:    "Moscow",
+		TempC:       12,
+		FeelsLikeC:  10,
+		Humidity:    81,
+		WindKmph:    14,
+		Description: "Переменная облачность",
+	}, report)
+
+	// Место из запроса заменяет место по умолчанию
+	_, err = provider.Current(context.Background(), "Санкт-Петербург")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/Москва", "/Санкт-Петербург"}, paths)
+}
+
+func TestWttrProviderErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.Write([]byte(`{"current_condition": []}`))
+			return
+		}
+		http.Error(w, "unknown location", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	provider, _ := NewProvider("", server.URL, "")
+
+	_, err := provider.Current(context.Background(), "nowhere")
+	assert.Error(t, err)
+
+	_, err = provider.Current(context.Background(), "empty")
+	assert.Error(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	provider, err := NewProvider(ProviderNone, "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, provider)
+
+	_, err = NewProvider("unknown", "", "")
+	assert.Error(t, err)
+}
@@ -1,26 +1,51 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
-	"flag"
 
 	"kot.ai/internal/assistant"
 	"kot.ai/internal/config"
 	"kot.ai/internal/mobile"
+	"kot.ai/internal/system"
 	"kot.ai/internal/ui"
 	"kot.ai/internal/voice"
-	"kot.ai/internal/system"
 )
 
 func main() {
 	// Parse command line arguments
 	checkStatus := flag.Bool("status", false, "Check application status")
+	configPath := flag.String("config", "", "Файл настроек (по умолчанию $KOT_CONFIG или ~/.kot.ai/config.json)")
 	flag.Parse()
 
+	// Служебные команды читают настройки через config.Load, который
+	// берет путь из KOT_CONFIG
+	if *configPath != "" {
+		os.Setenv(config.PathEnv, *configPath)
+	}
+
+	// Служебные команды без запуска ассистента: kot history, kot secrets, kot keys
+	if flag.NArg() > 0 {
+		args := flag.Args()
+		switch args[0] {
+		case "history":
+			os.Exit(runHistory(args[1:], os.Stdout, os.Stderr))
+		case "secrets":
+			os.Exit(runSecrets(args[1:], os.Stdin, os.Stdout, os.Stderr))
+		case "keys":
+			os.Exit(runKeys(args[1:], os.Stdout, os.Stderr))
+		default:
+			fmt.Fprintf(os.Stderr, "Неизвестная команда: %s\n", args[0])
+			os.Exit(2)
+		}
+	}
+
 	// Initialize system manager for both normal operation and status check
 	sys := system.NewSystemManager()
 
@@ -39,17 +64,51 @@ func main() {
 	log.SetOutput(logFile)
 	log.Println("Запуск KOT.AI...")
 
-	// Загрузка конфигурации
-	cfg, err := config.Load()
+	// Загрузка конфигурации: файл, переменные KOT_* и секреты
+	manager, err := config.NewManager(config.DefaultPath(), os.Environ())
 	if err != nil {
 		log.Fatalf("Ошибка при загрузке конфигурации: %v", err)
 	}
+	defer manager.Close()
+	if overrides := manager.Overrides(); len(overrides) > 0 {
+		log.Printf("Настройки из переменных окружения: %v", overrides)
+	}
+
+	// Ссылки "secret:имя" заменяются значениями из хранилища секретов
+	resolver := &secretResolver{}
+	if err := manager.SetResolver(resolver.Resolve); err != nil {
+		log.Fatalf("Ошибка при чтении секретов: %v", err)
+	}
+	cfg := manager.Config()
 
 	// Инициализация компонентов
 	voiceManager := voice.NewVoiceManager(cfg.VoiceConfig)
 	mobileManager := mobile.NewMobileManager(cfg.MobileConfig)
 	assistant := assistant.NewAssistant(cfg.AssistantConfig, sys, voiceManager)
 	uiManager := ui.NewUIManager(cfg.UIConfig, assistant, mobileManager)
+	uiManager.SetConfigManager(manager)
+	if resolver.vault != nil && cfg.SecurityConfig.EncryptHistory {
+		assistant.SetHistoryCipher(resolver.vault.Keys)
+	}
+
+	// Изменения файла настроек применяются без перезапуска: каждый
+	// изменившийся раздел перенастраивает свою подсистему
+	manager.OnChange(func(old, new *config.Config) error {
+		var errs []error
+		if !reflect.DeepEqual(old.VoiceConfig, new.VoiceConfig) {
+			errs = append(errs, voiceManager.Reconfigure(new.VoiceConfig))
+		}
+		if !reflect.DeepEqual(old.MobileConfig, new.MobileConfig) {
+			errs = append(errs, mobileManager.Reconfigure(new.MobileConfig))
+		}
+		if !reflect.DeepEqual(old.AssistantConfig, new.AssistantConfig) {
+			errs = append(errs, assistant.Reconfigure(new.AssistantConfig))
+		}
+		if !reflect.DeepEqual(old.UIConfig, new.UIConfig) {
+			uiManager.Reconfigure(new.UIConfig)
+		}
+		return errors.Join(errs...)
+	})
 
 	// Запуск компонентов
 	if err := voiceManager.Start(); err != nil {
@@ -68,6 +127,8 @@ func main() {
 		log.Fatalf("Ошибка при запуске ассистента: %v", err)
 	}
 
+	manager.Watch(config.WatchInterval)
+
 	fmt.Println("KOT.AI запущен и готов к работе!")
 	fmt.Println("Нажмите Ctrl+C для завершения работы.")
 
@@ -78,9 +139,10 @@ func main() {
 
 	// Корректное завершение работы
 	fmt.Println("\nЗавершение работы KOT.AI...")
+	manager.Close()
 	assistant.Stop()
 	uiManager.Stop()
 	voiceManager.Stop()
 	mobileManager.Stop()
 	log.Println("KOT.AI успешно завершил работу.")
-}
\ No newline at end of file
+}
@@ -1,117 +1,86 @@
 package main
 
 import (
-	"os"
+	"bytes"
+	"path/filepath"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"kot.ai/internal/config"
+	"kot.ai/internal/secrets"
 )
 
-// TestMainInit проверяет инициализацию основных компонентов приложения
-func TestMainInit(t *testing.T) {
-	// Сохраняем оригинальные аргументы командной строки
-	origArgs := os.Args
-	defer func() { os.Args = origArgs }()
-
-	// Устанавливаем тестовые аргументы
-	os.Args = []string{"kot.ai", "--test"}
-
-	// Запускаем инициализацию в отдельной горутине с таймаутом
-	done := make(chan bool)
-	go func() {
-		// Перехватываем панику, которая может возникнуть при тестировании main
-		defer func() {
-			if r := recover(); r != nil {
-				// Игнорируем панику, так как мы не можем полностью запустить main в тесте
-			}
-			done <- true
-		}()
-
-		// Вызываем функцию инициализации вместо main
-		// Мы не можем вызвать main() напрямую, так как она блокирует выполнение
-		// Вместо этого мы проверяем только инициализацию компонентов
-		initComponents()
-	}()
-
-	// Ждем завершения инициализации или таймаута
-	select {
-		case <-done:
-			// Инициализация завершена
-		case <-time.After(5 * time.Second):
-			t.Fatal("Таймаут при инициализации компонентов")
+// testConfig сохраняет настройки с ключами, защищенными паролем, во
+// временный каталог и указывает на них KOT_CONFIG
+func testConfig(t *testing.T) *config.Config {
+	dir := t.TempDir()
+	t.Setenv(secrets.PassphraseEnv, "пароль для теста")
+
+	cfg := config.DefaultConfig()
+	cfg.AssistantConfig.HistoryFilePath = filepath.Join(dir, "history.db")
+	cfg.SecurityConfig.KeySource = secrets.SourcePassphrase
+	cfg.SecurityConfig.KeysPath = filepath.Join(dir, "keys.json")
+	cfg.SecurityConfig.SecretsPath = filepath.Join(dir, "secrets.json")
+
+	path := filepath.Join(dir, "config.json")
+	assert.NoError(t, cfg.SaveFile(path))
+	t.Setenv(config.PathEnv, path)
+	return cfg
+}
+
+// TestSecretResolver проверяет, что хранилище секретов открывается только
+// когда оно нужно, и подставляет секреты в настройки
+func TestSecretResolver(t *testing.T) {
+	cfg := testConfig(t)
+
+	// Без ссылок на секреты хранилище не открывается
+	resolver := &secretResolver{}
+	resolved, err := resolver.Resolve(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, resolved)
+	assert.Nil(t, resolver.vault)
+
+	vault, err := openVault(cfg.SecurityConfig)
+	if !assert.NoError(t, err) {
+		return
 	}
+	assert.NoError(t, vault.Secrets.Set("openai", "sk-test"))
+
+	cfg.AssistantConfig.OpenAIAPIKey = "secret:openai"
+	resolved, err = resolver.Resolve(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-test", resolved.AssistantConfig.OpenAIAPIKey)
+	assert.Equal(t, "secret:openai", cfg.AssistantConfig.OpenAIAPIKey)
+	assert.NotNil(t, resolver.vault)
+
+	// Ссылка на несуществующий секрет — ошибка
+	cfg.AssistantConfig.GoogleAPIKey = "secret:google"
+	_, err = resolver.Resolve(cfg)
+	assert.ErrorContains(t, err, "assistant.google_api_key")
+}
 
-	// Проверяем, что логгер инициализирован
-	assert.NotNil(t, logger)
+// TestRunSecrets проверяет команду kot secrets
+func TestRunSecrets(t *testing.T) {
+	testConfig(t)
+	var stdout, stderr bytes.Buffer
 
-	// Проверяем, что каналы сигналов инициализированы
-	assert.NotNil(t, sigChan)
-}
+	assert.Equal(t, 0, runSecrets([]string{"set", "openai"}, strings.NewReader("sk-test\n"), &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "secret:openai")
 
-// TestSetupLogging проверяет настройку логирования
-func TestSetupLogging(t *testing.T) {
-	// Вызываем функцию настройки логирования
-	setupLogging()
+	stdout.Reset()
+	assert.Equal(t, 0, runSecrets([]string{"get", "openai"}, nil, &stdout, &stderr))
+	assert.Equal(t, "sk-test\n", stdout.String())
 
-	// Проверяем, что логгер инициализирован
-	assert.NotNil(t, logger)
-}
+	stdout.Reset()
+	assert.Equal(t, 0, runSecrets([]string{"list"}, nil, &stdout, &stderr))
+	assert.Equal(t, "openai\n", stdout.String())
 
-// TestInitComponents проверяет инициализацию компонентов
-func TestInitComponents(t *testing.T) {
-	// Запускаем инициализацию в отдельной горутине с таймаутом
-	done := make(chan bool)
-	go func() {
-		// Перехватываем панику, которая может возникнуть при тестировании
-		defer func() {
-			if r := recover(); r != nil {
-				// Игнорируем панику, так как мы не можем полностью инициализировать компоненты в тесте
-			}
-			done <- true
-		}()
-
-		// Вызываем функцию инициализации компонентов
-		initComponents()
-	}()
-
-	// Ждем завершения инициализации или таймаута
-	select {
-		case <-done:
-			// Инициализация завершена
-		case <-time.After(5 * time.Second):
-			t.Fatal("Таймаут при инициализации компонентов")
-	}
-}
+	assert.Equal(t, 0, runSecrets([]string{"delete", "openai"}, nil, &stdout, &stderr))
+	assert.Equal(t, 1, runSecrets([]string{"get", "openai"}, nil, &stdout, &stderr))
 
-// TestHandleSignals проверяет обработку сигналов
-func TestHandleSignals(t *testing.T) {
-	// Инициализируем канал сигналов
-	sigChan = make(chan os.Signal, 1)
-
-	// Запускаем обработчик сигналов в отдельной горутине
-	done := make(chan bool)
-	go func() {
-		// Перехватываем панику, которая может возникнуть при тестировании
-		defer func() {
-			if r := recover(); r != nil {
-				// Игнорируем панику
-			}
-			done <- true
-		}()
-
-		// Вызываем функцию обработки сигналов
-		handleSignals()
-	}()
-
-	// Отправляем сигнал в канал
-	sigChan <- os.Interrupt
-
-	// Ждем завершения обработки сигнала или таймаута
-	select {
-		case <-done:
-			// Обработка завершена
-		case <-time.After(5 * time.Second):
-			t.Fatal("Таймаут при обработке сигнала")
-	}
-}
\ No newline at end of file
+	// Пустое значение и неизвестная команда
+	assert.Equal(t, 1, runSecrets([]string{"set", "empty"}, strings.NewReader(""), &stdout, &stderr))
+	assert.Equal(t, 2, runSecrets([]string{"rename"}, nil, &stdout, &stderr))
+}
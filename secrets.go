@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"kot.ai/internal/config"
+	"kot.ai/internal/history"
+	"kot.ai/internal/secrets"
+)
+
+// secretsUsage описывает команду kot secrets
+const secretsUsage = `Использование:
+  kot secrets set ИМЯ      значение читается из стандартного ввода
+  kot secrets get ИМЯ
+  kot secrets list
+  kot secrets delete ИМЯ
+
+Секреты хранятся зашифрованными. В настройках на секрет ссылаются так:
+"openai_api_key": "secret:openai". Если ключи защищены паролем
+(key_source: passphrase), пароль берется из переменной KOT_PASSPHRASE.
+`
+
+// keysUsage описывает команду kot keys
+const keysUsage = `Использование:
+  kot keys list
+  kot keys rotate [--retire]
+
+rotate создает новый ключ шифрования и перешифровывает им секреты и историю.
+С --retire прежние ключи удаляются; копии истории, зашифрованные ими,
+после этого не прочитать. История открывается только при остановленном
+ассистенте.
+`
+
+// runSecrets выполняет kot secrets и возвращает код завершения
+func runSecrets(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, secretsUsage)
+		return 2
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stdout, secretsUsage)
+		return 0
+	}
+
+	need := map[string]int{"set": 1, "get": 1, "delete": 1, "list": 0}
+	count, ok := need[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "Неизвестная команда: %s\n\n%s", args[0], secretsUsage)
+		return 2
+	}
+	if len(args)-1 != count {
+		fmt.Fprint(stderr, secretsUsage)
+		return 2
+	}
+
+	err := func() error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		vault, err := openVault(cfg.SecurityConfig)
+		if err != nil {
+			return err
+		}
+
+		switch args[0] {
+		case "set":
+			value, err := readSecret(stdin)
+			if err != nil {
+				return err
+			}
+			if err := vault.Secrets.Set(args[1], value); err != nil {
+				return err
+			}
+			fmt.Fprintf(stderr, "Секрет %s сохранен, ссылка в настройках: %s%s\n", args[1], secrets.ReferencePrefix, args[1])
+		case "get":
+			value, err := vault.Secrets.Get(args[1])
+			if err == secrets.ErrNotFound {
+				return fmt.Errorf("секрет %s не найден", args[1])
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(stdout, value)
+		case "list":
+			for _, name := range vault.Secrets.Names() {
+				fmt.Fprintln(stdout, name)
+			}
+		case "delete":
+			return vault.Secrets.Delete(args[1])
+		}
+		return nil
+	}()
+	if err != nil {
+		fmt.Fprintf(stderr, "Ошибка: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// readSecret читает значение секрета: первую строку ввода без перевода строки
+func readSecret(stdin io.Reader) (string, error) {
+	value, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	value = strings.TrimRight(value, "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("пустое значение: передайте секрет в стандартный ввод")
+	}
+	return value, nil
+}
+
+// runKeys выполняет kot keys и возвращает код завершения
+func runKeys(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, keysUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "list":
+		err = listKeys(stdout)
+	case "rotate":
+		err = rotateKeys(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, keysUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "Неизвестная команда: %s\n\n%s", args[0], keysUsage)
+		return 2
+	}
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Ошибка: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// listKeys выполняет kot keys list
+func listKeys(stdout io.Writer) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	vault, err := openVault(cfg.SecurityConfig)
+	if err != nil {
+		return err
+	}
+	for _, key := range vault.Keys.Keys() {
+		current := ""
+		if key.Current {
+			current = " (текущий)"
+		}
+		fmt.Fprintf(stdout, "%d\t%s%s\n", key.ID, key.Created.Local().Format("2006-01-02 15:04:05"), current)
+	}
+	return nil
+}
+
+// rotateKeys выполняет kot keys rotate
+func rotateKeys(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("kot keys rotate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	retire := flags.Bool("retire", false, "Удалить прежние ключи после перешифровки")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	vault, err := openVault(cfg.SecurityConfig)
+	if err != nil {
+		return err
+	}
+
+	// История открывается до смены ключа: если она занята запущенным
+	// ассистентом, ключ не меняется
+	var store *history.Store
+	if cfg.SecurityConfig.EncryptHistory && cfg.AssistantConfig.HistoryFilePath != "" {
+		if store, err = history.Open(cfg.AssistantConfig.HistoryFilePath, history.Options{Cipher: vault.Keys}); err != nil {
+			return fmt.Errorf("не удалось открыть историю %s (возможно, ассистент запущен): %v", cfg.AssistantConfig.HistoryFilePath, err)
+		}
+		defer store.Close()
+	}
+
+	id, err := vault.Keys.Rotate()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Новый ключ: %d\n", id)
+
+	count, err := vault.Secrets.Rekey()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Перешифровано секретов: %d\n", count)
+	if store != nil {
+		if count, err = store.Rekey(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Перешифровано записей истории: %d\n", count)
+	}
+
+	if *retire {
+		if err := vault.Keys.Retire(); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "Прежние ключи удалены")
+	}
+	return nil
+}
+
+// openVault открывает ключи и секреты из настроек
+func openVault(security config.SecurityConfig) (*secrets.Vault, error) {
+	return secrets.Open(security.KeysPath, security.SecretsPath, security.KeySource)
+}
+
+// secretResolver подставляет в настройки секреты для config.Manager.
+// Хранилище открывается при первой ссылке на секрет или если история
+// шифруется; если ни то ни другое не нужно, vault остается nil.
+type secretResolver struct {
+	vault *secrets.Vault
+}
+
+// Resolve заменяет ссылки "secret:имя" значениями из хранилища
+func (r *secretResolver) Resolve(cfg *config.Config) (*config.Config, error) {
+	if r.vault == nil {
+		if len(cfg.SecretRefs()) == 0 && !cfg.SecurityConfig.EncryptHistory {
+			return cfg, nil
+		}
+		vault, err := openVault(cfg.SecurityConfig)
+		if err != nil {
+			return nil, err
+		}
+		r.vault = vault
+	}
+	return cfg.ResolveSecrets(r.vault.Secrets.Get)
+}
+
+// historyOptions возвращает параметры открытия истории из настроек
+func historyOptions(cfg *config.Config) (history.Options, error) {
+	if !cfg.SecurityConfig.EncryptHistory {
+		return history.Options{}, nil
+	}
+	vault, err := openVault(cfg.SecurityConfig)
+	if err != nil {
+		return history.Options{}, err
+	}
+	return history.Options{Cipher: vault.Keys}, nil
+}